@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"math/big"
 	"os"
+	"strconv"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -28,6 +31,50 @@ var (
 		Run:   wrap(hostdbcmd),
 	}
 
+	hostdbFilterCmd = &cobra.Command{
+		Use:   "filter [none|blacklist|whitelist] [pubkeys...]",
+		Short: "View or set the filter mode of the hostdb.",
+		Long: `View or set the filter mode of the hostdb.
+Without arguments, the current filter mode and the hosts of the filter are
+displayed. In blacklist mode, no contracts are formed with the provided hosts.
+In whitelist mode, contracts are only formed with the provided hosts. Existing
+contracts with hosts that are excluded by the filter are not renewed, e.g.:
+	siac hostdb filter whitelist ed25519:6a0c... ed25519:1f3d...
+	siac hostdb filter none`,
+		Run: hostdbfiltercmd,
+	}
+
+	hostdbScoringCmd = &cobra.Command{
+		Use:   "scoring [setting] [value]",
+		Short: "View or modify the scoring profile of the hostdb.",
+		Long: `View or modify the scoring profile of the hostdb.
+Without arguments, the current scoring profile is displayed. Each adjustment
+of a host's score is raised to the power of its weight. A weight of 1 is the
+default, a weight of 2 doubles the influence of an adjustment and a weight of
+0 disables it. No contracts are formed or renewed with hosts that don't meet
+the cutoffs.
+
+Available settings:
+     ageweight:              float
+     collateralweight:       float
+     interactionweight:      float
+     performanceweight:      float
+     priceweight:            float
+     storageproofweight:     float
+     storageremainingweight: float
+     uptimeweight:           float
+     versionweight:          float
+     maxstorageprice:        currency/TB/month, 0 disables the cutoff
+     minuptime:              percentage, 0 disables the cutoff
+
+Currency units can be specified, e.g. 10SC; run 'siac help wallet' for details.
+
+For example:
+	siac hostdb scoring uptimeweight 3
+	siac hostdb scoring minuptime 95`,
+		Run: hostdbscoringcmd,
+	}
+
 	hostdbViewCmd = &cobra.Command{
 		Use:   "view [pubkey]",
 		Short: "View the full information for a host.",
@@ -44,10 +91,15 @@ func printScoreBreakdown(info *api.HostdbHostsGET) {
 	fmt.Fprintf(w, "\t\tBurn:\t %.3f\n", info.ScoreBreakdown.BurnAdjustment)
 	fmt.Fprintf(w, "\t\tCollateral:\t %.3f\n", info.ScoreBreakdown.CollateralAdjustment)
 	fmt.Fprintf(w, "\t\tInteraction:\t %.3f\n", info.ScoreBreakdown.InteractionAdjustment)
+	fmt.Fprintf(w, "\t\tPerformance:\t %.3f\n", info.ScoreBreakdown.PerformanceAdjustment)
 	fmt.Fprintf(w, "\t\tPrice:\t %.3f\n", info.ScoreBreakdown.PriceAdjustment*1e6)
 	fmt.Fprintf(w, "\t\tStorage:\t %.3f\n", info.ScoreBreakdown.StorageRemainingAdjustment)
+	fmt.Fprintf(w, "\t\tStorage Proofs:\t %.3f\n", info.ScoreBreakdown.StorageProofAdjustment)
 	fmt.Fprintf(w, "\t\tUptime:\t %.3f\n", info.ScoreBreakdown.UptimeAdjustment)
 	fmt.Fprintf(w, "\t\tVersion:\t %.3f\n", info.ScoreBreakdown.VersionAdjustment)
+	if info.ScoreBreakdown.CutoffReason != "" {
+		fmt.Fprintf(w, "\t\tCutoff:\t %v\n", info.ScoreBreakdown.CutoffReason)
+	}
 	w.Flush()
 }
 
@@ -273,6 +325,43 @@ func hostdbcmd() {
 	}
 }
 
+// hostdbfiltercmd displays the filter mode of the hostdb if no arguments are
+// provided and sets it otherwise.
+func hostdbfiltercmd(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		hdfmg, err := httpClient.HostDbFilterModeGet()
+		if err != nil {
+			die("Could not get the filter mode:", err)
+		}
+		fmt.Println("Filter Mode:", hdfmg.FilterMode)
+		if len(hdfmg.Hosts) > 0 {
+			fmt.Println("Hosts:")
+			for _, host := range hdfmg.Hosts {
+				fmt.Println("  " + host)
+			}
+		}
+		return
+	}
+
+	var fm modules.FilterMode
+	if err := fm.FromString(args[0]); err != nil {
+		die(err)
+	}
+	var hosts []types.SiaPublicKey
+	for _, str := range args[1:] {
+		var pk types.SiaPublicKey
+		pk.LoadString(str)
+		if len(pk.Key) == 0 {
+			die("Could not parse host public key:", str)
+		}
+		hosts = append(hosts, pk)
+	}
+	if err := httpClient.HostDbFilterModePost(fm, hosts); err != nil {
+		die("Could not set the filter mode:", err)
+	}
+	fmt.Println("Filter mode set to", fm)
+}
+
 func hostdbviewcmd(pubkey string) {
 	var publicKey types.SiaPublicKey
 	publicKey.LoadString(pubkey)
@@ -325,6 +414,93 @@ func hostdbviewcmd(pubkey string) {
 	// 98% uptime and 100% uptime is valued the same.
 	fmt.Println("\n  Scan History Length:", len(info.Entry.ScanHistory))
 	fmt.Printf("  Overall Uptime:      %.3f\n", uptimeRatio)
+	fmt.Printf("  Storage Proofs:      %v submitted, %v missed\n", info.Entry.SuccessfulStorageProofs, info.Entry.FailedStorageProofs)
+
+	// Display the measured performance of the host.
+	latency, uploadThroughput, downloadThroughput := "not measured", "not measured", "not measured"
+	if info.Entry.Latency > 0 {
+		latency = info.Entry.Latency.Round(time.Millisecond).String()
+	}
+	if info.Entry.UploadThroughput > 0 {
+		uploadThroughput = filesizeUnits(int64(info.Entry.UploadThroughput)) + "/s"
+	}
+	if info.Entry.DownloadThroughput > 0 {
+		downloadThroughput = filesizeUnits(int64(info.Entry.DownloadThroughput)) + "/s"
+	}
+	fmt.Println("\n  Performance:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\t\tLatency:\t", latency)
+	fmt.Fprintln(w, "\t\tUpload Throughput:\t", uploadThroughput)
+	fmt.Fprintln(w, "\t\tDownload Throughput:\t", downloadThroughput)
+	w.Flush()
 
 	fmt.Println()
 }
+
+// hostdbscoringcmd displays the scoring profile of the hostdb if no arguments
+// are provided, and changes a setting of the profile otherwise.
+func hostdbscoringcmd(cmd *cobra.Command, args []string) {
+	switch len(args) {
+	case 0:
+		hdsg, err := httpClient.HostDbScoringGet()
+		if err != nil {
+			die("Could not get the scoring profile:", err)
+		}
+		sp := hdsg.ScoringProfile
+		maxStoragePrice := "none"
+		if !sp.MaxStoragePrice.IsZero() {
+			maxStoragePrice = currencyUnits(sp.MaxStoragePrice.Mul(modules.BlockBytesPerMonthTerabyte)) + " / TB / Month"
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Weights:")
+		fmt.Fprintf(w, "  Age:\t%v\n", sp.AgeWeight)
+		fmt.Fprintf(w, "  Collateral:\t%v\n", sp.CollateralWeight)
+		fmt.Fprintf(w, "  Interaction:\t%v\n", sp.InteractionWeight)
+		fmt.Fprintf(w, "  Performance:\t%v\n", sp.PerformanceWeight)
+		fmt.Fprintf(w, "  Price:\t%v\n", sp.PriceWeight)
+		fmt.Fprintf(w, "  Storage Proofs:\t%v\n", sp.StorageProofWeight)
+		fmt.Fprintf(w, "  Storage Remaining:\t%v\n", sp.StorageRemainingWeight)
+		fmt.Fprintf(w, "  Uptime:\t%v\n", sp.UptimeWeight)
+		fmt.Fprintf(w, "  Version:\t%v\n", sp.VersionWeight)
+		fmt.Fprintln(w, "Cutoffs:")
+		fmt.Fprintf(w, "  Max Storage Price:\t%v\n", maxStoragePrice)
+		fmt.Fprintf(w, "  Min Uptime:\t%.2f%%\n", sp.MinUptime*100)
+		w.Flush()
+		return
+	case 2:
+	default:
+		cmd.UsageFunc()(cmd)
+		os.Exit(exitCodeUsage)
+	}
+
+	param, value := args[0], args[1]
+	switch param {
+	case "ageweight", "collateralweight", "interactionweight", "performanceweight",
+		"priceweight", "storageproofweight", "storageremainingweight", "uptimeweight",
+		"versionweight":
+
+	// currency/TB/month (convert to hastings/byte/block)
+	case "maxstorageprice":
+		hastings, err := parseCurrency(value)
+		if err != nil {
+			die("Could not parse "+param+":", err)
+		}
+		i, _ := new(big.Int).SetString(hastings, 10)
+		value = types.NewCurrency(i).Div(modules.BlockBytesPerMonthTerabyte).String()
+
+	// percentage (convert to ratio)
+	case "minuptime":
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			die("Could not parse "+param+":", err)
+		}
+		value = strconv.FormatFloat(percent/100, 'g', -1, 64)
+
+	default:
+		die("\"" + param + "\" is not a scoring setting")
+	}
+	if err := httpClient.HostDbScoringSettingPost(param, value); err != nil {
+		die("Could not update the scoring profile:", err)
+	}
+	fmt.Println("Scoring profile updated.")
+}
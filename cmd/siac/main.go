@@ -13,14 +13,28 @@ import (
 
 var (
 	// Flags.
-	hostContractOutputType string // output type for host contracts
-	hostVerbose            bool   // display additional host info
-	initForce              bool   // destroy and re-encrypt the wallet on init if it already exists
-	initPassword           bool   // supply a custom password when creating a wallet
-	renterAllContracts     bool   // Show all active and expired contracts
-	renterDownloadAsync    bool   // Downloads files asynchronously
-	renterListVerbose      bool   // Show additional info about uploaded files.
-	renterShowHistory      bool   // Show download history in addition to download queue.
+	hostContractOutputType   string  // output type for host contracts
+	hostVerbose              bool    // display additional host info
+	initForce                bool    // destroy and re-encrypt the wallet on init if it already exists
+	initPassword             bool    // supply a custom password when creating a wallet
+	renterAllContracts       bool    // Show all active and expired contracts
+	renterContractEndHeight  uint64  // End height of a manually formed contract
+	renterContractFunds      string  // Funds of a manually formed or renewed contract
+	renterDedupFiles         bool    // Deduplicate identical chunks of uploaded files
+	renterDownloadAsync      bool    // Downloads files asynchronously
+	renterErasureCode        string  // Erasure code type of a file
+	renterExpectedDownload   string  // Expected download per period of the allowance
+	renterExpectedRedundancy float64 // Expected redundancy of the allowance
+	renterExpectedStorage    string  // Expected storage of the allowance
+	renterExpectedUpload     string  // Expected upload per period of the allowance
+	renterListVerbose        bool    // Show additional info about uploaded files.
+	renterMaxContractPrice   string  // Maximum contract price of the allowance
+	renterMaxDownloadPrice   string  // Maximum download price per TB of the allowance
+	renterMaxStoragePrice    string  // Maximum storage price per TB per month of the allowance
+	renterMaxUploadPrice     string  // Maximum upload price per TB of the allowance
+	renterMinCollateralRatio float64 // Minimum collateral ratio of the allowance
+	renterPackFiles          bool    // Pack small files into shared chunks
+	renterShowHistory        bool    // Show download history in addition to download queue.
 )
 
 var (
@@ -97,7 +111,7 @@ func main() {
 	hostContractCmd.Flags().StringVarP(&hostContractOutputType, "type", "t", "value", "Select output type")
 
 	root.AddCommand(hostdbCmd)
-	hostdbCmd.AddCommand(hostdbViewCmd)
+	hostdbCmd.AddCommand(hostdbViewCmd, hostdbFilterCmd, hostdbScoringCmd)
 	hostdbCmd.Flags().IntVarP(&hostdbNumHosts, "numhosts", "n", 0, "Number of hosts to display from the hostdb")
 	hostdbCmd.Flags().BoolVarP(&hostdbVerbose, "verbose", "v", false, "Display full hostdb information")
 
@@ -120,15 +134,34 @@ func main() {
 		renterDownloadsCmd, renterAllowanceCmd, renterSetAllowanceCmd,
 		renterContractsCmd, renterFilesListCmd, renterFilesRenameCmd,
 		renterFilesUploadCmd, renterUploadsCmd, renterExportCmd,
-		renterPricesCmd)
+		renterPricesCmd, renterFileInfoCmd, renterSetRedundancyCmd)
 
-	renterContractsCmd.AddCommand(renterContractsViewCmd)
+	renterContractsCmd.AddCommand(renterContractsViewCmd, renterContractsFormCmd,
+		renterContractsRenewCmd, renterContractsCancelCmd, renterContractsRecoverCmd)
+	renterContractsRecoverCmd.AddCommand(renterContractsRecoverStatusCmd)
 	renterAllowanceCmd.AddCommand(renterAllowanceCancelCmd)
+	renterFilesDownloadCmd.AddCommand(renterDownloadCancelCmd, renterDownloadPauseCmd,
+		renterDownloadResumeCmd, renterDownloadPriorityCmd)
 
 	renterCmd.Flags().BoolVarP(&renterListVerbose, "verbose", "v", false, "Show additional file info such as redundancy")
 	renterContractsCmd.Flags().BoolVarP(&renterAllContracts, "all", "A", false, "Show all expired contracts in addition to active contracts")
+	renterContractsFormCmd.Flags().StringVar(&renterContractFunds, "funds", "", "Funds of the contract, e.g. 100SC (default: based on the allowance)")
+	renterContractsFormCmd.Flags().Uint64Var(&renterContractEndHeight, "endheight", 0, "End height of the contract (default: end of the current period)")
+	renterContractsRenewCmd.Flags().StringVar(&renterContractFunds, "funds", "", "Funds of the renewed contract, e.g. 100SC (default: estimated from usage)")
 	renterDownloadsCmd.Flags().BoolVarP(&renterShowHistory, "history", "H", false, "Show download history in addition to the download queue")
+	renterSetAllowanceCmd.Flags().StringVar(&renterExpectedStorage, "expectedstorage", "", "Amount of data you expect to store, e.g. 500GB")
+	renterSetAllowanceCmd.Flags().StringVar(&renterExpectedUpload, "expectedupload", "", "Amount of data you expect to upload per period, e.g. 100GB")
+	renterSetAllowanceCmd.Flags().StringVar(&renterExpectedDownload, "expecteddownload", "", "Amount of data you expect to download per period, e.g. 100GB")
+	renterSetAllowanceCmd.Flags().Float64Var(&renterExpectedRedundancy, "expectedredundancy", 0, "Average redundancy of your files (default: 3)")
+	renterSetAllowanceCmd.Flags().StringVar(&renterMaxStoragePrice, "maxstorageprice", "", "Maximum storage price per TB per month, e.g. 500SC")
+	renterSetAllowanceCmd.Flags().StringVar(&renterMaxUploadPrice, "maxuploadprice", "", "Maximum upload price per TB, e.g. 100SC")
+	renterSetAllowanceCmd.Flags().StringVar(&renterMaxDownloadPrice, "maxdownloadprice", "", "Maximum download price per TB, e.g. 100SC")
+	renterSetAllowanceCmd.Flags().StringVar(&renterMaxContractPrice, "maxcontractprice", "", "Maximum contract price, e.g. 5SC")
+	renterSetAllowanceCmd.Flags().Float64Var(&renterMinCollateralRatio, "mincollateralratio", 0, "Minimum ratio of a host's collateral to its storage price")
 	renterFilesDownloadCmd.Flags().BoolVarP(&renterDownloadAsync, "async", "A", false, "Download file asynchronously")
+	renterFilesUploadCmd.Flags().BoolVar(&renterPackFiles, "pack", false, "Pack small files together with other small files into shared chunks")
+	renterFilesUploadCmd.Flags().BoolVar(&renterDedupFiles, "dedup", false, "Reuse the stored pieces of identical chunks of other deduplicated files")
+	renterSetRedundancyCmd.Flags().StringVar(&renterErasureCode, "erasurecode", "", "Erasure code type, e.g. Reed-Solomon-Systematic (default: Reed-Solomon)")
 	renterFilesListCmd.Flags().BoolVarP(&renterListVerbose, "verbose", "v", false, "Show additional file info such as redundancy")
 	renterExportCmd.AddCommand(renterExportContractTxnsCmd)
 
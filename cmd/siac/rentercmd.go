@@ -5,6 +5,7 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
@@ -57,6 +58,46 @@ var (
 		Run:   wrap(rentercontractsviewcmd),
 	}
 
+	renterContractsFormCmd = &cobra.Command{
+		Use:   "form [hostkey]",
+		Short: "Form a contract with a specific host",
+		Long: `Form a contract with the host with the specified public key. The contract
+is not dropped by the contract maintenance because of the score of the host.`,
+		Run: wrap(rentercontractsformcmd),
+	}
+
+	renterContractsRenewCmd = &cobra.Command{
+		Use:   "renew [contract-id]",
+		Short: "Renew a contract right away",
+		Long:  "Renew the specified contract without waiting for the renew window.",
+		Run:   wrap(rentercontractsrenewcmd),
+	}
+
+	renterContractsCancelCmd = &cobra.Command{
+		Use:   "cancel [contract-id]",
+		Short: "Cancel a contract",
+		Long: `Cancel the specified contract. The contract is no longer used or renewed,
+and its host is not used for new contracts unless a contract is formed with it
+manually. The remaining funds are returned once the contract expires.`,
+		Run: wrap(rentercontractscancelcmd),
+	}
+
+	renterContractsRecoverCmd = &cobra.Command{
+		Use:   "recover",
+		Short: "Recover contracts using the wallet seed",
+		Long: `Scan the blockchain for contracts that were formed with keys derived from the
+wallet seed. Once the scan is complete, the contracts that haven't expired yet
+are recovered from their hosts. The wallet must be unlocked.`,
+		Run: wrap(rentercontractsrecovercmd),
+	}
+
+	renterContractsRecoverStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "View the status of the recovery scan",
+		Long:  "View whether a recovery scan is in progress and the block height it has reached.",
+		Run:   wrap(rentercontractsrecoverstatuscmd),
+	}
+
 	renterDownloadsCmd = &cobra.Command{
 		Use:   "downloads",
 		Short: "View the download queue",
@@ -64,6 +105,34 @@ var (
 		Run:   wrap(renterdownloadscmd),
 	}
 
+	renterDownloadCancelCmd = &cobra.Command{
+		Use:   "cancel [id]",
+		Short: "Cancel a download",
+		Long:  "Cancel the download with the given id. The partially downloaded file is not removed.",
+		Run:   wrap(renterdownloadcancelcmd),
+	}
+
+	renterDownloadPauseCmd = &cobra.Command{
+		Use:   "pause [id]",
+		Short: "Pause a download",
+		Long:  "Pause the download with the given id. Chunks that are already being downloaded will still complete.",
+		Run:   wrap(renterdownloadpausecmd),
+	}
+
+	renterDownloadResumeCmd = &cobra.Command{
+		Use:   "resume [id]",
+		Short: "Resume a paused download",
+		Long:  "Resume the paused download with the given id.",
+		Run:   wrap(renterdownloadresumecmd),
+	}
+
+	renterDownloadPriorityCmd = &cobra.Command{
+		Use:   "priority [id] [priority]",
+		Short: "Change the priority of a download",
+		Long:  "Change the priority of the download with the given id. Downloads with a higher priority are processed first.",
+		Run:   wrap(renterdownloadprioritycmd),
+	}
+
 	renterFilesDeleteCmd = &cobra.Command{
 		Use:     "delete [path]",
 		Aliases: []string{"rm"},
@@ -79,12 +148,25 @@ var (
 		Run:   wrap(renterfilesdownloadcmd),
 	}
 
+	renterFileInfoCmd = &cobra.Command{
+		Use:   "file [path]",
+		Short: "Show the health of a file",
+		Long: `Show the health of a file and each of its chunks. A health of 0 means
+full redundancy, a health of 1 means that only the minimum number of pieces
+required to recover the file is left. Chunks whose repair keeps failing are
+marked as stuck.`,
+		Run: wrap(renterfileinfocmd),
+	}
+
 	renterFilesListCmd = &cobra.Command{
-		Use:     "list",
+		Use:     "list [path]",
 		Aliases: []string{"ls"},
 		Short:   "List the status of all files",
-		Long:    "List the status of all files known to the renter on the Sia network.",
-		Run:     wrap(renterfileslistcmd),
+		Long: `List the status of all files known to the renter on the Sia network.
+
+If a path is provided, only the files and directories located directly within
+that directory are listed. Use "/" to list the root directory.`,
+		Run: renterfileslistcmd,
 	}
 
 	renterFilesRenameCmd = &cobra.Command{
@@ -98,8 +180,17 @@ var (
 	renterFilesUploadCmd = &cobra.Command{
 		Use:   "upload [source] [path]",
 		Short: "Upload a file",
-		Long:  "Upload a file to [path] on the Sia network.",
-		Run:   wrap(renterfilesuploadcmd),
+		Long: `Upload a file to [path] on the Sia network.
+
+Files that are smaller than a chunk can be uploaded with --pack, which packs
+them together with other small files into shared chunks. This reduces the cost
+of storing many small files.
+
+Files that are uploaded with --dedup share the pieces of identical chunks with
+other files that were uploaded with --dedup, so data that is uploaded again,
+like the unchanged parts of a backup, isn't stored twice. The pieces of such
+files are encrypted with keys derived from their content.`,
+		Run: wrap(renterfilesuploadcmd),
 	}
 
 	renterPricesCmd = &cobra.Command{
@@ -109,6 +200,17 @@ var (
 		Run:   wrap(renterpricescmd),
 	}
 
+	renterSetRedundancyCmd = &cobra.Command{
+		Use:   "setredundancy [path] [datapieces] [paritypieces]",
+		Short: "Change the redundancy of a file",
+		Long: `Change the erasure coding parameters of an uploaded file.
+
+The file is re-encoded in the background. It keeps its current redundancy until
+all of its chunks have been uploaded with the new parameters. Afterwards, the
+pieces of the old layout are removed from the hosts.`,
+		Run: wrap(rentersetredundancycmd),
+	}
+
 	renterSetAllowanceCmd = &cobra.Command{
 		Use:   "setallowance [amount] [period] [hosts] [renew window]",
 		Short: "Set the allowance",
@@ -128,6 +230,16 @@ Allowance can be automatically renewed periodically. If the current
 blockheight + the renew window >= the end height the contract,
 then the contract is renewed automatically.
 
+The expected usage flags describe how you are going to use the allowance. They
+are used to split the funds between storage and bandwidth, and to prefer hosts
+whose prices suit that usage. Sizes are given with a unit (B, KB, MB, GB,
+etc.). Usage that isn't specified keeps its current value.
+
+The maximum price flags protect you from hosts that raise their prices. Hosts
+whose prices exceed them are not used for new contracts, and their contracts are
+not renewed. The storage price is given per TB per month, the upload and
+download prices per TB. A maximum price of 0 removes the limit.
+
 Note that setting the allowance will cause siad to immediately begin forming
 contracts! You should only set the allowance once you are fully synced and you
 have a reasonable number (>30) of hosts in your hostdb.`,
@@ -208,7 +320,7 @@ func rentercmd() {
 	}
 
 	// also list files
-	renterfileslistcmd()
+	renterfileslist()
 }
 
 // renteruploadscmd is the handler for the command `siac renter uploads`.
@@ -261,7 +373,11 @@ func renterdownloadscmd() {
 	} else {
 		fmt.Println("Downloading", len(downloading), "files:")
 		for _, file := range downloading {
-			fmt.Printf("%s: %5.1f%% %s -> %s\n", file.StartTime.Format("Jan 02 03:04 PM"), 100*float64(file.Received)/float64(file.Filesize), file.SiaPath, file.Destination)
+			status := ""
+			if file.Paused {
+				status = " (paused)"
+			}
+			fmt.Printf("%s: %s %5.1f%% %s -> %s%s\n", file.ID, file.StartTime.Format("Jan 02 03:04 PM"), 100*float64(file.Received)/float64(file.Filesize), file.SiaPath, file.Destination, status)
 		}
 	}
 	if !renterShowHistory {
@@ -280,11 +396,51 @@ func renterdownloadscmd() {
 	} else {
 		fmt.Println("Downloaded", len(downloaded), "files:")
 		for _, file := range downloaded {
-			fmt.Printf("%s: %s -> %s\n", file.StartTime.Format("Jan 02 03:04 PM"), file.SiaPath, file.Destination)
+			fmt.Printf("%s: %s %s -> %s\n", file.ID, file.StartTime.Format("Jan 02 03:04 PM"), file.SiaPath, file.Destination)
 		}
 	}
 }
 
+// renterdownloadcancelcmd cancels a download.
+func renterdownloadcancelcmd(id string) {
+	err := httpClient.RenterDownloadCancelPost(modules.DownloadID(id))
+	if err != nil {
+		die("Could not cancel download:", err)
+	}
+	fmt.Println("Download cancelled.")
+}
+
+// renterdownloadpausecmd pauses a download.
+func renterdownloadpausecmd(id string) {
+	err := httpClient.RenterDownloadPausePost(modules.DownloadID(id))
+	if err != nil {
+		die("Could not pause download:", err)
+	}
+	fmt.Println("Download paused.")
+}
+
+// renterdownloadresumecmd resumes a paused download.
+func renterdownloadresumecmd(id string) {
+	err := httpClient.RenterDownloadResumePost(modules.DownloadID(id))
+	if err != nil {
+		die("Could not resume download:", err)
+	}
+	fmt.Println("Download resumed.")
+}
+
+// renterdownloadprioritycmd changes the priority of a download.
+func renterdownloadprioritycmd(id, priorityStr string) {
+	priority, err := strconv.ParseUint(priorityStr, 10, 64)
+	if err != nil {
+		die("Could not parse priority:", err)
+	}
+	err = httpClient.RenterDownloadPriorityPost(modules.DownloadID(id), priority)
+	if err != nil {
+		die("Could not change download priority:", err)
+	}
+	fmt.Println("Download priority changed.")
+}
+
 // renterallowancecmd displays the current allowance.
 func renterallowancecmd() {
 	rg, err := httpClient.RenterGet()
@@ -298,6 +454,30 @@ func renterallowancecmd() {
 	Amount: %v
 	Period: %v blocks
 `, currencyUnits(allowance.Funds), allowance.Period)
+	if !allowance.MaxStoragePrice.IsZero() {
+		fmt.Printf("\tMax Storage Price:  %v / TB / Month\n", currencyUnits(allowance.MaxStoragePrice.Mul(modules.BlockBytesPerMonthTerabyte)))
+	}
+	if !allowance.MaxUploadBandwidthPrice.IsZero() {
+		fmt.Printf("\tMax Upload Price:   %v / TB\n", currencyUnits(allowance.MaxUploadBandwidthPrice.Mul(modules.BytesPerTerabyte)))
+	}
+	if !allowance.MaxDownloadBandwidthPrice.IsZero() {
+		fmt.Printf("\tMax Download Price: %v / TB\n", currencyUnits(allowance.MaxDownloadBandwidthPrice.Mul(modules.BytesPerTerabyte)))
+	}
+	if !allowance.MaxContractPrice.IsZero() {
+		fmt.Printf("\tMax Contract Price: %v\n", currencyUnits(allowance.MaxContractPrice))
+	}
+	if allowance.MinCollateralRatio != 0 {
+		fmt.Printf("\tMin Collateral Ratio: %v\n", allowance.MinCollateralRatio)
+	}
+	if allowance.ExpectedStorage != 0 {
+		fmt.Printf(`Expected Usage:
+	Storage:    %v
+	Upload:     %v per period
+	Download:   %v per period
+	Redundancy: %v
+`, filesizeUnits(int64(allowance.ExpectedStorage)), filesizeUnits(int64(allowance.ExpectedUpload)),
+			filesizeUnits(int64(allowance.ExpectedDownload)), allowance.ExpectedRedundancy)
+	}
 }
 
 // renterallowancecancelcmd cancels the current allowance.
@@ -369,6 +549,77 @@ func rentersetallowancecmd(cmd *cobra.Command, args []string) {
 			die("Could not parse renew window:", err)
 		}
 	}
+
+	// Keep the current expected usage and maximum prices unless they were
+	// specified.
+	rg, err := httpClient.RenterGet()
+	if err != nil {
+		die("Could not get allowance:", err)
+	}
+	allowance.ExpectedStorage = rg.Settings.Allowance.ExpectedStorage
+	allowance.ExpectedUpload = rg.Settings.Allowance.ExpectedUpload
+	allowance.ExpectedDownload = rg.Settings.Allowance.ExpectedDownload
+	allowance.ExpectedRedundancy = rg.Settings.Allowance.ExpectedRedundancy
+	allowance.MaxStoragePrice = rg.Settings.Allowance.MaxStoragePrice
+	allowance.MaxUploadBandwidthPrice = rg.Settings.Allowance.MaxUploadBandwidthPrice
+	allowance.MaxDownloadBandwidthPrice = rg.Settings.Allowance.MaxDownloadBandwidthPrice
+	allowance.MaxContractPrice = rg.Settings.Allowance.MaxContractPrice
+	allowance.MinCollateralRatio = rg.Settings.Allowance.MinCollateralRatio
+	expectedSizes := []struct {
+		flag  string
+		size  string
+		value *uint64
+	}{
+		{"expectedstorage", renterExpectedStorage, &allowance.ExpectedStorage},
+		{"expectedupload", renterExpectedUpload, &allowance.ExpectedUpload},
+		{"expecteddownload", renterExpectedDownload, &allowance.ExpectedDownload},
+	}
+	for _, es := range expectedSizes {
+		if !cmd.Flags().Changed(es.flag) {
+			continue
+		}
+		numBytes, err := parseFilesize(es.size)
+		if err != nil {
+			die("Could not parse "+es.flag+":", err)
+		}
+		_, err = fmt.Sscan(numBytes, es.value)
+		if err != nil {
+			die("Could not parse "+es.flag+":", err)
+		}
+	}
+	if cmd.Flags().Changed("expectedredundancy") {
+		allowance.ExpectedRedundancy = renterExpectedRedundancy
+	}
+	maxPrices := []struct {
+		flag  string
+		price string
+		unit  types.Currency // the number of bytes or byte-blocks the price is given for
+		value *types.Currency
+	}{
+		{"maxstorageprice", renterMaxStoragePrice, modules.BlockBytesPerMonthTerabyte, &allowance.MaxStoragePrice},
+		{"maxuploadprice", renterMaxUploadPrice, modules.BytesPerTerabyte, &allowance.MaxUploadBandwidthPrice},
+		{"maxdownloadprice", renterMaxDownloadPrice, modules.BytesPerTerabyte, &allowance.MaxDownloadBandwidthPrice},
+		{"maxcontractprice", renterMaxContractPrice, types.NewCurrency64(1), &allowance.MaxContractPrice},
+	}
+	for _, mp := range maxPrices {
+		if !cmd.Flags().Changed(mp.flag) {
+			continue
+		}
+		hastings, err := parseCurrency(mp.price)
+		if err != nil {
+			die("Could not parse "+mp.flag+":", err)
+		}
+		var price types.Currency
+		_, err = fmt.Sscan(hastings, &price)
+		if err != nil {
+			die("Could not parse "+mp.flag+":", err)
+		}
+		*mp.value = price.Div(mp.unit)
+	}
+	if cmd.Flags().Changed("mincollateralratio") {
+		allowance.MinCollateralRatio = renterMinCollateralRatio
+	}
+
 	err = httpClient.RenterPostAllowance(allowance)
 	if err != nil {
 		die("Could not set allowance:", err)
@@ -465,13 +716,13 @@ func rentercontractscmd() {
 
 `, len(rc.InactiveContracts), filesizeUnits(int64(inactiveTotalStored)), currencyUnits(inactiveTotalRemaining), currencyUnits(inactiveTotalSpent), currencyUnits(inactiveTotalFees))
 		w := tabwriter.NewWriter(os.Stdout, 2, 0, 2, ' ', 0)
-		fmt.Fprintln(w, "  Host\tRemaining Funds\tSpent Funds\tSpent Fees\tData\tEnd Height\tID\tGoodForUpload\tGoodForRenew")
+		fmt.Fprintln(w, "  Host\tRemaining Funds\tSpent Funds\tSpent Fees\tData\tEnd Height\tID\tGoodForUpload\tGoodForRenew\tReason")
 		for _, c := range rc.InactiveContracts {
 			address := c.NetAddress
 			if address == "" {
 				address = "Host Removed"
 			}
-			fmt.Fprintf(w, "  %v\t%8s\t%8s\t%8s\t%v\t%v\t%v\t%v\t%v\n",
+			fmt.Fprintf(w, "  %v\t%8s\t%8s\t%8s\t%v\t%v\t%v\t%v\t%v\t%v\n",
 				address,
 				currencyUnits(c.RenterFunds),
 				currencyUnits(c.TotalCost.Sub(c.RenterFunds).Sub(c.Fees)),
@@ -480,7 +731,8 @@ func rentercontractscmd() {
 				c.EndHeight,
 				c.ID,
 				c.GoodForUpload,
-				c.GoodForRenew)
+				c.GoodForRenew,
+				c.UtilityReason)
 		}
 		w.Flush()
 	}
@@ -588,6 +840,90 @@ Contract %v
 	fmt.Println("Contract not found")
 }
 
+// rentercontractsfunds parses the --funds flag of the contract commands. An
+// empty flag results in zero funds, which lets the contractor pick a default.
+func rentercontractsfunds() types.Currency {
+	if renterContractFunds == "" {
+		return types.ZeroCurrency
+	}
+	hastings, err := parseCurrency(renterContractFunds)
+	if err != nil {
+		die("Could not parse funds:", err)
+	}
+	var funds types.Currency
+	if _, err := fmt.Sscan(hastings, &funds); err != nil {
+		die("Could not parse funds:", err)
+	}
+	return funds
+}
+
+// rentercontractsformcmd is the handler for the command `siac renter contracts
+// form [hostkey]`. It forms a contract with the specified host.
+func rentercontractsformcmd(hostKey string) {
+	var pk types.SiaPublicKey
+	pk.LoadString(hostKey)
+	if len(pk.Key) == 0 {
+		die("Could not parse host public key")
+	}
+	rcp, err := httpClient.RenterContractFormPost(pk, rentercontractsfunds(), types.BlockHeight(renterContractEndHeight))
+	if err != nil {
+		die("Could not form contract:", err)
+	}
+	fmt.Printf("Formed contract %v with %v for %v, ending at height %v.\n", rcp.Contract.ID,
+		rcp.Contract.NetAddress, currencyUnits(rcp.Contract.TotalCost), rcp.Contract.EndHeight)
+}
+
+// rentercontractsrenewcmd is the handler for the command `siac renter
+// contracts renew [contract-id]`. It renews the specified contract right away.
+func rentercontractsrenewcmd(cid string) {
+	var id types.FileContractID
+	if err := id.LoadString(cid); err != nil {
+		die("Could not parse contract id:", err)
+	}
+	rcp, err := httpClient.RenterContractRenewPost(id, rentercontractsfunds())
+	if err != nil {
+		die("Could not renew contract:", err)
+	}
+	fmt.Printf("Renewed contract %v as %v for %v, ending at height %v.\n", cid,
+		rcp.Contract.ID, currencyUnits(rcp.Contract.TotalCost), rcp.Contract.EndHeight)
+}
+
+// rentercontractscancelcmd is the handler for the command `siac renter
+// contracts cancel [contract-id]`. It cancels the specified contract.
+func rentercontractscancelcmd(cid string) {
+	var id types.FileContractID
+	if err := id.LoadString(cid); err != nil {
+		die("Could not parse contract id:", err)
+	}
+	if err := httpClient.RenterContractCancelPost(id); err != nil {
+		die("Could not cancel contract:", err)
+	}
+	fmt.Println("Contract canceled.")
+}
+
+// rentercontractsrecovercmd is the handler for the command `siac renter
+// contracts recover`. It starts a scan for recoverable contracts.
+func rentercontractsrecovercmd() {
+	if err := httpClient.RenterInitRecoveryScanPost(); err != nil {
+		die("Could not start recovery scan:", err)
+	}
+	fmt.Println("Recovery scan started. Use 'siac renter contracts recover status' to view its progress.")
+}
+
+// rentercontractsrecoverstatuscmd is the handler for the command `siac renter
+// contracts recover status`.
+func rentercontractsrecoverstatuscmd() {
+	rsg, err := httpClient.RenterRecoveryStatusGet()
+	if err != nil {
+		die("Could not get recovery scan status:", err)
+	}
+	if rsg.ScanInProgress {
+		fmt.Printf("Recovery scan in progress, scanned %v blocks.\n", rsg.ScannedHeight)
+		return
+	}
+	fmt.Println("No recovery scan in progress.")
+}
+
 // renterfilesdeletecmd is the handler for the command `siac renter delete [path]`.
 // Removes the specified path from the Sia network.
 func renterfilesdeletecmd(path string) {
@@ -606,14 +942,14 @@ func renterfilesdownloadcmd(path, destination string) {
 	// Queue the download. An error will be returned if the queueing failed, but
 	// the call will return before the download has completed. The call is made
 	// as an async call.
-	err := httpClient.RenterDownloadFullGet(path, destination, true)
+	id, err := httpClient.RenterDownloadAsyncGet(path, destination, 0, 0)
 	if err != nil {
 		die("Download could not be started:", err)
 	}
 
 	// If the download is async, report success.
 	if renterDownloadAsync {
-		fmt.Printf("Queued Download '%s' to %s.\n", path, abs(destination))
+		fmt.Printf("Queued Download '%s' to %s (id %s).\n", path, abs(destination), id)
 		return
 	}
 
@@ -733,9 +1069,23 @@ func (s bySiaPath) Len() int           { return len(s) }
 func (s bySiaPath) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s bySiaPath) Less(i, j int) bool { return s[i].SiaPath < s[j].SiaPath }
 
-// renterfileslistcmd is the handler for the command `siac renter list`.
-// Lists files known to the renter on the network.
-func renterfileslistcmd() {
+// renterfileslistcmd is the handler for the command `siac renter list [path]`.
+// Lists files known to the renter on the network, or the contents of a single
+// directory if a path is provided.
+func renterfileslistcmd(cmd *cobra.Command, args []string) {
+	switch len(args) {
+	case 0:
+		renterfileslist()
+	case 1:
+		renterdirlist(args[0])
+	default:
+		cmd.UsageFunc()(cmd)
+		os.Exit(exitCodeUsage)
+	}
+}
+
+// renterfileslist lists all files known to the renter on the network.
+func renterfileslist() {
 	var rf api.RenterFiles
 	rf, err := httpClient.RenterFilesGet()
 	if err != nil {
@@ -751,12 +1101,76 @@ func renterfileslistcmd() {
 		totalStored += file.Filesize
 	}
 	fmt.Printf(" %9s\n", filesizeUnits(int64(totalStored)))
+	printFiles(rf.Files)
+}
+
+// renterdirlist lists the files and directories located directly within the
+// directory at path.
+func renterdirlist(path string) {
+	rd, err := httpClient.RenterDirGet(path)
+	if err != nil {
+		die("Could not get directory:", err)
+	}
+	dir := rd.Directories[0]
+	fmt.Printf("Directory '/%s': %v files, %v subdirectories, %s total, health %.2f\n",
+		dir.SiaPath, dir.AggregateNumFiles, dir.NumSubDirs, filesizeUnits(int64(dir.AggregateSize)), dir.Health)
+	if len(rd.Directories) > 1 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		if renterListVerbose {
+			fmt.Fprintln(w, "  Total size\tFiles\tHealth\tSia path")
+		}
+		for _, subDir := range rd.Directories[1:] {
+			fmt.Fprintf(w, "  %9s", filesizeUnits(int64(subDir.AggregateSize)))
+			if renterListVerbose {
+				fmt.Fprintf(w, "\t%v\t%.2f", subDir.AggregateNumFiles, subDir.Health)
+			}
+			fmt.Fprintf(w, "\t%s/\n", subDir.SiaPath)
+		}
+		w.Flush()
+	}
+	printFiles(rd.Files)
+}
+
+// renterfileinfocmd is the handler for the command `siac renter file [path]`.
+// It shows the health and repair status of a file and its chunks.
+func renterfileinfocmd(path string) {
+	rf, err := httpClient.RenterFileGet(path)
+	if err != nil {
+		die("Could not get file info:", err)
+	}
+	file := rf.File
+	fmt.Printf(`File:          %v
+Size:          %v
+Redundancy:    %.2f
+Health:        %.2f
+On Disk:       %v
+Recoverable:   %v
+Stuck Chunks:  %v
+`, file.SiaPath, filesizeUnits(int64(file.Filesize)), file.Redundancy, file.Health,
+		yesNo(file.OnDisk), yesNo(file.Recoverable), file.NumStuckChunks)
+	if file.Health > 1 {
+		fmt.Println("\nWARNING: the file can't be recovered from the network.")
+	} else if file.Health > 0.75 {
+		fmt.Println("\nWARNING: the file is close to dropping below the minimum number of pieces.")
+	}
+
+	fmt.Println()
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	if renterListVerbose {
+	fmt.Fprintln(w, "  Chunk\tHealth\tFailures\tStuck\tLast Error")
+	for _, chunk := range rf.Chunks {
+		fmt.Fprintf(w, "  %v\t%.2f\t%v\t%v\t%v\n", chunk.Index, chunk.Health, chunk.RepairFailures, yesNo(chunk.Stuck), chunk.LastError)
+	}
+	w.Flush()
+}
+
+// printFiles prints the status of the provided files.
+func printFiles(files []modules.FileInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if renterListVerbose && len(files) > 0 {
 		fmt.Fprintln(w, "  File size\tAvailable\tUploaded\tProgress\tRedundancy\tRenewing\tOn Disk\tRecoverable\tSia path")
 	}
-	sort.Sort(bySiaPath(rf.Files))
-	for _, file := range rf.Files {
+	sort.Sort(bySiaPath(files))
+	for _, file := range files {
 		fmt.Fprintf(w, "  %9s", filesizeUnits(int64(file.Filesize)))
 		if renterListVerbose {
 			availableStr := yesNo(file.Available)
@@ -766,9 +1180,8 @@ func renterfileslistcmd() {
 				redundancyStr = "-"
 			}
 			uploadProgressStr := fmt.Sprintf("%.2f%%", file.UploadProgress)
-			_, err := os.Stat(file.LocalPath)
-			onDiskStr := yesNo(!os.IsNotExist(err))
-			recoverableStr := yesNo(!(file.Redundancy < 1))
+			onDiskStr := yesNo(file.OnDisk)
+			recoverableStr := yesNo(file.Recoverable)
 			if file.UploadProgress == -1 {
 				uploadProgressStr = "-"
 			}
@@ -793,11 +1206,38 @@ func renterfilesrenamecmd(path, newpath string) {
 	fmt.Printf("Renamed %s to %s\n", path, newpath)
 }
 
+// rentersetredundancycmd is the handler for the command `siac renter
+// setredundancy [path] [datapieces] [paritypieces]`. Changes the erasure coding
+// parameters of an uploaded file.
+func rentersetredundancycmd(path, dataPiecesStr, parityPiecesStr string) {
+	dataPieces, err := strconv.ParseUint(dataPiecesStr, 10, 64)
+	if err != nil {
+		die("Could not parse data pieces:", err)
+	}
+	parityPieces, err := strconv.ParseUint(parityPiecesStr, 10, 64)
+	if err != nil {
+		die("Could not parse parity pieces:", err)
+	}
+	err = httpClient.RenterFileRedundancyPost(path, renterErasureCode, dataPieces, parityPieces)
+	if err != nil {
+		die("Could not change redundancy:", err)
+	}
+	fmt.Printf("Changing the redundancy of %s to %v-of-%v. The file will be re-encoded in the background.\n", path, dataPieces, dataPieces+parityPieces)
+}
+
 // renterfilesuploadcmd is the handler for the command `siac renter upload
 // [source] [path]`. Uploads the [source] file to [path] on the Sia network.
 // If [source] is a directory, all files inside it will be uploaded and named
 // relative to [path].
 func renterfilesuploadcmd(source, path string) {
+	values := url.Values{}
+	if renterPackFiles && renterDedupFiles {
+		die("Packed files can't be deduplicated.")
+	} else if renterPackFiles {
+		values.Set("pack", "true")
+	} else if renterDedupFiles {
+		values.Set("dedup", "true")
+	}
 	stat, err := os.Stat(source)
 	if err != nil {
 		die("Could not stat file or folder:", err)
@@ -826,7 +1266,7 @@ func renterfilesuploadcmd(source, path string) {
 			fpath, _ := filepath.Rel(source, file)
 			fpath = filepath.Join(path, fpath)
 			fpath = filepath.ToSlash(fpath)
-			err = httpClient.RenterUploadDefaultPost(abs(file), fpath)
+			err = httpClient.RenterUploadValuesPost(abs(file), fpath, values)
 			if err != nil {
 				die("Could not upload file:", err)
 			}
@@ -834,7 +1274,7 @@ func renterfilesuploadcmd(source, path string) {
 		fmt.Printf("Uploaded %d files into '%s'.\n", len(files), path)
 	} else {
 		// single file
-		err = httpClient.RenterUploadDefaultPost(abs(source), path)
+		err = httpClient.RenterUploadValuesPost(abs(source), path, values)
 		if err != nil {
 			die("Could not upload file:", err)
 		}
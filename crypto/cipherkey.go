@@ -0,0 +1,150 @@
+package crypto
+
+// cipherkey.go defines the interface of the keys that are used to encrypt file
+// pieces, which allows the renter to choose the cipher of each file.
+
+import (
+	"errors"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// TypeTwofish is the cipher type of Twofish-GCM.
+	TypeTwofish CipherType = "Twofish-GCM"
+
+	// TypeXChaCha20 is the cipher type of XChaCha20-Poly1305.
+	TypeXChaCha20 CipherType = "XChaCha20-Poly1305"
+
+	// XChaCha20Overhead is the number of bytes added by
+	// XChaCha20Key.EncryptBytes.
+	XChaCha20Overhead = chacha20poly1305.NonceSizeX + chacha20poly1305.Overhead
+)
+
+var (
+	// ErrUnknownCipherType is returned when a key is requested for an
+	// unknown cipher type.
+	ErrUnknownCipherType = errors.New("unknown cipher type")
+)
+
+type (
+	// CipherType identifies the cipher of a CipherKey.
+	CipherType string
+
+	// CipherKey is a key of an authenticated cipher that is used to encrypt
+	// and decrypt data.
+	CipherKey interface {
+		// Type returns the cipher type of the key.
+		Type() CipherType
+
+		// Key returns the raw bytes of the key.
+		Key() []byte
+
+		// Overhead returns the number of bytes that EncryptBytes adds to
+		// the plaintext.
+		Overhead() uint64
+
+		// EncryptBytes encrypts the plaintext and prepends a random nonce
+		// to the ciphertext.
+		EncryptBytes(plaintext []byte) Ciphertext
+
+		// DecryptBytes decrypts a ciphertext created by EncryptBytes.
+		DecryptBytes(ct Ciphertext) ([]byte, error)
+
+		// DecryptBytesInPlace decrypts a ciphertext created by
+		// EncryptBytes, reusing the memory of ct.
+		DecryptBytesInPlace(ct Ciphertext) ([]byte, error)
+	}
+
+	// RangeDecrypter is implemented by CipherKeys whose ciphertexts can be
+	// decrypted in parts. DecryptRange doesn't verify the authentication tag
+	// of the ciphertext, so the ciphertext must be authenticated by other
+	// means, e.g. by a Merkle proof.
+	RangeDecrypter interface {
+		// NonceSize returns the size of the nonce that EncryptBytes
+		// prepends to the ciphertext.
+		NonceSize() uint64
+
+		// DecryptRange decrypts ct in place, where ct is the part of a
+		// ciphertext created by EncryptBytes that starts offset bytes
+		// after the nonce.
+		DecryptRange(nonce []byte, ct Ciphertext, offset uint64) ([]byte, error)
+	}
+
+	// XChaCha20Key is a key used for encrypting and decrypting data with
+	// XChaCha20-Poly1305.
+	XChaCha20Key [EntropySize]byte
+)
+
+// GenerateCipherKey produces a random key of the given cipher type.
+func GenerateCipherKey(ct CipherType) (CipherKey, error) {
+	return NewCipherKey(ct, fastrand.Bytes(EntropySize))
+}
+
+// NewCipherKey creates a key of the given cipher type from entropy, which must
+// be EntropySize bytes long.
+func NewCipherKey(ct CipherType, entropy []byte) (CipherKey, error) {
+	if len(entropy) != EntropySize {
+		return nil, errors.New("wrong key length")
+	}
+	switch ct {
+	case TypeTwofish:
+		var key TwofishKey
+		copy(key[:], entropy)
+		return key, nil
+	case TypeXChaCha20:
+		var key XChaCha20Key
+		copy(key[:], entropy)
+		return key, nil
+	default:
+		return nil, ErrUnknownCipherType
+	}
+}
+
+// Type implements CipherKey.
+func (key TwofishKey) Type() CipherType { return TypeTwofish }
+
+// Key implements CipherKey.
+func (key TwofishKey) Key() []byte { return key[:] }
+
+// Overhead implements CipherKey.
+func (key TwofishKey) Overhead() uint64 { return TwofishOverhead }
+
+// Type implements CipherKey.
+func (key XChaCha20Key) Type() CipherType { return TypeXChaCha20 }
+
+// Key implements CipherKey.
+func (key XChaCha20Key) Key() []byte { return key[:] }
+
+// Overhead implements CipherKey.
+func (key XChaCha20Key) Overhead() uint64 { return XChaCha20Overhead }
+
+// EncryptBytes encrypts a []byte using the key and prepends the nonce (24
+// bytes) to the ciphertext.
+func (key XChaCha20Key) EncryptBytes(plaintext []byte) Ciphertext {
+	// NOTE: NewX only returns an error if the key has the wrong length.
+	aead, _ := chacha20poly1305.NewX(key[:])
+	return EncryptWithNonce(plaintext, aead)
+}
+
+// DecryptBytes decrypts the ciphertext created by EncryptBytes. The nonce is
+// expected to be the first 24 bytes of the ciphertext.
+func (key XChaCha20Key) DecryptBytes(ct Ciphertext) ([]byte, error) {
+	aead, _ := chacha20poly1305.NewX(key[:])
+	return DecryptWithNonce(ct, aead)
+}
+
+// DecryptBytesInPlace decrypts the ciphertext created by EncryptBytes, reusing
+// the memory of ct. This means that ct can't be reused after calling
+// DecryptBytesInPlace.
+func (key XChaCha20Key) DecryptBytesInPlace(ct Ciphertext) ([]byte, error) {
+	aead, _ := chacha20poly1305.NewX(key[:])
+	if len(ct) < aead.NonceSize() {
+		return nil, ErrInsufficientLen
+	}
+	nonce := ct[:aead.NonceSize()]
+	ciphertext := ct[aead.NonceSize():]
+	return aead.Open(ciphertext[:0], nonce, ciphertext, nil)
+}
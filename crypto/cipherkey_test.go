@@ -0,0 +1,86 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestCipherKeys checks that all cipher types encrypt and decrypt data
+// correctly and add the advertised overhead.
+func TestCipherKeys(t *testing.T) {
+	for _, ct := range []CipherType{TypeTwofish, TypeXChaCha20} {
+		key, err := GenerateCipherKey(ct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key.Type() != ct {
+			t.Fatalf("expected cipher type %v, got %v", ct, key.Type())
+		}
+
+		// Encrypt and decrypt some data.
+		plaintext := fastrand.Bytes(600)
+		ciphertext := key.EncryptBytes(plaintext)
+		if uint64(len(ciphertext)) != uint64(len(plaintext))+key.Overhead() {
+			t.Fatalf("%v: expected overhead of %v, got %v", ct, key.Overhead(), len(ciphertext)-len(plaintext))
+		}
+		decrypted, err := key.DecryptBytes(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("%v: decrypted data does not match plaintext", ct)
+		}
+
+		// Recreating the key from its bytes should produce the same key.
+		key2, err := NewCipherKey(ct, key.Key())
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err = key2.DecryptBytesInPlace(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("%v: decrypted data does not match plaintext", ct)
+		}
+
+		// Corrupted and short ciphertexts should be rejected.
+		ciphertext = key.EncryptBytes(plaintext)
+		ciphertext[len(ciphertext)-1]++
+		if _, err := key.DecryptBytes(ciphertext); err == nil {
+			t.Fatalf("%v: expected corrupted ciphertext to be rejected", ct)
+		}
+		if _, err := key.DecryptBytesInPlace(ciphertext[:10]); err != ErrInsufficientLen {
+			t.Fatalf("%v: expected ErrInsufficientLen, got %v", ct, err)
+		}
+	}
+
+	// Unknown cipher types should be rejected.
+	if _, err := GenerateCipherKey("foo"); err != ErrUnknownCipherType {
+		t.Fatal("expected ErrUnknownCipherType, got", err)
+	}
+}
+
+// TestDecryptRange checks that ranges of ciphertexts can be decrypted by keys
+// that implement RangeDecrypter.
+func TestDecryptRange(t *testing.T) {
+	key := GenerateTwofishKey()
+	var rd RangeDecrypter = key
+	plaintext := fastrand.Bytes(600)
+	ct := key.EncryptBytes(plaintext)
+	nonce := ct[:rd.NonceSize()]
+	for _, r := range [][2]uint64{{0, 600}, {0, 1}, {15, 2}, {16, 16}, {100, 333}, {599, 1}} {
+		offset, length := r[0], r[1]
+		start := rd.NonceSize() + offset
+		part := append(Ciphertext(nil), ct[start:start+length]...)
+		decrypted, err := rd.DecryptRange(nonce, part, offset)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(decrypted, plaintext[offset:offset+length]) {
+			t.Fatalf("range %v-%v was not decrypted correctly", offset, offset+length)
+		}
+	}
+	if _, err := rd.DecryptRange(nonce[:4], ct[20:30], 0); err == nil {
+		t.Fatal("expected error for short nonce")
+	}
+}
@@ -5,9 +5,11 @@ package crypto
 
 import (
 	"crypto/cipher"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"io"
+	"math"
 
 	"gitlab.com/NebulousLabs/fastrand"
 
@@ -17,6 +19,9 @@ import (
 const (
 	// TwofishOverhead is the number of bytes added by EncryptBytes
 	TwofishOverhead = 28
+
+	// twofishNonceSize is the size of the nonce used by Twofish-GCM.
+	twofishNonceSize = 12
 )
 
 var (
@@ -99,6 +104,35 @@ func (key TwofishKey) DecryptBytesInPlace(ct Ciphertext) ([]byte, error) {
 	return aead.Open(ciphertext[:0], nonce, ciphertext, nil)
 }
 
+// NonceSize returns the size of the nonce that EncryptBytes prepends to the
+// ciphertext.
+func (key TwofishKey) NonceSize() uint64 {
+	return twofishNonceSize
+}
+
+// DecryptRange decrypts ct in place, where ct is the part of a ciphertext
+// created by EncryptBytes that starts offset bytes after the nonce. The GCM tag
+// isn't verified; the caller must authenticate the ciphertext by other means.
+func (key TwofishKey) DecryptRange(nonce []byte, ct Ciphertext, offset uint64) ([]byte, error) {
+	if len(nonce) != twofishNonceSize {
+		return nil, ErrInsufficientLen
+	} else if offset+uint64(len(ct)) > (math.MaxUint32-1)*twofish.BlockSize {
+		return nil, errors.New("range exceeds the maximum GCM plaintext size")
+	}
+	// GCM encrypts the plaintext in counter mode. The counter block is the
+	// nonce followed by a 32-bit counter, which is 2 for the first block of
+	// the plaintext.
+	iv := make([]byte, twofish.BlockSize)
+	copy(iv, nonce)
+	binary.BigEndian.PutUint32(iv[twofishNonceSize:], uint32(2+offset/twofish.BlockSize))
+	stream := cipher.NewCTR(key.NewCipher(), iv)
+	// Discard the keystream preceding offset within its block.
+	skip := make([]byte, offset%twofish.BlockSize)
+	stream.XORKeyStream(skip, skip)
+	stream.XORKeyStream(ct, ct)
+	return ct, nil
+}
+
 // NewWriter returns a writer that encrypts or decrypts its input stream.
 func (key TwofishKey) NewWriter(w io.Writer) io.Writer {
 	// OK to use a zero IV if the key is unique for each ciphertext.
@@ -133,3 +167,21 @@ func (c *Ciphertext) UnmarshalJSON(b []byte) error {
 	*c = Ciphertext(umarB)
 	return nil
 }
+
+// EncryptWithNonce encrypts a []byte using the provided AEAD and prepends the
+// randomly generated nonce to the ciphertext.
+func EncryptWithNonce(plaintext []byte, aead cipher.AEAD) []byte {
+	nonce := fastrand.Bytes(aead.NonceSize())
+	return aead.Seal(nonce, nonce, plaintext, nil)
+}
+
+// DecryptWithNonce decrypts the ciphertext created by EncryptWithNonce. The
+// nonce is expected to be the first bytes of the ciphertext.
+func DecryptWithNonce(ct []byte, aead cipher.AEAD) ([]byte, error) {
+	if len(ct) < aead.NonceSize() {
+		return nil, ErrInsufficientLen
+	}
+	nonce := ct[:aead.NonceSize()]
+	ciphertext := ct[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
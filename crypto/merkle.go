@@ -154,3 +154,79 @@ func VerifySegment(base []byte, hashSet []Hash, numSegments, proofIndex uint64,
 	}
 	return merkletree.VerifyProof(NewHash(), root[:], proofSet, proofIndex, numSegments)
 }
+
+// rangeSubtrees returns the heights of the largest subtrees that cover the
+// segments in the range [start, end), ordered from left to right.
+func rangeSubtrees(start, end int) []int {
+	var heights []int
+	for start < end {
+		height := 0
+		for start%(2<<uint(height)) == 0 && start+(2<<uint(height)) <= end {
+			height++
+		}
+		heights = append(heights, height)
+		start += 1 << uint(height)
+	}
+	return heights
+}
+
+// MerkleRangeProof builds a Merkle proof that the segments in the range
+// [proofStart, proofEnd) are a part of the Merkle root formed by 'b'. The
+// proof consists of the roots of the largest subtrees that don't overlap the
+// range, ordered from left to right. The number of segments in 'b' must be a
+// power of two, which is the case for sectors.
+func MerkleRangeProof(b []byte, proofStart, proofEnd int) []Hash {
+	var proof []Hash
+	addSubtrees := func(start, end int) {
+		for _, height := range rangeSubtrees(start, end) {
+			size := 1 << uint(height)
+			proof = append(proof, MerkleRoot(b[start*SegmentSize:(start+size)*SegmentSize]))
+			start += size
+		}
+	}
+	addSubtrees(0, proofStart)
+	addSubtrees(proofEnd, len(b)/SegmentSize)
+	return proof
+}
+
+// VerifyRangeProof verifies that the segments in the range [proofStart,
+// proofEnd) are a part of a Merkle root that was formed from 'numSegments'
+// segments, using a proof created by MerkleRangeProof. The root is rebuilt by
+// pushing the subtrees of the proof and the subtrees of the segments into a
+// CachedMerkleTree, so every segment is only hashed once.
+func VerifyRangeProof(segments []byte, proof []Hash, proofStart, proofEnd, numSegments int, root Hash) bool {
+	if proofStart < 0 || proofStart >= proofEnd || proofEnd > numSegments || numSegments&(numSegments-1) != 0 {
+		return false
+	} else if len(segments) != (proofEnd-proofStart)*SegmentSize {
+		return false
+	}
+
+	ct := NewCachedTree(0)
+	pushProof := func(start, end int) bool {
+		for _, height := range rangeSubtrees(start, end) {
+			if len(proof) == 0 {
+				return false
+			} else if err := ct.PushSubTree(height, proof[0]); err != nil {
+				return false
+			}
+			proof = proof[1:]
+		}
+		return true
+	}
+	if !pushProof(0, proofStart) {
+		return false
+	}
+	start := proofStart
+	for _, height := range rangeSubtrees(proofStart, proofEnd) {
+		size := 1 << uint(height)
+		subtree := segments[(start-proofStart)*SegmentSize : (start-proofStart+size)*SegmentSize]
+		if err := ct.PushSubTree(height, MerkleRoot(subtree)); err != nil {
+			return false
+		}
+		start += size
+	}
+	if !pushProof(proofEnd, numSegments) {
+		return false
+	}
+	return len(proof) == 0 && ct.Root() == root
+}
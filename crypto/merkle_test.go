@@ -153,3 +153,49 @@ func TestOddDataSize(t *testing.T) {
 		}
 	}
 }
+
+// TestMerkleRangeProof checks that range proofs can be verified for all
+// ranges of a small tree, and that invalid proofs are rejected.
+func TestMerkleRangeProof(t *testing.T) {
+	const numSegments = 16
+	data := fastrand.Bytes(numSegments * SegmentSize)
+	root := MerkleRoot(data)
+	for start := 0; start < numSegments; start++ {
+		for end := start + 1; end <= numSegments; end++ {
+			segments := data[start*SegmentSize : end*SegmentSize]
+			proof := MerkleRangeProof(data, start, end)
+			if !VerifyRangeProof(segments, proof, start, end, numSegments, root) {
+				t.Fatalf("range proof for [%v, %v) was rejected", start, end)
+			}
+		}
+	}
+
+	// The proof of the full range is empty.
+	if proof := MerkleRangeProof(data, 0, numSegments); len(proof) != 0 {
+		t.Fatal("expected empty proof for the full range, got", len(proof))
+	}
+
+	// Modified data, a modified proof, a wrong range and a proof with too
+	// many hashes should all be rejected.
+	segments := append([]byte(nil), data[3*SegmentSize:7*SegmentSize]...)
+	proof := MerkleRangeProof(data, 3, 7)
+	segments[0]++
+	if VerifyRangeProof(segments, proof, 3, 7, numSegments, root) {
+		t.Error("range proof accepted modified data")
+	}
+	segments[0]--
+	proof[0][0]++
+	if VerifyRangeProof(segments, proof, 3, 7, numSegments, root) {
+		t.Error("range proof accepted modified proof")
+	}
+	proof[0][0]--
+	if VerifyRangeProof(segments, proof, 4, 8, numSegments, root) {
+		t.Error("range proof accepted wrong range")
+	}
+	if VerifyRangeProof(segments, append(proof, Hash{}), 3, 7, numSegments, root) {
+		t.Error("range proof accepted extra hashes")
+	}
+	if !VerifyRangeProof(segments, proof, 3, 7, numSegments, root) {
+		t.Error("valid range proof was rejected")
+	}
+}
@@ -0,0 +1,55 @@
+package crypto
+
+// x25519.go contains the Diffie-Hellman key exchange that is used to establish
+// a shared secret between two parties, e.g. to encrypt the connection between
+// a renter and a host.
+
+import (
+	"crypto/cipher"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	// X25519KeySize is the size of X25519 public and secret keys in bytes.
+	X25519KeySize = 32
+)
+
+type (
+	// X25519SecretKey is the secret half of an ephemeral key pair that is
+	// used for a key exchange.
+	X25519SecretKey [X25519KeySize]byte
+
+	// X25519PublicKey is the public half of an ephemeral key pair that is
+	// used for a key exchange.
+	X25519PublicKey [X25519KeySize]byte
+)
+
+// GenerateX25519KeyPair generates an ephemeral key pair for use in a key
+// exchange.
+func GenerateX25519KeyPair() (xsk X25519SecretKey, xpk X25519PublicKey) {
+	fastrand.Read(xsk[:])
+	curve25519.ScalarBaseMult((*[X25519KeySize]byte)(&xpk), (*[X25519KeySize]byte)(&xsk))
+	return
+}
+
+// DeriveSharedSecret derives a secret from the secret key of one party and the
+// public key of the other party. Both parties derive the same secret. The
+// result of the key exchange is hashed, so that the secret can be used as a
+// symmetric key directly.
+func DeriveSharedSecret(xsk X25519SecretKey, xpk X25519PublicKey) [EntropySize]byte {
+	var dst [X25519KeySize]byte
+	curve25519.ScalarMult(&dst, (*[X25519KeySize]byte)(&xsk), (*[X25519KeySize]byte)(&xpk))
+	return blake2b.Sum256(dst[:])
+}
+
+// NewChaCha20Poly1305 creates a ChaCha20-Poly1305 AEAD from a shared secret.
+func NewChaCha20Poly1305(key [EntropySize]byte) cipher.AEAD {
+	// NOTE: New only returns an error if len(key) != 32.
+	aead, _ := chacha20poly1305.New(key[:])
+	return aead
+}
@@ -0,0 +1,43 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestX25519KeyExchange checks that both parties of a key exchange derive the
+// same secret, and that the secret can be used to encrypt messages.
+func TestX25519KeyExchange(t *testing.T) {
+	xsk1, xpk1 := GenerateX25519KeyPair()
+	xsk2, xpk2 := GenerateX25519KeyPair()
+	secret1 := DeriveSharedSecret(xsk1, xpk2)
+	secret2 := DeriveSharedSecret(xsk2, xpk1)
+	if secret1 != secret2 {
+		t.Fatal("parties derived different secrets")
+	}
+	_, xpk3 := GenerateX25519KeyPair()
+	if DeriveSharedSecret(xsk1, xpk3) == secret1 {
+		t.Fatal("different public keys resulted in the same secret")
+	}
+
+	// Encrypt a message with one secret and decrypt it with the other.
+	plaintext := fastrand.Bytes(100)
+	ct := EncryptWithNonce(plaintext, NewChaCha20Poly1305(secret1))
+	decrypted, err := DecryptWithNonce(ct, NewChaCha20Poly1305(secret2))
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(decrypted, plaintext) {
+		t.Fatal("decrypted message doesn't match the plaintext")
+	}
+
+	// A modified ciphertext shouldn't decrypt.
+	ct[len(ct)-1] ^= 1
+	if _, err := DecryptWithNonce(ct, NewChaCha20Poly1305(secret2)); err == nil {
+		t.Fatal("modified ciphertext was decrypted")
+	}
+	if _, err := DecryptWithNonce(ct[:5], NewChaCha20Poly1305(secret2)); err != ErrInsufficientLen {
+		t.Fatal("expected ErrInsufficientLen, got", err)
+	}
+}
@@ -56,6 +56,10 @@ type (
 		// LoadFile allows the host to load a persistence structure form disk.
 		LoadFile(persist.Metadata, interface{}, string) error
 
+		// LookupIP resolves a hostname into the IP addresses that are
+		// associated with it.
+		LookupIP(string) ([]net.IP, error)
+
 		// MkdirAll gives the host the ability to create chains of folders
 		// within the filesystem.
 		MkdirAll(string, os.FileMode) error
@@ -229,6 +233,11 @@ func (*ProductionDependencies) LoadFile(meta persist.Metadata, data interface{},
 	return persist.LoadJSON(meta, data, filename)
 }
 
+// LookupIP resolves a hostname using the local resolver of the system.
+func (*ProductionDependencies) LookupIP(host string) ([]net.IP, error) {
+	return net.LookupIP(host)
+}
+
 // SaveFileSync writes JSON encoded data to a file and syncs the file to disk
 // afterwards.
 func (*ProductionDependencies) SaveFileSync(meta persist.Metadata, data interface{}, filename string) error {
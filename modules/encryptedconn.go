@@ -0,0 +1,87 @@
+package modules
+
+// encryptedconn.go defines the encrypted transport for host RPCs. Instead of
+// the specifier of an RPC, the renter sends RPCEncrypt, followed by the same
+// key exchange that starts a session. Afterwards, both parties wrap the
+// connection in an encrypted connection, and the renter sends the specifier of
+// the actual RPC over the encrypted connection. The RPC then proceeds as
+// usual.
+//
+// Renters only request an encrypted connection if the host announced a
+// version that supports it in its settings. Hosts of older versions are
+// contacted without encryption.
+
+import (
+	"net"
+
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// EncryptedConnFrameSize is the maximum size of the plaintext of a
+	// single frame of an encrypted connection.
+	EncryptedConnFrameSize = 1 << 16
+
+	// EncryptedTransportVersion is the first host version that supports
+	// RPCEncrypt.
+	EncryptedTransportVersion = "1.3.4"
+)
+
+var (
+	// RPCEncrypt is the specifier for encrypting the connection to a host
+	// before calling an RPC.
+	RPCEncrypt = types.Specifier{'E', 'n', 'c', 'r', 'y', 'p', 't'}
+)
+
+// An encryptedConn is a net.Conn that encrypts all data using the cipher of
+// the key exchange. The data is sent in length-prefixed frames, which are
+// sealed like the messages of a session, so frames can't be replayed,
+// reordered or reflected either.
+type encryptedConn struct {
+	net.Conn
+	cipher  *SessionCipher
+	readBuf []byte
+}
+
+// Read reads decrypted data from the connection.
+func (c *encryptedConn) Read(b []byte) (int, error) {
+	if len(c.readBuf) == 0 {
+		ct, err := encoding.ReadPrefixedBytes(c.Conn, EncryptedConnFrameSize+c.cipher.Overhead())
+		if err != nil {
+			return 0, err
+		}
+		plaintext, err := c.cipher.Open(ct)
+		if err != nil {
+			return 0, err
+		}
+		c.readBuf = plaintext
+	}
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// Write encrypts data and writes it to the connection.
+func (c *encryptedConn) Write(b []byte) (int, error) {
+	var n int
+	for len(b) > 0 {
+		frame := b
+		if len(frame) > EncryptedConnFrameSize {
+			frame = frame[:EncryptedConnFrameSize]
+		}
+		if err := encoding.WritePrefixedBytes(c.Conn, c.cipher.Seal(frame)); err != nil {
+			return n, err
+		}
+		n += len(frame)
+		b = b[len(frame):]
+	}
+	return n, nil
+}
+
+// NewEncryptedConn wraps conn in a connection that encrypts all data using
+// the cipher of the key exchange. The cipher must not be used for anything
+// else afterwards.
+func NewEncryptedConn(conn net.Conn, c *SessionCipher) net.Conn {
+	return &encryptedConn{Conn: conn, cipher: c}
+}
@@ -0,0 +1,71 @@
+package modules
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestEncryptedConn checks that data written to one side of an encrypted
+// connection can be read from the other side, and that tampered frames are
+// rejected.
+func TestEncryptedConn(t *testing.T) {
+	t.Parallel()
+
+	var key [crypto.EntropySize]byte
+	copy(key[:], fastrand.Bytes(crypto.EntropySize))
+	aead := crypto.NewChaCha20Poly1305(key)
+
+	// Send data spanning multiple frames in both directions.
+	c1, c2 := net.Pipe()
+	renter := NewEncryptedConn(c1, NewSessionCipher(aead, false))
+	host := NewEncryptedConn(c2, NewSessionCipher(aead, true))
+	for _, conns := range [][2]net.Conn{{renter, host}, {host, renter}} {
+		data := fastrand.Bytes(2*EncryptedConnFrameSize + 100)
+		errChan := make(chan error, 1)
+		go func(w net.Conn) {
+			_, err := w.Write(data)
+			errChan <- err
+		}(conns[0])
+		buf := make([]byte, len(data))
+		if _, err := io.ReadFull(conns[1], buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errChan; err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, data) {
+			t.Fatal("received data does not match sent data")
+		}
+	}
+	c1.Close()
+	c2.Close()
+
+	// A frame encrypted with the host's nonce should be rejected by the
+	// host.
+	c1, c2 = net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	host = NewEncryptedConn(c2, NewSessionCipher(aead, true))
+	hostNonce := make([]byte, aead.NonceSize())
+	hostNonce[0] = 1
+	go encoding.WritePrefixedBytes(c1, aead.Seal(nil, hostNonce, []byte("foo"), nil))
+	if _, err := host.Read(make([]byte, 3)); err == nil {
+		t.Fatal("expected reflected frame to be rejected")
+	}
+
+	// A frame with a flipped bit should be rejected.
+	host = NewEncryptedConn(c2, NewSessionCipher(aead, true))
+	ct := aead.Seal(nil, make([]byte, aead.NonceSize()), []byte("foo"), nil)
+	ct[0] ^= 1
+	go encoding.WritePrefixedBytes(c1, ct)
+	if _, err := host.Read(make([]byte, 3)); err == nil {
+		t.Fatal("expected tampered frame to be rejected")
+	}
+}
@@ -26,11 +26,21 @@ const (
 	// connection.
 	iteratedConnectionTime = 1200 * time.Second
 
+	// maxParallelSectorAdds is the maximum number of sectors of a single
+	// storage obligation modification that are added to the storage manager
+	// at the same time. Adding sectors in parallel lets them share the syncs
+	// of the storage manager, but every add holds a full sector in memory.
+	maxParallelSectorAdds = 16
+
 	// resubmissionTimeout defines the number of blocks that a host will wait
 	// before attempting to resubmit a transaction to the blockchain.
 	// Typically, this transaction will contain either a file contract, a file
 	// contract revision, or a storage proof.
 	resubmissionTimeout = 3
+
+	// sessionIdleTime is the amount of time that the host waits for the next
+	// request of a session before closing the connection.
+	sessionIdleTime = 600 * time.Second
 )
 
 var (
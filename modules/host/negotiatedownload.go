@@ -6,6 +6,7 @@ import (
 	"net"
 	"time"
 
+	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/encoding"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
@@ -20,6 +21,10 @@ var (
 	// errRequestOutOfBounds is returned when a download request is made which
 	// asks for elements of a sector which do not exist.
 	errRequestOutOfBounds = ErrorCommunication("download request has invalid sector bounds")
+
+	// errUnalignedRequest is returned when a download request that requires a
+	// Merkle proof is not aligned to the segments of the sector.
+	errUnalignedRequest = ErrorCommunication("download request is not aligned to sector segments")
 )
 
 // managedDownloadIteration is responsible for managing a single iteration of
@@ -65,39 +70,7 @@ func (h *Host) managedDownloadIteration(conn net.Conn, so *storageObligation) er
 	// Verify that the request is acceptable, and then fetch all of the data
 	// for the renter.
 	existingRevision := so.RevisionTransactionSet[len(so.RevisionTransactionSet)-1].FileContractRevisions[0]
-	var payload [][]byte
-	err = func() error {
-		// Check that the length of each file is in-bounds, and that the total
-		// size being requested is acceptable.
-		var totalSize uint64
-		for _, request := range requests {
-			if request.Length > modules.SectorSize || request.Offset+request.Length > modules.SectorSize {
-				return extendErr("download iteration request failed: ", errRequestOutOfBounds)
-			}
-			totalSize += request.Length
-		}
-		if totalSize > settings.MaxDownloadBatchSize {
-			return extendErr("download iteration batch failed: ", errLargeDownloadBatch)
-		}
-
-		// Verify that the correct amount of money has been moved from the
-		// renter's contract funds to the host's contract funds.
-		expectedTransfer := settings.DownloadBandwidthPrice.Mul64(totalSize)
-		err = verifyPaymentRevision(existingRevision, paymentRevision, blockHeight, expectedTransfer)
-		if err != nil {
-			return extendErr("payment verification failed: ", err)
-		}
-
-		// Load the sectors and build the data payload.
-		for _, request := range requests {
-			sectorData, err := h.ReadSector(request.MerkleRoot)
-			if err != nil {
-				return extendErr("failed to load sector: ", ErrorInternal(err.Error()))
-			}
-			payload = append(payload, sectorData[request.Offset:request.Offset+request.Length])
-		}
-		return nil
-	}()
+	payload, _, err := h.managedReadSections(requests, existingRevision, paymentRevision, settings, blockHeight, false)
 	if err != nil {
 		modules.WriteNegotiationRejection(conn, err) // Error not reported to preserve type in extendErr
 		return extendErr("download request rejected: ", err)
@@ -148,6 +121,53 @@ func (h *Host) managedDownloadIteration(conn net.Conn, so *storageObligation) er
 	return nil
 }
 
+// managedReadSections verifies that a set of download requests is acceptable
+// and paid for by the payment revision, and then loads the requested data. If
+// buildProofs is set, the requests need to be aligned to the segments of the
+// sector, and a Merkle range proof is returned for each request.
+func (h *Host) managedReadSections(requests []modules.DownloadAction, existingRevision, paymentRevision types.FileContractRevision, settings modules.HostExternalSettings, blockHeight types.BlockHeight, buildProofs bool) ([][]byte, [][]crypto.Hash, error) {
+	// Check that the length of each file is in-bounds, and that the total
+	// size being requested is acceptable.
+	var totalSize uint64
+	for _, request := range requests {
+		if request.Length > modules.SectorSize || request.Offset+request.Length > modules.SectorSize {
+			return nil, nil, extendErr("download iteration request failed: ", errRequestOutOfBounds)
+		}
+		if buildProofs && (request.Length == 0 || request.Offset%crypto.SegmentSize != 0 || request.Length%crypto.SegmentSize != 0) {
+			return nil, nil, extendErr("download iteration request failed: ", errUnalignedRequest)
+		}
+		totalSize += request.Length
+	}
+	if totalSize > settings.MaxDownloadBatchSize {
+		return nil, nil, extendErr("download iteration batch failed: ", errLargeDownloadBatch)
+	}
+
+	// Verify that the correct amount of money has been moved from the
+	// renter's contract funds to the host's contract funds.
+	expectedTransfer := settings.DownloadBandwidthPrice.Mul64(totalSize)
+	err := verifyPaymentRevision(existingRevision, paymentRevision, blockHeight, expectedTransfer)
+	if err != nil {
+		return nil, nil, extendErr("payment verification failed: ", err)
+	}
+
+	// Load the sectors and build the data payload.
+	var payload [][]byte
+	var proofs [][]crypto.Hash
+	for _, request := range requests {
+		sectorData, err := h.ReadSector(request.MerkleRoot)
+		if err != nil {
+			return nil, nil, extendErr("failed to load sector: ", ErrorInternal(err.Error()))
+		}
+		payload = append(payload, sectorData[request.Offset:request.Offset+request.Length])
+		if buildProofs {
+			proofStart := int(request.Offset / crypto.SegmentSize)
+			proofEnd := int((request.Offset + request.Length) / crypto.SegmentSize)
+			proofs = append(proofs, crypto.MerkleRangeProof(sectorData, proofStart, proofEnd))
+		}
+	}
+	return payload, proofs, nil
+}
+
 // verifyPaymentRevision verifies that the revision being provided to pay for
 // the data has transferred the expected amount of money from the renter to the
 // host.
@@ -0,0 +1,34 @@
+package host
+
+import (
+	"net"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+// managedRPCRecoverContract is called by a renter that lost its contract
+// metadata. After proving ownership of the contract through the recent
+// revision exchange, the renter receives the Merkle roots of all sectors that
+// are stored under the contract, which allows it to rebuild the contract.
+func (h *Host) managedRPCRecoverContract(conn net.Conn) error {
+	_, so, err := h.managedRPCRecentRevision(conn)
+	if err != nil {
+		return extendErr("failed RPCRecentRevision during RPCRecoverContract: ", err)
+	}
+	// The storage obligation is returned with a lock on it. Defer a call to
+	// unlock the storage obligation.
+	defer func() {
+		h.managedUnlockStorageObligation(so.id())
+	}()
+
+	// Send the sector roots to the renter. A large contract can have many
+	// sectors, so allow for more time.
+	conn.SetDeadline(time.Now().Add(modules.NegotiateRecoverContractTime))
+	err = encoding.WriteObject(conn, so.SectorRoots)
+	if err != nil {
+		return extendErr("failed to write sector roots: ", ErrorConnection(err.Error()))
+	}
+	return nil
+}
@@ -57,87 +57,16 @@ func (h *Host) managedRevisionIteration(conn net.Conn, so *storageObligation, fi
 		return extendErr("unable to read proposed revision: ", ErrorConnection(err.Error()))
 	}
 
-	// First read all of the modifications. Then make the modifications, but
-	// with the ability to reverse them. Then verify the file contract revision
-	// correctly accounts for the changes.
-	var bandwidthRevenue types.Currency // Upload bandwidth.
-	var storageRevenue types.Currency
-	var newCollateral types.Currency
-	var sectorsRemoved []crypto.Hash
-	var sectorsGained []crypto.Hash
-	var gainedSectorData [][]byte
+	// Make the modifications, but with the ability to reverse them. Then
+	// verify the file contract revision correctly accounts for the changes.
+	var sm sectorModifications
 	err = func() error {
-		for _, modification := range modifications {
-			// Check that the index points to an existing sector root. If the type
-			// is ActionInsert, we permit inserting at the end.
-			if modification.Type == modules.ActionInsert {
-				if modification.SectorIndex > uint64(len(so.SectorRoots)) {
-					return errBadModificationIndex
-				}
-			} else if modification.SectorIndex >= uint64(len(so.SectorRoots)) {
-				return errBadModificationIndex
-			}
-			// Check that the data sent for the sector is not too large.
-			if uint64(len(modification.Data)) > modules.SectorSize {
-				return errLargeSector
-			}
-
-			switch modification.Type {
-			case modules.ActionDelete:
-				// There is no financial information to change, it is enough to
-				// remove the sector.
-				sectorsRemoved = append(sectorsRemoved, so.SectorRoots[modification.SectorIndex])
-				so.SectorRoots = append(so.SectorRoots[0:modification.SectorIndex], so.SectorRoots[modification.SectorIndex+1:]...)
-			case modules.ActionInsert:
-				// Check that the sector size is correct.
-				if uint64(len(modification.Data)) != modules.SectorSize {
-					return errBadSectorSize
-				}
-
-				// Update finances.
-				blocksRemaining := so.proofDeadline() - blockHeight
-				blockBytesCurrency := types.NewCurrency64(uint64(blocksRemaining)).Mul64(modules.SectorSize)
-				bandwidthRevenue = bandwidthRevenue.Add(settings.UploadBandwidthPrice.Mul64(modules.SectorSize))
-				storageRevenue = storageRevenue.Add(settings.StoragePrice.Mul(blockBytesCurrency))
-				newCollateral = newCollateral.Add(settings.Collateral.Mul(blockBytesCurrency))
-
-				// Insert the sector into the root list.
-				newRoot := crypto.MerkleRoot(modification.Data)
-				sectorsGained = append(sectorsGained, newRoot)
-				gainedSectorData = append(gainedSectorData, modification.Data)
-				so.SectorRoots = append(so.SectorRoots[:modification.SectorIndex], append([]crypto.Hash{newRoot}, so.SectorRoots[modification.SectorIndex:]...)...)
-			case modules.ActionModify:
-				// Check that the offset and length are okay. Length is already
-				// known to be appropriately small, but the offset needs to be
-				// checked for being appropriately small as well otherwise there is
-				// a risk of overflow.
-				if modification.Offset > modules.SectorSize || modification.Offset+uint64(len(modification.Data)) > modules.SectorSize {
-					return errIllegalOffsetAndLength
-				}
-
-				// Get the data for the new sector.
-				sector, err := h.ReadSector(so.SectorRoots[modification.SectorIndex])
-				if err != nil {
-					return extendErr("could not read sector: ", ErrorInternal(err.Error()))
-				}
-				copy(sector[modification.Offset:], modification.Data)
-
-				// Update finances.
-				bandwidthRevenue = bandwidthRevenue.Add(settings.UploadBandwidthPrice.Mul64(uint64(len(modification.Data))))
-
-				// Update the sectors removed and gained to indicate that the old
-				// sector has been replaced with a new sector.
-				newRoot := crypto.MerkleRoot(sector)
-				sectorsRemoved = append(sectorsRemoved, so.SectorRoots[modification.SectorIndex])
-				sectorsGained = append(sectorsGained, newRoot)
-				gainedSectorData = append(gainedSectorData, sector)
-				so.SectorRoots[modification.SectorIndex] = newRoot
-			default:
-				return errUnknownModification
-			}
+		sm, err = h.managedApplyModifications(so, modifications, settings, blockHeight)
+		if err != nil {
+			return err
 		}
-		newRevenue := storageRevenue.Add(bandwidthRevenue)
-		return extendErr("unable to verify updated contract: ", verifyRevision(*so, revision, blockHeight, newRevenue, newCollateral))
+		newRevenue := sm.storageRevenue.Add(sm.bandwidthRevenue)
+		return extendErr("unable to verify updated contract: ", verifyRevision(*so, revision, blockHeight, newRevenue, sm.newCollateral))
 	}()
 	if err != nil {
 		modules.WriteNegotiationRejection(conn, err) // Error is ignored so that the error type can be preserved in extendErr.
@@ -162,12 +91,12 @@ func (h *Host) managedRevisionIteration(conn net.Conn, so *storageObligation, fi
 		return extendErr("could not create revision signature: ", err)
 	}
 
-	so.PotentialStorageRevenue = so.PotentialStorageRevenue.Add(storageRevenue)
-	so.RiskedCollateral = so.RiskedCollateral.Add(newCollateral)
-	so.PotentialUploadRevenue = so.PotentialUploadRevenue.Add(bandwidthRevenue)
+	so.PotentialStorageRevenue = so.PotentialStorageRevenue.Add(sm.storageRevenue)
+	so.RiskedCollateral = so.RiskedCollateral.Add(sm.newCollateral)
+	so.PotentialUploadRevenue = so.PotentialUploadRevenue.Add(sm.bandwidthRevenue)
 	so.RevisionTransactionSet = []types.Transaction{txn}
 	h.mu.Lock()
-	err = h.modifyStorageObligation(*so, sectorsRemoved, sectorsGained, gainedSectorData)
+	err = h.modifyStorageObligation(*so, sm.sectorsRemoved, sm.sectorsGained, sm.gainedSectorData)
 	h.mu.Unlock()
 	if err != nil {
 		modules.WriteNegotiationRejection(conn, err) // Error is ignored so that the error type can be preserved in extendErr.
@@ -193,6 +122,112 @@ func (h *Host) managedRevisionIteration(conn net.Conn, so *storageObligation, fi
 	return nil
 }
 
+// sectorModifications describes the changes that a set of revision actions
+// makes to a storage obligation, and the payment that the host expects for
+// them.
+type sectorModifications struct {
+	bandwidthRevenue types.Currency // Upload bandwidth.
+	storageRevenue   types.Currency
+	newCollateral    types.Currency
+	sectorsRemoved   []crypto.Hash
+	sectorsGained    []crypto.Hash
+	gainedSectorData [][]byte
+}
+
+// managedApplyModifications applies a set of revision actions to the sector
+// roots of a storage obligation. The returned sectorModifications contain the
+// sectors that need to be added to and removed from the host, as well as the
+// revenue and collateral resulting from the modifications.
+func (h *Host) managedApplyModifications(so *storageObligation, modifications []modules.RevisionAction, settings modules.HostExternalSettings, blockHeight types.BlockHeight) (sectorModifications, error) {
+	var sm sectorModifications
+	for _, modification := range modifications {
+		// Check that the index points to an existing sector root. If the type
+		// is ActionInsert, we permit inserting at the end. If the type is
+		// ActionTrim, the index is the number of sectors to remove, which
+		// may be all of them.
+		if modification.Type == modules.ActionInsert || modification.Type == modules.ActionTrim {
+			if modification.SectorIndex > uint64(len(so.SectorRoots)) {
+				return sectorModifications{}, errBadModificationIndex
+			}
+		} else if modification.SectorIndex >= uint64(len(so.SectorRoots)) {
+			return sectorModifications{}, errBadModificationIndex
+		}
+		// Check that the data sent for the sector is not too large.
+		if uint64(len(modification.Data)) > modules.SectorSize {
+			return sectorModifications{}, errLargeSector
+		}
+
+		switch modification.Type {
+		case modules.ActionDelete:
+			// There is no financial information to change, it is enough to
+			// remove the sector.
+			sm.sectorsRemoved = append(sm.sectorsRemoved, so.SectorRoots[modification.SectorIndex])
+			so.SectorRoots = append(so.SectorRoots[0:modification.SectorIndex], so.SectorRoots[modification.SectorIndex+1:]...)
+		case modules.ActionInsert:
+			// Check that the sector size is correct.
+			if uint64(len(modification.Data)) != modules.SectorSize {
+				return sectorModifications{}, errBadSectorSize
+			}
+
+			// Update finances.
+			blocksRemaining := so.proofDeadline() - blockHeight
+			blockBytesCurrency := types.NewCurrency64(uint64(blocksRemaining)).Mul64(modules.SectorSize)
+			sm.bandwidthRevenue = sm.bandwidthRevenue.Add(settings.UploadBandwidthPrice.Mul64(modules.SectorSize))
+			sm.storageRevenue = sm.storageRevenue.Add(settings.StoragePrice.Mul(blockBytesCurrency))
+			sm.newCollateral = sm.newCollateral.Add(settings.Collateral.Mul(blockBytesCurrency))
+
+			// Insert the sector into the root list.
+			newRoot := crypto.MerkleRoot(modification.Data)
+			sm.sectorsGained = append(sm.sectorsGained, newRoot)
+			sm.gainedSectorData = append(sm.gainedSectorData, modification.Data)
+			so.SectorRoots = append(so.SectorRoots[:modification.SectorIndex], append([]crypto.Hash{newRoot}, so.SectorRoots[modification.SectorIndex:]...)...)
+		case modules.ActionModify:
+			// Check that the offset and length are okay. Length is already
+			// known to be appropriately small, but the offset needs to be
+			// checked for being appropriately small as well otherwise there is
+			// a risk of overflow.
+			if modification.Offset > modules.SectorSize || modification.Offset+uint64(len(modification.Data)) > modules.SectorSize {
+				return sectorModifications{}, errIllegalOffsetAndLength
+			}
+
+			// Get the data for the new sector.
+			sector, err := h.ReadSector(so.SectorRoots[modification.SectorIndex])
+			if err != nil {
+				return sectorModifications{}, extendErr("could not read sector: ", ErrorInternal(err.Error()))
+			}
+			copy(sector[modification.Offset:], modification.Data)
+
+			// Update finances.
+			sm.bandwidthRevenue = sm.bandwidthRevenue.Add(settings.UploadBandwidthPrice.Mul64(uint64(len(modification.Data))))
+
+			// Update the sectors removed and gained to indicate that the old
+			// sector has been replaced with a new sector.
+			newRoot := crypto.MerkleRoot(sector)
+			sm.sectorsRemoved = append(sm.sectorsRemoved, so.SectorRoots[modification.SectorIndex])
+			sm.sectorsGained = append(sm.sectorsGained, newRoot)
+			sm.gainedSectorData = append(sm.gainedSectorData, sector)
+			so.SectorRoots[modification.SectorIndex] = newRoot
+		case modules.ActionSwap:
+			// Check that the offset points to an existing sector root as
+			// well.
+			if modification.Offset >= uint64(len(so.SectorRoots)) {
+				return sectorModifications{}, errBadModificationIndex
+			}
+			i, j := modification.SectorIndex, modification.Offset
+			so.SectorRoots[i], so.SectorRoots[j] = so.SectorRoots[j], so.SectorRoots[i]
+		case modules.ActionTrim:
+			// Like ActionDelete, there is no financial information to
+			// change.
+			newLen := uint64(len(so.SectorRoots)) - modification.SectorIndex
+			sm.sectorsRemoved = append(sm.sectorsRemoved, so.SectorRoots[newLen:]...)
+			so.SectorRoots = so.SectorRoots[:newLen]
+		default:
+			return sectorModifications{}, errUnknownModification
+		}
+	}
+	return sm, nil
+}
+
 // managedRPCReviseContract accepts a request to revise an existing contract.
 // Revisions can add sectors, delete sectors, and modify existing sectors.
 func (h *Host) managedRPCReviseContract(conn net.Conn) error {
@@ -0,0 +1,319 @@
+package host
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+var (
+	// errSessionLocked is returned if the renter tries to lock a contract
+	// while another contract is locked by the session.
+	errSessionLocked = ErrorCommunication("session already has a locked contract")
+
+	// errSessionNotLocked is returned if the renter tries to revise a
+	// contract without locking it first.
+	errSessionNotLocked = ErrorCommunication("session has no locked contract")
+
+	// errUnknownSessionRequest is returned if the renter sends a request that
+	// the host does not recognize.
+	errUnknownSessionRequest = ErrorCommunication("unknown session request")
+)
+
+// A session holds the state of a session with a renter. Only one contract can
+// be locked by a session at a time.
+type session struct {
+	conn      net.Conn
+	cipher    *modules.SessionCipher
+	challenge [modules.SessionChallengeSize]byte
+
+	so     storageObligation
+	locked bool
+}
+
+// managedSessionKeyExchange performs the key exchange that starts a session.
+// The host signs the exchange with its public key so that the renter can be
+// certain that it is talking to the correct host.
+func (h *Host) managedSessionKeyExchange(conn net.Conn) (*session, error) {
+	conn.SetDeadline(time.Now().Add(modules.NegotiateSettingsTime))
+
+	var req modules.SessionKeyExchangeRequest
+	err := encoding.ReadObject(conn, &req, modules.NegotiateMaxSessionKeyExchangeSize)
+	if err != nil {
+		return nil, extendErr("could not read key exchange request: ", ErrorConnection(err.Error()))
+	}
+
+	h.mu.RLock()
+	secretKey := h.secretKey
+	h.mu.RUnlock()
+
+	// Pick a cipher that is supported by both parties. If there is none, the
+	// response is sent with an empty cipher so that the renter knows why the
+	// session failed.
+	xsk, xpk := crypto.GenerateX25519KeyPair()
+	resp := modules.SessionKeyExchangeResponse{
+		PublicKey: xpk,
+	}
+	fastrand.Read(resp.Challenge[:])
+	for _, c := range req.Ciphers {
+		if c == modules.SessionCipherChaCha20Poly1305 {
+			resp.Cipher = c
+			break
+		}
+	}
+	resp.Signature = crypto.SignHash(resp.SigHash(req), secretKey)
+	err = encoding.WriteObject(conn, resp)
+	if err != nil {
+		return nil, extendErr("could not write key exchange response: ", ErrorConnection(err.Error()))
+	}
+	if resp.Cipher != modules.SessionCipherChaCha20Poly1305 {
+		return nil, ErrorCommunication(modules.ErrSessionNoCipher.Error())
+	}
+
+	return &session{
+		conn:      conn,
+		cipher:    modules.NewSessionCipher(crypto.NewChaCha20Poly1305(crypto.DeriveSharedSecret(xsk, req.PublicKey)), true),
+		challenge: resp.Challenge,
+	}, nil
+}
+
+// managedSessionLock locks the contract requested by the renter and sends the
+// most recent revision of the contract.
+func (h *Host) managedSessionLock(s *session) error {
+	s.conn.SetDeadline(time.Now().Add(modules.NegotiateRecentRevisionTime))
+
+	var req modules.SessionLockRequest
+	err := modules.ReadSessionMessage(s.conn, s.cipher, &req, modules.NegotiateMaxSessionRequestSize)
+	if err != nil {
+		return extendErr("could not read lock request: ", ErrorConnection(err.Error()))
+	}
+	if s.locked {
+		return modules.WriteSessionResponse(s.conn, s.cipher, nil, errSessionLocked)
+	}
+
+	so, recentRevision, revisionSigs, err := h.managedVerifyChallengeResponse(req.ContractID, modules.SessionChallengeHash(s.challenge), req.Signature)
+	if err != nil {
+		// Do not disclose the original error to renter not to leak if the
+		// host has the contract with the ID sent by renter.
+		modules.WriteSessionResponse(s.conn, s.cipher, nil, errVerifyChallenge)
+		return extendErr("challenge failed: ", err)
+	}
+	s.so = so
+	s.locked = true
+
+	err = modules.WriteSessionResponse(s.conn, s.cipher, modules.SessionLockResponse{
+		Revision:   recentRevision,
+		Signatures: revisionSigs,
+	}, nil)
+	if err != nil {
+		return extendErr("failed to write recent revision: ", ErrorConnection(err.Error()))
+	}
+	return nil
+}
+
+// managedSessionUnlock unlocks the contract that is locked by the session.
+func (h *Host) managedSessionUnlock(s *session) error {
+	if s.locked {
+		h.managedUnlockStorageObligation(s.so.id())
+		s.locked = false
+	}
+	err := modules.WriteSessionResponse(s.conn, s.cipher, nil, nil)
+	if err != nil {
+		return extendErr("failed to write unlock response: ", ErrorConnection(err.Error()))
+	}
+	return nil
+}
+
+// managedSessionSettings sends the settings of the host to the renter. The
+// settings don't need to be signed, because the session is already
+// authenticated by the key exchange.
+func (h *Host) managedSessionSettings(s *session) error {
+	s.conn.SetDeadline(time.Now().Add(modules.NegotiateSettingsTime))
+
+	h.mu.Lock()
+	settings := h.externalSettings()
+	h.mu.Unlock()
+	err := modules.WriteSessionResponse(s.conn, s.cipher, settings, nil)
+	if err != nil {
+		return extendErr("failed to write settings: ", ErrorConnection(err.Error()))
+	}
+	return nil
+}
+
+// managedSessionRead sends the data requested by the renter, after verifying
+// that the renter has paid for it.
+func (h *Host) managedSessionRead(s *session) error {
+	s.conn.SetDeadline(time.Now().Add(modules.NegotiateDownloadTime))
+
+	var req modules.SessionReadRequest
+	err := modules.ReadSessionMessage(s.conn, s.cipher, &req, modules.NegotiateMaxSessionRequestSize)
+	if err != nil {
+		return extendErr("failed to read download request: ", ErrorConnection(err.Error()))
+	}
+	if !s.locked {
+		return modules.WriteSessionResponse(s.conn, s.cipher, nil, errSessionNotLocked)
+	}
+
+	h.mu.Lock()
+	blockHeight := h.blockHeight
+	secretKey := h.secretKey
+	settings := h.externalSettings()
+	h.mu.Unlock()
+
+	// Verify that the request is acceptable and fetch the data along with the
+	// Merkle proofs. Then sign the payment revision.
+	existingRevision := s.so.RevisionTransactionSet[len(s.so.RevisionTransactionSet)-1].FileContractRevisions[0]
+	payload, proofs, err := h.managedReadSections(req.Sections, existingRevision, req.Revision, settings, blockHeight, true)
+	if err != nil {
+		modules.WriteSessionResponse(s.conn, s.cipher, nil, err) // Error not reported to preserve type in extendErr
+		return extendErr("download request rejected: ", err)
+	}
+	txn, err := createRevisionSignature(req.Revision, req.Signature, secretKey, blockHeight)
+	if err != nil {
+		modules.WriteSessionResponse(s.conn, s.cipher, nil, err) // Error not reported to preserve type in extendErr
+		return extendErr("could not create revision signature: ", err)
+	}
+
+	// Update the storage obligation.
+	so := s.so
+	paymentTransfer := existingRevision.NewValidProofOutputs[0].Value.Sub(req.Revision.NewValidProofOutputs[0].Value)
+	so.PotentialDownloadRevenue = so.PotentialDownloadRevenue.Add(paymentTransfer)
+	so.RevisionTransactionSet = []types.Transaction{txn}
+	h.mu.Lock()
+	err = h.modifyStorageObligation(so, nil, nil, nil)
+	h.mu.Unlock()
+	if err != nil {
+		return extendErr("failed to modify storage obligation: ", ErrorInternal(modules.WriteSessionResponse(s.conn, s.cipher, nil, err).Error()))
+	}
+	s.so = so
+
+	err = modules.WriteSessionResponse(s.conn, s.cipher, modules.SessionReadResponse{
+		Signature:    txn.TransactionSignatures[1],
+		Data:         payload,
+		MerkleProofs: proofs,
+	}, nil)
+	if err != nil {
+		return extendErr("failed to write payload: ", ErrorConnection(err.Error()))
+	}
+	return nil
+}
+
+// managedSessionWrite applies the revision actions requested by the renter to
+// the locked contract, after verifying that the renter has paid for them.
+func (h *Host) managedSessionWrite(s *session) error {
+	s.conn.SetDeadline(time.Now().Add(modules.NegotiateFileContractRevisionTime))
+
+	h.mu.Lock()
+	blockHeight := h.blockHeight
+	secretKey := h.secretKey
+	settings := h.externalSettings()
+	h.mu.Unlock()
+
+	var req modules.SessionWriteRequest
+	err := modules.ReadSessionMessage(s.conn, s.cipher, &req, settings.MaxReviseBatchSize+modules.NegotiateMaxSessionRequestSize)
+	if err != nil {
+		return extendErr("unable to read revision request: ", ErrorConnection(err.Error()))
+	}
+	if !s.locked {
+		return modules.WriteSessionResponse(s.conn, s.cipher, nil, errSessionNotLocked)
+	}
+
+	// Apply the modifications and verify that the revision accounts for them.
+	// The storage obligation of the session is only updated once the
+	// modifications have been committed.
+	so := s.so
+	so.SectorRoots = append([]crypto.Hash(nil), s.so.SectorRoots...)
+	sm, err := h.managedApplyModifications(&so, req.Actions, settings, blockHeight)
+	if err == nil {
+		newRevenue := sm.storageRevenue.Add(sm.bandwidthRevenue)
+		err = extendErr("unable to verify updated contract: ", verifyRevision(so, req.Revision, blockHeight, newRevenue, sm.newCollateral))
+	}
+	if err != nil {
+		modules.WriteSessionResponse(s.conn, s.cipher, nil, err) // Error is ignored so that the error type can be preserved in extendErr.
+		return extendErr("rejected proposed modifications: ", err)
+	}
+	txn, err := createRevisionSignature(req.Revision, req.Signature, secretKey, blockHeight)
+	if err != nil {
+		modules.WriteSessionResponse(s.conn, s.cipher, nil, err) // Error is ignored so that the error type can be preserved in extendErr.
+		return extendErr("could not create revision signature: ", err)
+	}
+
+	so.PotentialStorageRevenue = so.PotentialStorageRevenue.Add(sm.storageRevenue)
+	so.RiskedCollateral = so.RiskedCollateral.Add(sm.newCollateral)
+	so.PotentialUploadRevenue = so.PotentialUploadRevenue.Add(sm.bandwidthRevenue)
+	so.RevisionTransactionSet = []types.Transaction{txn}
+	h.mu.Lock()
+	err = h.modifyStorageObligation(so, sm.sectorsRemoved, sm.sectorsGained, sm.gainedSectorData)
+	h.mu.Unlock()
+	if err != nil {
+		modules.WriteSessionResponse(s.conn, s.cipher, nil, err) // Error is ignored so that the error type can be preserved in extendErr.
+		return extendErr("could not modify storage obligation: ", ErrorInternal(err.Error()))
+	}
+	s.so = so
+
+	err = modules.WriteSessionResponse(s.conn, s.cipher, modules.SessionWriteResponse{
+		Signature: txn.TransactionSignatures[1],
+	}, nil)
+	if err != nil {
+		return extendErr("failed to write revision signature: ", ErrorConnection(err.Error()))
+	}
+	return nil
+}
+
+// managedRPCSession handles a session with a renter. After the key exchange,
+// the host processes the renter's requests until the renter ends the session,
+// or until the maximum time for a single connection has been reached.
+func (h *Host) managedRPCSession(conn net.Conn) error {
+	startTime := time.Now()
+	s, err := h.managedSessionKeyExchange(conn)
+	if err != nil {
+		return extendErr("key exchange failed: ", err)
+	}
+	// Unlock the contract of the session once the session ends.
+	defer func() {
+		if s.locked {
+			h.managedUnlockStorageObligation(s.so.id())
+		}
+	}()
+
+	for time.Since(startTime) < iteratedConnectionTime {
+		conn.SetDeadline(time.Now().Add(sessionIdleTime))
+		var id types.Specifier
+		err := modules.ReadSessionMessage(conn, s.cipher, &id, types.SpecifierLen)
+		if err != nil {
+			return extendErr("could not read session request: ", ErrorConnection(err.Error()))
+		}
+
+		switch id {
+		case modules.RPCSessionLock:
+			err = extendErr("lock request failed: ", h.managedSessionLock(s))
+		case modules.RPCSessionRead:
+			atomic.AddUint64(&h.atomicDownloadCalls, 1)
+			err = extendErr("read request failed: ", h.managedSessionRead(s))
+		case modules.RPCSessionSettings:
+			atomic.AddUint64(&h.atomicSettingsCalls, 1)
+			err = extendErr("settings request failed: ", h.managedSessionSettings(s))
+		case modules.RPCSessionStop:
+			return nil
+		case modules.RPCSessionUnlock:
+			err = extendErr("unlock request failed: ", h.managedSessionUnlock(s))
+		case modules.RPCSessionWrite:
+			atomic.AddUint64(&h.atomicReviseCalls, 1)
+			err = extendErr("write request failed: ", h.managedSessionWrite(s))
+		default:
+			atomic.AddUint64(&h.atomicUnrecognizedCalls, 1)
+			modules.WriteSessionResponse(conn, s.cipher, nil, errUnknownSessionRequest)
+			err = errUnknownSessionRequest
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -250,16 +250,17 @@ func (h *Host) threadedHandleConn(conn net.Conn) {
 	defer h.tg.Done()
 
 	// Close the conn on host.Close or when the method terminates, whichever comes
-	// first.
+	// first. The conn is passed as an argument because it may be replaced by
+	// an encrypted conn below.
 	connCloseChan := make(chan struct{})
 	defer close(connCloseChan)
-	go func() {
+	go func(conn net.Conn) {
 		select {
 		case <-h.tg.StopChan():
 		case <-connCloseChan:
 		}
 		conn.Close()
-	}()
+	}(conn)
 
 	// Set an initial duration that is generous, but finite. RPCs can extend
 	// this if desired.
@@ -277,6 +278,24 @@ func (h *Host) threadedHandleConn(conn net.Conn) {
 		return
 	}
 
+	// If the renter requested an encrypted connection, perform the key
+	// exchange and read the actual RPC from the encrypted connection.
+	if id == modules.RPCEncrypt {
+		encryptedConn, err := h.managedEncryptConn(conn)
+		if err != nil {
+			atomic.AddUint64(&h.atomicErroredCalls, 1)
+			err = extendErr("incoming RPCEncrypt failed: ", err)
+			h.managedLogError(extendErr("error with "+conn.RemoteAddr().String()+": ", err))
+			return
+		}
+		conn = encryptedConn
+		if err := encoding.ReadObject(conn, &id, 16); err != nil {
+			atomic.AddUint64(&h.atomicUnrecognizedCalls, 1)
+			h.log.Debugf("WARN: incoming encrypted conn %v was malformed: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+
 	switch id {
 	case modules.RPCDownload:
 		atomic.AddUint64(&h.atomicDownloadCalls, 1)
@@ -287,9 +306,13 @@ func (h *Host) threadedHandleConn(conn net.Conn) {
 	case modules.RPCFormContract:
 		atomic.AddUint64(&h.atomicFormContractCalls, 1)
 		err = extendErr("incoming RPCFormContract failed: ", h.managedRPCFormContract(conn))
+	case modules.RPCRecoverContract:
+		err = extendErr("incoming RPCRecoverContract failed: ", h.managedRPCRecoverContract(conn))
 	case modules.RPCReviseContract:
 		atomic.AddUint64(&h.atomicReviseCalls, 1)
 		err = extendErr("incoming RPCReviseContract failed: ", h.managedRPCReviseContract(conn))
+	case modules.RPCSession:
+		err = extendErr("incoming RPCSession failed: ", h.managedRPCSession(conn))
 	case modules.RPCSettings:
 		atomic.AddUint64(&h.atomicSettingsCalls, 1)
 		err = extendErr("incoming RPCSettings failed: ", h.managedRPCSettings(conn))
@@ -306,6 +329,20 @@ func (h *Host) threadedHandleConn(conn net.Conn) {
 	}
 }
 
+// managedEncryptConn performs the key exchange of an RPCEncrypt call and
+// returns the encrypted connection. The deadline of the connection is reset to
+// give the renter time to call the actual RPC.
+func (h *Host) managedEncryptConn(conn net.Conn) (net.Conn, error) {
+	s, err := h.managedSessionKeyExchange(conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Minute)); err != nil {
+		return nil, ErrorConnection(err.Error())
+	}
+	return modules.NewEncryptedConn(conn, s.cipher), nil
+}
+
 // listen listens for incoming RPCs and spawns an appropriate handler for each.
 func (h *Host) threadedListen(closeChan chan struct{}) {
 	defer close(closeChan)
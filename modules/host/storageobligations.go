@@ -35,6 +35,7 @@ import (
 	"encoding/json"
 	"errors"
 	"strconv"
+	"sync"
 
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/crypto"
@@ -477,21 +478,43 @@ func (h *Host) modifyStorageObligation(so storageObligation, sectorsRemoved []cr
 	// and left to consistency checks and user actions to fix (will reduce host
 	// capacity, but will not inhibit the host's ability to submit storage
 	// proofs)
-	var i int
+	//
+	// The sectors are added in parallel by up to maxParallelSectorAdds
+	// threads, so that they are committed by shared syncs of the storage
+	// manager's WAL instead of one sync per sector.
+	addErrs := make([]error, len(sectorsGained))
+	sectorIndices := make(chan int)
+	var wg sync.WaitGroup
+	for t := 0; t < maxParallelSectorAdds && t < len(sectorsGained); t++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range sectorIndices {
+				addErrs[i] = h.AddSector(sectorsGained[i], gainedSectorData[i])
+			}
+		}()
+	}
+	for i := range sectorsGained {
+		sectorIndices <- i
+	}
+	close(sectorIndices)
+	wg.Wait()
 	var err error
-	for i = range sectorsGained {
-		err = h.AddSector(sectorsGained[i], gainedSectorData[i])
-		if err != nil {
+	for i := range addErrs {
+		if addErrs[i] != nil {
+			err = addErrs[i]
 			break
 		}
 	}
 	if err != nil {
 		// Because there was an error, all of the sectors that got added need
 		// to be reverted.
-		for j := 0; j < i; j++ {
-			// Error is not checked because there's nothing useful that can be
-			// done about an error.
-			_ = h.RemoveSector(sectorsGained[j])
+		for j := range sectorsGained {
+			if addErrs[j] == nil {
+				// Error is not checked because there's nothing useful that
+				// can be done about an error.
+				_ = h.RemoveSector(sectorsGained[j])
+			}
 		}
 		return err
 	}
@@ -90,6 +90,11 @@ const (
 	// running Tor.
 	NegotiateRecentRevisionTime = 120 * time.Second
 
+	// NegotiateRecoverContractTime establishes the minimum amount of time that
+	// the connection deadline is expected to be set to when the sector roots
+	// of a file contract are being requested from the host.
+	NegotiateRecoverContractTime = 600 * time.Second
+
 	// NegotiateRenewContractTime defines the minimum amount of time that the
 	// renter and host have to negotiate a final contract renewal. The time is
 	// high enough that the negotiation can occur over a Tor connection, and
@@ -123,6 +128,14 @@ var (
 	// data.
 	ActionModify = types.Specifier{'M', 'o', 'd', 'i', 'f', 'y'}
 
+	// ActionSwap is the specifier for a RevisionAction that swaps two
+	// sectors.
+	ActionSwap = types.Specifier{'S', 'w', 'a', 'p'}
+
+	// ActionTrim is the specifier for a RevisionAction that removes sectors
+	// from the end of the contract.
+	ActionTrim = types.Specifier{'T', 'r', 'i', 'm'}
+
 	// ErrAnnNotAnnouncement indicates that the provided host announcement does
 	// not use a recognized specifier, indicating that it's either not a host
 	// announcement or it's not a recognized version of a host announcement.
@@ -157,6 +170,16 @@ var (
 	// RPCFormContract is the specifier for forming a contract with a host.
 	RPCFormContract = types.Specifier{'F', 'o', 'r', 'm', 'C', 'o', 'n', 't', 'r', 'a', 'c', 't', 2}
 
+	// PrefixFileContractIdentifier is used to indicate that a transaction's
+	// Arbitrary Data field contains a file contract identifier. The
+	// identifier allows a renter to find its contracts on the blockchain
+	// using only its seed.
+	PrefixFileContractIdentifier = types.Specifier{'F', 'C', 'I', 'd', 'e', 'n', 't', 'i', 'f', 'i', 'e', 'r'}
+
+	// RPCRecoverContract is the specifier for requesting the most recent
+	// revision and the sector roots of a file contract from a host.
+	RPCRecoverContract = types.Specifier{'R', 'e', 'c', 'o', 'v', 'e', 'r', 'C', 'o', 'n', 't', 'r', 'a', 'c', 't'}
+
 	// RPCRenewContract is the specifier to renewing an existing contract.
 	RPCRenewContract = types.Specifier{'R', 'e', 'n', 'e', 'w', 'C', 'o', 'n', 't', 'r', 'a', 'c', 't', 2}
 
@@ -263,9 +286,10 @@ type (
 	}
 
 	// A RevisionAction is a description of an edit to be performed on a file
-	// contract. Three types are allowed, 'ActionDelete', 'ActionInsert', and
-	// 'ActionModify'. ActionDelete just takes a sector index, indicating which
-	// sector is going to be deleted. ActionInsert takes a sector index, and a
+	// contract. Five types are allowed, 'ActionDelete', 'ActionInsert',
+	// 'ActionModify', 'ActionSwap' and 'ActionTrim'. ActionDelete just takes a
+	// sector index, indicating which sector is going to be deleted; the
+	// following sectors are shifted. ActionInsert takes a sector index, and a
 	// full sector of data, indicating that a sector at the index should be
 	// inserted with the provided data. 'Modify' revises the sector at the
 	// given index, rewriting it with the provided data starting from the
@@ -274,6 +298,13 @@ type (
 	// Modify could be simulated with an insert and a delete, however an insert
 	// requires a full sector to be uploaded, and a modify can be just a few
 	// kb, which can be significantly faster.
+	//
+	// 'ActionSwap' and 'ActionTrim' allow the renter to remove sectors without
+	// shifting the remaining sectors. ActionSwap swaps the sector at the
+	// sector index with the sector at the index given by 'offset'. ActionTrim
+	// removes the last sectors of the contract; the sector index is the
+	// number of sectors that are removed. Deleting a sector is then a swap
+	// with the last sector, followed by a trim.
 	RevisionAction struct {
 		Type        types.Specifier
 		SectorIndex uint64
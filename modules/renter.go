@@ -2,6 +2,7 @@ package modules
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"time"
 
@@ -58,13 +59,113 @@ type ErasureCoder interface {
 	Recover(pieces [][]byte, n uint64, w io.Writer) error
 }
 
+// A RangeRecoverer is an ErasureCoder whose data pieces contain the original
+// data unmodified and in order, such that a range of the original data can be
+// recovered from only the data pieces that contain it.
+type RangeRecoverer interface {
+	ErasureCoder
+
+	// DataPieces returns the indices of the data pieces that contain the
+	// range [offset, offset+length) of the original data, given that each
+	// piece is pieceSize bytes long.
+	DataPieces(pieceSize, offset, length uint64) []uint64
+
+	// RecoverRange recovers the range [offset, offset+length) of the
+	// original data and writes it to w. Either the pieces returned by
+	// DataPieces or at least MinPieces pieces must be present; missing
+	// elements are set to nil.
+	RecoverRange(pieces [][]byte, pieceSize, offset, length uint64, w io.Writer) error
+}
+
 // An Allowance dictates how much the Renter is allowed to spend in a given
 // period. Note that funds are spent on both storage and bandwidth.
+//
+// The expected usage fields describe how the renter is going to use the
+// allowance. They are used to split the funds between storage and bandwidth
+// when funding contracts, and to score hosts by the prices that matter for
+// that usage. If ExpectedStorage is zero, the usage is unknown and the funds
+// are split evenly across the hosts.
 type Allowance struct {
 	Funds       types.Currency    `json:"funds"`
 	Hosts       uint64            `json:"hosts"`
 	Period      types.BlockHeight `json:"period"`
 	RenewWindow types.BlockHeight `json:"renewwindow"`
+
+	// ExpectedStorage is the amount of data in bytes that the renter expects
+	// to store, before redundancy.
+	ExpectedStorage uint64 `json:"expectedstorage"`
+	// ExpectedUpload is the amount of data in bytes that the renter expects to
+	// upload per period, before redundancy.
+	ExpectedUpload uint64 `json:"expectedupload"`
+	// ExpectedDownload is the amount of data in bytes that the renter expects
+	// to download per period.
+	ExpectedDownload uint64 `json:"expecteddownload"`
+	// ExpectedRedundancy is the average redundancy of the renter's files.
+	ExpectedRedundancy float64 `json:"expectedredundancy"`
+
+	// The maximum prices protect the renter from hosts that raise their
+	// prices after contracts were formed with them. Hosts whose prices exceed
+	// the maximum prices are not used for new contracts or renewals. A
+	// maximum price of zero is not enforced.
+	//
+	// MaxStoragePrice is the maximum storage price per byte per block. The
+	// MaxStoragePrice of the HostScoringProfile is enforced as well, so the
+	// lower of the two non-zero values applies.
+	MaxStoragePrice types.Currency `json:"maxstorageprice"`
+	// MaxUploadBandwidthPrice is the maximum upload price per byte.
+	MaxUploadBandwidthPrice types.Currency `json:"maxuploadbandwidthprice"`
+	// MaxDownloadBandwidthPrice is the maximum download price per byte.
+	MaxDownloadBandwidthPrice types.Currency `json:"maxdownloadbandwidthprice"`
+	// MaxContractPrice is the maximum price of forming or renewing a
+	// contract.
+	MaxContractPrice types.Currency `json:"maxcontractprice"`
+	// MinCollateralRatio is the minimum ratio of the collateral of a host to
+	// its storage price. A host that puts up little collateral has little to
+	// lose by raising its prices.
+	MinCollateralRatio float64 `json:"mincollateralratio"`
+}
+
+// CheckPriceGouging returns an error if the settings of a host exceed the
+// maximum prices of the allowance.
+func (a Allowance) CheckPriceGouging(hes HostExternalSettings) error {
+	if !a.MaxStoragePrice.IsZero() && hes.StoragePrice.Cmp(a.MaxStoragePrice) > 0 {
+		return fmt.Errorf("storage price %v is above the maximum storage price %v of the allowance", hes.StoragePrice, a.MaxStoragePrice)
+	}
+	if !a.MaxUploadBandwidthPrice.IsZero() && hes.UploadBandwidthPrice.Cmp(a.MaxUploadBandwidthPrice) > 0 {
+		return fmt.Errorf("upload price %v is above the maximum upload price %v of the allowance", hes.UploadBandwidthPrice, a.MaxUploadBandwidthPrice)
+	}
+	if !a.MaxDownloadBandwidthPrice.IsZero() && hes.DownloadBandwidthPrice.Cmp(a.MaxDownloadBandwidthPrice) > 0 {
+		return fmt.Errorf("download price %v is above the maximum download price %v of the allowance", hes.DownloadBandwidthPrice, a.MaxDownloadBandwidthPrice)
+	}
+	if !a.MaxContractPrice.IsZero() && hes.ContractPrice.Cmp(a.MaxContractPrice) > 0 {
+		return fmt.Errorf("contract price %v is above the maximum contract price %v of the allowance", hes.ContractPrice, a.MaxContractPrice)
+	}
+	if a.MinCollateralRatio > 0 && hes.Collateral.Cmp(hes.StoragePrice.MulFloat(a.MinCollateralRatio)) < 0 {
+		return fmt.Errorf("collateral %v is below the minimum collateral ratio %v of the allowance", hes.Collateral, a.MinCollateralRatio)
+	}
+	return nil
+}
+
+// DefaultExpectedRedundancy is the redundancy that is assumed if the expected
+// usage of an allowance doesn't specify a redundancy.
+const DefaultExpectedRedundancy = 3.0
+
+// ExpectedUsagePerHost returns the amount of data that each host of the
+// allowance is expected to store, and the amount of data that is expected to be
+// uploaded to and downloaded from each host per period. All values are zero if
+// the expected usage of the allowance is unknown.
+func (a Allowance) ExpectedUsagePerHost() (storage, upload, download uint64) {
+	if a.ExpectedStorage == 0 || a.Hosts == 0 {
+		return 0, 0, 0
+	}
+	redundancy := a.ExpectedRedundancy
+	if redundancy == 0 {
+		redundancy = DefaultExpectedRedundancy
+	}
+	storage = uint64(float64(a.ExpectedStorage) * redundancy / float64(a.Hosts))
+	upload = uint64(float64(a.ExpectedUpload) * redundancy / float64(a.Hosts))
+	download = a.ExpectedDownload / a.Hosts
+	return
 }
 
 // ContractUtility contains metrics internal to the contractor that reflect the
@@ -78,11 +179,12 @@ type ContractUtility struct {
 // DownloadInfo provides information about a file that has been requested for
 // download.
 type DownloadInfo struct {
-	Destination     string `json:"destination"`     // The destination of the download.
-	DestinationType string `json:"destinationtype"` // Can be "file", "memory buffer", or "http stream".
-	Length          uint64 `json:"length"`          // The length requested for the download.
-	Offset          uint64 `json:"offset"`          // The offset within the siafile requested for the download.
-	SiaPath         string `json:"siapath"`         // The siapath of the file used for the download.
+	ID              DownloadID `json:"id"`              // The unique identifier of the download.
+	Destination     string     `json:"destination"`     // The destination of the download.
+	DestinationType string     `json:"destinationtype"` // Can be "file", "memory buffer", or "http stream".
+	Length          uint64     `json:"length"`          // The length requested for the download.
+	Offset          uint64     `json:"offset"`          // The offset within the siafile requested for the download.
+	SiaPath         string     `json:"siapath"`         // The siapath of the file used for the download.
 
 	Completed            bool      `json:"completed"`            // Whether or not the download has completed.
 	EndTime              time.Time `json:"endtime"`              // The time when the download fully completed.
@@ -91,6 +193,23 @@ type DownloadInfo struct {
 	StartTime            time.Time `json:"starttime"`            // The time when the download was started.
 	StartTimeUnix        int64     `json:"starttimeunix"`        // The time when the download was started in unix format.
 	TotalDataTransferred uint64    `json:"totaldatatransferred"` // Total amount of data transferred, including negotiation, etc.
+
+	Paused   bool   `json:"paused"`   // Whether or not the download is paused.
+	Priority uint64 `json:"priority"` // Downloads with a higher priority are processed first.
+}
+
+// DownloadID is a unique identifier for a download.
+type DownloadID string
+
+// DirectoryInfo provides information about a renter directory.
+type DirectoryInfo struct {
+	SiaPath           string    `json:"siapath"`
+	AggregateNumFiles uint64    `json:"aggregatenumfiles"`
+	AggregateSize     uint64    `json:"aggregatesize"`
+	Health            float64   `json:"health"`
+	LastUpdate        time.Time `json:"lastupdate"`
+	NumFiles          uint64    `json:"numfiles"`
+	NumSubDirs        uint64    `json:"numsubdirs"`
 }
 
 // FileUploadParams contains the information used by the Renter to upload a
@@ -99,6 +218,18 @@ type FileUploadParams struct {
 	Source      string
 	SiaPath     string
 	ErasureCode ErasureCoder
+	CipherType  crypto.CipherType
+
+	// Pack indicates that a file which is smaller than a chunk should be
+	// packed together with other small files into a shared chunk, instead of
+	// occupying a chunk of its own.
+	Pack bool
+
+	// Dedup indicates that the chunks of the file should be deduplicated
+	// against identical chunks of other deduplicated files, reusing their
+	// pieces instead of uploading them again. The pieces of deduplicated
+	// chunks are encrypted with keys derived from the chunk's content.
+	Dedup bool
 }
 
 // FileInfo provides information about a file.
@@ -112,6 +243,34 @@ type FileInfo struct {
 	UploadedBytes  uint64            `json:"uploadedbytes"`
 	UploadProgress float64           `json:"uploadprogress"`
 	Expiration     types.BlockHeight `json:"expiration"`
+
+	// OnDisk indicates whether the local copy of the file is available and
+	// unchanged. If it isn't, the file can only be repaired from the network
+	// and Recoverable indicates whether that is still possible.
+	OnDisk      bool `json:"ondisk"`
+	Recoverable bool `json:"recoverable"`
+
+	// RemoteRepairChunks is the number of chunks that are currently being
+	// repaired by downloading them from the network.
+	RemoteRepairChunks uint64 `json:"remoterepairchunks"`
+
+	// Health is the health of the least healthy chunk of the file. A health
+	// of 0 means full redundancy, 1 means that only the minimum number of
+	// pieces is left and a health above 1 means that the file can't be
+	// recovered from the network. NumStuckChunks is the number of chunks
+	// whose repair keeps failing.
+	Health         float64 `json:"health"`
+	NumStuckChunks uint64  `json:"numstuckchunks"`
+}
+
+// ChunkInfo provides information about the health and repair status of a
+// single chunk of a file.
+type ChunkInfo struct {
+	Index          uint64  `json:"index"`
+	Health         float64 `json:"health"`
+	RepairFailures uint64  `json:"repairfailures"`
+	Stuck          bool    `json:"stuck"`
+	LastError      string  `json:"lasterror"`
 }
 
 // A HostDBEntry represents one host entry in the Renter's host DB. It
@@ -139,6 +298,81 @@ type HostDBEntry struct {
 	// The public key of the host, stored separately to minimize risk of certain
 	// MitM based vulnerabilities.
 	PublicKey types.SiaPublicKey `json:"publickey"`
+
+	// Filtered indicates whether the host is excluded by the filter of the
+	// hostdb.
+	Filtered bool `json:"filtered"`
+
+	// IPNets contains the subnets of the addresses that the NetAddress of the
+	// host resolved to during the most recent scan. LastIPNetChange is the
+	// time at which the subnets of the host last changed.
+	IPNets          []string  `json:"ipnets"`
+	LastIPNetChange time.Time `json:"lastipnetchange"`
+
+	// Latency is the rolling average of the time it took the host to respond
+	// to the settings requests of recent scans. UploadThroughput and
+	// DownloadThroughput are the rolling averages of the throughput in bytes
+	// per second that the renter observed when transferring sectors to and
+	// from the host. A value of zero means that nothing was measured yet.
+	Latency            time.Duration `json:"latency"`
+	UploadThroughput   float64       `json:"uploadthroughput"`
+	DownloadThroughput float64       `json:"downloadthroughput"`
+
+	// SuccessfulStorageProofs and FailedStorageProofs count the expired
+	// contracts of the host that required a storage proof, depending on
+	// whether the host submitted the proof or missed it.
+	SuccessfulStorageProofs uint64 `json:"successfulstorageproofs"`
+	FailedStorageProofs     uint64 `json:"failedstorageproofs"`
+}
+
+// FilterMode is the mode of the hostdb filter. Depending on the mode, the
+// hosts of the filter are either excluded from forming contracts, or they are
+// the only hosts that contracts are formed with.
+type FilterMode int
+
+const (
+	// HostDBFilterNone disables the filter of the hostdb.
+	HostDBFilterNone FilterMode = iota
+
+	// HostDBFilterBlacklist excludes the hosts of the filter.
+	HostDBFilterBlacklist
+
+	// HostDBFilterWhitelist excludes all hosts except the hosts of the
+	// filter.
+	HostDBFilterWhitelist
+)
+
+// ErrInvalidFilterMode is returned if an unknown filter mode is used.
+var ErrInvalidFilterMode = errors.New("invalid filter mode, must be one of 'none', 'blacklist' or 'whitelist'")
+
+// String returns the string representation of the filter mode.
+func (fm FilterMode) String() string {
+	switch fm {
+	case HostDBFilterNone:
+		return "none"
+	case HostDBFilterBlacklist:
+		return "blacklist"
+	case HostDBFilterWhitelist:
+		return "whitelist"
+	default:
+		return "unknown"
+	}
+}
+
+// FromString assigns the filter mode with the given string representation to
+// fm.
+func (fm *FilterMode) FromString(s string) error {
+	switch s {
+	case "none":
+		*fm = HostDBFilterNone
+	case "blacklist":
+		*fm = HostDBFilterBlacklist
+	case "whitelist":
+		*fm = HostDBFilterWhitelist
+	default:
+		return ErrInvalidFilterMode
+	}
+	return nil
 }
 
 // HostDBScan represents a single scan event.
@@ -162,10 +396,44 @@ type HostScoreBreakdown struct {
 	BurnAdjustment             float64 `json:"burnadjustment"`
 	CollateralAdjustment       float64 `json:"collateraladjustment"`
 	InteractionAdjustment      float64 `json:"interactionadjustment"`
+	PerformanceAdjustment      float64 `json:"performanceadjustment"`
 	PriceAdjustment            float64 `json:"pricesmultiplier"`
+	StorageProofAdjustment     float64 `json:"storageproofadjustment"`
 	StorageRemainingAdjustment float64 `json:"storageremainingadjustment"`
 	UptimeAdjustment           float64 `json:"uptimeadjustment"`
 	VersionAdjustment          float64 `json:"versionadjustment"`
+
+	// CutoffReason explains which cutoff of the scoring profile the host
+	// doesn't meet. It is empty if the host meets all cutoffs.
+	CutoffReason string `json:"cutoffreason"`
+}
+
+// HostScoringProfile allows the user to tune how the hostdb scores hosts. Each
+// adjustment of a host's score is raised to the power of its weight. A weight
+// of 1 keeps the default behavior, a weight of 2 squares the adjustment and a
+// weight of 0 disables the adjustment completely. Hosts that don't meet one
+// of the cutoffs receive the lowest possible score, and the renter doesn't
+// form or renew contracts with them.
+type HostScoringProfile struct {
+	AgeWeight              float64 `json:"ageweight"`
+	CollateralWeight       float64 `json:"collateralweight"`
+	InteractionWeight      float64 `json:"interactionweight"`
+	PerformanceWeight      float64 `json:"performanceweight"`
+	PriceWeight            float64 `json:"priceweight"`
+	StorageProofWeight     float64 `json:"storageproofweight"`
+	StorageRemainingWeight float64 `json:"storageremainingweight"`
+	UptimeWeight           float64 `json:"uptimeweight"`
+	VersionWeight          float64 `json:"versionweight"`
+
+	// MaxStoragePrice is the highest storage price in hastings per byte per
+	// block that a host may charge. A value of zero disables the cutoff. The
+	// MaxStoragePrice of the allowance is enforced as well, so the lower of
+	// the two non-zero values applies.
+	MaxStoragePrice types.Currency `json:"maxstorageprice"`
+
+	// MinUptime is the lowest ratio of uptime to total measured time that a
+	// host may have. A value of zero disables the cutoff.
+	MinUptime float64 `json:"minuptime"`
 }
 
 // RenterPriceEstimation contains a bunch of files estimating the costs of
@@ -193,6 +461,21 @@ type RenterSettings struct {
 	StreamCacheSize  uint64    `json:"streamcachesize"`
 }
 
+// DefaultHostScoringProfile is the scoring profile that is used by the hostdb
+// unless the user sets a different one. It applies every adjustment with its
+// default weight and has no cutoffs.
+var DefaultHostScoringProfile = HostScoringProfile{
+	AgeWeight:              1,
+	CollateralWeight:       1,
+	InteractionWeight:      1,
+	PerformanceWeight:      1,
+	PriceWeight:            1,
+	StorageProofWeight:     1,
+	StorageRemainingWeight: 1,
+	UptimeWeight:           1,
+	VersionWeight:          1,
+}
+
 // HostDBScans represents a sortable slice of scans.
 type HostDBScans []HostDBScan
 
@@ -338,6 +621,36 @@ type Renter interface {
 	// ContractUtility provides the contract utility for a given host key.
 	ContractUtility(pk types.SiaPublicKey) (ContractUtility, bool)
 
+	// ContractUtilityReason returns the reason why a contract is not good
+	// for upload or renew. An empty string is returned if the contract is in
+	// good standing.
+	ContractUtilityReason(id types.FileContractID) string
+
+	// FormContract forms a contract with the specified host, bypassing the
+	// host selection of the contract maintenance. If funds is zero, a default
+	// funding based on the allowance is used. If endHeight is zero, the
+	// contract ends with the current period.
+	FormContract(hostKey types.SiaPublicKey, funds types.Currency, endHeight types.BlockHeight) (RenterContract, error)
+
+	// RenewContract renews the specified contract without waiting for the
+	// renew window. If funds is zero, the funding is estimated from the usage
+	// of the contract.
+	RenewContract(id types.FileContractID, funds types.Currency) (RenterContract, error)
+
+	// CancelContract cancels the specified contract. The contract is moved to
+	// the old contracts and its host is not used for new contracts, unless a
+	// contract is formed with it manually.
+	CancelContract(id types.FileContractID) error
+
+	// InitRecoveryScan starts scanning the blockchain for contracts that
+	// were formed with keys derived from the wallet seed. The contracts are
+	// recovered from their hosts once the scan is complete.
+	InitRecoveryScan() error
+
+	// RecoveryScanStatus returns whether a recovery scan is in progress and
+	// the height of the blockchain it has reached.
+	RecoveryScanStatus() (bool, types.BlockHeight)
+
 	// CurrentPeriod returns the height at which the current allowance period
 	// began.
 	CurrentPeriod() types.BlockHeight
@@ -346,16 +659,43 @@ type Renter interface {
 	// billing period.
 	PeriodSpending() ContractorSpending
 
+	// CreateDir creates a new directory for the renter.
+	CreateDir(siaPath string) error
+
+	// DeleteDir deletes a directory and all of the files and directories
+	// within it.
+	DeleteDir(siaPath string) error
+
 	// DeleteFile deletes a file entry from the renter.
 	DeleteFile(path string) error
 
+	// DirList lists the directories and the files located directly within the
+	// directory at siaPath. The first DirectoryInfo belongs to the directory
+	// itself.
+	DirList(siaPath string) ([]DirectoryInfo, []FileInfo, error)
+
 	// Download performs a download according to the parameters passed, including
 	// downloads of `offset` and `length` type.
 	Download(params RenterDownloadParameters) error
 
 	// Download performs a download according to the parameters passed without
-	// blocking, including downloads of `offset` and `length` type.
-	DownloadAsync(params RenterDownloadParameters) error
+	// blocking, including downloads of `offset` and `length` type. The ID of
+	// the download is returned.
+	DownloadAsync(params RenterDownloadParameters) (DownloadID, error)
+
+	// CancelDownload cancels an ongoing download and releases its resources.
+	CancelDownload(id DownloadID) error
+
+	// PauseDownload stops an ongoing download from fetching any further
+	// chunks until it is resumed.
+	PauseDownload(id DownloadID) error
+
+	// ResumeDownload resumes a paused download.
+	ResumeDownload(id DownloadID) error
+
+	// SetDownloadPriority changes the priority of an ongoing download.
+	// Downloads with a higher priority are processed first.
+	SetDownloadPriority(id DownloadID, priority uint64) error
 
 	// ClearDownloadHistory clears the download history of the renter
 	// inclusive for before and after times.
@@ -370,6 +710,15 @@ type Renter interface {
 	// FileList returns information on all of the files stored by the renter.
 	FileList() []FileInfo
 
+	// Filter returns the filter mode of the hostdb and the hosts of the
+	// filter.
+	Filter() (FilterMode, []types.SiaPublicKey)
+
+	// SetFilterMode sets the filter mode of the hostdb. Contracts with hosts
+	// that are excluded by the filter are no longer used for uploads and
+	// will not be renewed.
+	SetFilterMode(fm FilterMode, hosts []types.SiaPublicKey) error
+
 	// Host provides the DB entry and score breakdown for the requested host.
 	Host(pk types.SiaPublicKey) (HostDBEntry, bool)
 
@@ -389,6 +738,9 @@ type Renter interface {
 	// storage and data operations.
 	PriceEstimation() RenterPriceEstimation
 
+	// RenameDir changes the path of a directory and every file within it.
+	RenameDir(siaPath, newSiaPath string) error
+
 	// RenameFile changes the path of a file.
 	RenameFile(path, newPath string) error
 
@@ -400,12 +752,24 @@ type Renter interface {
 	// hostdb's weighting algorithm.
 	ScoreBreakdown(entry HostDBEntry) HostScoreBreakdown
 
+	// ScoringProfile returns the scoring profile of the hostdb.
+	ScoringProfile() HostScoringProfile
+
+	// SetScoringProfile sets the scoring profile of the hostdb. The scores of
+	// all hosts are updated immediately.
+	SetScoringProfile(sp HostScoringProfile) error
+
 	// Settings returns the Renter's current settings.
 	Settings() RenterSettings
 
 	// SetSettings sets the Renter's settings.
 	SetSettings(RenterSettings) error
 
+	// SetFileRedundancy changes the erasure code of an uploaded file. The
+	// file is re-encoded in the background and keeps its current redundancy
+	// until the re-encoding is complete.
+	SetFileRedundancy(path string, ec ErasureCoder) error
+
 	// ShareFiles creates a '.sia' file that can be shared with others.
 	ShareFiles(paths []string, shareDest string) error
 
@@ -417,8 +781,17 @@ type Renter interface {
 	// resource.
 	Streamer(siaPath string) (string, io.ReadSeeker, error)
 
+	// FileChunks returns the health and repair status of every chunk of the
+	// file at siaPath.
+	FileChunks(siaPath string) ([]ChunkInfo, error)
+
 	// Upload uploads a file using the input parameters.
 	Upload(FileUploadParams) error
+
+	// UploadStreamFromReader reads from the provided reader until io.EOF is
+	// reached and uploads the data to the Sia network. The Source of the
+	// upload parameters is ignored.
+	UploadStreamFromReader(up FileUploadParams, reader io.Reader) error
 }
 
 // RenterDownloadParameters defines the parameters passed to the Renter's
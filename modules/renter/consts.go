@@ -5,7 +5,6 @@ import (
 
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/crypto"
-	"gitlab.com/NebulousLabs/Sia/modules"
 )
 
 var (
@@ -48,8 +47,9 @@ var (
 		panic("undefined defaultParityPieces")
 	}()
 
-	// Erasure-coded piece size
-	pieceSize = modules.SectorSize - crypto.TwofishOverhead
+	// defaultCipherType is the cipher used to encrypt the pieces of a file if
+	// the upload doesn't specify one.
+	defaultCipherType = crypto.TypeTwofish
 )
 
 const (
@@ -61,6 +61,21 @@ const (
 	// permissions are supplied.
 	defaultFilePerm = 0666
 
+	// stuckChunkThreshold is the number of consecutive failed repair attempts
+	// after which a chunk is marked as stuck.
+	stuckChunkThreshold = 3
+
+	// unhealthyFileThreshold is the health above which the renter logs a
+	// warning about a file, before the file drops below its minimum number
+	// of pieces at a health of 1.
+	unhealthyFileThreshold = 0.75
+
+	// maxUploadBatchPieces is the maximum number of pieces that a worker
+	// uploads to its host in a single batch. Batches that exceed the host's
+	// MaxReviseBatchSize are split into multiple revisions; the default
+	// MaxReviseBatchSize fits four sectors into one revision.
+	maxUploadBatchPieces = 4
+
 	// downloadFailureCooldown defines how long to wait for a worker after a
 	// worker has experienced a download failure.
 	downloadFailureCooldown = time.Second * 3
@@ -115,6 +130,16 @@ var (
 		Testing:  5,
 	}).(int)
 
+	// streamReadAheadSize is the maximum number of bytes of a data piece that
+	// the streamer downloads at once for files whose erasure code can recover
+	// ranges from data pieces. Subsequent reads within those bytes are served
+	// from memory.
+	streamReadAheadSize = build.Select(build.Var{
+		Dev:      uint64(1 << 18), // 256 KiB
+		Standard: uint64(1 << 20), // 1 MiB
+		Testing:  uint64(1 << 10), // 1 KiB
+	}).(uint64)
+
 	// offlineCheckFrequency is how long the renter will wait to check the
 	// online status if it is offline.
 	offlineCheckFrequency = build.Select(build.Var{
@@ -123,6 +148,14 @@ var (
 		Testing:  250 * time.Millisecond,
 	}).(time.Duration)
 
+	// packFlushInterval is the amount of time that small files are buffered
+	// in an open pack before the pack is uploaded, even if it isn't full yet.
+	packFlushInterval = build.Select(build.Var{
+		Dev:      30 * time.Second,
+		Standard: 5 * time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+
 	// rebuildChunkHeapInterval defines how long the renter sleeps between
 	// checking on the filesystem health.
 	rebuildChunkHeapInterval = build.Select(build.Var{
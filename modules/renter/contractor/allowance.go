@@ -2,14 +2,17 @@ package contractor
 
 import (
 	"errors"
+	"math"
 	"reflect"
 
 	"gitlab.com/NebulousLabs/Sia/modules"
 )
 
 var (
+	errAllowanceCollateral = errors.New("minimum collateral ratio must not be negative")
 	errAllowanceNoHosts    = errors.New("hosts must be non-zero")
 	errAllowanceNotSynced  = errors.New("you must be synced to set an allowance")
+	errAllowanceRedundancy = errors.New("expected redundancy must be at least 1")
 	errAllowanceWindowSize = errors.New("renew window must be less than period")
 	errAllowanceZeroPeriod = errors.New("period must be non-zero")
 
@@ -56,6 +59,10 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 		return ErrAllowanceZeroWindow
 	} else if a.RenewWindow >= a.Period {
 		return errAllowanceWindowSize
+	} else if a.ExpectedRedundancy != 0 && !(a.ExpectedRedundancy >= 1) {
+		return errAllowanceRedundancy
+	} else if !(a.MinCollateralRatio >= 0) || math.IsInf(a.MinCollateralRatio, 0) {
+		return errAllowanceCollateral
 	} else if !c.cs.Synced() {
 		return errAllowanceNotSynced
 	}
@@ -108,8 +115,8 @@ func (c *Contractor) managedCancelAllowance() error {
 	ids := c.staticContracts.IDs()
 	c.mu.Lock()
 	for _, id := range ids {
-		// we aren't renewing, but we don't want new editors or downloaders to
-		// be created
+		// we aren't renewing, but we don't want new editors, downloaders or
+		// sessions to be created
 		c.renewing[id] = true
 	}
 	c.mu.Unlock()
@@ -123,10 +130,14 @@ func (c *Contractor) managedCancelAllowance() error {
 	for _, id := range ids {
 		c.mu.RLock()
 		e, eok := c.editors[id]
+		hs, sok := c.sessions[id]
 		c.mu.RUnlock()
 		if eok {
 			e.invalidate()
 		}
+		if sok {
+			hs.invalidate()
+		}
 	}
 
 	// Clear out the allowance and save.
@@ -34,7 +34,8 @@ type (
 // managedEstimateRenewFundingRequirements estimates the amount of money that a
 // contract is going to need in the next billing cycle by looking at how much
 // storage is in the contract and what the historic usage pattern of the
-// contract has been.
+// contract has been. If the expected usage of the allowance is known, it is
+// used instead of the historic usage pattern.
 func (c *Contractor) managedEstimateRenewFundingRequirements(contract modules.RenterContract, blockHeight types.BlockHeight, allowance modules.Allowance) (types.Currency, error) {
 	// Fetch the host pricing to use in the estimate.
 	host, exists := c.hdb.Host(contract.HostPublicKey)
@@ -71,9 +72,9 @@ func (c *Contractor) managedEstimateRenewFundingRequirements(contract modules.Re
 			break
 		}
 
-		// If the contract did not start in the current period, then it is not
+		// If the contract was not used in the current period, then it is not
 		// relevant, and none of the previous contracts will be relevant either.
-		if currentContract.StartHeight < c.currentPeriod {
+		if !c.usedInCurrentPeriod(currentContract) {
 			break
 		}
 
@@ -99,6 +100,18 @@ func (c *Contractor) managedEstimateRenewFundingRequirements(contract modules.Re
 	// Estimate the amount of money that's going to be spent on downloads.
 	newDownloadsCost := prevDownloadSpending
 
+	// If the expected usage of the allowance is known, use it instead of the
+	// historic usage. The expected storage already includes new uploads, and
+	// the contract is never funded for less than the data it already stores.
+	expectedStorage, expectedUpload, expectedDownload := allowance.ExpectedUsagePerHost()
+	if expectedStorage > 0 {
+		if expectedStorage > dataStored {
+			maintenanceCost = types.NewCurrency64(expectedStorage).Mul64(uint64(allowance.Period)).Mul(host.StoragePrice)
+		}
+		newUploadsCost = host.UploadBandwidthPrice.Mul64(expectedUpload)
+		newDownloadsCost = host.DownloadBandwidthPrice.Mul64(expectedDownload)
+	}
+
 	// We will also need to pay the host contract price.
 	contractPrice := host.ContractPrice
 
@@ -130,6 +143,36 @@ func (c *Contractor) managedEstimateRenewFundingRequirements(contract modules.Re
 	return estimatedCost, nil
 }
 
+// managedInitialContractFunds returns the amount of money that goes into a new
+// contract with the host. If the expected usage of the allowance is known, the
+// contract is funded for one period of that usage, but never with less than
+// 'fileContractMinimumFunding' or more than all of the funds per host.
+// Otherwise the contract receives a third of the funds per host.
+func (c *Contractor) managedInitialContractFunds(host modules.HostDBEntry, allowance modules.Allowance, blockHeight types.BlockHeight) types.Currency {
+	fundsPerHost := allowance.Funds.Div64(allowance.Hosts)
+	storage, upload, download := allowance.ExpectedUsagePerHost()
+	if storage == 0 {
+		return fundsPerHost.Div64(3)
+	}
+
+	// Estimate the cost of the expected usage, including the contract price,
+	// the siafund fee and the transaction fees.
+	cost := host.StoragePrice.Mul64(storage).Mul64(uint64(allowance.Period))
+	cost = cost.Add(host.UploadBandwidthPrice.Mul64(upload))
+	cost = cost.Add(host.DownloadBandwidthPrice.Mul64(download))
+	cost = cost.Add(host.ContractPrice)
+	cost = cost.Add(types.Tax(blockHeight, cost))
+	_, maxTxnFee := c.tpool.FeeEstimation()
+	cost = cost.Add(maxTxnFee.Mul64(modules.EstimatedFileContractTransactionSetSize))
+
+	if minimum := fundsPerHost.MulFloat(fileContractMinimumFunding); cost.Cmp(minimum) < 0 {
+		return minimum
+	} else if cost.Cmp(fundsPerHost) > 0 {
+		return fundsPerHost
+	}
+	return cost
+}
+
 // managedInterruptContractMaintenance will issue an interrupt signal to any
 // running maintenance, stopping that maintenance. If there are multiple threads
 // running maintenance, they will all be stopped.
@@ -166,29 +209,62 @@ func (c *Contractor) managedMarkContractsUtility() error {
 	c.mu.RLock()
 	hostCount := int(c.allowance.Hosts)
 	c.mu.RUnlock()
-	hosts, err := c.hdb.RandomHosts(hostCount+randomHostsBufferForScore, nil)
+	hosts, err := c.hdb.RandomHosts(hostCount+randomHostsBufferForScore, nil, nil)
 	if err != nil {
 		return err
 	}
 
 	// Find the minimum score that a host is allowed to have to be considered
-	// good for upload.
+	// good for upload. Hosts that don't meet the cutoffs of the scoring
+	// profile of the hostdb are ignored.
 	var minScore types.Currency
-	if len(hosts) > 0 {
-		lowestScore := c.hdb.ScoreBreakdown(hosts[0]).Score
-		for i := 1; i < len(hosts); i++ {
-			score := c.hdb.ScoreBreakdown(hosts[i]).Score
-			if score.Cmp(lowestScore) < 0 {
-				lowestScore = score
-			}
+	var lowestScore types.Currency
+	for _, host := range hosts {
+		sb := c.hdb.ScoreBreakdown(host)
+		if sb.CutoffReason != "" {
+			continue
+		}
+		if lowestScore.IsZero() || sb.Score.Cmp(lowestScore) < 0 {
+			lowestScore = sb.Score
 		}
+	}
+	if !lowestScore.IsZero() {
 		// Set the minimum acceptable score to a factor of the lowest score.
 		minScore = lowestScore.Div(scoreLeeway)
 	}
 
+	// Find the contracts whose hosts share a subnet with the host of another
+	// contract. Only the host that has been using its subnet for the longest
+	// time is kept.
+	contracts := c.staticContracts.ViewAll()
+	hostKeys := make([]types.SiaPublicKey, 0, len(contracts))
+	for _, contract := range contracts {
+		hostKeys = append(hostKeys, contract.HostPublicKey)
+	}
+	ipViolations := make(map[string]struct{})
+	for _, pk := range c.hdb.CheckForIPViolations(hostKeys) {
+		ipViolations[pk.String()] = struct{}{}
+	}
+
+	// Hosts of manually formed contracts are not dropped because of their
+	// score.
+	c.mu.RLock()
+	manualHosts := make(map[string]struct{}, len(c.manualHosts))
+	for pk := range c.manualHosts {
+		manualHosts[pk] = struct{}{}
+	}
+	allowance := c.allowance
+	blockHeight := c.blockHeight
+	c.mu.RUnlock()
+
+	// Remember why contracts are not good for upload or renew, so that the
+	// reason can be reported to the user.
+	utilityReasons := make(map[types.FileContractID]string)
+
 	// Update utility fields for each contract.
-	for _, contract := range c.staticContracts.ViewAll() {
-		utility := func() (u modules.ContractUtility) {
+	for _, contract := range contracts {
+		_, manual := manualHosts[contract.HostPublicKey.String()]
+		utility, reason := func() (u modules.ContractUtility, reason string) {
 			// Start the contract in good standing if the utility wasn't
 			// locked.
 			if !u.Locked {
@@ -201,31 +277,56 @@ func (c *Contractor) managedMarkContractsUtility() error {
 			if !exists {
 				u.GoodForUpload = false
 				u.GoodForRenew = false
-				return
+				return u, "host is not in the hostdb"
+			}
+			// Contract has no utility if the host is excluded by the filter
+			// of the hostdb.
+			if host.Filtered {
+				u.GoodForUpload = false
+				u.GoodForRenew = false
+				return u, "host is excluded by the filter of the hostdb"
+			}
+			// Contract has no utility if the host raised its prices above the
+			// maximum prices of the allowance. This applies to the hosts of
+			// manually formed contracts as well.
+			if err := allowance.CheckPriceGouging(host.HostExternalSettings); err != nil {
+				u.GoodForUpload = false
+				u.GoodForRenew = false
+				return u, "price gouging: " + err.Error()
+			}
+			// Contract has no utility if the host doesn't meet the cutoffs of
+			// the scoring profile.
+			sb := c.hdb.ScoreBreakdown(host)
+			if sb.CutoffReason != "" && !manual {
+				u.GoodForUpload = false
+				u.GoodForRenew = false
+				return u, sb.CutoffReason
 			}
 			// Contract has no utility if the score is poor.
-			if !minScore.IsZero() && c.hdb.ScoreBreakdown(host).Score.Cmp(minScore) < 0 {
+			if !minScore.IsZero() && sb.Score.Cmp(minScore) < 0 && !manual {
 				u.GoodForUpload = false
 				u.GoodForRenew = false
-				return
+				return u, "host score is too low"
 			}
 			// Contract has no utility if the host is offline.
 			if isOffline(host) {
 				u.GoodForUpload = false
 				u.GoodForRenew = false
-				return
+				return u, "host is offline"
 			}
 			// Contract should not be used for uploading if the time has come to
 			// renew the contract.
-			c.mu.RLock()
-			blockHeight := c.blockHeight
-			renewWindow := c.allowance.RenewWindow
-			c.mu.RUnlock()
-			if blockHeight+renewWindow >= contract.EndHeight {
+			if blockHeight+allowance.RenewWindow >= contract.EndHeight {
 				u.GoodForUpload = false
-				return
+				return u, "contract is up for renewal"
 			}
-			return
+			// Contract should not be used for uploading if its host shares a
+			// subnet with the host of another contract.
+			if _, violation := ipViolations[contract.HostPublicKey.String()]; violation && !manual {
+				u.GoodForUpload = false
+				return u, "host shares a subnet with the host of another contract"
+			}
+			return u, ""
 		}()
 
 		// Apply changes.
@@ -233,7 +334,13 @@ func (c *Contractor) managedMarkContractsUtility() error {
 		if err != nil {
 			return err
 		}
+		if reason != "" {
+			utilityReasons[contract.ID] = reason
+		}
 	}
+	c.mu.Lock()
+	c.utilityReasons = utilityReasons
+	c.mu.Unlock()
 	return nil
 }
 
@@ -255,6 +362,12 @@ func (c *Contractor) managedNewContract(host modules.HostDBEntry, contractFundin
 		return types.ZeroCurrency, modules.RenterContract{}, err
 	}
 
+	// derive the renter seed, which makes the contract recoverable
+	renterSeed, err := c.managedRenterSeed()
+	if err != nil {
+		return types.ZeroCurrency, modules.RenterContract{}, err
+	}
+
 	// create contract params
 	c.mu.RLock()
 	params := proto.ContractParams{
@@ -263,6 +376,8 @@ func (c *Contractor) managedNewContract(host modules.HostDBEntry, contractFundin
 		StartHeight:   c.blockHeight,
 		EndHeight:     endHeight,
 		RefundAddress: uc.UnlockHash(),
+		RenterSeed:    renterSeed,
+		Allowance:     c.allowance,
 	}
 	c.mu.RUnlock()
 
@@ -345,6 +460,12 @@ func (c *Contractor) managedRenew(sc *proto.SafeContract, contractFunding types.
 		return modules.RenterContract{}, err
 	}
 
+	// derive the renter seed, which makes the contract recoverable
+	renterSeed, err := c.managedRenterSeed()
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+
 	// create contract params
 	c.mu.RLock()
 	params := proto.ContractParams{
@@ -353,6 +474,8 @@ func (c *Contractor) managedRenew(sc *proto.SafeContract, contractFunding types.
 		StartHeight:   c.blockHeight,
 		EndHeight:     newEndHeight,
 		RefundAddress: uc.UnlockHash(),
+		RenterSeed:    renterSeed,
+		Allowance:     c.allowance,
 	}
 	c.mu.RUnlock()
 
@@ -396,11 +519,12 @@ func (c *Contractor) managedRenewContract(renewInstructions fileContractRenewal,
 		c.mu.Unlock()
 	}()
 
-	// Wait for any active editors and downloaders to finish for this
+	// Wait for any active editors, downloaders and sessions to finish for this
 	// contract, and then grab the latest revision.
 	c.mu.RLock()
 	e, eok := c.editors[id]
 	d, dok := c.downloaders[id]
+	hs, sok := c.sessions[id]
 	c.mu.RUnlock()
 	if eok {
 		e.invalidate()
@@ -408,6 +532,9 @@ func (c *Contractor) managedRenewContract(renewInstructions fileContractRenewal,
 	if dok {
 		d.invalidate()
 	}
+	if sok {
+		hs.invalidate()
+	}
 
 	// Fetch the contract that we are renewing.
 	oldContract, exists := c.staticContracts.Acquire(id)
@@ -504,6 +631,44 @@ func (c *Contractor) managedRenewContract(renewInstructions fileContractRenewal,
 	return amount, nil
 }
 
+// managedNeedsRefresh returns true if the contract is empty and needs to be
+// refreshed before the end of the period. We define a contract as being empty
+// if less than 'minContractFundRenewalThreshold' funds are remaining (3% at
+// time of writing), or if there is less than 3 sectors worth of
+// storage+upload+download remaining.
+func (c *Contractor) managedNeedsRefresh(contract modules.RenterContract, period types.BlockHeight) bool {
+	host, _ := c.hdb.Host(contract.HostPublicKey)
+	blockBytes := types.NewCurrency64(modules.SectorSize * uint64(period))
+	sectorStoragePrice := host.StoragePrice.Mul(blockBytes)
+	sectorUploadBandwidthPrice := host.UploadBandwidthPrice.Mul64(modules.SectorSize)
+	sectorDownloadBandwidthPrice := host.DownloadBandwidthPrice.Mul64(modules.SectorSize)
+	sectorBandwidthPrice := sectorUploadBandwidthPrice.Add(sectorDownloadBandwidthPrice)
+	sectorPrice := sectorStoragePrice.Add(sectorBandwidthPrice)
+	percentRemaining, _ := big.NewRat(0, 1).SetFrac(contract.RenterFunds.Big(), contract.TotalCost.Big()).Float64()
+	return contract.RenterFunds.Cmp(sectorPrice.Mul64(3)) < 0 || percentRemaining < minContractFundRenewalThreshold
+}
+
+// managedRefreshContract renews a contract that ran out of funds before the
+// end of the period. Unlike a regular renewal, the new contract keeps the end
+// height of the old contract and only receives more funds, so that it is
+// renewed together with the other contracts at the end of the period. The
+// data of the old contract is moved to the new contract and the old contract
+// is archived the same way as a renewed contract, so the spending of both
+// contracts is reported for the current period and the contract ids in the
+// renter's files still resolve to the host.
+func (c *Contractor) managedRefreshContract(refresh fileContractRenewal, currentPeriod types.BlockHeight, allowance modules.Allowance, blockHeight types.BlockHeight) (types.Currency, error) {
+	contract, exists := c.staticContracts.View(refresh.id)
+	if !exists {
+		return types.ZeroCurrency, errors.New("contract no longer exists")
+	}
+	fundsSpent, err := c.managedRenewContract(refresh, currentPeriod, allowance, blockHeight, contract.EndHeight)
+	if err != nil {
+		return fundsSpent, err
+	}
+	c.log.Printf("Refreshed contract %v with %v\n", refresh.id, refresh.amount.HumanString())
+	return fundsSpent, nil
+}
+
 // threadedContractMaintenance checks the set of contracts that the contractor
 // has against the allownace, renewing any contracts that need to be renewed,
 // dropping contracts which are no longer worthwhile, and adding contracts if
@@ -543,7 +708,26 @@ func (c *Contractor) threadedContractMaintenance() {
 	} else if !c.maintenanceLock.TryLock() {
 		return
 	}
-	defer c.maintenanceLock.Unlock()
+	defer func() {
+		c.maintenanceLock.Unlock()
+		// Start another round if maintenance was triggered while this round
+		// was running.
+		select {
+		case <-c.maintenanceTriggered:
+			go c.threadedContractMaintenance()
+		default:
+		}
+	}()
+
+	// This round covers all triggers up to this point.
+	select {
+	case <-c.maintenanceTriggered:
+	default:
+	}
+
+	// Recover the contracts that were found by a recovery scan before deciding
+	// which contracts to form.
+	c.managedRecoverContracts()
 
 	// Update the utility fields for this contract based on the most recent
 	// hostdb.
@@ -602,20 +786,10 @@ func (c *Contractor) threadedContractMaintenance() {
 			continue
 		}
 
-		// Check if the contract is empty. We define a contract as being empty
-		// if less than 'minContractFundRenewalThreshold' funds are remaining
-		// (3% at time of writing), or if there is less than 3 sectors worth of
-		// storage+upload+download remaining.
-		host, _ := c.hdb.Host(contract.HostPublicKey)
-		blockBytes := types.NewCurrency64(modules.SectorSize * uint64(allowance.Period))
-		sectorStoragePrice := host.StoragePrice.Mul(blockBytes)
-		sectorUploadBandwidthPrice := host.UploadBandwidthPrice.Mul64(modules.SectorSize)
-		sectorDownloadBandwidthPrice := host.DownloadBandwidthPrice.Mul64(modules.SectorSize)
-		sectorBandwidthPrice := sectorUploadBandwidthPrice.Add(sectorDownloadBandwidthPrice)
-		sectorPrice := sectorStoragePrice.Add(sectorBandwidthPrice)
-		percentRemaining, _ := big.NewRat(0, 1).SetFrac(contract.RenterFunds.Big(), contract.TotalCost.Big()).Float64()
-		if contract.RenterFunds.Cmp(sectorPrice.Mul64(3)) < 0 || percentRemaining < minContractFundRenewalThreshold {
-			// Renew the contract with double the amount of funds that the
+		// Check if the contract is empty and needs to be refreshed before the
+		// end of the period.
+		if c.managedNeedsRefresh(contract, allowance.Period) {
+			// Refresh the contract with double the amount of funds that the
 			// contract had previously. The reason that we double the funding
 			// instead of doing anything more clever is that we don't know what
 			// the usage pattern has been. The spending could have all occured
@@ -626,7 +800,7 @@ func (c *Contractor) threadedContractMaintenance() {
 			// quickly without consuming too many transaction fees, however this
 			// does mean that a larger percentage of funds get locked away from
 			// the user in the event that the user stops uploading immediately
-			// after the renew.
+			// after the refresh.
 			refreshSet = append(refreshSet, fileContractRenewal{
 				id:     contract.ID,
 				amount: contract.TotalCost.Mul64(2),
@@ -691,16 +865,16 @@ func (c *Contractor) threadedContractMaintenance() {
 		default:
 		}
 	}
-	for _, renewal := range refreshSet {
-		// Skip this renewal if we don't have enough funds remaining.
-		if renewal.amount.Cmp(fundsRemaining) > 0 {
+	for _, refresh := range refreshSet {
+		// Skip this refresh if we don't have enough funds remaining.
+		if refresh.amount.Cmp(fundsRemaining) > 0 {
 			continue
 		}
 
-		// Renew one contract. The error is ignored because the renew function
-		// already will have logged the error, and in the event of an error,
-		// 'fundsSpent' will return '0'.
-		fundsSpent, _ := c.managedRenewContract(renewal, currentPeriod, allowance, blockHeight, endHeight)
+		// Refresh one contract. The error is ignored because the renew
+		// function already will have logged the error, and in the event of an
+		// error, 'fundsSpent' will return '0'.
+		fundsSpent, _ := c.managedRefreshContract(refresh, currentPeriod, allowance, blockHeight)
 		fundsRemaining = fundsRemaining.Sub(fundsSpent)
 
 		// Return here if an interrupt or kill signal has been sent.
@@ -730,15 +904,22 @@ func (c *Contractor) threadedContractMaintenance() {
 
 	// Assemble an exclusion list that includes all of the hosts that we already
 	// have contracts with, then select a new batch of hosts to attempt contract
-	// formation with.
-	c.mu.RLock()
-	var exclude []types.SiaPublicKey
+	// formation with. Hosts that share a subnet with the host of a contract
+	// that is good for upload are excluded as well, and so are the hosts of
+	// manually canceled contracts.
+	var exclude, addressBlacklist []types.SiaPublicKey
 	for _, contract := range c.staticContracts.ViewAll() {
 		exclude = append(exclude, contract.HostPublicKey)
+		if cu, ok := c.managedContractUtility(contract.ID); ok && cu.GoodForUpload {
+			addressBlacklist = append(addressBlacklist, contract.HostPublicKey)
+		}
+	}
+	c.mu.RLock()
+	for _, pk := range c.canceledHosts {
+		exclude = append(exclude, pk)
 	}
-	initialContractFunds := c.allowance.Funds.Div64(c.allowance.Hosts).Div64(3)
 	c.mu.RUnlock()
-	hosts, err := c.hdb.RandomHosts(neededContracts*2+randomHostsBufferForScore, exclude)
+	hosts, err := c.hdb.RandomHosts(neededContracts*2+randomHostsBufferForScore, exclude, addressBlacklist)
 	if err != nil {
 		c.log.Println("WARN: not forming new contracts:", err)
 		return
@@ -748,11 +929,17 @@ func (c *Contractor) threadedContractMaintenance() {
 	// contracts.
 	for _, host := range hosts {
 		// Determine if we have enough money to form a new contract.
+		initialContractFunds := c.managedInitialContractFunds(host, allowance, blockHeight)
 		if fundsRemaining.Cmp(initialContractFunds) < 0 {
 			c.log.Println("WARN: need to form new contracts, but unable to because of a low allowance")
 			break
 		}
 
+		// Skip hosts that don't meet the cutoffs of the scoring profile.
+		if c.hdb.ScoreBreakdown(host).CutoffReason != "" {
+			continue
+		}
+
 		// Attempt forming a contract with this host.
 		fundsSpent, newContract, err := c.managedNewContract(host, initialContractFunds, endHeight)
 		if err != nil {
@@ -47,8 +47,11 @@ type Contractor struct {
 	wallet     wallet
 
 	// Only one thread should be performing contract maintenance at a time.
+	// maintenanceTriggered holds a pending request for another round of
+	// maintenance, which is run once the current round is finished.
 	interruptMaintenance chan struct{}
 	maintenanceLock      siasync.TryMutex
+	maintenanceTriggered chan struct{}
 
 	allowance     modules.Allowance
 	blockHeight   types.BlockHeight
@@ -62,6 +65,7 @@ type Contractor struct {
 	contractIDToPubKey  map[types.FileContractID]types.SiaPublicKey
 	renewing            map[types.FileContractID]bool // prevent revising during renewal
 	revising            map[types.FileContractID]bool // prevent overlapping revisions
+	sessions            map[types.FileContractID]*hostSession
 
 	// renewedFrom links the new contract's ID to the old contract's ID
 	// renewedTo links the old contract's ID to the new contract's ID
@@ -69,6 +73,25 @@ type Contractor struct {
 	oldContracts    map[types.FileContractID]modules.RenterContract
 	renewedFrom     map[types.FileContractID]types.FileContractID
 	renewedTo       map[types.FileContractID]types.FileContractID
+
+	// canceledHosts contains the hosts of manually canceled contracts, which
+	// are not used for new contracts by the contract maintenance.
+	// manualHosts contains the hosts of manually formed contracts, which are
+	// not dropped by the contract maintenance because of their score.
+	canceledHosts map[string]types.SiaPublicKey
+	manualHosts   map[string]types.SiaPublicKey
+
+	// recoverableContracts contains the contracts that were found by a
+	// recovery scan and have not been recovered yet. The scan fields are only
+	// used while a recovery scan is running.
+	recoverableContracts map[types.FileContractID]proto.RecoverableContract
+	scanInProgress       bool
+	scannedHeight        types.BlockHeight
+
+	// utilityReasons contains the reasons why contracts are not good for
+	// upload or renew. It is updated every time the utility of the contracts
+	// is checked.
+	utilityReasons map[types.FileContractID]string
 }
 
 // Allowance returns the current allowance.
@@ -78,6 +101,26 @@ func (c *Contractor) Allowance() modules.Allowance {
 	return c.allowance
 }
 
+// usedInCurrentPeriod returns true if an old contract was used during the
+// current period. This is the case if it started in the current period, or if
+// it was refreshed in the current period after it ran out of funds. A refresh
+// keeps the end height of the contract, which distinguishes it from a regular
+// renewal at the end of the period.
+func (c *Contractor) usedInCurrentPeriod(contract modules.RenterContract) bool {
+	if contract.StartHeight >= c.currentPeriod {
+		return true
+	}
+	newID, renewed := c.renewedTo[contract.ID]
+	if !renewed {
+		return false
+	}
+	newContract, exists := c.staticContracts.View(newID)
+	if !exists {
+		newContract, exists = c.oldContracts[newID]
+	}
+	return exists && newContract.EndHeight == contract.EndHeight && newContract.StartHeight >= c.currentPeriod
+}
+
 // PeriodSpending returns the amount spent on contracts during the current
 // billing period.
 func (c *Contractor) PeriodSpending() modules.ContractorSpending {
@@ -102,8 +145,9 @@ func (c *Contractor) PeriodSpending() modules.ContractorSpending {
 	// Calculate needed spending to be reported from old contracts
 	for _, contract := range c.oldContracts {
 		host, exist := c.hdb.Host(contract.HostPublicKey)
-		if contract.StartHeight >= c.currentPeriod {
-			// Calculate spending from contracts that were renewed during the current period
+		if c.usedInCurrentPeriod(contract) {
+			// Calculate spending from contracts that were renewed or refreshed
+			// during the current period
 			// Calculate ContractFees
 			spending.ContractFees = spending.ContractFees.Add(contract.ContractFee)
 			spending.ContractFees = spending.ContractFees.Add(contract.TxnFee)
@@ -163,6 +207,18 @@ func (c *Contractor) SetRateLimits(readBPS int64, writeBPS int64, packetSize uin
 	c.staticContracts.SetRateLimits(readBPS, writeBPS, packetSize)
 }
 
+// TriggerContractMaintenance starts a round of contract maintenance without
+// waiting for the next block. It is used to apply changes to the hostdb, such
+// as a new filter mode, to the contracts right away. If maintenance is already
+// running, another round is started once the current round is finished.
+func (c *Contractor) TriggerContractMaintenance() {
+	select {
+	case c.maintenanceTriggered <- struct{}{}:
+	default:
+	}
+	go c.threadedContractMaintenance()
+}
+
 // Close closes the Contractor.
 func (c *Contractor) Close() error {
 	return c.tg.Stop()
@@ -220,6 +276,7 @@ func NewCustomContractor(cs consensusSet, w wallet, tp transactionPool, hdb host
 		wallet:     w,
 
 		interruptMaintenance: make(chan struct{}),
+		maintenanceTriggered: make(chan struct{}, 1),
 
 		staticContracts:     contractSet,
 		downloaders:         make(map[types.FileContractID]*hostDownloader),
@@ -229,8 +286,14 @@ func NewCustomContractor(cs consensusSet, w wallet, tp transactionPool, hdb host
 		pubKeysToContractID: make(map[string]types.FileContractID),
 		renewing:            make(map[types.FileContractID]bool),
 		revising:            make(map[types.FileContractID]bool),
+		sessions:            make(map[types.FileContractID]*hostSession),
 		renewedFrom:         make(map[types.FileContractID]types.FileContractID),
 		renewedTo:           make(map[types.FileContractID]types.FileContractID),
+		canceledHosts:       make(map[string]types.SiaPublicKey),
+		manualHosts:         make(map[string]types.SiaPublicKey),
+
+		recoverableContracts: make(map[types.FileContractID]proto.RecoverableContract),
+		utilityReasons:       make(map[types.FileContractID]string),
 	}
 
 	// Close the contract set and logger upon shutdown.
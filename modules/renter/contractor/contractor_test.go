@@ -24,6 +24,7 @@ func (newStub) Unsubscribe(modules.ConsensusSetSubscriber) { return }
 
 // wallet stubs
 func (newStub) NextAddress() (uc types.UnlockConditions, err error)          { return }
+func (newStub) PrimarySeed() (s modules.Seed, p uint64, err error)           { return }
 func (newStub) StartTransaction() (tb modules.TransactionBuilder, err error) { return }
 
 // transaction pool stubs
@@ -31,12 +32,15 @@ func (newStub) AcceptTransactionSet([]types.Transaction) error      { return nil
 func (newStub) FeeEstimation() (a types.Currency, b types.Currency) { return }
 
 // hdb stubs
-func (newStub) AllHosts() []modules.HostDBEntry                                      { return nil }
-func (newStub) ActiveHosts() []modules.HostDBEntry                                   { return nil }
-func (newStub) Host(types.SiaPublicKey) (settings modules.HostDBEntry, ok bool)      { return }
-func (newStub) IncrementSuccessfulInteractions(key types.SiaPublicKey)               { return }
-func (newStub) IncrementFailedInteractions(key types.SiaPublicKey)                   { return }
-func (newStub) RandomHosts(int, []types.SiaPublicKey) ([]modules.HostDBEntry, error) { return nil, nil }
+func (newStub) CheckForIPViolations([]types.SiaPublicKey) []types.SiaPublicKey  { return nil }
+func (newStub) AllHosts() []modules.HostDBEntry                                 { return nil }
+func (newStub) ActiveHosts() []modules.HostDBEntry                              { return nil }
+func (newStub) Host(types.SiaPublicKey) (settings modules.HostDBEntry, ok bool) { return }
+func (newStub) IncrementSuccessfulInteractions(key types.SiaPublicKey)          { return }
+func (newStub) IncrementFailedInteractions(key types.SiaPublicKey)              { return }
+func (newStub) RandomHosts(int, []types.SiaPublicKey, []types.SiaPublicKey) ([]modules.HostDBEntry, error) {
+	return nil, nil
+}
 func (newStub) ScoreBreakdown(modules.HostDBEntry) modules.HostScoreBreakdown {
 	return modules.HostScoreBreakdown{}
 }
@@ -103,13 +107,16 @@ func TestAllowance(t *testing.T) {
 // its methods.
 type stubHostDB struct{}
 
-func (stubHostDB) AllHosts() (hs []modules.HostDBEntry)                                      { return }
-func (stubHostDB) ActiveHosts() (hs []modules.HostDBEntry)                                   { return }
-func (stubHostDB) Host(types.SiaPublicKey) (h modules.HostDBEntry, ok bool)                  { return }
-func (stubHostDB) IncrementSuccessfulInteractions(key types.SiaPublicKey)                    { return }
-func (stubHostDB) IncrementFailedInteractions(key types.SiaPublicKey)                        { return }
-func (stubHostDB) PublicKey() (spk types.SiaPublicKey)                                       { return }
-func (stubHostDB) RandomHosts(int, []types.SiaPublicKey) (hs []modules.HostDBEntry, _ error) { return }
+func (stubHostDB) CheckForIPViolations([]types.SiaPublicKey) (pks []types.SiaPublicKey) { return }
+func (stubHostDB) AllHosts() (hs []modules.HostDBEntry)                                 { return }
+func (stubHostDB) ActiveHosts() (hs []modules.HostDBEntry)                              { return }
+func (stubHostDB) Host(types.SiaPublicKey) (h modules.HostDBEntry, ok bool)             { return }
+func (stubHostDB) IncrementSuccessfulInteractions(key types.SiaPublicKey)               { return }
+func (stubHostDB) IncrementFailedInteractions(key types.SiaPublicKey)                   { return }
+func (stubHostDB) PublicKey() (spk types.SiaPublicKey)                                  { return }
+func (stubHostDB) RandomHosts(int, []types.SiaPublicKey, []types.SiaPublicKey) (hs []modules.HostDBEntry, _ error) {
+	return
+}
 func (stubHostDB) ScoreBreakdown(modules.HostDBEntry) modules.HostScoreBreakdown {
 	return modules.HostScoreBreakdown{}
 }
@@ -146,7 +153,7 @@ func TestAllowanceSpending(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = build.Retry(50, 100*time.Millisecond, func() error {
-		hosts, err := c.hdb.RandomHosts(1, nil)
+		hosts, err := c.hdb.RandomHosts(1, nil, nil)
 		if err != nil {
 			return err
 		}
@@ -286,7 +293,7 @@ func TestIntegrationSetAllowance(t *testing.T) {
 	}
 
 	// wait for hostdb to scan
-	hosts, err := c.hdb.RandomHosts(1, nil)
+	hosts, err := c.hdb.RandomHosts(1, nil, nil)
 	if err != nil {
 		t.Fatal("failed to get hosts", err)
 	}
@@ -317,10 +324,16 @@ func TestIntegrationSetAllowance(t *testing.T) {
 	if err != errAllowanceWindowSize {
 		t.Errorf("expected %q, got %q", errAllowanceWindowSize, err)
 	}
+	a.RenewWindow = 10
+	a.ExpectedRedundancy = 0.5
+	err = c.SetAllowance(a)
+	if err != errAllowanceRedundancy {
+		t.Errorf("expected %q, got %q", errAllowanceRedundancy, err)
+	}
+	a.ExpectedRedundancy = 0
 
 	// reasonable values; should succeed
 	a.Funds = types.SiacoinPrecision.Mul64(100)
-	a.RenewWindow = 10
 	err = c.SetAllowance(a)
 	if err != nil {
 		t.Fatal(err)
@@ -498,6 +511,7 @@ func TestLinkedContracts(t *testing.T) {
 // testWalletShim is used to test the walletBridge type.
 type testWalletShim struct {
 	nextAddressCalled bool
+	primarySeedCalled bool
 	startTxnCalled    bool
 }
 
@@ -507,6 +521,10 @@ func (ws *testWalletShim) NextAddress() (types.UnlockConditions, error) {
 	ws.nextAddressCalled = true
 	return types.UnlockConditions{}, nil
 }
+func (ws *testWalletShim) PrimarySeed() (modules.Seed, uint64, error) {
+	ws.primarySeedCalled = true
+	return modules.Seed{}, 0, nil
+}
 func (ws *testWalletShim) StartTransaction() (modules.TransactionBuilder, error) {
 	ws.startTxnCalled = true
 	return nil, nil
@@ -520,6 +538,10 @@ func TestWalletBridge(t *testing.T) {
 	if !shim.nextAddressCalled {
 		t.Error("NextAddress was not called on the shim")
 	}
+	bridge.PrimarySeed()
+	if !shim.primarySeedCalled {
+		t.Error("PrimarySeed was not called on the shim")
+	}
 	bridge.StartTransaction()
 	if !shim.startTxnCalled {
 		t.Error("StartTransaction was not called on the shim")
@@ -63,6 +63,15 @@ func (c *Contractor) ContractUtility(pk types.SiaPublicKey) (modules.ContractUti
 	return c.managedContractUtility(id)
 }
 
+// ContractUtilityReason returns the reason why the contract with the given id
+// is not good for upload or renew. An empty string is returned if the contract
+// is in good standing.
+func (c *Contractor) ContractUtilityReason(id types.FileContractID) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.utilityReasons[id]
+}
+
 // ResolveIDToPubKey returns the ID of the most recent renewal of id.
 func (c *Contractor) ResolveIDToPubKey(id types.FileContractID) types.SiaPublicKey {
 	c.mu.RLock()
@@ -23,6 +23,16 @@ type Editor interface {
 	// returns the Merkle root of the data.
 	Upload(data []byte) (root crypto.Hash, err error)
 
+	// UploadBatch revises the underlying contract to store multiple sectors,
+	// using as few revisions as possible. It returns the Merkle roots of the
+	// sectors that were uploaded, which are a prefix of sectors if an error
+	// occurred.
+	UploadBatch(sectors [][]byte) (roots []crypto.Hash, err error)
+
+	// DeleteSectors revises the underlying contract to remove the sectors
+	// with the specified Merkle roots, releasing them on the host.
+	DeleteSectors(roots []crypto.Hash) error
+
 	// Address returns the address of the host.
 	Address() modules.NetAddress
 
@@ -113,6 +123,32 @@ func (he *hostEditor) Upload(data []byte) (_ crypto.Hash, err error) {
 	return sectorRoot, nil
 }
 
+// UploadBatch negotiates revisions that add multiple sectors to a file
+// contract.
+func (he *hostEditor) UploadBatch(sectors [][]byte) ([]crypto.Hash, error) {
+	he.mu.Lock()
+	defer he.mu.Unlock()
+	if he.invalid {
+		return nil, errInvalidEditor
+	}
+
+	// Perform the upload.
+	_, sectorRoots, err := he.editor.UploadBatch(sectors)
+	return sectorRoots, err
+}
+
+// DeleteSectors negotiates a revision that removes sectors from a file
+// contract.
+func (he *hostEditor) DeleteSectors(roots []crypto.Hash) error {
+	he.mu.Lock()
+	defer he.mu.Unlock()
+	if he.invalid {
+		return errInvalidEditor
+	}
+	_, err := he.editor.DeleteSectors(roots)
+	return err
+}
+
 // Editor returns a Editor object that can be used to upload, modify, and
 // delete sectors on a host.
 func (c *Contractor) Editor(pk types.SiaPublicKey, cancel <-chan struct{}) (_ Editor, err error) {
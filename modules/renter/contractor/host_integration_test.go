@@ -3,9 +3,12 @@ package contractor
 import (
 	"bytes"
 	"errors"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -316,6 +319,445 @@ func TestIntegrationUploadDownload(t *testing.T) {
 	}
 }
 
+// recordingProxy forwards connections to a host and records all data that is
+// sent in either direction.
+type recordingProxy struct {
+	addr     modules.NetAddress
+	listener net.Listener
+	traffic  bytes.Buffer
+	mu       sync.Mutex
+}
+
+// Write records data that was sent through the proxy.
+func (p *recordingProxy) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.traffic.Write(b)
+}
+
+// Traffic returns a copy of the recorded data.
+func (p *recordingProxy) Traffic() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]byte(nil), p.traffic.Bytes()...)
+}
+
+// Close stops the proxy from accepting new connections.
+func (p *recordingProxy) Close() error {
+	return p.listener.Close()
+}
+
+// newRecordingProxy starts a recordingProxy for the host at hostAddr.
+func newRecordingProxy(hostAddr modules.NetAddress) (*recordingProxy, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &recordingProxy{
+		addr:     modules.NetAddress(l.Addr().String()),
+		listener: l,
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			hostConn, err := net.Dial("tcp", string(hostAddr))
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			forward := func(dst, src net.Conn) {
+				io.Copy(io.MultiWriter(dst, p), src)
+				dst.Close()
+				src.Close()
+			}
+			go forward(hostConn, conn)
+			go forward(conn, hostConn)
+		}
+	}()
+	return p, nil
+}
+
+// TestIntegrationEncryptedTransport tests that the RPCs between a current
+// renter and a current host are encrypted, by recording the traffic between
+// them while the renter uploads and downloads data.
+func TestIntegrationEncryptedTransport(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// create testing trio
+	h, c, _, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// get the host's entry from the db. The host should announce a version
+	// that supports encrypted connections.
+	hostEntry, ok := c.hdb.Host(h.PublicKey())
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+	if build.VersionCmp(hostEntry.Version, modules.EncryptedTransportVersion) < 0 {
+		t.Fatalf("host announced version %v, which doesn't support encryption", hostEntry.Version)
+	}
+
+	// connect to the host through a proxy that records the traffic
+	proxy, err := newRecordingProxy(hostEntry.NetAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	hostEntry.NetAddress = proxy.addr
+
+	// form a contract with the host
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// revise the contract
+	editor, err := c.staticContracts.NewEditor(hostEntry, contract.ID, c.blockHeight, c.hdb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fastrand.Bytes(int(modules.SectorSize))
+	_, root, err := editor.Upload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = editor.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// download the data
+	downloader, err := c.staticContracts.NewDownloader(hostEntry, contract.ID, c.hdb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, retrieved, err := downloader.Sector(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, retrieved) {
+		t.Fatal("downloaded data does not match original")
+	}
+	err = downloader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the RPCs should have been encrypted. Neither the specifiers of the
+	// RPCs nor any part of the data should have been sent in plaintext.
+	traffic := proxy.Traffic()
+	if !bytes.Contains(traffic, modules.RPCEncrypt[:]) {
+		t.Fatal("renter did not request an encrypted connection")
+	}
+	for _, rpc := range []types.Specifier{modules.RPCFormContract, modules.RPCReviseContract, modules.RPCDownload} {
+		if bytes.Contains(traffic, rpc[:]) {
+			t.Fatalf("RPC %v was sent in plaintext", rpc)
+		}
+	}
+	if bytes.Contains(traffic, data[:crypto.SegmentSize]) || bytes.Contains(traffic, root[:]) {
+		t.Fatal("sector was sent in plaintext")
+	}
+}
+
+// TestIntegrationUploadBatch tests that the contractor can upload multiple
+// sectors using a single revision.
+func TestIntegrationUploadBatch(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// create testing trio
+	h, c, _, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok := c.hdb.Host(h.PublicKey())
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startRevision := contract.Transaction.FileContractRevisions[0].NewRevisionNumber
+
+	// upload a batch of sectors
+	editor, err := c.Editor(contract.HostPublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sectors := make([][]byte, 3)
+	for i := range sectors {
+		sectors[i] = fastrand.Bytes(int(modules.SectorSize))
+	}
+	roots, err := editor.UploadBatch(sectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != len(sectors) {
+		t.Fatal("wrong number of roots:", len(roots))
+	}
+	err = editor.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the sectors should have been added in a single revision
+	contract, ok = c.staticContracts.View(contract.ID)
+	if !ok {
+		t.Fatal("contract not found")
+	}
+	rev := contract.Transaction.FileContractRevisions[0]
+	if rev.NewRevisionNumber != startRevision+1 {
+		t.Fatal("expected a single revision, got", rev.NewRevisionNumber-startRevision)
+	}
+	if rev.NewFileSize != uint64(len(sectors))*modules.SectorSize {
+		t.Fatal("wrong file size after batch upload:", rev.NewFileSize)
+	}
+
+	// download the data
+	downloader, err := c.Downloader(contract.HostPublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, root := range roots {
+		retrieved, err := downloader.Sector(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sectors[i], retrieved) {
+			t.Fatal("downloaded data does not match original")
+		}
+	}
+	err = downloader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestIntegrationDeleteSectors tests that the contractor can remove sectors
+// from a contract, and that the host no longer serves them afterwards.
+func TestIntegrationDeleteSectors(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// create testing trio
+	h, c, _, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok := c.hdb.Host(h.PublicKey())
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// upload some sectors and delete the first and the third one
+	editor, err := c.Editor(contract.HostPublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sectors := make([][]byte, 4)
+	for i := range sectors {
+		sectors[i] = fastrand.Bytes(int(modules.SectorSize))
+	}
+	roots, err := editor.UploadBatch(sectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := editor.DeleteSectors([]crypto.Hash{roots[0], roots[2]}); err != nil {
+		t.Fatal(err)
+	}
+	// deleting sectors that are not part of the contract is a no-op
+	if err := editor.DeleteSectors([]crypto.Hash{roots[0], {1}}); err != nil {
+		t.Fatal(err)
+	}
+	err = editor.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the contract should only contain the remaining sectors
+	contract, ok = c.staticContracts.View(contract.ID)
+	if !ok {
+		t.Fatal("contract not found")
+	}
+	rev := contract.Transaction.FileContractRevisions[0]
+	if rev.NewFileSize != 2*modules.SectorSize {
+		t.Fatal("wrong file size after deleting sectors:", rev.NewFileSize)
+	}
+
+	// the remaining sectors can be downloaded, the deleted ones can't
+	downloader, err := c.Downloader(contract.HostPublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{1, 3} {
+		retrieved, err := downloader.Sector(roots[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sectors[i], retrieved) {
+			t.Fatal("downloaded data does not match original")
+		}
+	}
+	err = downloader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloader, err = c.Downloader(contract.HostPublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := downloader.Sector(roots[0]); err == nil {
+		t.Fatal("expected download of deleted sector to fail")
+	}
+	downloader.Close()
+}
+
+// TestIntegrationSession tests that the contractor can upload and download
+// data using a single session with a host, and that the old RPCs can still be
+// used once the session has ended.
+func TestIntegrationSession(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// create testing trio
+	h, c, _, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok := c.hdb.Host(h.PublicKey())
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a session with the wrong host key should fail the key exchange
+	wrongEntry := hostEntry
+	_, pk := crypto.GenerateKeyPair()
+	wrongEntry.PublicKey = types.Ed25519PublicKey(pk)
+	if _, err := c.staticContracts.NewSession(wrongEntry, contract.ID, c.blockHeight, c.hdb, nil); err == nil {
+		t.Fatal("expected session with the wrong host key to fail")
+	}
+
+	// start a session and request the settings of the host
+	startRevision := contract.Transaction.FileContractRevisions[0].NewRevisionNumber
+	s, err := c.staticContracts.NewSession(hostEntry, contract.ID, c.blockHeight, c.hdb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := s.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.RevisionNumber <= hostEntry.RevisionNumber {
+		t.Fatal("host did not send fresh settings")
+	}
+
+	// upload and download multiple sectors over the same session
+	var roots []crypto.Hash
+	var sectors [][]byte
+	for i := 0; i < 2; i++ {
+		data := fastrand.Bytes(int(modules.SectorSize))
+		_, root, err := s.Upload(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+		sectors = append(sectors, data)
+	}
+	for i, root := range roots {
+		_, data, err := s.Sector(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, sectors[i]) {
+			t.Fatal("downloaded data does not match the uploaded data")
+		}
+	}
+	// download part of a sector that is not aligned to segments
+	offset, length := uint64(crypto.SegmentSize+7), uint64(3*crypto.SegmentSize)
+	_, data, err := s.PartialSector(roots[0], offset, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, sectors[0][offset:offset+length]) {
+		t.Fatal("downloaded data does not match the uploaded data")
+	}
+	if _, _, err := s.PartialSector(roots[0], modules.SectorSize-1, 2); err == nil {
+		t.Fatal("expected out of bounds read to fail")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the contract should reflect the uploads and downloads
+	contract, ok = c.staticContracts.View(contract.ID)
+	if !ok {
+		t.Fatal("contract not found")
+	}
+	rev := contract.Transaction.FileContractRevisions[0]
+	if rev.NewFileSize != 2*modules.SectorSize {
+		t.Fatal("wrong file size after session:", rev.NewFileSize)
+	}
+	if rev.NewRevisionNumber != startRevision+5 {
+		t.Fatal("wrong revision number after session:", rev.NewRevisionNumber)
+	}
+
+	// the session should have released the contract, and the revisions
+	// should be known to the host
+	downloader, err := c.Downloader(contract.HostPublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = downloader.Sector(roots[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, sectors[1]) {
+		t.Fatal("downloaded data does not match the uploaded data")
+	}
+	if err := downloader.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestIntegrationRenew tests that the contractor can renew a previously-
 // formed file contract.
 func TestIntegrationRenew(t *testing.T) {
@@ -428,6 +870,194 @@ func TestIntegrationRenew(t *testing.T) {
 	}
 }
 
+// TestIntegrationRefresh tests that refreshing a contract keeps its end height
+// and its data, and that the spending of the refreshed contract is reported
+// for the current period.
+func TestIntegrationRefresh(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// create testing trio
+	h, c, m, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok := c.hdb.Host(h.PublicKey())
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.managedUpdateContractUtility(contract.ID, modules.ContractUtility{GoodForUpload: true, GoodForRenew: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// revise the contract
+	editor, err := c.Editor(contract.HostPublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fastrand.Bytes(int(modules.SectorSize))
+	root, err := editor.Upload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = editor.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// start a new period after the contract was formed
+	if _, err := m.AddBlock(); err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	c.currentPeriod = c.blockHeight
+	currentPeriod, blockHeight, allowance := c.currentPeriod, c.blockHeight, c.allowance
+	c.mu.Unlock()
+
+	// refresh the contract
+	oldContract, _ := c.staticContracts.View(contract.ID)
+	refresh := fileContractRenewal{
+		id:     contract.ID,
+		amount: oldContract.TotalCost.Mul64(2),
+	}
+	if _, err := c.managedRefreshContract(refresh, currentPeriod, allowance, blockHeight); err != nil {
+		t.Fatal(err)
+	}
+	contract, ok = c.ContractByPublicKey(h.PublicKey())
+	if !ok {
+		t.Fatal("no contract with the host after refreshing")
+	}
+	if contract.ID == oldContract.ID {
+		t.Fatal("contract wasn't refreshed")
+	}
+	if contract.EndHeight != oldContract.EndHeight {
+		t.Fatalf("refreshed contract has end height %v, expected %v", contract.EndHeight, oldContract.EndHeight)
+	}
+	c.mu.RLock()
+	renewedFrom, renewedTo := c.renewedFrom[contract.ID], c.renewedTo[oldContract.ID]
+	_, archived := c.oldContracts[oldContract.ID]
+	c.mu.RUnlock()
+	if renewedFrom != oldContract.ID || renewedTo != contract.ID || !archived {
+		t.Fatal("old contract wasn't archived correctly")
+	}
+
+	// the old contract id should still resolve to the host
+	hpk := h.PublicKey()
+	if pk := c.ResolveIDToPubKey(oldContract.ID); pk.String() != hpk.String() {
+		t.Fatal("old contract id doesn't resolve to the host")
+	}
+
+	// the spending of both contracts should be reported for the current
+	// period
+	spending := c.PeriodSpending()
+	if !spending.TotalAllocated.Equals(oldContract.TotalCost.Add(contract.TotalCost)) {
+		t.Fatalf("expected %v to be allocated, got %v", oldContract.TotalCost.Add(contract.TotalCost).HumanString(), spending.TotalAllocated.HumanString())
+	}
+	if !spending.PreviousSpending.IsZero() {
+		t.Fatal("refreshed contract was reported as previous spending:", spending.PreviousSpending.HumanString())
+	}
+
+	// download the data from the refreshed contract
+	downloader, err := c.Downloader(contract.HostPublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retrieved, err := downloader.Sector(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, retrieved) {
+		t.Fatal("downloaded data does not match original")
+	}
+	err = downloader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestIntegrationRenewPeriodSpending tests that renewing a contract at the
+// start of a new period doesn't report the spending of the old contract for
+// the new period.
+func TestIntegrationRenewPeriodSpending(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// create testing trio
+	h, c, m, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok := c.hdb.Host(h.PublicKey())
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.managedUpdateContractUtility(contract.ID, modules.ContractUtility{GoodForUpload: true, GoodForRenew: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// start a new period and renew the contract at the same height, like the
+	// contract maintenance does at the end of a period
+	if _, err := m.AddBlock(); err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	c.currentPeriod = c.blockHeight
+	currentPeriod, blockHeight, allowance := c.currentPeriod, c.blockHeight, c.allowance
+	c.mu.Unlock()
+	spendingBefore := c.PeriodSpending()
+
+	renewal := fileContractRenewal{
+		id:     contract.ID,
+		amount: types.SiacoinPrecision.Mul64(50),
+	}
+	if _, err := c.managedRenewContract(renewal, currentPeriod, allowance, blockHeight, blockHeight+100); err != nil {
+		t.Fatal(err)
+	}
+	newContract, ok := c.ContractByPublicKey(h.PublicKey())
+	if !ok {
+		t.Fatal("no contract with the host after renewing")
+	}
+	if newContract.ID == contract.ID {
+		t.Fatal("contract wasn't renewed")
+	}
+
+	// only the renewed contract should be reported for the current period
+	spending := c.PeriodSpending()
+	if !spending.TotalAllocated.Equals(newContract.TotalCost) {
+		t.Fatalf("expected %v to be allocated, got %v", newContract.TotalCost.HumanString(), spending.TotalAllocated.HumanString())
+	}
+	if spending.TotalAllocated.Cmp(spendingBefore.TotalAllocated.Mul64(2)) >= 0 {
+		t.Fatal("spending of the old contract was reported for the current period")
+	}
+	if spending.PreviousSpending.IsZero() {
+		t.Fatal("spending of the old contract wasn't reported as previous spending")
+	}
+}
+
 // TestIntegrationDownloaderCaching tests that downloaders are properly cached
 // by the contractor. When two downloaders are requested for the same
 // contract, only one underlying downloader should be created.
@@ -610,6 +1240,102 @@ func TestIntegrationEditorCaching(t *testing.T) {
 	d4.Close()
 }
 
+// TestIntegrationHostSession tests that a Session can be used to upload,
+// download and delete sectors, both with hosts that support the session RPC
+// and with older hosts.
+func TestIntegrationHostSession(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// create testing trio
+	h, c, _, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok := c.hdb.Host(h.PublicKey())
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []string{modules.SessionVersion, "1.3.3"} {
+		s, err := c.Session(contract.HostPublicKey, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.(*hostSession).host.Version = version
+
+		// the session holds the revising lock of the contract
+		if _, err := c.Editor(contract.HostPublicKey, nil); err == nil {
+			t.Fatal("expected editor to fail while the session is open")
+		}
+
+		// upload, download and delete sectors, switching between the
+		// operations
+		sectors := [][]byte{fastrand.Bytes(int(modules.SectorSize)), fastrand.Bytes(int(modules.SectorSize))}
+		roots, err := s.UploadBatch(sectors)
+		if err != nil {
+			t.Fatal(version, err)
+		}
+		data, err := s.PartialSector(roots[1], crypto.SegmentSize+7, 3*crypto.SegmentSize)
+		if err != nil {
+			t.Fatal(version, err)
+		}
+		if !bytes.Equal(data, sectors[1][crypto.SegmentSize+7:4*crypto.SegmentSize+7]) {
+			t.Fatal("downloaded data does not match the uploaded data")
+		}
+		if err := s.DeleteSectors(roots[:1]); err != nil {
+			t.Fatal(version, err)
+		}
+		data, err = s.Sector(roots[1])
+		if err != nil {
+			t.Fatal(version, err)
+		}
+		if !bytes.Equal(data, sectors[1]) {
+			t.Fatal("downloaded data does not match the uploaded data")
+		}
+		var unknownRoot crypto.Hash
+		fastrand.Read(unknownRoot[:])
+		if _, err := s.Sector(unknownRoot); err == nil {
+			t.Fatal("expected download of unknown sector to fail")
+		}
+
+		// the session should recover from the failed download
+		if _, err := s.Upload(sectors[0]); err != nil {
+			t.Fatal(version, err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		c.mu.RLock()
+		_, ok = c.sessions[contract.ID]
+		revising := c.revising[contract.ID]
+		c.mu.RUnlock()
+		if ok || revising {
+			t.Fatal("session was not released after it was closed")
+		}
+	}
+
+	// the contract should reflect the uploads and deletions
+	contract, ok = c.staticContracts.View(contract.ID)
+	if !ok {
+		t.Fatal("contract not found")
+	}
+	if size := contract.Transaction.FileContractRevisions[0].NewFileSize; size != 4*modules.SectorSize {
+		t.Fatal("wrong file size after sessions:", size)
+	}
+}
+
 // TestContractPresenceLeak tests that a renter can not tell from the response
 // of the host to RPCs if the host has the contract if the renter doesn't
 // own this contract. See https://gitlab.com/NebulousLabs/Sia/issues/2327.
@@ -674,3 +1400,64 @@ func TestContractPresenceLeak(t *testing.T) {
 		t.Fatalf("Expected to get equal errors, got %q and %q.", errors[0], errors[1])
 	}
 }
+
+// TestIntegrationPriceGouging tests that contracts with hosts whose prices
+// exceed the maximum prices of the allowance are marked as !GoodForUpload and
+// !GoodForRenew, and that such hosts reject new contracts.
+func TestIntegrationPriceGouging(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// create testing trio
+	h, c, _, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok := c.hdb.Host(h.PublicKey())
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.managedUpdateContractUtility(contract.ID, modules.ContractUtility{GoodForUpload: true, GoodForRenew: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// set a maximum contract price below the contract price of the host
+	c.mu.Lock()
+	c.allowance.MaxContractPrice = hostEntry.ContractPrice.Div64(2)
+	c.mu.Unlock()
+
+	// the contract should no longer be good for upload or renew once the
+	// initial scan of the hostdb is complete
+	err = build.Retry(50, 100*time.Millisecond, c.managedMarkContractsUtility)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utility, ok := c.managedContractUtility(contract.ID)
+	if !ok {
+		t.Fatal("contract not found")
+	}
+	if utility.GoodForUpload || utility.GoodForRenew {
+		t.Fatal("contract with a price gouging host should not be good for upload or renew", utility)
+	}
+	if reason := c.ContractUtilityReason(contract.ID); !strings.Contains(reason, "price gouging") {
+		t.Fatal("unexpected utility reason:", reason)
+	}
+
+	// the host should reject new contracts
+	_, _, err = c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err == nil || !strings.Contains(err.Error(), "contract price") {
+		t.Fatal("expected contract formation to fail because of price gouging, got", err)
+	}
+}
@@ -0,0 +1,234 @@
+package contractor
+
+// manual.go allows the user to form, renew and cancel contracts with specific
+// hosts, bypassing the decisions of the contract maintenance. Manual actions
+// are persisted so that the maintenance does not undo them: hosts of manually
+// formed contracts are not dropped because of their score, and hosts of
+// canceled contracts are not used to form new contracts.
+
+import (
+	"errors"
+	"reflect"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errAllowanceExceeded     = errors.New("not enough funds remaining in the allowance")
+	errAllowanceNotSet       = errors.New("an allowance must be set to manage contracts")
+	errContractAlreadyExists = errors.New("a contract with that host already exists")
+	errContractNotFound      = errors.New("no active contract with that id")
+	errEndHeightTooLow       = errors.New("end height must be greater than the current block height")
+	errHostNotFound          = errors.New("host not found in the hostdb")
+)
+
+// managedManualPreamble interrupts any running contract maintenance and
+// acquires the maintenance lock, so that manual actions don't race with the
+// maintenance. The returned function releases the lock again.
+func (c *Contractor) managedManualPreamble() (func(), error) {
+	if err := c.tg.Add(); err != nil {
+		return nil, err
+	}
+	c.managedInterruptContractMaintenance()
+	c.maintenanceLock.Lock()
+	return func() {
+		c.maintenanceLock.Unlock()
+		c.tg.Done()
+	}, nil
+}
+
+// managedFundsRemaining returns the funds of the allowance that haven't been
+// allocated to contracts yet.
+func (c *Contractor) managedFundsRemaining(allowance modules.Allowance) types.Currency {
+	spending := c.PeriodSpending()
+	if spending.TotalAllocated.Cmp(allowance.Funds) >= 0 {
+		return types.ZeroCurrency
+	}
+	return allowance.Funds.Sub(spending.TotalAllocated)
+}
+
+// FormContract forms a contract with the specified host. If funds is zero, the
+// contract is funded the same way as contracts formed by the contract
+// maintenance. If endHeight is zero, the contract ends with the current
+// period. The host is marked as manually chosen, so the contract is not
+// dropped by the maintenance because of the score of the host.
+func (c *Contractor) FormContract(hostKey types.SiaPublicKey, funds types.Currency, endHeight types.BlockHeight) (modules.RenterContract, error) {
+	done, err := c.managedManualPreamble()
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+	defer done()
+
+	c.mu.RLock()
+	allowance := c.allowance
+	blockHeight := c.blockHeight
+	if endHeight == 0 {
+		endHeight = c.contractEndHeight()
+	}
+	c.mu.RUnlock()
+	if reflect.DeepEqual(allowance, modules.Allowance{}) {
+		return modules.RenterContract{}, errAllowanceNotSet
+	}
+	if endHeight <= blockHeight {
+		return modules.RenterContract{}, errEndHeightTooLow
+	}
+	c.managedPrunePubkeyMap()
+	if _, exists := c.ContractByPublicKey(hostKey); exists {
+		return modules.RenterContract{}, errContractAlreadyExists
+	}
+	host, ok := c.hdb.Host(hostKey)
+	if !ok {
+		return modules.RenterContract{}, errHostNotFound
+	}
+	if funds.IsZero() {
+		funds = c.managedInitialContractFunds(host, allowance, blockHeight)
+	}
+	if funds.Cmp(c.managedFundsRemaining(allowance)) > 0 {
+		return modules.RenterContract{}, errAllowanceExceeded
+	}
+
+	_, contract, err := c.managedNewContract(host, funds, endHeight)
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+	utility := modules.ContractUtility{
+		GoodForUpload: true,
+		GoodForRenew:  true,
+	}
+	if err := c.managedUpdateContractUtility(contract.ID, utility); err != nil {
+		return modules.RenterContract{}, err
+	}
+	contract.Utility = utility
+
+	// Remember that the host was chosen manually. The host might have been
+	// canceled before, but the user changed their mind.
+	c.mu.Lock()
+	delete(c.canceledHosts, hostKey.String())
+	c.manualHosts[hostKey.String()] = hostKey
+	err = c.saveSync()
+	c.mu.Unlock()
+	if err != nil {
+		c.log.Println("Unable to save the contractor after forming a contract:", err)
+	}
+	return contract, nil
+}
+
+// RenewContract renews the contract with the specified id right away, without
+// waiting for the renew window. If funds is zero, the funding is estimated the
+// same way as for renewals by the contract maintenance. The renewed contract
+// ends with the current period.
+func (c *Contractor) RenewContract(id types.FileContractID, funds types.Currency) (modules.RenterContract, error) {
+	done, err := c.managedManualPreamble()
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+	defer done()
+
+	contract, exists := c.staticContracts.View(id)
+	if !exists {
+		return modules.RenterContract{}, errContractNotFound
+	}
+	c.mu.RLock()
+	allowance := c.allowance
+	blockHeight := c.blockHeight
+	currentPeriod := c.currentPeriod
+	endHeight := c.contractEndHeight()
+	c.mu.RUnlock()
+	if reflect.DeepEqual(allowance, modules.Allowance{}) {
+		return modules.RenterContract{}, errAllowanceNotSet
+	}
+	if endHeight <= blockHeight {
+		return modules.RenterContract{}, errEndHeightTooLow
+	}
+	if funds.IsZero() {
+		funds, err = c.managedEstimateRenewFundingRequirements(contract, blockHeight, allowance)
+		if err != nil {
+			return modules.RenterContract{}, err
+		}
+	}
+	if funds.Cmp(c.managedFundsRemaining(allowance)) > 0 {
+		return modules.RenterContract{}, errAllowanceExceeded
+	}
+
+	renewal := fileContractRenewal{
+		id:     id,
+		amount: funds,
+	}
+	if _, err := c.managedRenewContract(renewal, currentPeriod, allowance, blockHeight, endHeight); err != nil {
+		return modules.RenterContract{}, err
+	}
+	c.mu.RLock()
+	newID, renewed := c.renewedTo[id]
+	c.mu.RUnlock()
+	if !renewed {
+		return modules.RenterContract{}, errors.New("renewed contract not found")
+	}
+	newContract, exists := c.staticContracts.View(newID)
+	if !exists {
+		return modules.RenterContract{}, errors.New("renewed contract not found")
+	}
+	return newContract, nil
+}
+
+// CancelContract cancels the contract with the specified id. The contract is
+// marked as neither good for upload nor good for renew and moved to the old
+// contracts. The host is not used for new contracts by the contract
+// maintenance, unless a contract is formed with it manually. The funds of the
+// contract are returned once it expires.
+func (c *Contractor) CancelContract(id types.FileContractID) error {
+	done, err := c.managedManualPreamble()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	// Prevent new editors, downloaders and sessions from being created and
+	// invalidate the existing ones.
+	c.mu.Lock()
+	c.renewing[id] = true
+	e, eok := c.editors[id]
+	d, dok := c.downloaders[id]
+	hs, sok := c.sessions[id]
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.renewing, id)
+		c.mu.Unlock()
+	}()
+	if eok {
+		e.invalidate()
+	}
+	if dok {
+		d.invalidate()
+	}
+	if sok {
+		hs.invalidate()
+	}
+
+	sc, exists := c.staticContracts.Acquire(id)
+	if !exists {
+		return errContractNotFound
+	}
+	utility := sc.Utility()
+	utility.GoodForUpload = false
+	utility.GoodForRenew = false
+	utility.Locked = true
+	if err := sc.UpdateUtility(utility); err != nil {
+		c.staticContracts.Return(sc)
+		return err
+	}
+	contract := sc.Metadata()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.staticContracts.Delete(sc)
+	c.oldContracts[id] = contract
+	if c.pubKeysToContractID[string(contract.HostPublicKey.Key)] == id {
+		delete(c.pubKeysToContractID, string(contract.HostPublicKey.Key))
+	}
+	delete(c.manualHosts, contract.HostPublicKey.String())
+	c.canceledHosts[contract.HostPublicKey.String()] = contract.HostPublicKey
+	c.log.Println("INFO: canceled contract", id)
+	return c.saveSync()
+}
@@ -21,6 +21,10 @@ type contractorPersist struct {
 	OldContracts  []modules.RenterContract        `json:"oldcontracts"`
 	RenewedFrom   map[string]types.FileContractID `json:"renewedfrom"`
 	RenewedTo     map[string]types.FileContractID `json:"renewedto"`
+	CanceledHosts []types.SiaPublicKey            `json:"canceledhosts"`
+	ManualHosts   []types.SiaPublicKey            `json:"manualhosts"`
+
+	RecoverableContracts []proto.RecoverableContract `json:"recoverablecontracts"`
 }
 
 // persistData returns the data in the Contractor that will be saved to disk.
@@ -42,6 +46,15 @@ func (c *Contractor) persistData() contractorPersist {
 	for _, contract := range c.oldContracts {
 		data.OldContracts = append(data.OldContracts, contract)
 	}
+	for _, pk := range c.canceledHosts {
+		data.CanceledHosts = append(data.CanceledHosts, pk)
+	}
+	for _, pk := range c.manualHosts {
+		data.ManualHosts = append(data.ManualHosts, pk)
+	}
+	for _, rc := range c.recoverableContracts {
+		data.RecoverableContracts = append(data.RecoverableContracts, rc)
+	}
 	return data
 }
 
@@ -72,6 +85,15 @@ func (c *Contractor) load() error {
 	for _, contract := range data.OldContracts {
 		c.oldContracts[contract.ID] = contract
 	}
+	for _, pk := range data.CanceledHosts {
+		c.canceledHosts[pk.String()] = pk
+	}
+	for _, pk := range data.ManualHosts {
+		c.manualHosts[pk.String()] = pk
+	}
+	for _, rc := range data.RecoverableContracts {
+		c.recoverableContracts[rc.ID] = rc
+	}
 
 	return nil
 }
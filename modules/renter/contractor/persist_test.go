@@ -96,6 +96,39 @@ func TestSaveLoad(t *testing.T) {
 	}
 }
 
+// TestSaveLoadManualHosts tests that the hosts of manually formed and canceled
+// contracts are persisted.
+func TestSaveLoadManualHosts(t *testing.T) {
+	c := &Contractor{
+		persist:       new(memPersist),
+		oldContracts:  make(map[types.FileContractID]modules.RenterContract),
+		renewedFrom:   make(map[types.FileContractID]types.FileContractID),
+		renewedTo:     make(map[types.FileContractID]types.FileContractID),
+		canceledHosts: make(map[string]types.SiaPublicKey),
+		manualHosts:   make(map[string]types.SiaPublicKey),
+	}
+	canceled := types.SiaPublicKey{Key: []byte("foo")}
+	manual := types.SiaPublicKey{Key: []byte("bar")}
+	c.canceledHosts[canceled.String()] = canceled
+	c.manualHosts[manual.String()] = manual
+
+	// save, clear, and reload
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+	c.canceledHosts = make(map[string]types.SiaPublicKey)
+	c.manualHosts = make(map[string]types.SiaPublicKey)
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.canceledHosts[canceled.String()]; !ok || len(c.canceledHosts) != 1 {
+		t.Fatal("canceledHosts not restored properly:", c.canceledHosts)
+	}
+	if _, ok := c.manualHosts[manual.String()]; !ok || len(c.manualHosts) != 1 {
+		t.Fatal("manualHosts not restored properly:", c.manualHosts)
+	}
+}
+
 // TestConvertPersist tests that contracts previously stored in the
 // .journal format can be converted to the .contract format.
 func TestConvertPersist(t *testing.T) {
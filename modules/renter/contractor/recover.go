@@ -0,0 +1,213 @@
+package contractor
+
+// recover.go allows the contractor to recover contracts after the contract set
+// was lost. A recovery scan goes through the whole blockchain and remembers
+// the contracts that were formed with keys derived from the wallet seed. The
+// hosts of those contracts are then asked for the most recent revisions and
+// sector roots, and the contracts are added to the set. Contracts that can't be
+// recovered right away are retried during contract maintenance.
+
+import (
+	"errors"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/proto"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errScanInProgress = errors.New("a recovery scan is already in progress")
+)
+
+// A recoveryScanner subscribes to the consensus set from the beginning of the
+// blockchain to find the contracts that belong to the renter seed.
+type recoveryScanner struct {
+	c  *Contractor
+	rs proto.RenterSeed
+}
+
+// ProcessConsensusChange implements modules.ConsensusSetSubscriber.
+func (rs *recoveryScanner) ProcessConsensusChange(cc modules.ConsensusChange) {
+	c := rs.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, block := range cc.RevertedBlocks {
+		if block.ID() != types.GenesisID {
+			c.scannedHeight--
+		}
+	}
+	for _, block := range cc.AppliedBlocks {
+		if block.ID() != types.GenesisID {
+			c.scannedHeight++
+		}
+		for _, txn := range block.Transactions {
+			for _, rc := range proto.FindRecoverableContracts(rs.rs, txn, c.scannedHeight) {
+				c.addRecoverableContract(rc)
+			}
+		}
+	}
+}
+
+// addRecoverableContract adds a contract that was found by a recovery scan to
+// the recoverable contracts. Only the most recent contract with each host is
+// kept, since older contracts have usually been renewed.
+func (c *Contractor) addRecoverableContract(rc proto.RecoverableContract) {
+	for id, existing := range c.recoverableContracts {
+		if existing.HostPublicKey.String() != rc.HostPublicKey.String() {
+			continue
+		}
+		if existing.WindowStart >= rc.WindowStart {
+			return
+		}
+		delete(c.recoverableContracts, id)
+	}
+	c.recoverableContracts[rc.ID] = rc
+}
+
+// managedRenterSeed derives the renter seed from the primary seed of the
+// wallet. The wallet needs to be unlocked.
+func (c *Contractor) managedRenterSeed() (proto.RenterSeed, error) {
+	walletSeed, _, err := c.wallet.PrimarySeed()
+	if err != nil {
+		return proto.RenterSeed{}, err
+	}
+	defer crypto.SecureWipe(walletSeed[:])
+	return proto.DeriveRenterSeed(walletSeed), nil
+}
+
+// InitRecoveryScan starts scanning the whole blockchain for contracts that can
+// be recovered using the wallet seed. Once the scan is complete, the contracts
+// that haven't expired yet are recovered from their hosts.
+func (c *Contractor) InitRecoveryScan() error {
+	if err := c.tg.Add(); err != nil {
+		return err
+	}
+	defer c.tg.Done()
+	renterSeed, err := c.managedRenterSeed()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.scanInProgress {
+		c.mu.Unlock()
+		return errScanInProgress
+	}
+	c.scanInProgress = true
+	c.scannedHeight = 0
+	c.mu.Unlock()
+
+	go c.threadedRecoveryScan(renterSeed)
+	return nil
+}
+
+// threadedRecoveryScan performs a recovery scan, recovers the contracts it
+// found and triggers the contract maintenance.
+func (c *Contractor) threadedRecoveryScan(renterSeed proto.RenterSeed) {
+	if err := c.tg.Add(); err != nil {
+		return
+	}
+	defer c.tg.Done()
+	defer func() {
+		c.mu.Lock()
+		c.scanInProgress = false
+		c.mu.Unlock()
+	}()
+
+	// Subscribing from the beginning of the blockchain only returns after all
+	// existing blocks were processed.
+	scanner := &recoveryScanner{
+		c:  c,
+		rs: renterSeed,
+	}
+	err := c.cs.ConsensusSetSubscribe(scanner, modules.ConsensusChangeBeginning, c.tg.StopChan())
+	c.cs.Unsubscribe(scanner)
+	if err != nil {
+		c.log.Println("WARN: recovery scan failed:", err)
+		return
+	}
+
+	c.mu.Lock()
+	c.log.Printf("Recovery scan found %v recoverable contracts", len(c.recoverableContracts))
+	err = c.saveSync()
+	c.mu.Unlock()
+	if err != nil {
+		c.log.Println("Unable to save the contractor after a recovery scan:", err)
+	}
+
+	// Recover the contracts right away. The contract maintenance doesn't run
+	// without an allowance, which is likely to be lost as well.
+	c.managedInterruptContractMaintenance()
+	c.maintenanceLock.Lock()
+	c.managedRecoverContracts()
+	c.maintenanceLock.Unlock()
+	go c.threadedContractMaintenance()
+}
+
+// RecoveryScanStatus returns whether a recovery scan is in progress and the
+// height of the blockchain it has reached.
+func (c *Contractor) RecoveryScanStatus() (bool, types.BlockHeight) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.scanInProgress, c.scannedHeight
+}
+
+// managedRecoverContracts tries to recover the contracts that were found by a
+// recovery scan. Contracts that expired, that already exist or whose hosts
+// already have an active contract with the renter are dropped. Contracts whose
+// hosts can't be reached are retried during the next round of maintenance.
+func (c *Contractor) managedRecoverContracts() {
+	c.mu.RLock()
+	if len(c.recoverableContracts) == 0 {
+		c.mu.RUnlock()
+		return
+	}
+	blockHeight := c.blockHeight
+	var rcs []proto.RecoverableContract
+	for _, rc := range c.recoverableContracts {
+		rcs = append(rcs, rc)
+	}
+	c.mu.RUnlock()
+
+	renterSeed, err := c.managedRenterSeed()
+	if err != nil {
+		c.log.Println("WARN: unable to recover contracts:", err)
+		return
+	}
+	for _, rc := range rcs {
+		// Check whether the contract can be dropped.
+		_, exists := c.staticContracts.View(rc.ID)
+		_, hostExists := c.ContractByPublicKey(rc.HostPublicKey)
+		c.mu.RLock()
+		_, old := c.oldContracts[rc.ID]
+		c.mu.RUnlock()
+		if exists || hostExists || old || rc.WindowStart <= blockHeight {
+			c.mu.Lock()
+			delete(c.recoverableContracts, rc.ID)
+			c.mu.Unlock()
+			continue
+		}
+
+		host, ok := c.hdb.Host(rc.HostPublicKey)
+		if !ok {
+			c.log.Println("WARN: unable to recover contract", rc.ID, "- host not found in the hostdb")
+			continue
+		}
+		contract, err := c.staticContracts.RecoverContract(rc, renterSeed, host, c.tg.StopChan())
+		if err != nil {
+			c.log.Println("WARN: unable to recover contract", rc.ID, "-", err)
+			continue
+		}
+
+		c.mu.Lock()
+		c.contractIDToPubKey[contract.ID] = contract.HostPublicKey
+		c.pubKeysToContractID[string(contract.HostPublicKey.Key)] = contract.ID
+		delete(c.recoverableContracts, rc.ID)
+		err = c.saveSync()
+		c.mu.Unlock()
+		if err != nil {
+			c.log.Println("Unable to save the contractor after recovering a contract:", err)
+		}
+		c.log.Println("INFO: recovered contract", contract.ID)
+	}
+}
@@ -0,0 +1,374 @@
+package contractor
+
+import (
+	"errors"
+	"sync"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/proto"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+var errInvalidSession = errors.New("session has been invalidated because its contract is being renewed")
+
+// A Session uploads, downloads and deletes sectors on a host using the same
+// contract. Unlike an Editor and a Downloader, a single Session can be used
+// for all operations, so a renter that mixes uploads and downloads only needs
+// one connection to each host.
+type Session interface {
+	// Upload revises the underlying contract to store the new data. It
+	// returns the Merkle root of the data.
+	Upload(data []byte) (root crypto.Hash, err error)
+
+	// UploadBatch revises the underlying contract to store multiple sectors,
+	// using as few revisions as possible. It returns the Merkle roots of the
+	// sectors that were uploaded, which are a prefix of sectors if an error
+	// occurred.
+	UploadBatch(sectors [][]byte) (roots []crypto.Hash, err error)
+
+	// DeleteSectors revises the underlying contract to remove the sectors
+	// with the specified Merkle roots, releasing them on the host.
+	DeleteSectors(roots []crypto.Hash) error
+
+	// Sector retrieves the sector with the specified Merkle root, and revises
+	// the underlying contract to pay the host proportionally to the data
+	// retrieved.
+	Sector(root crypto.Hash) ([]byte, error)
+
+	// PartialSector retrieves length bytes of the sector with the specified
+	// Merkle root, starting at offset.
+	PartialSector(root crypto.Hash, offset, length uint64) ([]byte, error)
+
+	// Address returns the address of the host.
+	Address() modules.NetAddress
+
+	// ContractID returns the FileContractID of the contract.
+	ContractID() types.FileContractID
+
+	// EndHeight returns the height at which the contract ends.
+	EndHeight() types.BlockHeight
+
+	// Close terminates the connection to the host.
+	Close() error
+}
+
+// A hostSession implements the Session interface. Hosts that support the
+// session RPC are contacted using a proto.Session. Older hosts are contacted
+// using a proto.Editor or a proto.Downloader, depending on the operation; only
+// one of them is open at a time, since the host doesn't accept concurrent
+// revisions of a contract. The connection is opened when it is first needed,
+// and it is reopened if an operation fails, so a hostSession can be kept for
+// the lifetime of its contract. hostSessions are safe for use by multiple
+// goroutines.
+type hostSession struct {
+	cancel     <-chan struct{}
+	clients    int // safe to Close when 0
+	contractor *Contractor
+	endHeight  types.BlockHeight
+	host       modules.HostDBEntry
+	id         types.FileContractID
+	invalid    bool // true if invalidate has been called
+
+	session    *proto.Session
+	editor     *proto.Editor
+	downloader *proto.Downloader
+
+	mu sync.Mutex
+}
+
+// closeConn closes the open connection to the host, if there is one. The
+// session must be locked.
+func (hs *hostSession) closeConn() error {
+	var err error
+	if hs.session != nil {
+		err = hs.session.Close()
+	} else if hs.editor != nil {
+		err = hs.editor.Close()
+	} else if hs.downloader != nil {
+		err = hs.downloader.Close()
+	}
+	hs.session, hs.editor, hs.downloader = nil, nil, nil
+	return err
+}
+
+// useSession returns the proto.Session of hosts that support the session RPC,
+// opening it if necessary. nil is returned for older hosts. A session that is
+// about to be ended by the host is replaced by a new one, so that the next
+// request doesn't fail on a closed connection. The session must be locked.
+func (hs *hostSession) useSession() (*proto.Session, error) {
+	if build.VersionCmp(hs.host.Version, modules.SessionVersion) < 0 {
+		return nil, nil
+	}
+	hs.contractor.mu.RLock()
+	height := hs.contractor.blockHeight
+	hs.contractor.mu.RUnlock()
+	if hs.session != nil && hs.session.Expired() {
+		hs.closeConn()
+	}
+	if hs.session != nil {
+		hs.session.SetHeight(height)
+		return hs.session, nil
+	}
+	s, err := hs.contractor.staticContracts.NewSession(hs.host, hs.id, height, hs.contractor.hdb, hs.cancel)
+	if err != nil {
+		return nil, err
+	}
+	hs.session = s
+	return s, nil
+}
+
+// useEditor returns the proto.Editor of an older host, closing the
+// proto.Downloader if it is open. The session must be locked.
+func (hs *hostSession) useEditor() (*proto.Editor, error) {
+	if hs.editor != nil {
+		return hs.editor, nil
+	}
+	hs.closeConn()
+	hs.contractor.mu.RLock()
+	height := hs.contractor.blockHeight
+	hs.contractor.mu.RUnlock()
+	e, err := hs.contractor.staticContracts.NewEditor(hs.host, hs.id, height, hs.contractor.hdb, hs.cancel)
+	if err != nil {
+		return nil, err
+	}
+	hs.editor = e
+	return e, nil
+}
+
+// useDownloader returns the proto.Downloader of an older host, closing the
+// proto.Editor if it is open. The session must be locked.
+func (hs *hostSession) useDownloader() (*proto.Downloader, error) {
+	if hs.downloader != nil {
+		return hs.downloader, nil
+	}
+	hs.closeConn()
+	d, err := hs.contractor.staticContracts.NewDownloader(hs.host, hs.id, hs.contractor.hdb, hs.cancel)
+	if err != nil {
+		return nil, err
+	}
+	hs.downloader = d
+	return d, nil
+}
+
+// invalidate sets the invalid flag and closes the connection to the host.
+// Once invalidate returns, the hostSession is guaranteed to not further revise
+// its contract. This is used during contract renewal to prevent a Session
+// from revising a contract mid-renewal.
+func (hs *hostSession) invalidate() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if !hs.invalid {
+		hs.closeConn()
+		hs.invalid = true
+	}
+	hs.contractor.mu.Lock()
+	delete(hs.contractor.sessions, hs.id)
+	delete(hs.contractor.revising, hs.id)
+	hs.contractor.mu.Unlock()
+}
+
+// Address returns the NetAddress of the host.
+func (hs *hostSession) Address() modules.NetAddress { return hs.host.NetAddress }
+
+// ContractID returns the id of the contract used by the session.
+func (hs *hostSession) ContractID() types.FileContractID { return hs.id }
+
+// EndHeight returns the height at which the host is no longer obligated to
+// store the data.
+func (hs *hostSession) EndHeight() types.BlockHeight { return hs.endHeight }
+
+// Close cleanly ends the session with the host and closes the connection.
+func (hs *hostSession) Close() error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.clients--
+	// Close is a no-op if invalidate has been called, or if there are other
+	// clients still using the hostSession.
+	if hs.invalid || hs.clients > 0 {
+		return nil
+	}
+	hs.invalid = true
+	hs.contractor.mu.Lock()
+	delete(hs.contractor.sessions, hs.id)
+	delete(hs.contractor.revising, hs.id)
+	hs.contractor.mu.Unlock()
+	return hs.closeConn()
+}
+
+// Upload negotiates a revision that adds a sector to a file contract.
+func (hs *hostSession) Upload(data []byte) (crypto.Hash, error) {
+	roots, err := hs.UploadBatch([][]byte{data})
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	return roots[0], nil
+}
+
+// UploadBatch negotiates revisions that add multiple sectors to a file
+// contract.
+func (hs *hostSession) UploadBatch(sectors [][]byte) (roots []crypto.Hash, err error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.invalid {
+		return nil, errInvalidSession
+	} else if hs.host.StoragePrice.Cmp(maxStoragePrice) > 0 || hs.host.UploadBandwidthPrice.Cmp(maxUploadPrice) > 0 {
+		return nil, errTooExpensive
+	}
+	// Reconnect for the next operation if this one fails.
+	defer func() {
+		if err != nil {
+			hs.closeConn()
+		}
+	}()
+
+	s, err := hs.useSession()
+	if err != nil {
+		return nil, err
+	} else if s != nil {
+		_, roots, err = s.UploadBatch(sectors)
+		return roots, err
+	}
+	e, err := hs.useEditor()
+	if err != nil {
+		return nil, err
+	}
+	_, roots, err = e.UploadBatch(sectors)
+	return roots, err
+}
+
+// DeleteSectors negotiates a revision that removes sectors from a file
+// contract.
+func (hs *hostSession) DeleteSectors(roots []crypto.Hash) (err error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.invalid {
+		return errInvalidSession
+	}
+	// Reconnect for the next operation if this one fails.
+	defer func() {
+		if err != nil {
+			hs.closeConn()
+		}
+	}()
+
+	s, err := hs.useSession()
+	if err != nil {
+		return err
+	} else if s != nil {
+		_, err = s.DeleteSectors(roots)
+		return err
+	}
+	e, err := hs.useEditor()
+	if err != nil {
+		return err
+	}
+	_, err = e.DeleteSectors(roots)
+	return err
+}
+
+// Sector retrieves the sector with the specified Merkle root, and revises
+// the underlying contract to pay the host proportionally to the data
+// retrieved.
+func (hs *hostSession) Sector(root crypto.Hash) ([]byte, error) {
+	return hs.PartialSector(root, 0, modules.SectorSize)
+}
+
+// PartialSector retrieves length bytes of the sector with the specified
+// Merkle root, starting at offset. Older hosts don't support partial reads,
+// so the whole sector is downloaded from them.
+func (hs *hostSession) PartialSector(root crypto.Hash, offset, length uint64) (data []byte, err error) {
+	if length == 0 || offset+length > modules.SectorSize || offset+length < offset {
+		return nil, errors.New("requested range is out of sector bounds")
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.invalid {
+		return nil, errInvalidSession
+	} else if hs.host.DownloadBandwidthPrice.Cmp(maxDownloadPrice) > 0 {
+		return nil, errTooExpensive
+	}
+	// Reconnect for the next operation if this one fails.
+	defer func() {
+		if err != nil {
+			hs.closeConn()
+		}
+	}()
+
+	s, err := hs.useSession()
+	if err != nil {
+		return nil, err
+	} else if s != nil {
+		_, data, err = s.PartialSector(root, offset, length)
+		return data, err
+	}
+	d, err := hs.useDownloader()
+	if err != nil {
+		return nil, err
+	}
+	_, sector, err := d.Sector(root)
+	if err != nil {
+		return nil, err
+	}
+	return sector[offset : offset+length], nil
+}
+
+// Session returns a Session that can be used to upload, download and delete
+// sectors on a host. The Session holds the revising lock of the contract until
+// all of its clients have closed it.
+func (c *Contractor) Session(pk types.SiaPublicKey, cancel <-chan struct{}) (Session, error) {
+	c.mu.RLock()
+	id, gotID := c.pubKeysToContractID[string(pk.Key)]
+	cachedSession, haveSession := c.sessions[id]
+	height := c.blockHeight
+	renewing := c.renewing[id]
+	c.mu.RUnlock()
+	if !gotID {
+		return nil, errors.New("failed to get filecontract id from key")
+	}
+	if renewing {
+		// Cannot use the session if the contract is being renewed.
+		return nil, errors.New("currently renewing that contract")
+	} else if haveSession {
+		// This session already exists. Mark that there is another routine
+		// using the session, and then return the session that already
+		// exists.
+		cachedSession.mu.Lock()
+		cachedSession.clients++
+		cachedSession.mu.Unlock()
+		return cachedSession, nil
+	}
+
+	// Check that the contract and host are both available.
+	contract, haveContract := c.staticContracts.View(id)
+	if !haveContract {
+		return nil, errors.New("no record of that contract")
+	}
+	host, haveHost := c.hdb.Host(contract.HostPublicKey)
+	if height > contract.EndHeight {
+		return nil, errors.New("contract has already ended")
+	} else if !haveHost {
+		return nil, errors.New("no record of that host")
+	}
+
+	// Acquire the revising lock. It is released when the session is closed
+	// or invalidated.
+	c.mu.Lock()
+	if c.revising[contract.ID] {
+		c.mu.Unlock()
+		return nil, errors.New("already revising that contract")
+	}
+	c.revising[contract.ID] = true
+	hs := &hostSession{
+		cancel:     cancel,
+		clients:    1,
+		contractor: c,
+		endHeight:  contract.EndHeight,
+		host:       host,
+		id:         id,
+	}
+	c.sessions[contract.ID] = hs
+	c.mu.Unlock()
+	return hs, nil
+}
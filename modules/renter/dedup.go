@@ -0,0 +1,222 @@
+package renter
+
+// dedup.go implements the deduplication of identical chunks across files.
+// Files that are uploaded in dedup mode derive the keys of their pieces from
+// the content hash of each chunk instead of their master key (convergent
+// encryption), so the pieces of identical chunks can be decrypted by every
+// file that contains the chunk. The content hash of every chunk is stored in
+// the file's metadata once the chunk is first uploaded.
+//
+// The renter keeps an index from the content hashes of the uploaded chunks to
+// the files and chunks that contain them. Before a chunk of a deduplicated
+// file is uploaded, the index is searched for chunks with the same content,
+// erasure code and cipher, and their pieces are added to the file instead of
+// being uploaded again. Only the missing pieces are uploaded.
+//
+// A piece that is shared by several files is referenced by each of them.
+// Deleting a file removes its references from the index, and its sectors are
+// only removed from the hosts once no other file references them anymore.
+//
+// Chunks are deduplicated at fixed offsets, so only data that is aligned to
+// the chunk size of the file is deduplicated. Since the keys only depend on
+// the content of a chunk, anyone who knows the data of a chunk can confirm
+// that it is stored in the renter's contracts.
+
+import (
+	"errors"
+	"reflect"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+)
+
+var (
+	// errChunkContentChanged is returned if the data of a chunk of a
+	// deduplicated file doesn't match the content hash the chunk was
+	// uploaded with.
+	errChunkContentChanged = errors.New("data of chunk doesn't match its content hash")
+
+	// errDedupPacked is returned if the user tries to upload a file with both
+	// packing and deduplication enabled.
+	errDedupPacked = errors.New("packed files can't be deduplicated")
+)
+
+// dedupRef references a chunk of a deduplicated file.
+type dedupRef struct {
+	file  *file
+	chunk uint64
+}
+
+// chunkContentHash returns the content hash of the logical data of a chunk.
+func chunkContentHash(logicalChunkData [][]byte) crypto.Hash {
+	h := crypto.NewHash()
+	for _, shard := range logicalChunkData {
+		h.Write(shard)
+	}
+	var contentHash crypto.Hash
+	copy(contentHash[:], h.Sum(nil))
+	return contentHash
+}
+
+// convergentKey returns the key that the piece keys of a deduplicated chunk
+// are derived from.
+func convergentKey(cipherType crypto.CipherType, contentHash crypto.Hash) crypto.CipherKey {
+	return mustCipherKey(cipherType, crypto.HashAll(cipherType, contentHash))
+}
+
+// dedupIndexKey returns the key of a chunk with the given content hash of f in
+// the dedup index. Chunks can only share pieces if they use the same erasure
+// code and cipher.
+func dedupIndexKey(f *file, contentHash crypto.Hash) crypto.Hash {
+	return crypto.HashAll(
+		contentHash,
+		f.masterKey.Type(),
+		reflect.TypeOf(f.erasureCode).String(),
+		uint64(f.erasureCode.MinPieces()),
+		uint64(f.erasureCode.NumPieces()),
+		f.pieceSize,
+	)
+}
+
+// addDedupRefs adds the chunks of f with known content hashes to the dedup
+// index. The renter should be locked by the caller.
+func (r *Renter) addDedupRefs(f *file) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if !f.dedup {
+		return
+	}
+	for i, contentHash := range f.chunkHashes {
+		if contentHash != (crypto.Hash{}) {
+			key := dedupIndexKey(f, contentHash)
+			r.dedupIndex[key] = append(r.dedupIndex[key], dedupRef{file: f, chunk: uint64(i)})
+		}
+	}
+}
+
+// removeDedupRefs removes the chunks of f from the dedup index. The renter
+// should be locked by the caller.
+func (r *Renter) removeDedupRefs(f *file) {
+	f.mu.RLock()
+	var keys []crypto.Hash
+	for _, contentHash := range f.chunkHashes {
+		if contentHash != (crypto.Hash{}) {
+			keys = append(keys, dedupIndexKey(f, contentHash))
+		}
+	}
+	f.mu.RUnlock()
+
+	for _, key := range keys {
+		refs := r.dedupIndex[key][:0]
+		for _, ref := range r.dedupIndex[key] {
+			if ref.file != f {
+				refs = append(refs, ref)
+			}
+		}
+		if len(refs) == 0 {
+			delete(r.dedupIndex, key)
+		} else {
+			r.dedupIndex[key] = refs
+		}
+	}
+}
+
+// managedDeduplicateChunk records the content hash of a chunk of a
+// deduplicated file and adds the pieces of identical chunks of other files to
+// the file. The pieces that were added are marked as completed in the chunk.
+// The number of added pieces is returned.
+func (r *Renter) managedDeduplicateChunk(chunk *unfinishedUploadChunk) (int, error) {
+	f := chunk.renterFile
+	contentHash := chunkContentHash(chunk.logicalChunkData)
+	key := dedupIndexKey(f, contentHash)
+
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+
+	// Find the pieces of the identical chunks, which may include other chunks
+	// of f. The files are locked one at a time. References to files that were
+	// deleted without being removed from the index, like the pending layouts
+	// of files, are dropped.
+	type sharedPiece struct {
+		contract fileContract
+		piece    pieceData
+	}
+	var shared []sharedPiece
+	refs := r.dedupIndex[key][:0]
+	for _, ref := range r.dedupIndex[key] {
+		ref.file.mu.RLock()
+		deleted := ref.file.deleted
+		if !deleted && (ref.file != f || ref.chunk != chunk.index) {
+			for _, fc := range ref.file.contracts {
+				for _, p := range fc.Pieces {
+					if p.Chunk == ref.chunk {
+						shared = append(shared, sharedPiece{contract: fc, piece: p})
+					}
+				}
+			}
+		}
+		ref.file.mu.RUnlock()
+		if !deleted {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		delete(r.dedupIndex, key)
+	} else {
+		r.dedupIndex[key] = refs
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.deleted {
+		return 0, errors.New("file was deleted")
+	}
+
+	// Record the content hash of the chunk. The pieces that were already
+	// uploaded for the chunk are encrypted with the key of the recorded hash.
+	if uint64(len(f.chunkHashes)) <= chunk.index {
+		f.chunkHashes = append(f.chunkHashes, make([]crypto.Hash, chunk.index+1-uint64(len(f.chunkHashes)))...)
+	}
+	if f.chunkHashes[chunk.index] == (crypto.Hash{}) {
+		f.chunkHashes[chunk.index] = contentHash
+		r.dedupIndex[key] = append(r.dedupIndex[key], dedupRef{file: f, chunk: chunk.index})
+	} else if f.chunkHashes[chunk.index] != contentHash {
+		return 0, errChunkContentChanged
+	}
+
+	// Add the pieces that the chunk is missing. Pieces are only reused if
+	// their contract is renewed, and each host stores at most one piece of the
+	// chunk.
+	added := 0
+	for _, sp := range shared {
+		if chunk.pieceUsage[sp.piece.Piece] {
+			continue
+		}
+		pk := r.hostContractor.ResolveIDToPubKey(sp.contract.ID)
+		utility, exists := r.hostContractor.ContractUtility(pk)
+		if !exists || !utility.GoodForRenew {
+			continue
+		}
+		if _, unused := chunk.unusedHosts[pk.String()]; !unused {
+			continue
+		}
+		fc, exists := f.contracts[sp.contract.ID]
+		if !exists {
+			fc = fileContract{
+				ID:          sp.contract.ID,
+				IP:          sp.contract.IP,
+				WindowStart: sp.contract.WindowStart,
+			}
+		}
+		fc.Pieces = append(fc.Pieces, pieceData{
+			Chunk:      chunk.index,
+			Piece:      sp.piece.Piece,
+			MerkleRoot: sp.piece.MerkleRoot,
+		})
+		f.contracts[sp.contract.ID] = fc
+		chunk.pieceUsage[sp.piece.Piece] = true
+		chunk.piecesCompleted++
+		delete(chunk.unusedHosts, pk.String())
+		added++
+	}
+	return added, r.saveFile(f)
+}
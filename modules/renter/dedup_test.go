@@ -0,0 +1,142 @@
+package renter
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestDedupChunkKeys checks that the piece keys of deduplicated chunks only
+// depend on the content of the chunks.
+func TestDedupChunkKeys(t *testing.T) {
+	ec, _ := NewRSCode(1, 1)
+	newDedupFile := func(cipherType crypto.CipherType) *file {
+		masterKey, err := crypto.GenerateCipherKey(cipherType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := newFile("foo", ec, masterKey, 1e6)
+		f.dedup = true
+		f.chunkHashes = make([]crypto.Hash, 2)
+		return f
+	}
+	contentHash := crypto.HashBytes(fastrand.Bytes(64))
+	f1, f2 := newDedupFile(crypto.TypeTwofish), newDedupFile(crypto.TypeTwofish)
+	f1.chunkHashes[0] = contentHash
+	f2.chunkHashes[1] = contentHash
+
+	// Identical chunks of different files at different indices use the same
+	// keys.
+	key1, index1 := f1.chunkKey(0)
+	key2, index2 := f2.chunkKey(1)
+	if deriveKey(key1, index1, 1) != deriveKey(key2, index2, 1) {
+		t.Fatal("identical chunks use different keys")
+	}
+	key2, index2 = f2.chunkKey(0)
+	if deriveKey(key1, index1, 1) == deriveKey(key2, index2, 1) {
+		t.Fatal("different chunks use the same keys")
+	}
+
+	// The keys depend on the cipher.
+	f3 := newDedupFile(crypto.TypeXChaCha20)
+	f3.chunkHashes[0] = contentHash
+	key3, _ := f3.chunkKey(0)
+	if key3.Type() != crypto.TypeXChaCha20 || string(key3.Key()) == string(key1.Key()) {
+		t.Fatal("chunks with different ciphers use the same keys")
+	}
+
+	// Files without deduplication use their master key.
+	f1.dedup = false
+	if key, index := f1.chunkKey(1); key != f1.masterKey || index != 1 {
+		t.Fatal("file without deduplication doesn't use its master key")
+	}
+}
+
+// TestDeduplicateChunk checks that the content hashes of deduplicated chunks
+// are recorded in their files and in the dedup index.
+func TestDeduplicateChunk(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	ec, _ := NewRSCode(1, 1)
+	masterKey, _ := crypto.GenerateCipherKey(crypto.TypeTwofish)
+	newDedupFile := func(name string) *file {
+		f := newFile(name, ec, masterKey, 0)
+		f.size = 2 * f.staticChunkSize()
+		f.dedup = true
+		r.files[name] = f
+		return f
+	}
+	foo, bar := newDedupFile("foo"), newDedupFile("bar")
+	data := fastrand.Bytes(int(foo.pieceSize))
+	deduplicate := func(f *file, index uint64, data []byte) error {
+		chunk := newUnfinishedUploadChunk(f, index, "", nil)
+		chunk.logicalChunkData = [][]byte{data}
+		reused, err := r.managedDeduplicateChunk(chunk)
+		if reused != 0 {
+			t.Fatal("pieces were reused without any contracts")
+		}
+		return err
+	}
+
+	// Upload the same chunk for both files at different indices.
+	if err := deduplicate(foo, 0, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := deduplicate(bar, 1, data); err != nil {
+		t.Fatal(err)
+	}
+	contentHash := chunkContentHash([][]byte{data})
+	if len(foo.chunkHashes) != 1 || foo.chunkHashes[0] != contentHash {
+		t.Fatal("content hash wasn't recorded:", foo.chunkHashes)
+	}
+	if len(bar.chunkHashes) != 2 || bar.chunkHashes[0] != (crypto.Hash{}) || bar.chunkHashes[1] != contentHash {
+		t.Fatal("content hash wasn't recorded:", bar.chunkHashes)
+	}
+	key := dedupIndexKey(foo, contentHash)
+	if refs := r.dedupIndex[key]; len(refs) != 2 || refs[0] != (dedupRef{foo, 0}) || refs[1] != (dedupRef{bar, 1}) {
+		t.Fatal("chunks weren't added to the dedup index:", refs)
+	}
+
+	// A chunk can't be uploaded with different data.
+	if err := deduplicate(foo, 0, fastrand.Bytes(int(foo.pieceSize))); err != errChunkContentChanged {
+		t.Fatal("expected errChunkContentChanged, got", err)
+	}
+
+	// The content hashes are persisted, and loading the files rebuilds the
+	// index.
+	r.files = make(map[string]*file)
+	r.dedupIndex = make(map[crypto.Hash][]dedupRef)
+	if err := r.loadSiaFiles(); err != nil {
+		t.Fatal(err)
+	}
+	foo, bar = r.files["foo"], r.files["bar"]
+	if foo == nil || bar == nil || !foo.dedup || bar.chunkHashes[1] != contentHash {
+		t.Fatal("deduplicated files weren't loaded correctly")
+	}
+	if len(r.dedupIndex[key]) != 2 {
+		t.Fatal("dedup index wasn't rebuilt:", r.dedupIndex[key])
+	}
+
+	// Deleting a file removes its references.
+	if err := r.DeleteFile("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if refs := r.dedupIndex[key]; len(refs) != 1 || refs[0] != (dedupRef{bar, 1}) {
+		t.Fatal("deleted file is still referenced:", refs)
+	}
+	if err := r.DeleteFile("bar"); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := r.dedupIndex[key]; exists {
+		t.Fatal("unreferenced chunk wasn't removed from the dedup index")
+	}
+}
@@ -0,0 +1,550 @@
+package renter
+
+// dirs.go implements the directory hierarchy of the renter. A renter
+// directory is a folder within the renter's persist directory that contains a
+// SiaDirMetadataFilename file. The metadata file caches aggregate information
+// about all of the files within the directory and its subdirectories, which
+// allows a user to browse large numbers of files without listing every single
+// one of them.
+//
+// Structural changes (uploads, deletions, renames) trigger a background
+// 'bubble' which recalculates the metadata of the changed directory from the
+// files directly within it and the persisted metadata of its subdirectories,
+// and then does the same for every parent up to the root. Listing a directory
+// recalculates the metadata of the directory itself the same way, but doesn't
+// persist it.
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/persist"
+)
+
+const (
+	// SiaDirMetadataFilename is the name of the metadata file that is stored
+	// within every renter directory.
+	SiaDirMetadataFilename = ".siadir"
+)
+
+var (
+	// ErrDirExists is returned if a directory already exists at the location
+	// that the user is trying to create or rename a directory to.
+	ErrDirExists = errors.New("a directory already exists at that location")
+	// ErrUnknownDir is returned if a directory cannot be found with the given
+	// path.
+	ErrUnknownDir = errors.New("no directory known with that path")
+
+	// errDeleteRootDir is returned if the user tries to delete the root
+	// directory of the renter.
+	errDeleteRootDir = errors.New("cannot delete the root directory")
+	// errReservedPath is returned if the user tries to create a directory at a
+	// location that is in use by a different part of the renter.
+	errReservedPath = errors.New("the path is reserved by the renter")
+	// errRenameDirIntoItself is returned if the user tries to move a
+	// directory into one of its own subdirectories.
+	errRenameDirIntoItself = errors.New("cannot move a directory into itself")
+
+	dirPersistMetadata = persist.Metadata{
+		Header:  "Sia Directory Metadata",
+		Version: "1.0",
+	}
+)
+
+type (
+	// dirMetadata is the metadata that is persisted for every renter
+	// directory.
+	dirMetadata struct {
+		// AggregateNumFiles and AggregateSize are the number of files and the
+		// total size of the files within the directory, including all of its
+		// subdirectories.
+		AggregateNumFiles uint64 `json:"aggregatenumfiles"`
+		AggregateSize     uint64 `json:"aggregatesize"`
+
+		// Health is the health of the least healthy file within the directory
+		// or any of its subdirectories. See fileHealth for details.
+		Health float64 `json:"health"`
+
+		// LastUpdate is the time at which the metadata was last calculated.
+		LastUpdate time.Time `json:"lastupdate"`
+
+		// NumFiles and NumSubDirs are the number of files and directories
+		// directly within the directory.
+		NumFiles   uint64 `json:"numfiles"`
+		NumSubDirs uint64 `json:"numsubdirs"`
+	}
+
+	// fileSummary contains the information about a file that is required to
+	// calculate the metadata of the directories containing it.
+	fileSummary struct {
+		size   uint64
+		health float64
+	}
+)
+
+// dirInfo converts the metadata of the directory at siaPath into a
+// modules.DirectoryInfo.
+func (md dirMetadata) dirInfo(siaPath string) modules.DirectoryInfo {
+	return modules.DirectoryInfo{
+		SiaPath:           siaPath,
+		AggregateNumFiles: md.AggregateNumFiles,
+		AggregateSize:     md.AggregateSize,
+		Health:            md.Health,
+		LastUpdate:        md.LastUpdate,
+		NumFiles:          md.NumFiles,
+		NumSubDirs:        md.NumSubDirs,
+	}
+}
+
+// fileHealth converts the redundancy of a file into its health. A health of 0
+// means that the file is at full redundancy, a health of 1 means that the file
+// has exactly enough pieces to be recovered, and a health above 1 means that
+// the file can't be recovered from the network anymore.
+func fileHealth(redundancy float64, minPieces, numPieces int) float64 {
+	// Empty files have a redundancy of -1 and are always healthy.
+	if redundancy < 0 {
+		return 0
+	}
+	goodPieces := redundancy * float64(minPieces)
+	if numPieces == minPieces {
+		// Without parity pieces a file is either complete or unrecoverable.
+		if goodPieces >= float64(minPieces) {
+			return 0
+		}
+		return 1 + (float64(minPieces)-goodPieces)/float64(minPieces)
+	}
+	health := 1 - (goodPieces-float64(minPieces))/float64(numPieces-minPieces)
+	if health < 0 {
+		return 0
+	}
+	return health
+}
+
+// dirParent returns the siapath of the directory that contains siaPath. The
+// root directory is represented by the empty string.
+func dirParent(siaPath string) string {
+	parent := path.Dir(siaPath)
+	if parent == "." || parent == "/" {
+		return ""
+	}
+	return parent
+}
+
+// isWithinDir returns true if siaPath is located within the directory dir or
+// one of its subdirectories.
+func isWithinDir(siaPath, dir string) bool {
+	return dir == "" || strings.HasPrefix(siaPath, dir+"/")
+}
+
+// validateDirSiapath checks that a siapath is a legal directory path. The
+// empty siapath refers to the root directory.
+func validateDirSiapath(siaPath string) error {
+	if siaPath == "" {
+		return nil
+	}
+	return validateSiapath(siaPath)
+}
+
+// dirPath returns the location of the directory on disk.
+func (r *Renter) dirPath(siaPath string) string {
+	return filepath.Join(r.persistDir, filepath.FromSlash(siaPath))
+}
+
+// dirExists returns true if a renter directory exists at siaPath.
+func (r *Renter) dirExists(siaPath string) bool {
+	_, err := os.Stat(filepath.Join(r.dirPath(siaPath), SiaDirMetadataFilename))
+	return err == nil
+}
+
+// createDirAll creates the directory at siaPath as well as all of its missing
+// parents. Metadata files are created for every new directory.
+func (r *Renter) createDirAll(siaPath string) error {
+	for dir := siaPath; ; dir = dirParent(dir) {
+		if r.dirExists(dir) {
+			return nil
+		}
+		if err := os.MkdirAll(r.dirPath(dir), 0700); err != nil {
+			return err
+		}
+		if err := r.saveDirMetadata(dir, dirMetadata{LastUpdate: time.Now()}); err != nil {
+			return err
+		}
+		if dir == "" {
+			return nil
+		}
+	}
+}
+
+// loadDirMetadata loads the persisted metadata of the directory at siaPath.
+func (r *Renter) loadDirMetadata(siaPath string) (dirMetadata, error) {
+	var md dirMetadata
+	r.dirMetadataMu.Lock()
+	defer r.dirMetadataMu.Unlock()
+	err := persist.LoadJSON(dirPersistMetadata, &md, filepath.Join(r.dirPath(siaPath), SiaDirMetadataFilename))
+	return md, err
+}
+
+// saveDirMetadata persists the metadata of the directory at siaPath.
+func (r *Renter) saveDirMetadata(siaPath string, md dirMetadata) error {
+	r.dirMetadataMu.Lock()
+	defer r.dirMetadataMu.Unlock()
+	return persist.SaveJSON(dirPersistMetadata, md, filepath.Join(r.dirPath(siaPath), SiaDirMetadataFilename))
+}
+
+// managedDirChildren returns the files located directly within the directory
+// at siaPath and the siapaths of its subdirectories. Only the directory itself
+// is read, so the cost doesn't depend on the total number of files.
+func (r *Renter) managedDirChildren(siaPath string) ([]*file, []string, error) {
+	d, err := os.Open(r.dirPath(siaPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer d.Close()
+	fis, err := d.Readdir(-1)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names, dirs []string
+	for _, fi := range fis {
+		if fi.IsDir() {
+			subDir := path.Join(siaPath, fi.Name())
+			if r.dirExists(subDir) {
+				dirs = append(dirs, subDir)
+			}
+		} else if filepath.Ext(fi.Name()) == ShareExtension {
+			names = append(names, path.Join(siaPath, strings.TrimSuffix(fi.Name(), ShareExtension)))
+		}
+	}
+	sort.Strings(dirs)
+
+	// Files that are being deleted may still have a .sia file.
+	var files []*file
+	id := r.mu.RLock()
+	for _, name := range names {
+		if f, exists := r.files[name]; exists {
+			files = append(files, f)
+		}
+	}
+	r.mu.RUnlock(id)
+	return files, dirs, nil
+}
+
+// managedFileSummaries returns a summary of each of the provided files.
+func (r *Renter) managedFileSummaries(files []*file) []fileSummary {
+	offline, goodForRenew := r.managedContractUtilityMaps(files)
+	summaries := make([]fileSummary, 0, len(files))
+	for _, f := range files {
+		// The health of a packed file is the health of its pack.
+		df := r.managedDataFile(f)
+		f.mu.RLock()
+		if df != f {
+			df.mu.RLock()
+		}
+		summaries = append(summaries, fileSummary{
+			size:   f.size,
+			health: df.health(offline, goodForRenew),
+		})
+		if df != f {
+			df.mu.RUnlock()
+		}
+		f.mu.RUnlock()
+	}
+	return summaries
+}
+
+// managedCalculateDirMetadata calculates the metadata of a directory from the
+// files located directly within it and the persisted metadata of its
+// subdirectories, as returned by managedDirChildren.
+func (r *Renter) managedCalculateDirMetadata(files []*file, subDirs []string) (dirMetadata, error) {
+	md := dirMetadata{
+		LastUpdate:        time.Now(),
+		NumFiles:          uint64(len(files)),
+		NumSubDirs:        uint64(len(subDirs)),
+		AggregateNumFiles: uint64(len(files)),
+	}
+	for _, fs := range r.managedFileSummaries(files) {
+		md.AggregateSize += fs.size
+		if fs.health > md.Health {
+			md.Health = fs.health
+		}
+	}
+	for _, dir := range subDirs {
+		subMD, err := r.loadDirMetadata(dir)
+		if err != nil {
+			return dirMetadata{}, err
+		}
+		md.AggregateNumFiles += subMD.AggregateNumFiles
+		md.AggregateSize += subMD.AggregateSize
+		if subMD.Health > md.Health {
+			md.Health = subMD.Health
+		}
+	}
+	return md, nil
+}
+
+// managedUpdateDirMetadata recalculates and persists the metadata of the
+// directory at siaPath.
+func (r *Renter) managedUpdateDirMetadata(siaPath string) error {
+	files, subDirs, err := r.managedDirChildren(siaPath)
+	if err != nil {
+		return err
+	}
+	md, err := r.managedCalculateDirMetadata(files, subDirs)
+	if err != nil {
+		return err
+	}
+	return r.saveDirMetadata(siaPath, md)
+}
+
+// bubbleParentDirs starts a bubble for every directory that contains one of
+// the provided siapaths.
+func (r *Renter) bubbleParentDirs(siaPaths []string) {
+	dirs := make(map[string]struct{})
+	for _, siaPath := range siaPaths {
+		dirs[dirParent(siaPath)] = struct{}{}
+	}
+	for dir := range dirs {
+		go r.threadedBubbleMetadata(dir)
+	}
+}
+
+// threadedBubbleMetadata recalculates and persists the metadata of the
+// directory at siaPath and of all of its parents.
+func (r *Renter) threadedBubbleMetadata(siaPath string) {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	// Bubbles for files that were deleted or moved in the meantime are
+	// skipped.
+	for !r.dirExists(siaPath) {
+		if siaPath == "" {
+			return
+		}
+		siaPath = dirParent(siaPath)
+	}
+	// Concurrent bubbles could otherwise persist the metadata of a parent
+	// that was calculated from outdated metadata of its subdirectories.
+	r.bubbleMu.Lock()
+	defer r.bubbleMu.Unlock()
+	for dir := siaPath; ; dir = dirParent(dir) {
+		if err := r.managedUpdateDirMetadata(dir); err != nil {
+			r.log.Printf("WARN: unable to update the metadata of directory '%v': %v", dir, err)
+		}
+		if dir == "" {
+			return
+		}
+	}
+}
+
+// CreateDir creates a new, empty directory at siaPath. Any missing parent
+// directories are created as well.
+func (r *Renter) CreateDir(siaPath string) error {
+	if err := validateSiapath(siaPath); err != nil {
+		return err
+	}
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	if _, exists := r.files[siaPath]; exists {
+		return ErrPathOverload
+	}
+	if r.dirExists(siaPath) {
+		return ErrDirExists
+	}
+	if _, err := os.Stat(r.dirPath(siaPath)); !os.IsNotExist(err) {
+		return errReservedPath
+	}
+	if err := r.createDirAll(siaPath); err != nil {
+		return err
+	}
+	go r.threadedBubbleMetadata(dirParent(siaPath))
+	return nil
+}
+
+// DeleteDir deletes the directory at siaPath together with all of the files
+// and subdirectories it contains.
+func (r *Renter) DeleteDir(siaPath string) error {
+	if siaPath == "" {
+		return errDeleteRootDir
+	}
+	if err := validateSiapath(siaPath); err != nil {
+		return err
+	}
+	lockID := r.mu.Lock()
+	if !r.dirExists(siaPath) {
+		r.mu.Unlock(lockID)
+		return ErrUnknownDir
+	}
+
+	// Remove all the files within the directory from the renter.
+	var deleted []*file
+	for name, f := range r.files {
+		if !isWithinDir(name, siaPath) {
+			continue
+		}
+		delete(r.files, name)
+		delete(r.persist.Tracking, name)
+		r.releasePackMember(f)
+		r.removeDedupRefs(f)
+		deleted = append(deleted, f)
+	}
+	err := r.saveSync()
+	if err != nil {
+		r.mu.Unlock(lockID)
+		return err
+	}
+
+	// Remove the renter files from disk. Any other data in the directory is
+	// left untouched, and the folders are only removed if they end up empty.
+	var folders []string
+	err = filepath.Walk(r.dirPath(siaPath), func(path string, info os.FileInfo, err error) error {
+		// Temporary files are removed together with the files they belong to.
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			folders = append(folders, path)
+			return nil
+		}
+		name := info.Name()
+		if ext := filepath.Ext(name); ext == ShareExtension || ext == migrationExtension || name == SiaDirMetadataFilename {
+			return persist.RemoveFile(path)
+		}
+		return nil
+	})
+	for i := len(folders) - 1; i >= 0; i-- {
+		os.Remove(folders[i])
+	}
+	r.mu.Unlock(lockID)
+
+	// Mark the files as deleted and remove their sectors from the contracts.
+	for _, f := range deleted {
+		f.mu.Lock()
+		f.deleted = true
+		r.cancelMigration(f)
+		go r.threadedDeleteSectors(f.sectors())
+		f.mu.Unlock()
+	}
+
+	go r.threadedBubbleMetadata(dirParent(siaPath))
+	return err
+}
+
+// DirList returns the contents of the directory at siaPath. The first
+// DirectoryInfo belongs to the directory itself and is followed by its
+// subdirectories. The metadata of the subdirectories is the metadata that was
+// persisted by the last bubble.
+func (r *Renter) DirList(siaPath string) ([]modules.DirectoryInfo, []modules.FileInfo, error) {
+	if err := validateDirSiapath(siaPath); err != nil {
+		return nil, nil, err
+	}
+	if !r.dirExists(siaPath) {
+		return nil, nil, ErrUnknownDir
+	}
+
+	// Calculate the metadata of the directory and load the metadata of its
+	// subdirectories.
+	files, subDirs, err := r.managedDirChildren(siaPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	md, err := r.managedCalculateDirMetadata(files, subDirs)
+	if err != nil {
+		return nil, nil, err
+	}
+	dirs := make([]modules.DirectoryInfo, 0, len(subDirs)+1)
+	dirs = append(dirs, md.dirInfo(siaPath))
+	for _, dir := range subDirs {
+		subMD, err := r.loadDirMetadata(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		dirs = append(dirs, subMD.dirInfo(dir))
+	}
+	return dirs, r.managedFileInfos(files), nil
+}
+
+// RenameDir moves the directory at currentPath to newPath. Every file within
+// the directory is renamed accordingly.
+func (r *Renter) RenameDir(currentPath, newPath string) error {
+	if err := validateSiapath(currentPath); err != nil {
+		return err
+	}
+	if err := validateSiapath(newPath); err != nil {
+		return err
+	}
+	if currentPath == newPath || isWithinDir(newPath, currentPath) {
+		return errRenameDirIntoItself
+	}
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	// Check that currentPath exists and newPath doesn't.
+	if !r.dirExists(currentPath) {
+		return ErrUnknownDir
+	}
+	if _, exists := r.files[newPath]; exists {
+		return ErrPathOverload
+	}
+	if r.dirExists(newPath) {
+		return ErrDirExists
+	}
+	if _, err := os.Stat(r.dirPath(newPath)); !os.IsNotExist(err) {
+		return errReservedPath
+	}
+
+	// Move the directory on disk.
+	if err := r.createDirAll(dirParent(newPath)); err != nil {
+		return err
+	}
+	if err := os.Rename(r.dirPath(currentPath), r.dirPath(newPath)); err != nil {
+		return err
+	}
+
+	// Update the names of the files within the directory. The .sia files have
+	// been moved together with the directory, but need to be rewritten to
+	// contain the new name.
+	renamed := make(map[string]*file)
+	for name, f := range r.files {
+		if isWithinDir(name, currentPath) {
+			renamed[name] = f
+		}
+	}
+	var err error
+	for oldName, f := range renamed {
+		newName := newPath + strings.TrimPrefix(oldName, currentPath)
+		f.mu.Lock()
+		f.name = newName
+		if saveErr := r.saveFile(f); saveErr != nil && err == nil {
+			err = saveErr
+		}
+		if saveErr := r.renameMigration(f); saveErr != nil && err == nil {
+			err = saveErr
+		}
+		f.mu.Unlock()
+
+		delete(r.files, oldName)
+		r.files[newName] = f
+		if t, ok := r.persist.Tracking[oldName]; ok {
+			delete(r.persist.Tracking, oldName)
+			r.persist.Tracking[newName] = t
+		}
+	}
+	if saveErr := r.saveSync(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+
+	go r.threadedBubbleMetadata(dirParent(currentPath))
+	go r.threadedBubbleMetadata(dirParent(newPath))
+	return err
+}
@@ -0,0 +1,413 @@
+package renter
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/contractor"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestFileHealth probes the fileHealth function.
+func TestFileHealth(t *testing.T) {
+	tests := []struct {
+		redundancy float64
+		minPieces  int
+		numPieces  int
+		health     float64
+	}{
+		{-1, 10, 30, 0},  // empty file
+		{3, 10, 30, 0},   // full redundancy
+		{2, 10, 30, 0.5}, // half of the parity pieces missing
+		{1, 10, 30, 1},   // barely recoverable
+		{0.5, 10, 30, 1.25},
+		{1, 1, 1, 0}, // no parity pieces
+		{0, 1, 1, 2},
+	}
+	for _, test := range tests {
+		if h := fileHealth(test.redundancy, test.minPieces, test.numPieces); h != test.health {
+			t.Errorf("expected health %v for redundancy %v (%v/%v), got %v", test.health, test.redundancy, test.minPieces, test.numPieces, h)
+		}
+	}
+}
+
+// TestRenterCreateDir probes the CreateDir method of the renter.
+func TestRenterCreateDir(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a nested directory. The parents should be created as well.
+	if err := rt.renter.CreateDir("foo/bar"); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"", "foo", "foo/bar"} {
+		if !rt.renter.dirExists(dir) {
+			t.Errorf("directory '%v' should exist", dir)
+		}
+	}
+	// Creating the same directory again should fail.
+	if err := rt.renter.CreateDir("foo/bar"); err != ErrDirExists {
+		t.Fatal("expected ErrDirExists, got", err)
+	}
+	// Creating a directory with the name of a file should fail.
+	f := newTestingFile()
+	f.name = "foo/file"
+	rt.renter.files[f.name] = f
+	if err := rt.renter.CreateDir("foo/file"); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+	// Folders that are used by other parts of the renter can't be used.
+	if err := rt.renter.CreateDir("contracts"); err != errReservedPath {
+		t.Fatal("expected errReservedPath, got", err)
+	}
+	// Invalid siapaths should be rejected.
+	for _, siaPath := range []string{"", "/foo", "../foo", "foo/../bar"} {
+		if err := rt.renter.CreateDir(siaPath); err == nil {
+			t.Errorf("expected an error when creating directory '%v'", siaPath)
+		}
+	}
+}
+
+// TestRenterDirList probes the DirList method of the renter.
+func TestRenterDirList(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Listing a directory that doesn't exist should fail.
+	if _, _, err := rt.renter.DirList("foo"); err != ErrUnknownDir {
+		t.Fatal("expected ErrUnknownDir, got", err)
+	}
+
+	// Add a few files to the renter.
+	var sizes []uint64
+	for _, name := range []string{"root", "foo/a", "foo/b", "foo/bar/c"} {
+		f := newTestingFile()
+		f.name = name
+		rt.renter.files[f.name] = f
+		if err := rt.renter.saveFile(f); err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, f.size)
+	}
+	rt.renter.threadedBubbleMetadata("foo/bar")
+
+	// Check the root directory.
+	dirs, files, err := rt.renter.DirList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 2 || dirs[0].SiaPath != "" || dirs[1].SiaPath != "foo" {
+		t.Fatal("wrong directories returned:", dirs)
+	}
+	if len(files) != 1 || files[0].SiaPath != "root" {
+		t.Fatal("wrong files returned:", files)
+	}
+	root := dirs[0]
+	if root.NumFiles != 1 || root.NumSubDirs != 1 || root.AggregateNumFiles != 4 {
+		t.Fatal("wrong metadata for root directory:", root)
+	}
+	if root.AggregateSize != sizes[0]+sizes[1]+sizes[2]+sizes[3] {
+		t.Fatal("wrong aggregate size for root directory:", root.AggregateSize)
+	}
+
+	// Check the foo directory.
+	dirs, files, err = rt.renter.DirList("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 2 || dirs[0].SiaPath != "foo" || dirs[1].SiaPath != "foo/bar" {
+		t.Fatal("wrong directories returned:", dirs)
+	}
+	if len(files) != 2 {
+		t.Fatal("wrong number of files returned:", len(files))
+	}
+	foo := dirs[0]
+	if foo.NumFiles != 2 || foo.NumSubDirs != 1 || foo.AggregateNumFiles != 3 {
+		t.Fatal("wrong metadata for foo directory:", foo)
+	}
+	if foo.AggregateSize != sizes[1]+sizes[2]+sizes[3] {
+		t.Fatal("wrong aggregate size for foo directory:", foo.AggregateSize)
+	}
+	// None of the files have been uploaded.
+	if foo.Health <= 1 {
+		t.Fatal("files without any pieces should be unrecoverable, got health", foo.Health)
+	}
+
+	// Listing a directory shouldn't persist its metadata. The new file is
+	// only included in the metadata of the parents after a bubble.
+	f := newTestingFile()
+	f.name = "foo/d"
+	rt.renter.files[f.name] = f
+	if err := rt.renter.saveFile(f); err != nil {
+		t.Fatal(err)
+	}
+	mdPath := filepath.Join(rt.renter.persistDir, "foo", SiaDirMetadataFilename)
+	before, err := ioutil.ReadFile(mdPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirs, _, err = rt.renter.DirList("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirs[0].NumFiles != 3 || dirs[0].AggregateNumFiles != 4 {
+		t.Fatal("wrong metadata for foo directory:", dirs[0])
+	}
+	after, err := ioutil.ReadFile(mdPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatal("listing a directory modified its metadata file")
+	}
+	if dirs, _, err = rt.renter.DirList(""); err != nil {
+		t.Fatal(err)
+	} else if dirs[0].AggregateNumFiles != 4 || dirs[1].AggregateNumFiles != 3 {
+		t.Fatal("metadata changed before the bubble:", dirs)
+	}
+	rt.renter.threadedBubbleMetadata("foo")
+	if dirs, _, err = rt.renter.DirList(""); err != nil {
+		t.Fatal(err)
+	} else if dirs[0].AggregateNumFiles != 5 || dirs[1].AggregateNumFiles != 4 {
+		t.Fatal("metadata wasn't updated by the bubble:", dirs)
+	}
+}
+
+// TestRenterDeleteDir probes the DeleteDir method of the renter.
+func TestRenterDeleteDir(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// The root directory can't be deleted.
+	if err := rt.renter.DeleteDir(""); err != errDeleteRootDir {
+		t.Fatal("expected errDeleteRootDir, got", err)
+	}
+	if err := rt.renter.DeleteDir("foo"); err != ErrUnknownDir {
+		t.Fatal("expected ErrUnknownDir, got", err)
+	}
+
+	// Add files to a directory and delete it.
+	for _, name := range []string{"foo/a", "foo/bar/b", "foobar"} {
+		f := newTestingFile()
+		f.name = name
+		rt.renter.files[f.name] = f
+		rt.renter.persist.Tracking[f.name] = trackedFile{RepairPath: name}
+		if err := rt.renter.saveFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rt.renter.DeleteDir("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if rt.renter.dirExists("foo") || rt.renter.dirExists("foo/bar") {
+		t.Fatal("directory should have been deleted")
+	}
+	if _, err := os.Stat(filepath.Join(rt.renter.persistDir, "foo")); !os.IsNotExist(err) {
+		t.Fatal("directory should have been removed from disk:", err)
+	}
+	files := rt.renter.FileList()
+	if len(files) != 1 || files[0].SiaPath != "foobar" {
+		t.Fatal("only foobar should remain, got", files)
+	}
+	if len(rt.renter.persist.Tracking) != 1 {
+		t.Fatal("deleted files should no longer be tracked")
+	}
+}
+
+// deleteSectorsContractor is a hostContractor that records the sectors that
+// are deleted through its sessions.
+type deleteSectorsContractor struct {
+	hostContractor
+
+	mu      sync.Mutex
+	deleted map[crypto.Hash]struct{}
+}
+
+func (*deleteSectorsContractor) ResolveIDToPubKey(types.FileContractID) types.SiaPublicKey {
+	return types.SiaPublicKey{}
+}
+func (c *deleteSectorsContractor) Session(types.SiaPublicKey, <-chan struct{}) (contractor.Session, error) {
+	return deleteSectorsSession{c: c}, nil
+}
+
+// deleteSectorsSession is the contractor.Session of a
+// deleteSectorsContractor. It only supports deleting sectors.
+type deleteSectorsSession struct {
+	contractor.Session
+	c *deleteSectorsContractor
+}
+
+func (s deleteSectorsSession) DeleteSectors(roots []crypto.Hash) error {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	for _, root := range roots {
+		s.c.deleted[root] = struct{}{}
+	}
+	return nil
+}
+func (deleteSectorsSession) Close() error { return nil }
+
+// TestRenterDeleteDirSectors checks that DeleteDir removes the sectors of the
+// deleted files from the contracts, and keeps the sectors that are still used
+// by other files.
+func TestRenterDeleteDirSectors(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	hc := &deleteSectorsContractor{
+		hostContractor: rt.renter.hostContractor,
+		deleted:        make(map[crypto.Hash]struct{}),
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.hostContractor = hc
+	rt.renter.mu.Unlock(id)
+
+	// Add files that share a contract, and delete the directory of two of
+	// them.
+	fcid := types.FileContractID{1}
+	shared := crypto.Hash{1}
+	roots := make(map[string]crypto.Hash)
+	for i, name := range []string{"foo/a", "foo/bar/b", "foobar"} {
+		f := newTestingFile()
+		f.name = name
+		roots[name] = crypto.Hash{byte(i + 2)}
+		f.contracts = map[types.FileContractID]fileContract{
+			fcid: {
+				ID:     fcid,
+				Pieces: []pieceData{{MerkleRoot: roots[name]}, {MerkleRoot: shared}},
+			},
+		}
+		rt.renter.files[f.name] = f
+		rt.renter.persist.Tracking[f.name] = trackedFile{RepairPath: name}
+		if err := rt.renter.saveFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rt.renter.DeleteDir("foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sectors of the deleted files should be removed, but not the sectors
+	// of foobar.
+	err = build.Retry(100, 10*time.Millisecond, func() error {
+		hc.mu.Lock()
+		defer hc.mu.Unlock()
+		if len(hc.deleted) != 2 {
+			return errors.New("sectors weren't deleted")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	for _, name := range []string{"foo/a", "foo/bar/b"} {
+		if _, deleted := hc.deleted[roots[name]]; !deleted {
+			t.Fatal("sector of deleted file wasn't deleted:", name)
+		}
+	}
+	if _, deleted := hc.deleted[roots["foobar"]]; deleted {
+		t.Fatal("sector of remaining file was deleted")
+	}
+	if _, deleted := hc.deleted[shared]; deleted {
+		t.Fatal("sector that is still in use was deleted")
+	}
+}
+
+// TestRenterRenameDir probes the RenameDir method of the renter.
+func TestRenterRenameDir(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	for _, name := range []string{"foo/a", "foo/bar/b"} {
+		f := newTestingFile()
+		f.name = name
+		rt.renter.files[f.name] = f
+		rt.renter.persist.Tracking[f.name] = trackedFile{RepairPath: name}
+		if err := rt.renter.saveFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rt.renter.CreateDir("baz"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid renames.
+	if err := rt.renter.RenameDir("dne", "qux"); err != ErrUnknownDir {
+		t.Fatal("expected ErrUnknownDir, got", err)
+	}
+	if err := rt.renter.RenameDir("foo", "baz"); err != ErrDirExists {
+		t.Fatal("expected ErrDirExists, got", err)
+	}
+	if err := rt.renter.RenameDir("foo", "foo/qux"); err != errRenameDirIntoItself {
+		t.Fatal("expected errRenameDirIntoItself, got", err)
+	}
+
+	// Move foo into baz.
+	if err := rt.renter.RenameDir("foo", "baz/qux"); err != nil {
+		t.Fatal(err)
+	}
+	if rt.renter.dirExists("foo") || !rt.renter.dirExists("baz/qux/bar") {
+		t.Fatal("directory wasn't moved")
+	}
+	for _, name := range []string{"baz/qux/a", "baz/qux/bar/b"} {
+		f, exists := rt.renter.files[name]
+		if !exists || f.name != name {
+			t.Fatal("file wasn't renamed:", name)
+		}
+		if _, exists := rt.renter.persist.Tracking[name]; !exists {
+			t.Fatal("tracking entry wasn't renamed:", name)
+		}
+	}
+	if len(rt.renter.files) != 2 || len(rt.renter.persist.Tracking) != 2 {
+		t.Fatal("old entries should have been removed")
+	}
+
+	// Reload the renter's files from disk to make sure the .sia files were
+	// updated.
+	rt.renter.files = make(map[string]*file)
+	if err := rt.renter.loadSiaFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := rt.renter.files["baz/qux/bar/b"]; !exists || len(rt.renter.files) != 2 {
+		t.Fatal("renamed files weren't persisted correctly")
+	}
+}
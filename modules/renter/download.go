@@ -124,6 +124,8 @@ package renter
 // heap.
 
 import (
+	"container/heap"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -136,6 +138,7 @@ import (
 	"gitlab.com/NebulousLabs/Sia/types"
 
 	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
 )
 
 type (
@@ -145,16 +148,29 @@ type (
 		atomicDataReceived         uint64 // Incremented as data completes, will stop at 100% file progress.
 		atomicTotalDataTransferred uint64 // Incremented as data arrives, includes overdrive, contract negotiation, etc.
 
+		// Priority of the download. Downloads with higher priority will
+		// complete first. The priority can be changed while the download is
+		// in progress.
+		atomicPriority uint64
+
 		// Other progress variables.
-		chunksRemaining uint64        // Number of chunks whose downloads are incomplete.
-		completeChan    chan struct{} // Closed once the download is complete.
-		err             error         // Only set if there was an error which prevented the download from completing.
+		chunks          []*unfinishedDownloadChunk // All of the chunks of the download.
+		chunksRemaining uint64                     // Number of chunks whose downloads are incomplete.
+		completeChan    chan struct{}              // Closed once the download is complete.
+		err             error                      // Only set if there was an error which prevented the download from completing.
+
+		// Paused downloads don't distribute any chunks to the workers. The
+		// chunks are taken out of the download heap and stored in
+		// pausedChunks until the download is resumed.
+		paused       bool
+		pausedChunks []*unfinishedDownloadChunk
 
 		// Timestamp information.
 		endTime         time.Time // Set immediately before closing 'completeChan'.
 		staticStartTime time.Time // Set immediately when the download object is created.
 
 		// Basic information about the file.
+		staticID              modules.DownloadID
 		destination           downloadDestination
 		destinationString     string // The string reported to the user to indicate the download's destination.
 		staticDestinationType string // "memory buffer", "http stream", "file", etc.
@@ -165,7 +181,6 @@ type (
 		// Retrieval settings for the file.
 		staticLatencyTarget time.Duration // In milliseconds. Lower latency results in lower total system throughput.
 		staticOverdrive     int           // How many extra pieces to download to prevent slow hosts from being a bottleneck.
-		staticPriority      uint64        // Downloads with higher priority will complete first.
 
 		// Utilities.
 		log           *persist.Logger // Same log as the renter.
@@ -217,6 +232,26 @@ func (d *download) managedFail(err error) {
 	}
 }
 
+// managedCancel fails the download and releases the resources of all of its
+// chunks. Chunks which are currently being fetched by workers are released as
+// soon as the workers return.
+func (d *download) managedCancel() {
+	d.managedFail(errDownloadCancelled)
+
+	d.mu.Lock()
+	chunks := d.chunks
+	d.pausedChunks = nil
+	d.mu.Unlock()
+	for _, udc := range chunks {
+		udc.mu.Lock()
+		if !udc.failed && !udc.recoveryComplete {
+			udc.fail(errDownloadCancelled)
+		}
+		udc.returnMemory()
+		udc.mu.Unlock()
+	}
+}
+
 // staticComplete is a helper function to indicate whether or not the download
 // has completed.
 func (d *download) staticComplete() bool {
@@ -253,10 +288,118 @@ func (r *Renter) Download(p modules.RenterDownloadParameters) error {
 }
 
 // DownloadAsync performs a file download using the passed parameters without
-// blocking until the download is finished.
-func (r *Renter) DownloadAsync(p modules.RenterDownloadParameters) error {
-	_, err := r.managedDownload(p)
-	return err
+// blocking until the download is finished. The ID of the download is returned.
+func (r *Renter) DownloadAsync(p modules.RenterDownloadParameters) (modules.DownloadID, error) {
+	d, err := r.managedDownload(p)
+	if err != nil {
+		return "", err
+	}
+	return d.staticID, nil
+}
+
+// managedDownloadByID returns the download with the given ID from the download
+// history.
+func (r *Renter) managedDownloadByID(id modules.DownloadID) (*download, error) {
+	r.downloadHistoryMu.Lock()
+	defer r.downloadHistoryMu.Unlock()
+	for _, d := range r.downloadHistory {
+		if d.staticID == id {
+			return d, nil
+		}
+	}
+	return nil, errUnknownDownload
+}
+
+// CancelDownload cancels the download with the given ID. The memory held by
+// the download is released and no further chunks are fetched.
+func (r *Renter) CancelDownload(id modules.DownloadID) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	d, err := r.managedDownloadByID(id)
+	if err != nil {
+		return err
+	}
+	if d.staticComplete() {
+		return errDownloadComplete
+	}
+	d.managedCancel()
+	return nil
+}
+
+// PauseDownload pauses the download with the given ID. Chunks which are
+// already being fetched by the workers will still complete, but no new chunks
+// will be started until the download is resumed.
+func (r *Renter) PauseDownload(id modules.DownloadID) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	d, err := r.managedDownloadByID(id)
+	if err != nil {
+		return err
+	}
+	if d.staticComplete() {
+		return errDownloadComplete
+	}
+	d.mu.Lock()
+	d.paused = true
+	d.mu.Unlock()
+	return nil
+}
+
+// ResumeDownload resumes the paused download with the given ID.
+func (r *Renter) ResumeDownload(id modules.DownloadID) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	d, err := r.managedDownloadByID(id)
+	if err != nil {
+		return err
+	}
+	if d.staticComplete() {
+		return errDownloadComplete
+	}
+	d.mu.Lock()
+	d.paused = false
+	pausedChunks := d.pausedChunks
+	d.pausedChunks = nil
+	d.mu.Unlock()
+
+	// Return the chunks to the download heap.
+	for _, udc := range pausedChunks {
+		r.managedAddChunkToDownloadHeap(udc)
+	}
+	select {
+	case r.newDownloads <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SetDownloadPriority changes the priority of the download with the given ID.
+// Downloads with a higher priority are processed first.
+func (r *Renter) SetDownloadPriority(id modules.DownloadID, priority uint64) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	d, err := r.managedDownloadByID(id)
+	if err != nil {
+		return err
+	}
+	if d.staticComplete() {
+		return errDownloadComplete
+	}
+	atomic.StoreUint64(&d.atomicPriority, priority)
+
+	// The order of the heap might have changed.
+	r.downloadHeapMu.Lock()
+	heap.Init(r.downloadHeap)
+	r.downloadHeapMu.Unlock()
+	return nil
 }
 
 // managedDownload performs a file download using the passed parameters and
@@ -359,26 +502,67 @@ func (r *Renter) managedNewDownload(params downloadParams) (*download, error) {
 		return nil, errors.New("download is requesting data past the boundary of the file")
 	}
 
+	// Packed files are downloaded from the corresponding range of their pack.
+	// Until the pack is fully uploaded, the range is read from the buffered
+	// data of the pack instead.
+	siaPath, offset := params.file.name, params.offset
+	var packData []byte
+	if params.file.packName != "" {
+		pack := r.managedDataFile(params.file)
+		if pack == params.file {
+			return nil, errUnknownPack
+		}
+		params.offset += params.file.packOffset
+		params.file = pack
+
+		var err error
+		packData, err = r.readPackData(pack, params.offset, params.length)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
 	// Create the download object.
 	d := &download{
-		completeChan: make(chan struct{}),
+		atomicPriority: params.priority,
+		completeChan:   make(chan struct{}),
 
 		staticStartTime: time.Now(),
 
+		staticID:              modules.DownloadID(hex.EncodeToString(fastrand.Bytes(16))),
 		destination:           params.destination,
 		destinationString:     params.destinationString,
 		staticDestinationType: params.destinationType,
 		staticLatencyTarget:   params.latencyTarget,
 		staticLength:          params.length,
-		staticOffset:          params.offset,
+		staticOffset:          offset,
 		staticOverdrive:       params.overdrive,
-		staticSiaPath:         params.file.name,
-		staticPriority:        params.priority,
+		staticSiaPath:         siaPath,
 
 		log:           r.log,
 		memoryManager: r.memoryManager,
 	}
 
+	// Serve the buffered data of a pack directly.
+	if packData != nil {
+		_, err := params.destination.WriteAt(packData, 0)
+		if err != nil {
+			d.managedFail(errors.AddContext(err, "unable to write to download destination"))
+			return d, nil
+		}
+		atomic.StoreUint64(&d.atomicDataReceived, params.length)
+		d.mu.Lock()
+		d.endTime = time.Now()
+		close(d.completeChan)
+		err = d.destination.Close()
+		d.destination = nil
+		d.mu.Unlock()
+		if err != nil {
+			d.log.Println("unable to close download destination:", err)
+		}
+		return d, nil
+	}
+
 	// Determine which chunks to download.
 	minChunk := params.offset / params.file.staticChunkSize()
 	maxChunk := (params.offset + params.length - 1) / params.file.staticChunkSize()
@@ -416,14 +600,19 @@ func (r *Renter) managedNewDownload(params downloadParams) (*download, error) {
 	// Queue the downloads for each chunk.
 	writeOffset := int64(0) // where to write a chunk within the download destination.
 	d.chunksRemaining += maxChunk - minChunk + 1
+	d.chunks = make([]*unfinishedDownloadChunk, 0, maxChunk-minChunk+1)
 	for i := minChunk; i <= maxChunk; i++ {
+		params.file.mu.RLock()
+		chunkKey, keyIndex := params.file.chunkKey(i)
+		params.file.mu.RUnlock()
 		udc := &unfinishedDownloadChunk{
 			destination: params.destination,
 			erasureCode: params.file.erasureCode,
-			masterKey:   params.file.masterKey,
+			chunkKey:    chunkKey,
+			keyIndex:    keyIndex,
 
 			staticChunkIndex: i,
-			staticCacheID:    fmt.Sprintf("%v:%v", d.staticSiaPath, i),
+			staticCacheID:    fmt.Sprintf("%v:%v", params.file.staticUID, i),
 			staticChunkMap:   chunkMaps[i-minChunk],
 			staticChunkSize:  params.file.staticChunkSize(),
 			staticPieceSize:  params.file.pieceSize,
@@ -439,8 +628,8 @@ func (r *Renter) managedNewDownload(params downloadParams) (*download, error) {
 			// workers that we have.
 			staticLatencyTarget: params.latencyTarget + (25 * time.Duration(i-minChunk)), // Increase target by 25ms per chunk.
 			staticNeedsMemory:   params.needsMemory,
-			staticPriority:      params.priority,
 
+			partialPieces:     make([]bool, params.file.erasureCode.NumPieces()),
 			physicalChunkData: make([][]byte, params.file.erasureCode.NumPieces()),
 			pieceUsage:        make([]bool, params.file.erasureCode.NumPieces()),
 
@@ -467,6 +656,15 @@ func (r *Renter) managedNewDownload(params downloadParams) (*download, error) {
 		udc.staticWriteOffset = writeOffset
 		writeOffset += int64(udc.staticFetchLength)
 
+		// If the erasure code allows it, and the fetched range is covered by
+		// fewer than MinPieces data pieces, only download those data pieces.
+		if rr, ok := params.file.erasureCode.(modules.RangeRecoverer); ok {
+			dataPieces := rr.DataPieces(params.file.pieceSize, udc.staticFetchOffset, udc.staticFetchLength)
+			if len(dataPieces) < params.file.erasureCode.MinPieces() {
+				udc.rangePieces = dataPieces
+			}
+		}
+
 		// TODO: Currently all chunks are given overdrive. This should probably
 		// be changed once the hostdb knows how to measure host speed/latency
 		// and once we can assign overdrive dynamically.
@@ -474,6 +672,9 @@ func (r *Renter) managedNewDownload(params downloadParams) (*download, error) {
 
 		// Add this chunk to the chunk heap, and notify the download loop that
 		// there is work to do.
+		d.mu.Lock()
+		d.chunks = append(d.chunks, udc)
+		d.mu.Unlock()
 		r.managedAddChunkToDownloadHeap(udc)
 		select {
 		case r.newDownloads <- struct{}{}:
@@ -501,8 +702,9 @@ func (r *Renter) DownloadHistory() []modules.DownloadInfo {
 	for i := range r.downloadHistory {
 		// Order from most recent to least recent.
 		d := r.downloadHistory[len(r.downloadHistory)-i-1]
-		d.mu.Lock() // Lock required for d.endTime only.
+		d.mu.Lock() // Lock required for d.endTime and d.paused only.
 		downloads[i] = modules.DownloadInfo{
+			ID:              d.staticID,
 			Destination:     d.destinationString,
 			DestinationType: d.staticDestinationType,
 			Length:          d.staticLength,
@@ -515,6 +717,9 @@ func (r *Renter) DownloadHistory() []modules.DownloadInfo {
 			StartTime:            d.staticStartTime,
 			StartTimeUnix:        d.staticStartTime.UnixNano(),
 			TotalDataTransferred: atomic.LoadUint64(&d.atomicTotalDataTransferred),
+
+			Paused:   d.paused,
+			Priority: atomic.LoadUint64(&d.atomicPriority),
 		}
 		// Release download lock before calling d.Err(), which will acquire the
 		// lock. The error needs to be checked separately because we need to
@@ -1,12 +1,108 @@
 package renter
 
 import (
+	"container/heap"
 	"testing"
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/types"
 )
 
+// TestDownloadHeapPriority checks that chunks are popped from the download
+// heap in order of the priority of their download, that priority changes are
+// respected and that chunks of paused downloads are set aside.
+func TestDownloadHeapPriority(t *testing.T) {
+	r := &Renter{downloadHeap: new(downloadChunkHeap)}
+	low := &download{atomicPriority: 1, completeChan: make(chan struct{})}
+	mid := &download{atomicPriority: 5, completeChan: make(chan struct{})}
+	high := &download{atomicPriority: 10, completeChan: make(chan struct{})}
+	for _, d := range []*download{mid, low, high} {
+		heap.Push(r.downloadHeap, &unfinishedDownloadChunk{download: d})
+	}
+
+	// Raise the priority of the low priority download above all others.
+	low.atomicPriority = 20
+	heap.Init(r.downloadHeap)
+
+	// Pause the mid priority download, its chunk should be skipped.
+	mid.paused = true
+	for _, expected := range []*download{low, high} {
+		udc := r.managedNextDownloadChunk()
+		if udc == nil || udc.download != expected {
+			t.Fatal("chunks were popped in the wrong order")
+		}
+	}
+	if r.managedNextDownloadChunk() != nil {
+		t.Fatal("chunk of paused download should not be returned")
+	}
+	if len(mid.pausedChunks) != 1 {
+		t.Fatal("chunk of paused download should have been set aside")
+	}
+}
+
+// TestCancelDownload probes the CancelDownload method of the renter.
+func TestCancelDownload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a download with a single chunk that holds some memory.
+	rsc, _ := NewRSCode(1, 1)
+	d := &download{
+		staticID:      "foo",
+		completeChan:  make(chan struct{}),
+		log:           rt.renter.log,
+		memoryManager: rt.renter.memoryManager,
+	}
+	udc := &unfinishedDownloadChunk{
+		download:         d,
+		erasureCode:      rsc,
+		staticPieceSize:  100,
+		workersRemaining: 2,
+		memoryAllocated:  200,
+	}
+	d.chunks = []*unfinishedDownloadChunk{udc}
+	available := rt.renter.memoryManager.available
+	if !rt.renter.memoryManager.Request(200, memoryPriorityLow) {
+		t.Fatal("unable to request memory")
+	}
+	rt.renter.downloadHistoryMu.Lock()
+	rt.renter.downloadHistory = append(rt.renter.downloadHistory, d)
+	rt.renter.downloadHistoryMu.Unlock()
+
+	if err := rt.renter.CancelDownload("bar"); err != errUnknownDownload {
+		t.Fatal("expected errUnknownDownload, got", err)
+	}
+	if err := rt.renter.CancelDownload("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if !d.staticComplete() || d.Err() != errDownloadCancelled {
+		t.Fatal("download should have failed with errDownloadCancelled, got", d.Err())
+	}
+	if !udc.failed || udc.memoryAllocated != 0 {
+		t.Fatal("chunk should have been failed and its memory released")
+	}
+	if rt.renter.memoryManager.available != available {
+		t.Fatal("memory wasn't returned to the memory manager")
+	}
+
+	// A completed download can't be cancelled, paused or resumed.
+	if err := rt.renter.CancelDownload("foo"); err != errDownloadComplete {
+		t.Fatal("expected errDownloadComplete, got", err)
+	}
+	if err := rt.renter.PauseDownload("foo"); err != errDownloadComplete {
+		t.Fatal("expected errDownloadComplete, got", err)
+	}
+	if err := rt.renter.ResumeDownload("foo"); err != errDownloadComplete {
+		t.Fatal("expected errDownloadComplete, got", err)
+	}
+}
+
 // TestClearDownloads tests all the edge cases of the ClearDownloadHistory Method
 func TestClearDownloads(t *testing.T) {
 	if testing.Short() {
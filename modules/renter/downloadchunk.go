@@ -37,10 +37,11 @@ type unfinishedDownloadChunk struct {
 	// Fetch + Write instructions - read only or otherwise thread safe.
 	destination downloadDestination // Where to write the recovered logical chunk.
 	erasureCode modules.ErasureCoder
-	masterKey   crypto.TwofishKey
+	chunkKey    crypto.CipherKey // Key that the piece keys are derived from.
+	keyIndex    uint64           // Chunk index used to derive the piece keys.
 
 	// Fetch + Write instructions - read only or otherwise thread safe.
-	staticChunkIndex  uint64                       // Required for deriving the encryption keys for each piece.
+	staticChunkIndex  uint64                       // Index of the chunk within the file.
 	staticCacheID     string                       // Used to uniquely identify a chunk in the chunk cache.
 	staticChunkMap    map[string]downloadPieceInfo // Maps from host PubKey to the info for the piece associated with that host
 	staticChunkSize   uint64
@@ -53,14 +54,15 @@ type unfinishedDownloadChunk struct {
 	staticLatencyTarget time.Duration
 	staticNeedsMemory   bool // Set to true if memory was not pre-allocated for this chunk.
 	staticOverdrive     int
-	staticPriority      uint64
 
 	// Download chunk state - need mutex to access.
 	failed            bool      // Indicates if the chunk has been marked as failed.
+	partialPieces     []bool    // Which data pieces only contain the part of the fetched range.
 	physicalChunkData [][]byte  // Used to recover the logical data.
 	pieceUsage        []bool    // Which pieces are being actively fetched.
 	piecesCompleted   int       // Number of pieces that have successfully completed.
 	piecesRegistered  int       // Number of pieces that workers are actively fetching.
+	rangePieces       []uint64  // Data pieces sufficient to recover the fetched range, nil if MinPieces pieces are needed.
 	recoveryComplete  bool      // Whether or not the recovery has completed and the chunk memory released.
 	workersRemaining  int       // Number of workers still able to fetch the chunk.
 	workersStandby    []*worker // Set of workers that are able to work on this download, but are not needed unless other workers fail.
@@ -89,6 +91,60 @@ func (udc *unfinishedDownloadChunk) fail(err error) {
 	udc.destination = nil
 }
 
+// abandonRangePieces falls back to recovering the chunk from any MinPieces
+// pieces. Data pieces that were only fetched partially can't be used to
+// recover the whole chunk, so they are dropped and have to be fetched again.
+func (udc *unfinishedDownloadChunk) abandonRangePieces() {
+	for _, i := range udc.rangePieces {
+		if udc.partialPieces[i] {
+			udc.partialPieces[i] = false
+			udc.physicalChunkData[i] = nil
+			udc.pieceUsage[i] = false
+			udc.piecesCompleted--
+		}
+	}
+	udc.rangePieces = nil
+}
+
+// piecesNeeded returns the number of pieces that need to be downloaded to
+// recover the fetched data.
+func (udc *unfinishedDownloadChunk) piecesNeeded() int {
+	if udc.rangePieces != nil {
+		return len(udc.rangePieces)
+	}
+	return udc.erasureCode.MinPieces()
+}
+
+// wantsPiece returns true if the piece with the given index helps to recover
+// the fetched data.
+func (udc *unfinishedDownloadChunk) wantsPiece(index uint64) bool {
+	if udc.rangePieces == nil {
+		return true
+	}
+	for _, i := range udc.rangePieces {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// complete returns true if enough pieces have been downloaded to recover the
+// fetched data.
+func (udc *unfinishedDownloadChunk) complete() bool {
+	if udc.piecesCompleted >= udc.erasureCode.MinPieces() {
+		return true
+	} else if udc.rangePieces == nil {
+		return false
+	}
+	for _, i := range udc.rangePieces {
+		if udc.physicalChunkData[i] == nil {
+			return false
+		}
+	}
+	return true
+}
+
 // managedCleanUp will check if the download has failed, and if not it will add
 // any standby workers which need to be added. Calling managedCleanUp too many
 // times is not harmful, however missing a call to managedCleanUp can lead to
@@ -109,8 +165,8 @@ func (udc *unfinishedDownloadChunk) managedCleanUp() {
 	}
 
 	// Check whether standby workers are required.
-	chunkComplete := udc.piecesCompleted >= udc.erasureCode.MinPieces()
-	desiredPiecesRegistered := udc.erasureCode.MinPieces() + udc.staticOverdrive - udc.piecesCompleted
+	chunkComplete := udc.complete()
+	desiredPiecesRegistered := udc.piecesNeeded() + udc.staticOverdrive - udc.piecesCompleted
 	standbyWorkersRequired := !chunkComplete && udc.piecesRegistered < desiredPiecesRegistered
 	if !standbyWorkersRequired {
 		udc.mu.Unlock()
@@ -150,7 +206,7 @@ func (udc *unfinishedDownloadChunk) returnMemory() {
 	maxMemory := uint64(udc.workersRemaining+udc.piecesCompleted) * udc.staticPieceSize
 	// If enough pieces have completed, max memory is the number of registered
 	// pieces plus the number of completed pieces.
-	if udc.piecesCompleted >= udc.erasureCode.MinPieces() {
+	if udc.complete() {
 		// udc.piecesRegistered is guaranteed to be at most equal to the number
 		// of overdrive pieces, meaning it will be equal to or less than
 		// initialMemory.
@@ -176,12 +232,27 @@ func (udc *unfinishedDownloadChunk) threadedRecoverLogicalData() error {
 	// succeeds or fails.
 	defer udc.managedCleanUp()
 
+	// If fewer than MinPieces pieces were downloaded, the chunk is recovered
+	// from the data pieces of the fetched range only.
+	udc.mu.Lock()
+	recoverRange := udc.piecesCompleted < udc.erasureCode.MinPieces()
+	udc.mu.Unlock()
+
 	// Recover the pieces into the logical chunk data.
 	//
 	// TODO: Might be some way to recover into the downloadDestination instead
 	// of creating a buffer and then writing that.
 	recoverWriter := new(bytes.Buffer)
-	err := udc.erasureCode.Recover(udc.physicalChunkData, udc.staticChunkSize, recoverWriter)
+	var err error
+	start := udc.staticFetchOffset
+	end := udc.staticFetchOffset + udc.staticFetchLength
+	if recoverRange {
+		rr := udc.erasureCode.(modules.RangeRecoverer)
+		err = rr.RecoverRange(udc.physicalChunkData, udc.staticPieceSize, udc.staticFetchOffset, udc.staticFetchLength, recoverWriter)
+		start, end = 0, udc.staticFetchLength
+	} else {
+		err = udc.erasureCode.Recover(udc.physicalChunkData, udc.staticChunkSize, recoverWriter)
+	}
 	if err != nil {
 		udc.mu.Lock()
 		udc.fail(err)
@@ -196,8 +267,8 @@ func (udc *unfinishedDownloadChunk) threadedRecoverLogicalData() error {
 	// Get recovered data
 	recoveredData := recoverWriter.Bytes()
 
-	// Add the chunk to the cache.
-	if udc.download.staticDestinationType == destinationTypeSeekStream {
+	// Add the chunk to the cache. Partially recovered chunks are not cached.
+	if udc.download.staticDestinationType == destinationTypeSeekStream && !recoverRange {
 		// We only cache streaming chunks since browsers and media players tend
 		// to only request a few kib at once when streaming data. That way we can
 		// prevent scheduling the same chunk for download over and over.
@@ -205,8 +276,6 @@ func (udc *unfinishedDownloadChunk) threadedRecoverLogicalData() error {
 	}
 
 	// Write the bytes to the requested output.
-	start := udc.staticFetchOffset
-	end := udc.staticFetchOffset + udc.staticFetchLength
 	_, err = udc.destination.WriteAt(recoveredData[start:end], udc.staticWriteOffset)
 	if err != nil {
 		udc.mu.Lock()
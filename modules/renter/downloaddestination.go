@@ -39,10 +39,10 @@ type downloadDestination interface {
 // This buffer is primarily used when performing repairs on uploads.
 type downloadDestinationBuffer [][]byte
 
-// NewDownloadDestinationBuffer allocates the necessary number of shards for
-// the downloadDestinationBuffer and returns the new buffer.
-func NewDownloadDestinationBuffer(length uint64) downloadDestinationBuffer {
-	// Round length up to next multiple of SectorSize.
+// NewDownloadDestinationBuffer allocates the necessary number of shards of
+// size pieceSize for the downloadDestinationBuffer and returns the new buffer.
+func NewDownloadDestinationBuffer(length, pieceSize uint64) downloadDestinationBuffer {
+	// Round length up to next multiple of pieceSize.
 	if length%pieceSize != 0 {
 		length += pieceSize - length%pieceSize
 	}
@@ -75,6 +75,10 @@ func (dw downloadDestinationBuffer) ReadFrom(r io.Reader) (int64, error) {
 
 // WriteAt writes the provided data to the downloadDestinationBuffer.
 func (dw downloadDestinationBuffer) WriteAt(data []byte, offset int64) (int, error) {
+	var pieceSize uint64
+	if len(dw) > 0 {
+		pieceSize = uint64(len(dw[0]))
+	}
 	if uint64(len(data))+uint64(offset) > uint64(len(dw))*pieceSize || offset < 0 {
 		return 0, errors.New("write at specified offset exceeds buffer size")
 	}
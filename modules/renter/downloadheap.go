@@ -10,6 +10,7 @@ package renter
 import (
 	"container/heap"
 	"errors"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,6 +19,10 @@ var (
 	errInsufficientHosts    = errors.New("insufficient hosts to recover file")
 	errInsufficientPieces   = errors.New("couldn't fetch enough pieces to recover data")
 	errPrevErr              = errors.New("download could not be completed due to a previous error")
+
+	errDownloadCancelled = errors.New("download was cancelled")
+	errDownloadComplete  = errors.New("download has already completed")
+	errUnknownDownload   = errors.New("no download with that id")
 )
 
 // downloadChunkHeap is a heap that is sorted first by file priority, then by
@@ -31,8 +36,10 @@ type downloadChunkHeap []*unfinishedDownloadChunk
 func (dch downloadChunkHeap) Len() int { return len(dch) }
 func (dch downloadChunkHeap) Less(i, j int) bool {
 	// First sort by priority.
-	if dch[i].staticPriority != dch[j].staticPriority {
-		return dch[i].staticPriority > dch[j].staticPriority
+	pi := atomic.LoadUint64(&dch[i].download.atomicPriority)
+	pj := atomic.LoadUint64(&dch[j].download.atomicPriority)
+	if pi != pj {
+		return pi > pj
 	}
 	// For equal priority, sort by start time.
 	if dch[i].download.staticStartTime != dch[j].download.staticStartTime {
@@ -98,7 +105,7 @@ func (r *Renter) managedAddChunkToDownloadHeap(udc *unfinishedDownloadChunk) {
 
 	// Put the chunk into the chunk heap.
 	r.downloadHeapMu.Lock()
-	r.downloadHeap.Push(udc)
+	heap.Push(r.downloadHeap, udc)
 	r.downloadHeapMu.Unlock()
 }
 
@@ -124,6 +131,22 @@ func (r *Renter) managedDistributeDownloadChunkToWorkers(udc *unfinishedDownload
 	id := r.mu.Lock()
 	udc.mu.Lock()
 	udc.workersRemaining = len(r.workerPool)
+	// Only download the data pieces of the fetched range if there is a worker
+	// for each of them.
+	if udc.rangePieces != nil {
+		available := make(map[uint64]bool)
+		for _, worker := range r.workerPool {
+			if pd, ok := udc.staticChunkMap[string(worker.contract.HostPublicKey.Key)]; ok {
+				available[pd.index] = true
+			}
+		}
+		for _, i := range udc.rangePieces {
+			if !available[i] {
+				udc.rangePieces = nil
+				break
+			}
+		}
+	}
 	udc.mu.Unlock()
 	for _, worker := range r.workerPool {
 		worker.managedQueueDownloadChunk(udc)
@@ -147,7 +170,19 @@ func (r *Renter) managedNextDownloadChunk() *unfinishedDownloadChunk {
 			return nil
 		}
 		nextChunk := heap.Pop(r.downloadHeap).(*unfinishedDownloadChunk)
-		if !nextChunk.download.staticComplete() {
+		if nextChunk.download.staticComplete() {
+			continue
+		}
+		// Chunks of paused downloads are set aside until the download is
+		// resumed.
+		d := nextChunk.download
+		d.mu.Lock()
+		paused := d.paused
+		if paused {
+			d.pausedChunks = append(d.pausedChunks, nextChunk)
+		}
+		d.mu.Unlock()
+		if !paused {
 			return nextChunk
 		}
 	}
@@ -7,6 +7,8 @@ import (
 	"math"
 	"time"
 
+	"gitlab.com/NebulousLabs/Sia/modules"
+
 	"gitlab.com/NebulousLabs/errors"
 )
 
@@ -17,6 +19,13 @@ type (
 		file   *file
 		offset int64
 		r      *Renter
+
+		// piece contains the most recently downloaded part of a data piece
+		// of a file whose erasure code can recover ranges from data pieces,
+		// and pieceOffset is its offset within the file. Reads within the
+		// part are served from memory.
+		piece       []byte
+		pieceOffset int64
 	}
 )
 
@@ -64,12 +73,32 @@ func (s *streamer) Read(p []byte) (n int, err error) {
 		return 0, io.EOF
 	}
 
+	// Serve the read from the buffered data piece if possible.
+	if s.offset >= s.pieceOffset && s.offset < s.pieceOffset+int64(len(s.piece)) {
+		n = copy(p, s.piece[s.offset-s.pieceOffset:])
+		s.offset += int64(n)
+		return n, nil
+	}
+
 	// Calculate how much we can download. We never download more than a single chunk.
 	chunkSize := s.file.staticChunkSize()
 	remainingData := uint64(fileSize - s.offset)
 	requestedData := uint64(len(p))
 	remainingChunk := chunkSize - uint64(s.offset)%chunkSize
 	length := min(remainingData, requestedData, remainingChunk)
+	offset := s.offset
+
+	// If the erasure code can recover ranges from data pieces, download up to
+	// streamReadAheadSize bytes of the data piece that contains the offset.
+	// This only requires a single piece, of which the workers only fetch the
+	// downloaded part, and the following reads can be served from memory.
+	// Chunks are aligned to pieces, so the data piece is part of a single
+	// chunk.
+	_, rangeRecoverer := s.file.erasureCode.(modules.RangeRecoverer)
+	if rangeRecoverer {
+		remainingPiece := s.file.pieceSize - uint64(s.offset)%s.file.pieceSize
+		length = min(remainingData, remainingPiece, streamReadAheadSize)
+	}
 
 	// Download data
 	buffer := bytes.NewBuffer([]byte{})
@@ -82,7 +111,7 @@ func (s *streamer) Read(p []byte) (n int, err error) {
 		latencyTarget: 50 * time.Millisecond, // TODO low default until full latency suport is added.
 		length:        length,
 		needsMemory:   true,
-		offset:        uint64(s.offset),
+		offset:        uint64(offset),
 		overdrive:     5,    // TODO: high default until full overdrive support is added.
 		priority:      1000, // TODO: high default until full priority support is added.
 	})
@@ -106,6 +135,15 @@ func (s *streamer) Read(p []byte) (n int, err error) {
 		return 0, errors.New("download interrupted by shutdown")
 	}
 
+	// Buffer the part of the data piece and serve the read from it.
+	if rangeRecoverer {
+		s.piece = buffer.Bytes()
+		s.pieceOffset = offset
+		n = copy(p, s.piece[s.offset-offset:])
+		s.offset += int64(n)
+		return n, nil
+	}
+
 	// Copy downloaded data into buffer.
 	copy(p, buffer.Bytes())
 
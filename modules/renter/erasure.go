@@ -1,6 +1,7 @@
 package renter
 
 import (
+	"errors"
 	"fmt"
 	"io"
 
@@ -9,6 +10,20 @@ import (
 	"gitlab.com/NebulousLabs/Sia/modules"
 )
 
+const (
+	// CodeTypeReedSolomon identifies the Reed-Solomon erasure code.
+	CodeTypeReedSolomon = "Reed-Solomon"
+
+	// CodeTypeReedSolomonSystematic identifies the systematic Reed-Solomon
+	// erasure code, which allows ranges of a chunk to be recovered from its
+	// data pieces.
+	CodeTypeReedSolomonSystematic = "Reed-Solomon-Systematic"
+
+	// CodeTypeReplication identifies the replication erasure code, which
+	// stores full copies of a chunk.
+	CodeTypeReplication = "Replication"
+)
+
 // rsCode is a Reed-Solomon encoder/decoder. It implements the
 // modules.ErasureCoder interface.
 type rsCode struct {
@@ -47,9 +62,10 @@ func (rs *rsCode) EncodeShards(pieces [][]byte) ([][]byte, error) {
 	if len(pieces) != rs.MinPieces() {
 		return nil, fmt.Errorf("invalid number of pieces given %v %v", len(pieces), rs.MinPieces())
 	}
-	// Add the parity shards to pieces.
+	// Add the parity shards to pieces. They have the same size as the
+	// data shards.
 	for len(pieces) < rs.NumPieces() {
-		pieces = append(pieces, make([]byte, pieceSize))
+		pieces = append(pieces, make([]byte, len(pieces[0])))
 	}
 	err := rs.enc.Encode(pieces)
 	if err != nil {
@@ -82,3 +98,147 @@ func NewRSCode(nData, nParity int) (modules.ErasureCoder, error) {
 		dataPieces: nData,
 	}, nil
 }
+
+// rsSystematicCode is a Reed-Solomon encoder/decoder whose data pieces contain
+// the original data in order. It implements the modules.RangeRecoverer
+// interface.
+//
+// The pieces are identical to those of rsCode. Using a separate type records
+// in the file metadata that the renter may rely on the layout of the data
+// pieces when downloading ranges of a chunk.
+type rsSystematicCode struct {
+	*rsCode
+}
+
+// DataPieces returns the indices of the data pieces that contain the range
+// [offset, offset+length) of the original data.
+func (rs *rsSystematicCode) DataPieces(pieceSize, offset, length uint64) []uint64 {
+	if length == 0 {
+		return nil
+	}
+	var pieces []uint64
+	for i := offset / pieceSize; i <= (offset+length-1)/pieceSize && i < uint64(rs.dataPieces); i++ {
+		pieces = append(pieces, i)
+	}
+	return pieces
+}
+
+// RecoverRange recovers the range [offset, offset+length) of the original data
+// and writes it to w. If any of the data pieces containing the range is
+// missing, the data pieces are reconstructed first.
+func (rs *rsSystematicCode) RecoverRange(pieces [][]byte, pieceSize, offset, length uint64, w io.Writer) error {
+	if offset+length > pieceSize*uint64(rs.dataPieces) {
+		return errors.New("range exceeds the size of the data")
+	} else if len(pieces) != rs.numPieces {
+		return fmt.Errorf("invalid number of pieces given %v %v", len(pieces), rs.numPieces)
+	}
+	for _, i := range rs.DataPieces(pieceSize, offset, length) {
+		if uint64(len(pieces[i])) != pieceSize {
+			if err := rs.enc.ReconstructData(pieces); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	for length > 0 {
+		piece := pieces[offset/pieceSize]
+		n := pieceSize - offset%pieceSize
+		if n > length {
+			n = length
+		}
+		if _, err := w.Write(piece[offset%pieceSize : offset%pieceSize+n]); err != nil {
+			return err
+		}
+		offset += n
+		length -= n
+	}
+	return nil
+}
+
+// NewRSSystematicCode creates a new systematic Reed-Solomon encoder/decoder
+// using the supplied parameters.
+func NewRSSystematicCode(nData, nParity int) (modules.ErasureCoder, error) {
+	rsc, err := NewRSCode(nData, nParity)
+	if err != nil {
+		return nil, err
+	}
+	return &rsSystematicCode{rsc.(*rsCode)}, nil
+}
+
+// replicationCode is an erasure code that stores full copies of the data. Any
+// single piece is sufficient to recover the data. It implements the
+// modules.ErasureCoder interface.
+type replicationCode struct {
+	numPieces int
+}
+
+// NumPieces returns the number of pieces returned by Encode.
+func (rc *replicationCode) NumPieces() int { return rc.numPieces }
+
+// MinPieces returns the minimum number of pieces that must be present to
+// recover the original data, which is always 1.
+func (rc *replicationCode) MinPieces() int { return 1 }
+
+// Encode returns NumPieces copies of data.
+func (rc *replicationCode) Encode(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("cannot encode empty data")
+	}
+	return rc.EncodeShards([][]byte{data})
+}
+
+// EncodeShards returns the single input piece followed by NumPieces-1 copies
+// of it.
+func (rc *replicationCode) EncodeShards(pieces [][]byte) ([][]byte, error) {
+	if len(pieces) != 1 {
+		return nil, fmt.Errorf("invalid number of pieces given %v %v", len(pieces), 1)
+	}
+	for len(pieces) < rc.numPieces {
+		pieces = append(pieces, append([]byte(nil), pieces[0]...))
+	}
+	return pieces, nil
+}
+
+// Recover writes the first n bytes of any present piece to w.
+func (rc *replicationCode) Recover(pieces [][]byte, n uint64, w io.Writer) error {
+	for _, piece := range pieces {
+		if piece == nil {
+			continue
+		} else if uint64(len(piece)) < n {
+			return errors.New("piece is smaller than the requested data")
+		}
+		_, err := w.Write(piece[:n])
+		return err
+	}
+	return errors.New("no pieces available")
+}
+
+// NewReplicationCode creates a new replication encoder/decoder that stores
+// numCopies copies of the data.
+func NewReplicationCode(numCopies int) (modules.ErasureCoder, error) {
+	if numCopies < 1 {
+		return nil, errors.New("at least one copy is required")
+	}
+	return &replicationCode{numPieces: numCopies}, nil
+}
+
+// NewErasureCoder creates an erasure coder of the given code type. For the
+// replication code, nData must be 1 and nParity is the number of additional
+// copies.
+func NewErasureCoder(codeType string, nData, nParity int) (modules.ErasureCoder, error) {
+	switch codeType {
+	case CodeTypeReedSolomon:
+		return NewRSCode(nData, nParity)
+	case CodeTypeReedSolomonSystematic:
+		return NewRSSystematicCode(nData, nParity)
+	case CodeTypeReplication:
+		if nData != 1 {
+			return nil, errors.New("replication requires exactly one data piece")
+		} else if nParity < 0 {
+			return nil, errors.New("number of parity pieces must not be negative")
+		}
+		return NewReplicationCode(nData + nParity)
+	default:
+		return nil, errors.New("unrecognized erasure code type: " + codeType)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"testing"
 
+	"gitlab.com/NebulousLabs/Sia/modules"
+
 	"gitlab.com/NebulousLabs/fastrand"
 )
 
@@ -57,6 +59,103 @@ func TestRSEncode(t *testing.T) {
 	}
 }
 
+// TestRSSystematicRecoverRange tests that the rsSystematicCode type can
+// recover ranges from its data pieces.
+func TestRSSystematicRecoverRange(t *testing.T) {
+	rsc, err := NewRSSystematicCode(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := rsc.(modules.RangeRecoverer)
+
+	// Shard the data like the upload code does and encode it.
+	pieceSize := uint64(64)
+	data := fastrand.Bytes(int(4 * pieceSize))
+	var shards [][]byte
+	for i := uint64(0); i < 4; i++ {
+		shards = append(shards, append([]byte(nil), data[i*pieceSize:(i+1)*pieceSize]...))
+	}
+	pieces, err := rsc.EncodeShards(shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The range [70, 140) is covered by the data pieces 1 and 2.
+	dataPieces := rr.DataPieces(pieceSize, 70, 70)
+	if len(dataPieces) != 2 || dataPieces[0] != 1 || dataPieces[1] != 2 {
+		t.Fatal("wrong data pieces:", dataPieces)
+	}
+
+	// Recover the range from only the data pieces that contain it.
+	partial := make([][]byte, len(pieces))
+	for _, i := range dataPieces {
+		partial[i] = pieces[i]
+	}
+	buf := new(bytes.Buffer)
+	if err := rr.RecoverRange(partial, pieceSize, 70, 70, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data[70:140]) {
+		t.Fatal("recovered range does not match original")
+	}
+
+	// Recover the range with one of its data pieces missing.
+	partial = append([][]byte(nil), pieces...)
+	partial[1] = nil
+	partial[3] = nil
+	buf.Reset()
+	if err := rr.RecoverRange(partial, pieceSize, 70, 70, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data[70:140]) {
+		t.Fatal("recovered range does not match original")
+	}
+
+	// Ranges beyond the data should be rejected.
+	if err := rr.RecoverRange(pieces, pieceSize, 200, 100, buf); err == nil {
+		t.Fatal("expected out-of-bounds range to be rejected")
+	}
+}
+
+// TestReplicationCode tests the replicationCode type.
+func TestReplicationCode(t *testing.T) {
+	if _, err := NewReplicationCode(0); err == nil {
+		t.Fatal("expected bad parameter error, got nil")
+	}
+	rc, err := NewReplicationCode(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.MinPieces() != 1 || rc.NumPieces() != 3 {
+		t.Fatal("wrong number of pieces:", rc.MinPieces(), rc.NumPieces())
+	}
+
+	data := fastrand.Bytes(777)
+	pieces, err := rc.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pieces) != 3 {
+		t.Fatal("expected 3 pieces, got", len(pieces))
+	}
+
+	// Any single piece should be sufficient to recover the data.
+	for i := range pieces {
+		partial := make([][]byte, len(pieces))
+		partial[i] = pieces[i]
+		buf := new(bytes.Buffer)
+		if err := rc.Recover(partial, 700, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), data[:700]) {
+			t.Fatal("recovered data does not match original")
+		}
+	}
+	if err := rc.Recover(make([][]byte, 3), 700, ioutil.Discard); err == nil {
+		t.Fatal("expected recovery without pieces to fail")
+	}
+}
+
 func BenchmarkRSEncode(b *testing.B) {
 	rsc, err := NewRSCode(80, 20)
 	if err != nil {
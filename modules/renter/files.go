@@ -31,14 +31,58 @@ var (
 // contract covers many pieces.
 type file struct {
 	name        string
-	size        uint64 // Static - can be accessed without lock.
+	size        uint64 // Static for all files except packs, see isPack.
 	contracts   map[types.FileContractID]fileContract
-	masterKey   crypto.TwofishKey    // Static - can be accessed without lock.
+	masterKey   crypto.CipherKey     // Static - can be accessed without lock.
 	erasureCode modules.ErasureCoder // Static - can be accessed without lock.
 	pieceSize   uint64               // Static - can be accessed without lock.
 	mode        uint32               // actually an os.FileMode
 	deleted     bool                 // indicates if the file has been deleted.
 
+	// remoteRepairs is the number of chunks of the file that are currently
+	// being repaired by downloading them from the network. It is not
+	// persisted.
+	remoteRepairs uint64
+
+	// repairFailures contains the chunks of the file whose most recent repair
+	// attempts failed. It is not persisted.
+	repairFailures map[uint64]chunkRepairFailure
+
+	// migration is the pending layout of the file after its redundancy was
+	// changed. It is a separate file that is repaired like any other file
+	// and replaces the file once all of its chunks are fully uploaded.
+	// original is set on the pending layout and points back to the file
+	// whose data it is re-encoding.
+	migration *file
+	original  *file
+
+	// packName is the name of the pack that stores the data of a small file
+	// that was packed together with other small files, and packOffset is the
+	// offset of the file's data within the pack. Packed files don't have
+	// contracts of their own. Both fields are static.
+	packName   string
+	packOffset uint64
+
+	// isPack is set on the packs themselves. Packs are internal files that
+	// aren't visible to the user. The size of a pack grows while files are
+	// added to it, so it needs to be accessed with the lock. numMembers is
+	// the number of files that are stored in the pack, packReserved is the
+	// amount of data that was reserved in the pack, and pendingWrites is the
+	// number of files whose data is still being written to the pack. They are
+	// protected by the renter's lock and aren't persisted.
+	isPack        bool
+	numMembers    uint64
+	packReserved  uint64
+	pendingWrites uint64
+
+	// dedup is set on files whose chunks are deduplicated against the chunks
+	// of other deduplicated files. The pieces of their chunks are encrypted
+	// with keys derived from the content hashes in chunkHashes, which are
+	// recorded when a chunk is first uploaded. Unknown hashes are zero. dedup
+	// is static.
+	dedup       bool
+	chunkHashes []crypto.Hash
+
 	staticUID string // A UID assigned to the file when it gets created.
 
 	mu sync.RWMutex
@@ -65,9 +109,52 @@ type pieceData struct {
 	MerkleRoot crypto.Hash // the Merkle root of the piece
 }
 
+// chunkRepairFailure records the failed repair attempts of a chunk.
+type chunkRepairFailure struct {
+	consecutive int    // number of consecutive failed repair attempts
+	lastErr     string // the error of the most recent failed attempt
+}
+
+// stuck returns true if the repair of the chunk failed too many times in a
+// row.
+func (crf chunkRepairFailure) stuck() bool {
+	return crf.consecutive >= stuckChunkThreshold
+}
+
 // deriveKey derives the key used to encrypt and decrypt a specific file piece.
-func deriveKey(masterKey crypto.TwofishKey, chunkIndex, pieceIndex uint64) crypto.TwofishKey {
-	return crypto.TwofishKey(crypto.HashAll(masterKey, chunkIndex, pieceIndex))
+// The piece key uses the same cipher as the master key.
+func deriveKey(masterKey crypto.CipherKey, chunkIndex, pieceIndex uint64) crypto.CipherKey {
+	// The master key is hashed as an array to keep the keys of existing
+	// Twofish files unchanged.
+	var entropy [crypto.EntropySize]byte
+	copy(entropy[:], masterKey.Key())
+	return mustCipherKey(masterKey.Type(), crypto.HashAll(entropy, chunkIndex, pieceIndex))
+}
+
+// mustCipherKey creates a key of a known cipher type from a hash. It panics if
+// the cipher type is unknown, which means that the type wasn't checked when
+// the file was created or loaded.
+func mustCipherKey(cipherType crypto.CipherType, h crypto.Hash) crypto.CipherKey {
+	key, err := crypto.NewCipherKey(cipherType, h[:])
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// chunkKey returns the key that the piece keys of a chunk are derived from,
+// together with the chunk index that is used for the derivation. The piece
+// keys of deduplicated chunks don't depend on the file or the position of the
+// chunk within the file. The file should be locked by the caller.
+func (f *file) chunkKey(chunkIndex uint64) (crypto.CipherKey, uint64) {
+	if !f.dedup {
+		return f.masterKey, chunkIndex
+	}
+	var contentHash crypto.Hash
+	if chunkIndex < uint64(len(f.chunkHashes)) {
+		contentHash = f.chunkHashes[chunkIndex]
+	}
+	return convergentKey(f.masterKey.Type(), contentHash), 0
 }
 
 // staticChunkSize returns the size of one chunk.
@@ -116,7 +203,7 @@ func (f *file) uploadedBytes() uint64 {
 	for _, fc := range f.contracts {
 		// Note: we need to multiply by SectorSize here instead of
 		// f.pieceSize because the actual bytes uploaded include overhead
-		// from TwoFish encryption
+		// from encryption
 		uploaded += uint64(len(fc.Pieces)) * modules.SectorSize
 	}
 	return uploaded
@@ -218,6 +305,64 @@ func (f *file) redundancy(offlineMap map[types.FileContractID]bool, goodForRenew
 	return redundancy
 }
 
+// chunkHealth returns the health of every chunk of the file. Only unique
+// pieces stored on contracts that are online and good for renew are taken
+// into account. See fileHealth for details.
+func (f *file) chunkHealth(offlineMap map[types.FileContractID]bool, goodForRenewMap map[types.FileContractID]bool) []float64 {
+	healths := make([]float64, f.numChunks())
+	if f.size == 0 {
+		return healths
+	}
+	pieceUsage := make([][]bool, f.numChunks())
+	goodPieces := make([]int, f.numChunks())
+	for i := range pieceUsage {
+		pieceUsage[i] = make([]bool, f.erasureCode.NumPieces())
+	}
+	for _, fc := range f.contracts {
+		if offlineMap[fc.ID] || !goodForRenewMap[fc.ID] {
+			continue
+		}
+		for _, p := range fc.Pieces {
+			if p.Chunk >= uint64(len(pieceUsage)) || p.Piece >= uint64(len(pieceUsage[p.Chunk])) {
+				continue
+			}
+			if !pieceUsage[p.Chunk][p.Piece] {
+				pieceUsage[p.Chunk][p.Piece] = true
+				goodPieces[p.Chunk]++
+			}
+		}
+	}
+	minPieces := f.erasureCode.MinPieces()
+	for i, n := range goodPieces {
+		healths[i] = fileHealth(float64(n)/float64(minPieces), minPieces, f.erasureCode.NumPieces())
+	}
+	return healths
+}
+
+// health returns the health of the file, which is the health of its least
+// healthy chunk. See fileHealth for details.
+func (f *file) health(offlineMap map[types.FileContractID]bool, goodForRenewMap map[types.FileContractID]bool) float64 {
+	var health float64
+	for _, h := range f.chunkHealth(offlineMap, goodForRenewMap) {
+		if h > health {
+			health = h
+		}
+	}
+	return health
+}
+
+// numStuckChunks returns the number of chunks of the file that are marked as
+// stuck.
+func (f *file) numStuckChunks() uint64 {
+	var n uint64
+	for _, crf := range f.repairFailures {
+		if crf.stuck() {
+			n++
+		}
+	}
+	return n
+}
+
 // expiration returns the lowest height at which any of the file's contracts
 // will expire.
 func (f *file) expiration() types.BlockHeight {
@@ -233,15 +378,16 @@ func (f *file) expiration() types.BlockHeight {
 	return lowest
 }
 
-// newFile creates a new file object.
-func newFile(name string, code modules.ErasureCoder, pieceSize, fileSize uint64) *file {
+// newFile creates a new file object. The pieces of the file are encrypted
+// using masterKey, and are sized such that an encrypted piece fills a sector.
+func newFile(name string, code modules.ErasureCoder, masterKey crypto.CipherKey, fileSize uint64) *file {
 	return &file{
 		name:        name,
 		size:        fileSize,
 		contracts:   make(map[types.FileContractID]fileContract),
-		masterKey:   crypto.GenerateTwofishKey(),
+		masterKey:   masterKey,
 		erasureCode: code,
-		pieceSize:   pieceSize,
+		pieceSize:   modules.SectorSize - masterKey.Overhead(),
 
 		staticUID: persist.RandomSuffix(),
 	}
@@ -261,6 +407,8 @@ func (r *Renter) DeleteFile(nickname string) error {
 	}
 	delete(r.files, nickname)
 	delete(r.persist.Tracking, nickname)
+	r.releasePackMember(f)
+	r.removeDedupRefs(f)
 
 	err := persist.RemoveFile(filepath.Join(r.persistDir, f.name+ShareExtension))
 	if err != nil {
@@ -269,6 +417,7 @@ func (r *Renter) DeleteFile(nickname string) error {
 
 	r.saveSync()
 	r.mu.Unlock(lockID)
+	go r.threadedBubbleMetadata(dirParent(nickname))
 
 	// delete the file's associated contract data.
 	f.mu.Lock()
@@ -277,31 +426,148 @@ func (r *Renter) DeleteFile(nickname string) error {
 	// mark the file as deleted
 	f.deleted = true
 
-	// TODO: delete the sectors of the file as well.
-
+	// remove the sectors of the file and of its pending layout from the
+	// contracts
+	r.cancelMigration(f)
+	go r.threadedDeleteSectors(f.sectors())
 	return nil
 }
 
+// threadedDeleteSectors removes the sectors of a deleted file from the
+// contracts that store them, so that the hosts can release them and the
+// renter doesn't pay for them when the contracts are renewed. Sectors that
+// are still used by other files are kept.
+func (r *Renter) threadedDeleteSectors(sectors map[types.FileContractID][]crypto.Hash) {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	// Group the sectors by host, since the pieces of a file may be spread
+	// over multiple contracts with the same host after renewals.
+	hostSectors := make(map[string][]crypto.Hash)
+	hostKeys := make(map[string]types.SiaPublicKey)
+	for id, roots := range sectors {
+		pk := r.hostContractor.ResolveIDToPubKey(id)
+		hostSectors[pk.String()] = append(hostSectors[pk.String()], roots...)
+		hostKeys[pk.String()] = pk
+	}
+
+	// Find the sectors that are still used by other files.
+	inUse := make(map[string]map[crypto.Hash]struct{})
+	id := r.mu.RLock()
+	files := make([]*file, 0, len(r.files)+len(r.packs))
+	for _, f := range r.files {
+		files = append(files, f)
+	}
+	for _, pack := range r.packs {
+		files = append(files, pack)
+	}
+	r.mu.RUnlock(id)
+	markInUse := func(f *file) {
+		for fcid, fc := range f.contracts {
+			resolvedKey := r.hostContractor.ResolveIDToPubKey(fcid)
+			pk := resolvedKey.String()
+			if _, exists := hostSectors[pk]; !exists {
+				continue
+			}
+			if inUse[pk] == nil {
+				inUse[pk] = make(map[crypto.Hash]struct{})
+			}
+			for _, p := range fc.Pieces {
+				inUse[pk][p.MerkleRoot] = struct{}{}
+			}
+		}
+	}
+	for _, f := range files {
+		f.mu.RLock()
+		markInUse(f)
+		if m := f.migration; m != nil {
+			m.mu.RLock()
+			markInUse(m)
+			m.mu.RUnlock()
+		}
+		f.mu.RUnlock()
+	}
+
+	for pk, roots := range hostSectors {
+		var unused []crypto.Hash
+		for _, root := range roots {
+			if _, used := inUse[pk][root]; !used {
+				unused = append(unused, root)
+			}
+		}
+		if len(unused) == 0 {
+			continue
+		}
+		s, err := r.hostContractor.Session(hostKeys[pk], r.tg.StopChan())
+		if err != nil {
+			r.log.Debugln("Unable to acquire a session to delete sectors:", err)
+			continue
+		}
+		if err := s.DeleteSectors(unused); err != nil {
+			r.log.Debugln("Unable to delete sectors from contract:", err)
+		}
+		s.Close()
+	}
+}
+
 // FileList returns all of the files that the renter has.
 func (r *Renter) FileList() []modules.FileInfo {
-	// Get all the files and their contracts
 	var files []*file
-	contractIDs := make(map[types.FileContractID]struct{})
 	lockID := r.mu.RLock()
 	for _, f := range r.files {
 		files = append(files, f)
+	}
+	r.mu.RUnlock(lockID)
+	return r.managedFileInfos(files)
+}
+
+// FileChunks returns the health and repair status of every chunk of a file.
+func (r *Renter) FileChunks(siaPath string) ([]modules.ChunkInfo, error) {
+	lockID := r.mu.RLock()
+	f, exists := r.files[siaPath]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return nil, ErrUnknownPath
+	}
+	offline, goodForRenew := r.managedContractUtilityMaps([]*file{f})
+
+	// The chunks of a packed file are the chunks of its pack.
+	f = r.managedDataFile(f)
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	healths := f.chunkHealth(offline, goodForRenew)
+	chunks := make([]modules.ChunkInfo, len(healths))
+	for i, health := range healths {
+		crf := f.repairFailures[uint64(i)]
+		chunks[i] = modules.ChunkInfo{
+			Index:          uint64(i),
+			Health:         health,
+			RepairFailures: uint64(crf.consecutive),
+			Stuck:          crf.stuck(),
+			LastError:      crf.lastErr,
+		}
+	}
+	return chunks, nil
+}
+
+// managedContractUtilityMaps builds 2 maps that map the contracts of the
+// provided files to their offline and goodForRenew status.
+func (r *Renter) managedContractUtilityMaps(files []*file) (offline map[types.FileContractID]bool, goodForRenew map[types.FileContractID]bool) {
+	contractIDs := make(map[types.FileContractID]struct{})
+	for _, f := range files {
+		// Packed files are stored in the contracts of their packs.
+		f = r.managedDataFile(f)
 		f.mu.RLock()
 		for cid := range f.contracts {
 			contractIDs[cid] = struct{}{}
 		}
 		f.mu.RUnlock()
 	}
-	r.mu.RUnlock(lockID)
 
-	// Build 2 maps that map every contract id to its offline and goodForRenew
-	// status.
-	goodForRenew := make(map[types.FileContractID]bool)
-	offline := make(map[types.FileContractID]bool)
+	goodForRenew = make(map[types.FileContractID]bool)
+	offline = make(map[types.FileContractID]bool)
 	for cid := range contractIDs {
 		resolvedKey := r.hostContractor.ResolveIDToPubKey(cid)
 		cu, ok := r.hostContractor.ContractUtility(resolvedKey)
@@ -311,6 +577,12 @@ func (r *Renter) FileList() []modules.FileInfo {
 		goodForRenew[cid] = ok && cu.GoodForRenew
 		offline[cid] = r.hostContractor.IsOffline(resolvedKey)
 	}
+	return offline, goodForRenew
+}
+
+// managedFileInfos builds the FileInfos of the provided files.
+func (r *Renter) managedFileInfos(files []*file) []modules.FileInfo {
+	offline, goodForRenew := r.managedContractUtilityMaps(files)
 
 	// Build the list of FileInfos.
 	fileList := []modules.FileInfo{}
@@ -319,9 +591,21 @@ func (r *Renter) FileList() []modules.FileInfo {
 		f.mu.RLock()
 		renewing := true
 		var localPath string
+		var onDisk bool
 		tf, exists := r.persist.Tracking[f.name]
 		if exists {
 			localPath = tf.RepairPath
+			onDisk = tf.onDisk()
+		}
+		// The redundancy of a packed file is the redundancy of its pack. The
+		// uploaded bytes of the pack are attributed to its files by size.
+		df := r.dataFile(f)
+		if df != f {
+			df.mu.RLock()
+		}
+		uploadedBytes := df.uploadedBytes()
+		if df != f && df.size > 0 {
+			uploadedBytes = uint64(float64(uploadedBytes) * float64(f.size) / float64(df.size))
 		}
 		// Check for 0byte files
 		//
@@ -332,20 +616,28 @@ func (r *Renter) FileList() []modules.FileInfo {
 			redundancy = float64(f.erasureCode.NumPieces()) / float64(f.erasureCode.MinPieces())
 			uploadProgress = 100
 		} else {
-			redundancy = f.redundancy(offline, goodForRenew)
-			uploadProgress = f.uploadProgress()
+			redundancy = df.redundancy(offline, goodForRenew)
+			uploadProgress = df.uploadProgress()
 		}
 		fileList = append(fileList, modules.FileInfo{
-			SiaPath:        f.name,
-			LocalPath:      localPath,
-			Filesize:       f.size,
-			Renewing:       renewing,
-			Available:      f.available(offline),
-			Redundancy:     redundancy,
-			UploadedBytes:  f.uploadedBytes(),
-			UploadProgress: uploadProgress,
-			Expiration:     f.expiration(),
+			SiaPath:            f.name,
+			LocalPath:          localPath,
+			Filesize:           f.size,
+			Renewing:           renewing,
+			Available:          df.available(offline),
+			Redundancy:         redundancy,
+			UploadedBytes:      uploadedBytes,
+			UploadProgress:     uploadProgress,
+			Expiration:         df.expiration(),
+			OnDisk:             onDisk,
+			Recoverable:        onDisk || redundancy >= 1,
+			RemoteRepairChunks: df.remoteRepairs,
+			Health:             df.health(offline, goodForRenew),
+			NumStuckChunks:     df.numStuckChunks(),
 		})
+		if df != f {
+			df.mu.RUnlock()
+		}
 		f.mu.RUnlock()
 		r.mu.RUnlock(lockID)
 	}
@@ -355,56 +647,13 @@ func (r *Renter) FileList() []modules.FileInfo {
 // File returns file from siaPath queried by user.
 // Update based on FileList
 func (r *Renter) File(siaPath string) (modules.FileInfo, error) {
-	var fileInfo modules.FileInfo
-
-	// Get the file and its contracts
-	contractIDs := make(map[types.FileContractID]struct{})
 	lockID := r.mu.RLock()
-	defer r.mu.RUnlock(lockID)
-	file, exists := r.files[siaPath]
+	f, exists := r.files[siaPath]
+	r.mu.RUnlock(lockID)
 	if !exists {
-		return fileInfo, ErrUnknownPath
-	}
-	file.mu.RLock()
-	defer file.mu.RUnlock()
-	for cid := range file.contracts {
-		contractIDs[cid] = struct{}{}
-	}
-
-	// Build 2 maps that map every contract id to its offline and goodForRenew
-	// status.
-	goodForRenew := make(map[types.FileContractID]bool)
-	offline := make(map[types.FileContractID]bool)
-	for cid := range contractIDs {
-		resolvedKey := r.hostContractor.ResolveIDToPubKey(cid)
-		cu, ok := r.hostContractor.ContractUtility(resolvedKey)
-		if !ok {
-			continue
-		}
-		goodForRenew[cid] = ok && cu.GoodForRenew
-		offline[cid] = r.hostContractor.IsOffline(resolvedKey)
-	}
-
-	// Build the FileInfo
-	renewing := true
-	var localPath string
-	tf, exists := r.persist.Tracking[file.name]
-	if exists {
-		localPath = tf.RepairPath
-	}
-	fileInfo = modules.FileInfo{
-		SiaPath:        file.name,
-		LocalPath:      localPath,
-		Filesize:       file.size,
-		Renewing:       renewing,
-		Available:      file.available(offline),
-		Redundancy:     file.redundancy(offline, goodForRenew),
-		UploadedBytes:  file.uploadedBytes(),
-		UploadProgress: file.uploadProgress(),
-		Expiration:     file.expiration(),
+		return modules.FileInfo{}, ErrUnknownPath
 	}
-
-	return fileInfo, nil
+	return r.managedFileInfos([]*file{f})[0], nil
 }
 
 // RenameFile takes an existing file and changes the nickname. The original
@@ -428,11 +677,17 @@ func (r *Renter) RenameFile(currentName, newName string) error {
 	if exists {
 		return ErrPathOverload
 	}
+	if r.dirExists(newName) {
+		return ErrDirExists
+	}
 
 	// Modify the file and save it to disk.
 	file.mu.Lock()
 	file.name = newName
 	err = r.saveFile(file)
+	if err == nil {
+		err = r.renameMigration(file)
+	}
 	file.mu.Unlock()
 	if err != nil {
 		return err
@@ -452,5 +707,11 @@ func (r *Renter) RenameFile(currentName, newName string) error {
 
 	// Delete the old .sia file.
 	oldPath := filepath.Join(r.persistDir, currentName+ShareExtension)
-	return os.RemoveAll(oldPath)
+	err = os.RemoveAll(oldPath)
+	if err != nil {
+		return err
+	}
+	go r.threadedBubbleMetadata(dirParent(currentName))
+	go r.threadedBubbleMetadata(dirParent(newName))
+	return nil
 }
@@ -1,6 +1,7 @@
 package renter
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -218,6 +219,112 @@ func TestFileRedundancy(t *testing.T) {
 	}
 }
 
+// TestFileChunkHealth probes the chunkHealth and health methods of the file.
+func TestFileChunkHealth(t *testing.T) {
+	rsc, _ := NewRSCode(1, 2)
+	f := &file{
+		size:        300,
+		pieceSize:   100,
+		contracts:   make(map[types.FileContractID]fileContract),
+		erasureCode: rsc,
+	}
+	online := make(map[types.FileContractID]bool)
+	goodForRenew := make(map[types.FileContractID]bool)
+	for i := byte(0); i < 3; i++ {
+		online[types.FileContractID{i}] = false
+		goodForRenew[types.FileContractID{i}] = true
+	}
+	goodForRenew[types.FileContractID{2}] = false
+
+	// Chunk 0 is stored on all contracts, chunk 1 twice on the same contract
+	// and chunk 2 isn't stored at all.
+	for i := byte(0); i < 3; i++ {
+		f.contracts[types.FileContractID{i}] = fileContract{
+			ID:     types.FileContractID{i},
+			Pieces: []pieceData{{Chunk: 0, Piece: uint64(i)}},
+		}
+	}
+	fc := f.contracts[types.FileContractID{0}]
+	fc.Pieces = append(fc.Pieces, pieceData{Chunk: 1, Piece: 0}, pieceData{Chunk: 1, Piece: 0})
+	f.contracts[types.FileContractID{0}] = fc
+
+	healths := f.chunkHealth(online, goodForRenew)
+	// The piece on the contract that is not good for renew doesn't count.
+	expected := []float64{0.5, 1, 1.5}
+	if len(healths) != len(expected) {
+		t.Fatal("wrong number of chunks", len(healths))
+	}
+	for i := range expected {
+		if healths[i] != expected[i] {
+			t.Errorf("expected health %v for chunk %v, got %v", expected[i], i, healths[i])
+		}
+	}
+	if h := f.health(online, goodForRenew); h != 1.5 {
+		t.Error("file health should be the health of the worst chunk, got", h)
+	}
+
+	// Offline contracts don't count either.
+	online[types.FileContractID{1}] = true
+	if h := f.chunkHealth(online, goodForRenew)[0]; h != 1 {
+		t.Error("expected health 1 for chunk 0, got", h)
+	}
+
+	// Empty files are always healthy.
+	f.size = 0
+	if h := f.health(online, goodForRenew); h != 0 {
+		t.Error("expected empty file to be healthy, got", h)
+	}
+}
+
+// TestFileRepairFailures checks that failed repairs of a chunk are recorded
+// and that a chunk is marked as stuck after too many failures.
+func TestFileRepairFailures(t *testing.T) {
+	rsc, _ := NewRSCode(1, 2)
+	f := &file{
+		size:        300,
+		pieceSize:   100,
+		contracts:   make(map[types.FileContractID]fileContract),
+		erasureCode: rsc,
+	}
+	repair := func(err error, progress bool) {
+		uc := &unfinishedUploadChunk{renterFile: f, index: 1, err: err}
+		if progress {
+			uc.piecesCompleted = 1
+		}
+		uc.managedUpdateRepairFailures()
+	}
+
+	// Not repairing a chunk on purpose is not a failure.
+	repair(errLocalFileUnavailable, false)
+	if len(f.repairFailures) != 0 {
+		t.Fatal("unavailable local file shouldn't count as a failure")
+	}
+
+	// Fail the repair until the chunk is stuck.
+	for i := 0; i < stuckChunkThreshold; i++ {
+		if f.numStuckChunks() != 0 {
+			t.Fatal("chunk shouldn't be stuck yet")
+		}
+		repair(nil, false)
+	}
+	if f.numStuckChunks() != 1 {
+		t.Fatal("chunk should be stuck")
+	}
+	if crf := f.repairFailures[1]; crf.lastErr != errNoRepairProgress.Error() {
+		t.Fatal("wrong last error", crf.lastErr)
+	}
+	repair(errors.New("foo"), false)
+	if crf := f.repairFailures[1]; crf.lastErr != "foo" || crf.consecutive != stuckChunkThreshold+1 {
+		t.Fatal("wrong repair failure", crf)
+	}
+
+	// A successful repair resets the failures.
+	repair(nil, true)
+	if len(f.repairFailures) != 0 || f.numStuckChunks() != 0 {
+		t.Fatal("failures should have been reset")
+	}
+}
+
 // TestFileExpiration probes the expiration method of the file type.
 func TestFileExpiration(t *testing.T) {
 	f := &file{
@@ -442,7 +549,7 @@ func TestRenterRenameFile(t *testing.T) {
 	}
 
 	// Renaming should also update the tracking set
-	rt.renter.persist.Tracking["1"] = trackedFile{"foo"}
+	rt.renter.persist.Tracking["1"] = trackedFile{RepairPath: "foo"}
 	err = rt.renter.RenameFile("1", "1b")
 	if err != nil {
 		t.Fatal(err)
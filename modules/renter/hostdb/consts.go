@@ -22,6 +22,12 @@ const (
 	// scan.
 	hostScanDeadline = 4 * time.Minute
 
+	// ipv4FilterRange and ipv6FilterRange are the prefix lengths of the
+	// subnets that are used to determine whether two hosts are likely to be
+	// run by the same operator.
+	ipv4FilterRange = 24
+	ipv6FilterRange = 54
+
 	// maxHostDowntime specifies the maximum amount of time that a host is
 	// allowed to be offline while still being in the hostdb.
 	maxHostDowntime = 10 * 24 * time.Hour
@@ -45,6 +51,11 @@ const (
 	// minScansForSpeedup successful scans.
 	scanSpeedupMedianMultiplier = 5
 
+	// performanceDecay is the weight that the previous rolling average of the
+	// latency or the throughput of a host keeps when a new measurement is
+	// added.
+	performanceDecay = 0.8
+
 	// recentInteractionWeightLimit caps the number of recent interactions as a
 	// percentage of the historic interactions, to be certain that a large
 	// amount of activity in a short period of time does not overwhelm the
@@ -54,6 +65,10 @@ const (
 	// than half the total weight at this limit.
 	recentInteractionWeightLimit = 0.01
 
+	// referenceLatency is the latency at or below which a host doesn't
+	// receive a penalty for its latency.
+	referenceLatency = 250 * time.Millisecond
+
 	// saveFrequency defines how frequently the hostdb will save to disk. Hostdb
 	// will also save immediately prior to shutdown.
 	saveFrequency = 2 * time.Minute
@@ -64,6 +79,15 @@ const (
 )
 
 var (
+	// ipFilterEnabled determines whether the hostdb prevents the selection of
+	// multiple hosts from the same subnet. All hosts of a testing build run on
+	// the same machine, which is why the filter is disabled during testing.
+	ipFilterEnabled = build.Select(build.Var{
+		Standard: true,
+		Dev:      true,
+		Testing:  false,
+	}).(bool)
+
 	// hostCheckupQuantity specifies the number of hosts that get scanned every
 	// time there is a regular scanning operation.
 	hostCheckupQuantity = build.Select(build.Var{
@@ -97,4 +121,14 @@ var (
 		Dev:      time.Minute * 3,
 		Testing:  time.Second * 1,
 	}).(time.Duration)
+
+	// referenceThroughput is the throughput in bytes per second at or above
+	// which a host doesn't receive a penalty for its throughput. The sectors
+	// of testing builds are tiny, which makes the measured throughput of a
+	// sector transfer much lower.
+	referenceThroughput = build.Select(build.Var{
+		Standard: float64(1 << 20),
+		Dev:      float64(1 << 18),
+		Testing:  float64(1 << 10),
+	}).(float64)
 )
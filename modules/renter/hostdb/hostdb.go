@@ -7,8 +7,10 @@ package hostdb
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -23,6 +25,9 @@ var (
 	// ErrInitialScanIncomplete is returned whenever an operation is not
 	// allowed to be executed before the initial host scan has finished.
 	ErrInitialScanIncomplete = errors.New("initial hostdb scan is not yet completed")
+	errEmptyWhitelist        = errors.New("whitelist must contain at least one host")
+	errInvalidMinUptime      = errors.New("minimum uptime must be between 0 and 1")
+	errInvalidScoringWeight  = errors.New("scoring weights must be non-negative numbers")
 	errNilCS                 = errors.New("cannot create hostdb with nil consensus set")
 	errNilGateway            = errors.New("cannot create hostdb with nil gateway")
 )
@@ -56,6 +61,32 @@ type HostDB struct {
 	scanWait             bool
 	scanningThreads      int
 
+	// filterMode and filteredHosts define the filter of the hostdb. The
+	// filter is applied by the hostTree.
+	filterMode    modules.FilterMode
+	filteredHosts []types.SiaPublicKey
+
+	// ipFilter determines whether multiple hosts from the same subnet can be
+	// used at the same time.
+	ipFilter bool
+
+	// scoringProfile determines how the adjustments of the host weight are
+	// combined. It has a separate lock because the weight function of the
+	// hostTree is called while hdb.mu is held.
+	scoringProfile   modules.HostScoringProfile
+	scoringProfileMu sync.RWMutex
+
+	// allowance is the allowance of the renter. The prices of hosts are
+	// weighted according to the expected usage of the allowance. It has a
+	// separate lock for the same reason as the scoring profile.
+	allowance   modules.Allowance
+	allowanceMu sync.RWMutex
+
+	// trackedContracts are the contracts on the blockchain that require a
+	// storage proof from a host in the hostdb. They are used to keep track of
+	// whether hosts submit their storage proofs.
+	trackedContracts map[types.FileContractID]trackedContract
+
 	blockHeight types.BlockHeight
 	lastChange  modules.ConsensusChangeID
 }
@@ -84,7 +115,9 @@ func NewCustomHostDB(g modules.Gateway, cs modules.ConsensusSet, persistDir stri
 		gateway:    g,
 		persistDir: persistDir,
 
-		scanMap: make(map[string]struct{}),
+		scanMap:          make(map[string]struct{}),
+		scoringProfile:   modules.DefaultHostScoringProfile,
+		trackedContracts: make(map[types.FileContractID]trackedContract),
 	}
 
 	// Create the persist directory if it does not yet exist.
@@ -111,8 +144,11 @@ func NewCustomHostDB(g modules.Gateway, cs modules.ConsensusSet, persistDir stri
 		return nil, err
 	}
 
-	// The host tree is used to manage hosts and query them at random.
+	// The host tree is used to manage hosts and query them at random. Tests
+	// can enable the IP filter using a dependency.
+	hdb.ipFilter = ipFilterEnabled || hdb.deps.Disrupt("enableIPFilter")
 	hdb.hostTree = hosttree.New(hdb.calculateHostWeight)
+	hdb.hostTree.SetIPFilter(hdb.ipFilter)
 
 	// Load the prior persistence structures.
 	hdb.mu.Lock()
@@ -189,10 +225,14 @@ func NewCustomHostDB(g modules.Gateway, cs modules.ConsensusSet, persistDir stri
 }
 
 // ActiveHosts returns a list of hosts that are currently online, sorted by
-// weight.
+// weight. Hosts that are excluded by the filter of the hostdb are not
+// returned.
 func (hdb *HostDB) ActiveHosts() (activeHosts []modules.HostDBEntry) {
 	allHosts := hdb.hostTree.All()
 	for _, entry := range allHosts {
+		if entry.Filtered {
+			continue
+		}
 		if len(entry.ScanHistory) == 0 {
 			continue
 		}
@@ -216,7 +256,7 @@ func (hdb *HostDB) AllHosts() (allHosts []modules.HostDBEntry) {
 // AverageContractPrice returns the average price of a host.
 func (hdb *HostDB) AverageContractPrice() (totalPrice types.Currency) {
 	sampleSize := 32
-	hosts := hdb.hostTree.SelectRandom(sampleSize, nil)
+	hosts := hdb.hostTree.SelectRandom(sampleSize, nil, nil)
 	if len(hosts) == 0 {
 		return totalPrice
 	}
@@ -226,11 +266,133 @@ func (hdb *HostDB) AverageContractPrice() (totalPrice types.Currency) {
 	return totalPrice.Div64(uint64(len(hosts)))
 }
 
+// CheckForIPViolations returns the hosts of the provided set that share a
+// subnet with another host of the set. The host whose subnets have been known
+// for the longest time is kept, the others are returned. Hosts that are not
+// known to the hostdb are ignored.
+func (hdb *HostDB) CheckForIPViolations(hosts []types.SiaPublicKey) []types.SiaPublicKey {
+	if !hdb.ipFilter {
+		return nil
+	}
+
+	var entries []modules.HostDBEntry
+	for _, pk := range hosts {
+		entry, exists := hdb.hostTree.Select(pk)
+		if !exists {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastIPNetChange.Before(entries[j].LastIPNetChange)
+	})
+
+	var violations []types.SiaPublicKey
+	filter := hosttree.NewAddressFilter()
+	for _, entry := range entries {
+		if filter.Filtered(entry) {
+			violations = append(violations, entry.PublicKey)
+			continue
+		}
+		filter.Add(entry)
+	}
+	return violations
+}
+
 // Close closes the hostdb, terminating its scanning threads
 func (hdb *HostDB) Close() error {
 	return hdb.tg.Stop()
 }
 
+// Filter returns the filter mode of the hostdb and the hosts of the filter.
+func (hdb *HostDB) Filter() (modules.FilterMode, []types.SiaPublicKey) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	hosts := make([]types.SiaPublicKey, len(hdb.filteredHosts))
+	copy(hosts, hdb.filteredHosts)
+	return hdb.filterMode, hosts
+}
+
+// SetFilterMode sets the filter mode of the hostdb. A blacklist excludes the
+// provided hosts from being selected, a whitelist excludes all other hosts.
+// The hosts are ignored if the filter is disabled.
+func (hdb *HostDB) SetFilterMode(fm modules.FilterMode, hosts []types.SiaPublicKey) error {
+	if err := hdb.tg.Add(); err != nil {
+		return err
+	}
+	defer hdb.tg.Done()
+
+	switch fm {
+	case modules.HostDBFilterNone:
+		hosts = nil
+	case modules.HostDBFilterBlacklist:
+	case modules.HostDBFilterWhitelist:
+		if len(hosts) == 0 {
+			return errEmptyWhitelist
+		}
+	default:
+		return modules.ErrInvalidFilterMode
+	}
+
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.filterMode = fm
+	hdb.filteredHosts = append([]types.SiaPublicKey(nil), hosts...)
+	hdb.hostTree.SetFilterMode(fm, hosts)
+	return hdb.saveSync()
+}
+
+// ScoringProfile returns the scoring profile of the hostdb.
+func (hdb *HostDB) ScoringProfile() modules.HostScoringProfile {
+	hdb.scoringProfileMu.RLock()
+	defer hdb.scoringProfileMu.RUnlock()
+	return hdb.scoringProfile
+}
+
+// SetScoringProfile sets the scoring profile of the hostdb and updates the
+// weights of all hosts accordingly.
+func (hdb *HostDB) SetScoringProfile(sp modules.HostScoringProfile) error {
+	if err := hdb.tg.Add(); err != nil {
+		return err
+	}
+	defer hdb.tg.Done()
+
+	weights := []float64{sp.AgeWeight, sp.CollateralWeight, sp.InteractionWeight, sp.PerformanceWeight,
+		sp.PriceWeight, sp.StorageProofWeight, sp.StorageRemainingWeight, sp.UptimeWeight, sp.VersionWeight}
+	for _, weight := range weights {
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return errInvalidScoringWeight
+		}
+	}
+	if sp.MinUptime < 0 || sp.MinUptime > 1 || math.IsNaN(sp.MinUptime) {
+		return errInvalidMinUptime
+	}
+
+	hdb.scoringProfileMu.Lock()
+	hdb.scoringProfile = sp
+	hdb.scoringProfileMu.Unlock()
+	hdb.hostTree.SetWeightFunction(hdb.calculateHostWeight)
+
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	return hdb.saveSync()
+}
+
+// SetAllowance sets the allowance of the renter and updates the weights of all
+// hosts according to the expected usage of the allowance.
+func (hdb *HostDB) SetAllowance(a modules.Allowance) error {
+	if err := hdb.tg.Add(); err != nil {
+		return err
+	}
+	defer hdb.tg.Done()
+
+	hdb.allowanceMu.Lock()
+	hdb.allowance = a
+	hdb.allowanceMu.Unlock()
+	hdb.hostTree.SetWeightFunction(hdb.calculateHostWeight)
+	return nil
+}
+
 // Host returns the HostSettings associated with the specified NetAddress. If
 // no matching host is found, Host returns false.
 func (hdb *HostDB) Host(spk types.SiaPublicKey) (modules.HostDBEntry, bool) {
@@ -259,13 +421,15 @@ func (hdb *HostDB) InitialScanComplete() (complete bool, err error) {
 
 // RandomHosts implements the HostDB interface's RandomHosts() method. It takes
 // a number of hosts to return, and a slice of netaddresses to ignore, and
-// returns a slice of entries.
-func (hdb *HostDB) RandomHosts(n int, excludeKeys []types.SiaPublicKey) ([]modules.HostDBEntry, error) {
+// returns a slice of entries. Hosts that share a subnet with any of the hosts
+// of the addressBlacklist are not returned.
+func (hdb *HostDB) RandomHosts(n int, blacklist, addressBlacklist []types.SiaPublicKey) ([]modules.HostDBEntry, error) {
 	hdb.mu.RLock()
 	initialScanComplete := hdb.initialScanComplete
 	hdb.mu.RUnlock()
 	if !initialScanComplete {
 		return []modules.HostDBEntry{}, ErrInitialScanIncomplete
 	}
-	return hdb.hostTree.SelectRandom(n, excludeKeys), nil
+
+	return hdb.hostTree.SelectRandom(n, blacklist, addressBlacklist), nil
 }
@@ -39,7 +39,9 @@ type hdbTester struct {
 // dependencies or scanning threads. It is only intended for use in unit tests.
 func bareHostDB() *HostDB {
 	hdb := &HostDB{
-		log: persist.NewLogger(ioutil.Discard),
+		log:              persist.NewLogger(ioutil.Discard),
+		scoringProfile:   modules.DefaultHostScoringProfile,
+		trackedContracts: make(map[types.FileContractID]trackedContract),
 	}
 	hdb.hostTree = hosttree.New(hdb.calculateHostWeight)
 	return hdb
@@ -234,7 +236,7 @@ func TestRandomHosts(t *testing.T) {
 
 	// Check that all hosts can be queried.
 	for i := 0; i < 25; i++ {
-		hosts, err := hdbt.hdb.RandomHosts(nEntries, nil)
+		hosts, err := hdbt.hdb.RandomHosts(nEntries, nil, nil)
 		if err != nil {
 			t.Fatal("Failed to get hosts", err)
 		}
@@ -257,7 +259,7 @@ func TestRandomHosts(t *testing.T) {
 
 	// Base case, fill out a map exposing hosts from a single RH query.
 	dupCheck1 := make(map[string]modules.HostDBEntry)
-	hosts, err := hdbt.hdb.RandomHosts(nEntries/2, nil)
+	hosts, err := hdbt.hdb.RandomHosts(nEntries/2, nil, nil)
 	if err != nil {
 		t.Fatal("Failed to get hosts", err)
 	}
@@ -281,7 +283,7 @@ func TestRandomHosts(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		dupCheck2 := make(map[string]modules.HostDBEntry)
 		var overlap, disjoint bool
-		hosts, err = hdbt.hdb.RandomHosts(nEntries/2, nil)
+		hosts, err = hdbt.hdb.RandomHosts(nEntries/2, nil, nil)
 		if err != nil {
 			t.Fatal("Failed to get hosts", err)
 		}
@@ -315,7 +317,7 @@ func TestRandomHosts(t *testing.T) {
 	// Try exclude list by excluding every host except for the last one, and
 	// doing a random select.
 	for i := 0; i < 25; i++ {
-		hosts, err := hdbt.hdb.RandomHosts(nEntries, nil)
+		hosts, err := hdbt.hdb.RandomHosts(nEntries, nil, nil)
 		if err != nil {
 			t.Fatal("Failed to get hosts", err)
 		}
@@ -323,7 +325,7 @@ func TestRandomHosts(t *testing.T) {
 		for j := 1; j < len(hosts); j++ {
 			exclude = append(exclude, hosts[j].PublicKey)
 		}
-		rand, err := hdbt.hdb.RandomHosts(1, exclude)
+		rand, err := hdbt.hdb.RandomHosts(1, exclude, nil)
 		if err != nil {
 			t.Fatal("Failed to get hosts", err)
 		}
@@ -335,7 +337,7 @@ func TestRandomHosts(t *testing.T) {
 		}
 
 		// Try again but request more hosts than are available.
-		rand, err = hdbt.hdb.RandomHosts(5, exclude)
+		rand, err = hdbt.hdb.RandomHosts(5, exclude, nil)
 		if err != nil {
 			t.Fatal("Failed to get hosts", err)
 		}
@@ -357,7 +359,7 @@ func TestRandomHosts(t *testing.T) {
 
 		// Select only 20 hosts.
 		dupCheck := make(map[string]struct{})
-		rand, err = hdbt.hdb.RandomHosts(20, exclude)
+		rand, err = hdbt.hdb.RandomHosts(20, exclude, nil)
 		if err != nil {
 			t.Fatal("Failed to get hosts", err)
 		}
@@ -378,7 +380,7 @@ func TestRandomHosts(t *testing.T) {
 
 		// Select exactly 50 hosts.
 		dupCheck = make(map[string]struct{})
-		rand, err = hdbt.hdb.RandomHosts(50, exclude)
+		rand, err = hdbt.hdb.RandomHosts(50, exclude, nil)
 		if err != nil {
 			t.Fatal("Failed to get hosts", err)
 		}
@@ -399,7 +401,7 @@ func TestRandomHosts(t *testing.T) {
 
 		// Select 100 hosts.
 		dupCheck = make(map[string]struct{})
-		rand, err = hdbt.hdb.RandomHosts(100, exclude)
+		rand, err = hdbt.hdb.RandomHosts(100, exclude, nil)
 		if err != nil {
 			t.Fatal("Failed to get hosts", err)
 		}
@@ -583,3 +585,39 @@ func TestUpdateHistoricInteractions(t *testing.T) {
 			host.HistoricFailedInteractions, host.HistoricSuccessfulInteractions)
 	}
 }
+
+// TestCheckForIPViolations checks that CheckForIPViolations returns the hosts
+// that share a subnet with a host that has been using the subnet for longer.
+func TestCheckForIPViolations(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.ipFilter = true
+
+	now := time.Now()
+	old := makeHostDBEntry()
+	old.IPNets = []string{"1.2.3.0/24"}
+	old.LastIPNetChange = now.Add(-time.Hour)
+	recent := makeHostDBEntry()
+	recent.IPNets = []string{"1.2.3.0/24", "2001:db8::/54"}
+	recent.LastIPNetChange = now
+	other := makeHostDBEntry()
+	other.IPNets = []string{"1.2.4.0/24"}
+	other.LastIPNetChange = now
+	for _, entry := range []modules.HostDBEntry{old, recent, other} {
+		if err := hdb.hostTree.Insert(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The order of the hosts shouldn't matter. Unknown hosts are ignored.
+	unknown := makeHostDBEntry().PublicKey
+	violations := hdb.CheckForIPViolations([]types.SiaPublicKey{recent.PublicKey, unknown, other.PublicKey, old.PublicKey})
+	if len(violations) != 1 || violations[0].String() != recent.PublicKey.String() {
+		t.Fatal("expected only the recent host to violate the subnet rules, got", violations)
+	}
+
+	// Without the IP filter there are no violations.
+	hdb.ipFilter = false
+	if violations := hdb.CheckForIPViolations([]types.SiaPublicKey{recent.PublicKey, old.PublicKey}); len(violations) != 0 {
+		t.Fatal("expected no violations, got", violations)
+	}
+}
@@ -2,6 +2,7 @@ package hostdb
 
 import (
 	"math"
+	"time"
 
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
@@ -112,3 +113,60 @@ func (hdb *HostDB) IncrementFailedInteractions(key types.SiaPublicKey) {
 	host.RecentFailedInteractions++
 	hdb.hostTree.Modify(host)
 }
+
+// updateRollingAverage adds a measurement to the rolling average of a
+// measured value. The first measurement becomes the initial average.
+func updateRollingAverage(average, measurement float64) float64 {
+	if average == 0 {
+		return measurement
+	}
+	return average*performanceDecay + measurement*(1-performanceDecay)
+}
+
+// throughput returns the throughput in bytes per second of a transfer.
+func throughput(size uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		elapsed = time.Nanosecond
+	}
+	return float64(size) / elapsed.Seconds()
+}
+
+// updateLatency adds the latency measured during a scan to the rolling
+// average latency of a host.
+func (hdb *HostDB) updateLatency(key types.SiaPublicKey, latency time.Duration) {
+	host, haveHost := hdb.hostTree.Select(key)
+	if !haveHost {
+		return
+	}
+	host.Latency = time.Duration(updateRollingAverage(float64(host.Latency), float64(latency)))
+	hdb.hostTree.Modify(host)
+}
+
+// RecordUploadThroughput adds the throughput of an upload of size bytes that
+// took elapsed time to the rolling average upload throughput of a host.
+func (hdb *HostDB) RecordUploadThroughput(key types.SiaPublicKey, size uint64, elapsed time.Duration) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	host, haveHost := hdb.hostTree.Select(key)
+	if !haveHost {
+		return
+	}
+	host.UploadThroughput = updateRollingAverage(host.UploadThroughput, throughput(size, elapsed))
+	hdb.hostTree.Modify(host)
+}
+
+// RecordDownloadThroughput adds the throughput of a download of size bytes
+// that took elapsed time to the rolling average download throughput of a
+// host.
+func (hdb *HostDB) RecordDownloadThroughput(key types.SiaPublicKey, size uint64, elapsed time.Duration) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	host, haveHost := hdb.hostTree.Select(key)
+	if !haveHost {
+		return
+	}
+	host.DownloadThroughput = updateRollingAverage(host.DownloadThroughput, throughput(size, elapsed))
+	hdb.hostTree.Modify(host)
+}
@@ -0,0 +1,38 @@
+package hosttree
+
+import (
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+// An AddressFilter keeps track of the subnets that are used by a set of hosts.
+// It is used to prevent the selection of multiple hosts from the same subnet,
+// which would allow a single operator to hold most of the pieces of a file.
+type AddressFilter struct {
+	subnets map[string]struct{}
+}
+
+// NewAddressFilter creates a new, empty, AddressFilter.
+func NewAddressFilter() *AddressFilter {
+	return &AddressFilter{
+		subnets: make(map[string]struct{}),
+	}
+}
+
+// Add adds the subnets of a host to the filter. A host that has not been
+// resolved yet doesn't use any subnets.
+func (af *AddressFilter) Add(host modules.HostDBEntry) {
+	for _, subnet := range host.IPNets {
+		af.subnets[subnet] = struct{}{}
+	}
+}
+
+// Filtered returns true if the host uses a subnet that is already in use by a
+// host that was previously added to the filter.
+func (af *AddressFilter) Filtered(host modules.HostDBEntry) bool {
+	for _, subnet := range host.IPNets {
+		if _, exists := af.subnets[subnet]; exists {
+			return true
+		}
+	}
+	return false
+}
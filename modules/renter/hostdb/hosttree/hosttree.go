@@ -45,12 +45,28 @@ type (
 	HostTree struct {
 		root *node
 
-		// hosts is a map of public keys to nodes.
+		// hosts is a map of public keys to nodes. It only contains the hosts
+		// that can be selected at random.
 		hosts map[string]*node
 
+		// filteredEntries contains the hosts that are excluded by the filter
+		// of the tree. They are kept out of the tree, so that they don't need
+		// to be skipped by every random selection.
+		filteredEntries map[string]*hostEntry
+
 		// weightFn calculates the weight of a hostEntry
 		weightFn WeightFunc
 
+		// filterMode and filteredHosts determine which hosts are excluded
+		// from random selection. The filter is applied whenever a host is
+		// inserted or modified, and whenever the filter changes.
+		filterMode    modules.FilterMode
+		filteredHosts map[string]struct{}
+
+		// ipFilter determines whether hosts that share a subnet with other
+		// selected hosts are excluded from random selection.
+		ipFilter bool
+
 		mu sync.Mutex
 	}
 
@@ -93,9 +109,74 @@ func New(wf WeightFunc) *HostTree {
 		root: &node{
 			count: 1,
 		},
-		weightFn: wf,
-		hosts:    make(map[string]*node),
+		weightFn:        wf,
+		hosts:           make(map[string]*node),
+		filteredEntries: make(map[string]*hostEntry),
+		filteredHosts:   make(map[string]struct{}),
+		ipFilter:        true,
+	}
+}
+
+// filtered returns true if the host with the provided public key is excluded
+// by the filter of the tree.
+func (ht *HostTree) filtered(pk types.SiaPublicKey) bool {
+	_, listed := ht.filteredHosts[string(pk.Key)]
+	switch ht.filterMode {
+	case modules.HostDBFilterBlacklist:
+		return listed
+	case modules.HostDBFilterWhitelist:
+		return !listed
+	default:
+		return false
+	}
+}
+
+// entry returns the entry of the host with the provided public key, whether
+// it is part of the tree or excluded by the filter.
+func (ht *HostTree) entry(pk types.SiaPublicKey) (*hostEntry, bool) {
+	if node, exists := ht.hosts[string(pk.Key)]; exists {
+		return node.entry, true
+	}
+	entry, exists := ht.filteredEntries[string(pk.Key)]
+	return entry, exists
+}
+
+// insert adds an entry to the tree, or to the filtered entries if it is
+// excluded by the filter of the tree.
+func (ht *HostTree) insert(entry *hostEntry) {
+	if ht.filtered(entry.PublicKey) {
+		ht.filteredEntries[string(entry.PublicKey.Key)] = entry
+		return
 	}
+	_, node := ht.root.recursiveInsert(entry)
+	ht.hosts[string(entry.PublicKey.Key)] = node
+}
+
+// rebuild replaces the tree and the filtered entries with the provided
+// entries. The entries are inserted in order of their weight.
+func (ht *HostTree) rebuild(he []hostEntry) {
+	sort.Sort(byWeight(he))
+	ht.root = &node{
+		count: 1,
+	}
+	ht.hosts = make(map[string]*node)
+	ht.filteredEntries = make(map[string]*hostEntry)
+	for i := range he {
+		ht.insert(&he[i])
+	}
+}
+
+// entries returns a copy of all entries of the tree, including the filtered
+// entries.
+func (ht *HostTree) entries() []hostEntry {
+	he := make([]hostEntry, 0, len(ht.hosts)+len(ht.filteredEntries))
+	for _, node := range ht.hosts {
+		he = append(he, *node.entry)
+	}
+	for _, entry := range ht.filteredEntries {
+		he = append(he, *entry)
+	}
+	return he
 }
 
 // recursiveInsert inserts an entry into the appropriate place in the tree. The
@@ -190,14 +271,12 @@ func (ht *HostTree) All() []modules.HostDBEntry {
 	ht.mu.Lock()
 	defer ht.mu.Unlock()
 
-	var he []hostEntry
-	for _, node := range ht.hosts {
-		he = append(he, *node.entry)
-	}
+	he := ht.entries()
 	sort.Sort(byWeight(he))
 
 	var entries []modules.HostDBEntry
 	for _, entry := range he {
+		entry.Filtered = ht.filtered(entry.PublicKey)
 		entries = append(entries, entry.HostDBEntry)
 	}
 	return entries
@@ -214,13 +293,10 @@ func (ht *HostTree) Insert(hdbe modules.HostDBEntry) error {
 		weight:      ht.weightFn(hdbe),
 	}
 
-	if _, exists := ht.hosts[string(entry.PublicKey.Key)]; exists {
+	if _, exists := ht.entry(entry.PublicKey); exists {
 		return errHostExists
 	}
-
-	_, node := ht.root.recursiveInsert(entry)
-
-	ht.hosts[string(entry.PublicKey.Key)] = node
+	ht.insert(entry)
 	return nil
 }
 
@@ -229,6 +305,10 @@ func (ht *HostTree) Remove(pk types.SiaPublicKey) error {
 	ht.mu.Lock()
 	defer ht.mu.Unlock()
 
+	if _, exists := ht.filteredEntries[string(pk.Key)]; exists {
+		delete(ht.filteredEntries, string(pk.Key))
+		return nil
+	}
 	node, exists := ht.hosts[string(pk.Key)]
 	if !exists {
 		return errNoSuchHost
@@ -245,21 +325,20 @@ func (ht *HostTree) Modify(hdbe modules.HostDBEntry) error {
 	ht.mu.Lock()
 	defer ht.mu.Unlock()
 
-	node, exists := ht.hosts[string(hdbe.PublicKey.Key)]
-	if !exists {
+	if _, exists := ht.filteredEntries[string(hdbe.PublicKey.Key)]; exists {
+		delete(ht.filteredEntries, string(hdbe.PublicKey.Key))
+	} else if node, exists := ht.hosts[string(hdbe.PublicKey.Key)]; exists {
+		node.remove()
+		delete(ht.hosts, string(hdbe.PublicKey.Key))
+	} else {
 		return errNoSuchHost
 	}
 
-	node.remove()
-
 	entry := &hostEntry{
 		HostDBEntry: hdbe,
 		weight:      ht.weightFn(hdbe),
 	}
-
-	_, node = ht.root.recursiveInsert(entry)
-
-	ht.hosts[string(entry.PublicKey.Key)] = node
+	ht.insert(entry)
 	return nil
 }
 
@@ -268,24 +347,79 @@ func (ht *HostTree) Select(spk types.SiaPublicKey) (modules.HostDBEntry, bool) {
 	ht.mu.Lock()
 	defer ht.mu.Unlock()
 
-	node, exists := ht.hosts[string(spk.Key)]
+	he, exists := ht.entry(spk)
 	if !exists {
 		return modules.HostDBEntry{}, false
 	}
-	return node.entry.HostDBEntry, true
+	entry := he.HostDBEntry
+	entry.Filtered = ht.filtered(spk)
+	return entry, true
+}
+
+// SetFilterMode sets the filter of the tree. Depending on the filter mode,
+// the provided hosts are either the only hosts that can be selected, or they
+// can't be selected at all. The tree is rebuilt to apply the new filter.
+func (ht *HostTree) SetFilterMode(fm modules.FilterMode, hosts []types.SiaPublicKey) {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	ht.filterMode = fm
+	ht.filteredHosts = make(map[string]struct{})
+	for _, pk := range hosts {
+		ht.filteredHosts[string(pk.Key)] = struct{}{}
+	}
+	ht.rebuild(ht.entries())
+}
+
+// SetWeightFunction sets the weight function of the tree and recomputes the
+// weights of all hosts. The hosts are reinserted in order of their new weight.
+func (ht *HostTree) SetWeightFunction(wf WeightFunc) {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	he := ht.entries()
+	for i := range he {
+		he[i].weight = wf(he[i].HostDBEntry)
+	}
+	ht.weightFn = wf
+	ht.rebuild(he)
+}
+
+// SetIPFilter enables or disables the IP filter of the tree. If the filter is
+// enabled, SelectRandom will not return multiple hosts from the same subnet.
+func (ht *HostTree) SetIPFilter(enabled bool) {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+	ht.ipFilter = enabled
 }
 
 // SelectRandom grabs a random n hosts from the tree. There will be no repeats, but
 // the length of the slice returned may be less than n, and may even be zero.
 // The hosts that are returned first have the higher priority. Hosts passed to
-// 'ignore' will not be considered; pass `nil` if no blacklist is desired.
-func (ht *HostTree) SelectRandom(n int, ignore []types.SiaPublicKey) []modules.HostDBEntry {
+// 'ignore' and hosts that are excluded by the filter of the tree will not be
+// considered; pass `nil` if no blacklist is desired. If the IP filter of the
+// tree is enabled, hosts that share a subnet with a host passed to
+// 'addressBlacklist' or with a host that was already selected will not be
+// returned either.
+func (ht *HostTree) SelectRandom(n int, ignore, addressBlacklist []types.SiaPublicKey) []modules.HostDBEntry {
 	ht.mu.Lock()
 	defer ht.mu.Unlock()
 
 	var hosts []modules.HostDBEntry
 	var removedEntries []*hostEntry
 
+	// Add the subnets of the hosts in the addressBlacklist to the filter.
+	filter := NewAddressFilter()
+	if ht.ipFilter {
+		for _, pubkey := range addressBlacklist {
+			entry, exists := ht.entry(pubkey)
+			if !exists {
+				continue
+			}
+			filter.Add(entry.HostDBEntry)
+		}
+	}
+
 	for _, pubkey := range ignore {
 		node, exists := ht.hosts[string(pubkey.Key)]
 		if !exists {
@@ -302,10 +436,15 @@ func (ht *HostTree) SelectRandom(n int, ignore []types.SiaPublicKey) []modules.H
 
 		if node.entry.AcceptingContracts &&
 			len(node.entry.ScanHistory) > 0 &&
-			node.entry.ScanHistory[len(node.entry.ScanHistory)-1].Success {
+			node.entry.ScanHistory[len(node.entry.ScanHistory)-1].Success &&
+			!filter.Filtered(node.entry.HostDBEntry) {
 			// The host must be online and accepting contracts to be returned
-			// by the random function.
+			// by the random function. It also must not share a subnet with
+			// any host that is already in use.
 			hosts = append(hosts, node.entry.HostDBEntry)
+			if ht.ipFilter {
+				filter.Add(node.entry.HostDBEntry)
+			}
 		}
 
 		removedEntries = append(removedEntries, node.entry)
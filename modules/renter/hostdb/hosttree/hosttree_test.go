@@ -35,7 +35,7 @@ func verifyTree(tree *HostTree, nentries int) error {
 		selectionMap := make(map[string]int)
 		expected := 100
 		for i := 0; i < expected*nentries; i++ {
-			entries := tree.SelectRandom(1, nil)
+			entries := tree.SelectRandom(1, nil, nil)
 			if len(entries) == 0 {
 				return errors.New("no hosts")
 			}
@@ -222,7 +222,7 @@ func TestHostTreeParallel(t *testing.T) {
 
 					// FETCH
 					case 3:
-						tree.SelectRandom(3, nil)
+						tree.SelectRandom(3, nil, nil)
 					}
 				}
 			}
@@ -310,7 +310,7 @@ func TestVariedWeights(t *testing.T) {
 	// time.
 	selectionMap := make(map[string]int)
 	for i := 0; i < selections; i++ {
-		randEntry := tree.SelectRandom(1, nil)
+		randEntry := tree.SelectRandom(1, nil, nil)
 		if len(randEntry) == 0 {
 			t.Fatal("no hosts!")
 		}
@@ -389,7 +389,7 @@ func TestRandomHosts(t *testing.T) {
 	})
 
 	// Empty.
-	hosts := tree.SelectRandom(1, nil)
+	hosts := tree.SelectRandom(1, nil, nil)
 	if len(hosts) != 0 {
 		t.Errorf("empty hostdb returns %v hosts: %v", len(hosts), hosts)
 	}
@@ -418,13 +418,13 @@ func TestRandomHosts(t *testing.T) {
 	}
 
 	// Grab 1 random host.
-	randHosts := tree.SelectRandom(1, nil)
+	randHosts := tree.SelectRandom(1, nil, nil)
 	if len(randHosts) != 1 {
 		t.Error("didn't get 1 hosts")
 	}
 
 	// Grab 2 random hosts.
-	randHosts = tree.SelectRandom(2, nil)
+	randHosts = tree.SelectRandom(2, nil, nil)
 	if len(randHosts) != 2 {
 		t.Error("didn't get 2 hosts")
 	}
@@ -433,7 +433,7 @@ func TestRandomHosts(t *testing.T) {
 	}
 
 	// Grab 3 random hosts.
-	randHosts = tree.SelectRandom(3, nil)
+	randHosts = tree.SelectRandom(3, nil, nil)
 	if len(randHosts) != 3 {
 		t.Error("didn't get 3 hosts")
 	}
@@ -443,7 +443,7 @@ func TestRandomHosts(t *testing.T) {
 	}
 
 	// Grab 4 random hosts. 3 should be returned.
-	randHosts = tree.SelectRandom(4, nil)
+	randHosts = tree.SelectRandom(4, nil, nil)
 	if len(randHosts) != 3 {
 		t.Error("didn't get 3 hosts")
 	}
@@ -458,13 +458,13 @@ func TestRandomHosts(t *testing.T) {
 		randHosts[0].PublicKey,
 		randHosts[1].PublicKey,
 		randHosts[2].PublicKey,
-	})
+	}, nil)
 	if len(uniqueHosts) != 0 {
 		t.Error("didn't get 0 hosts")
 	}
 
 	// Ask for 3 hosts, blacklisting non-existent hosts. 3 should be returned.
-	randHosts = tree.SelectRandom(3, []types.SiaPublicKey{{}, {}, {}})
+	randHosts = tree.SelectRandom(3, []types.SiaPublicKey{{}, {}, {}}, nil)
 	if len(randHosts) != 3 {
 		t.Error("didn't get 3 hosts")
 	}
@@ -473,3 +473,146 @@ func TestRandomHosts(t *testing.T) {
 		t.Error("doubled up")
 	}
 }
+
+// TestHostTreeFilterMode checks that the filter of the tree is respected by
+// SelectRandom and reported by All and Select.
+func TestHostTreeFilterMode(t *testing.T) {
+	tree := New(func(modules.HostDBEntry) types.Currency {
+		return types.NewCurrency64(20)
+	})
+	var entries []modules.HostDBEntry
+	for i := 0; i < 5; i++ {
+		entry := makeHostDBEntry()
+		if err := tree.Insert(entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	listed := []types.SiaPublicKey{entries[0].PublicKey, entries[1].PublicKey}
+	isListed := func(pk types.SiaPublicKey) bool {
+		return pk.String() == listed[0].String() || pk.String() == listed[1].String()
+	}
+
+	// A blacklist excludes the listed hosts.
+	tree.SetFilterMode(modules.HostDBFilterBlacklist, listed)
+	hosts := tree.SelectRandom(len(entries), nil, nil)
+	if len(hosts) != len(entries)-len(listed) {
+		t.Fatalf("expected %v hosts, got %v", len(entries)-len(listed), len(hosts))
+	}
+	for _, host := range hosts {
+		if isListed(host.PublicKey) {
+			t.Fatal("blacklisted host was selected")
+		}
+	}
+	if entry, _ := tree.Select(listed[0]); !entry.Filtered {
+		t.Fatal("blacklisted host should be marked as filtered")
+	}
+
+	// A whitelist excludes all other hosts.
+	tree.SetFilterMode(modules.HostDBFilterWhitelist, listed)
+	hosts = tree.SelectRandom(len(entries), nil, nil)
+	if len(hosts) != len(listed) {
+		t.Fatalf("expected %v hosts, got %v", len(listed), len(hosts))
+	}
+	for _, host := range hosts {
+		if !isListed(host.PublicKey) {
+			t.Fatal("host that isn't whitelisted was selected")
+		}
+	}
+	for _, entry := range tree.All() {
+		if entry.Filtered == isListed(entry.PublicKey) {
+			t.Fatal("wrong filtered flag for host", entry.PublicKey)
+		}
+	}
+
+	// Disabling the filter makes all hosts available again. The tree must
+	// still contain all of the hosts after the selections.
+	tree.SetFilterMode(modules.HostDBFilterNone, nil)
+	if hosts := tree.SelectRandom(len(entries), nil, nil); len(hosts) != len(entries) {
+		t.Fatalf("expected %v hosts, got %v", len(entries), len(hosts))
+	}
+	if err := verifyTree(tree, len(entries)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestHostTreeIPFilter checks that SelectRandom doesn't return multiple hosts
+// from the same subnet.
+func TestHostTreeIPFilter(t *testing.T) {
+	tree := New(func(modules.HostDBEntry) types.Currency {
+		return types.NewCurrency64(20)
+	})
+	subnets := []string{"1.2.3.0/24", "1.2.3.0/24", "1.2.4.0/24", "2001:db8::/54"}
+	var entries []modules.HostDBEntry
+	for _, subnet := range subnets {
+		entry := makeHostDBEntry()
+		entry.IPNets = []string{subnet}
+		if err := tree.Insert(entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	// Only one of the hosts that share a subnet should be returned.
+	hosts := tree.SelectRandom(len(entries), nil, nil)
+	if len(hosts) != len(entries)-1 {
+		t.Fatalf("expected %v hosts, got %v", len(entries)-1, len(hosts))
+	}
+	seen := make(map[string]struct{})
+	for _, host := range hosts {
+		if _, exists := seen[host.IPNets[0]]; exists {
+			t.Fatal("multiple hosts from the same subnet were selected")
+		}
+		seen[host.IPNets[0]] = struct{}{}
+	}
+
+	// Hosts that share a subnet with a host of the address blacklist
+	// shouldn't be returned.
+	hosts = tree.SelectRandom(len(entries), []types.SiaPublicKey{entries[0].PublicKey}, []types.SiaPublicKey{entries[0].PublicKey})
+	if len(hosts) != 2 {
+		t.Fatalf("expected %v hosts, got %v", 2, len(hosts))
+	}
+	for _, host := range hosts {
+		if host.IPNets[0] == subnets[0] {
+			t.Fatal("host from a blacklisted subnet was selected")
+		}
+	}
+
+	// Disabling the filter makes all hosts available again.
+	tree.SetIPFilter(false)
+	if hosts := tree.SelectRandom(len(entries), nil, nil); len(hosts) != len(entries) {
+		t.Fatalf("expected %v hosts, got %v", len(entries), len(hosts))
+	}
+	if err := verifyTree(tree, len(entries)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestHostTreeSetWeightFunction checks that changing the weight function
+// updates the weights of all hosts in the tree.
+func TestHostTreeSetWeightFunction(t *testing.T) {
+	tree := New(func(modules.HostDBEntry) types.Currency {
+		return types.NewCurrency64(20)
+	})
+	for i := 0; i < 10; i++ {
+		if err := tree.Insert(makeHostDBEntry()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !tree.root.weight.Equals64(200) {
+		t.Fatal("wrong total weight:", tree.root.weight)
+	}
+
+	tree.SetWeightFunction(func(modules.HostDBEntry) types.Currency {
+		return types.NewCurrency64(5)
+	})
+	if !tree.root.weight.Equals64(50) {
+		t.Fatal("weights weren't updated:", tree.root.weight)
+	}
+	if err := verifyTree(tree, 10); err != nil {
+		t.Fatal(err)
+	}
+	if hosts := tree.SelectRandom(10, nil, nil); len(hosts) != 10 {
+		t.Fatal("expected 10 hosts, got", len(hosts))
+	}
+}
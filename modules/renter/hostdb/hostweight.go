@@ -3,6 +3,7 @@ package hostdb
 import (
 	"math"
 	"math/big"
+	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/modules"
@@ -127,6 +128,24 @@ func (hdb *HostDB) interactionAdjustments(entry modules.HostDBEntry) float64 {
 	return math.Pow(ratio, 15)
 }
 
+// performanceAdjustments penalizes hosts that respond slowly or transfer data
+// slowly. Hosts that haven't been measured yet don't receive a penalty. Each
+// of the latency, the upload throughput and the download throughput
+// contributes the square root of its ratio to the reference value, so a host
+// that is 4 times slower than the reference receives half the weight.
+func performanceAdjustments(entry modules.HostDBEntry) float64 {
+	adjustment := 1.0
+	if entry.Latency > referenceLatency {
+		adjustment *= math.Sqrt(float64(referenceLatency) / float64(entry.Latency))
+	}
+	for _, throughput := range []float64{entry.UploadThroughput, entry.DownloadThroughput} {
+		if throughput > 0 && throughput < referenceThroughput {
+			adjustment *= math.Sqrt(throughput / referenceThroughput)
+		}
+	}
+	return adjustment
+}
+
 // priceAdjustments will adjust the weight of the entry according to the prices
 // that it has set.
 func (hdb *HostDB) priceAdjustments(entry modules.HostDBEntry) float64 {
@@ -147,17 +166,28 @@ func (hdb *HostDB) priceAdjustments(entry modules.HostDBEntry) float64 {
 	//    - the upload bandwidth price is per byte
 	//    - the download bandwidth price is per byte
 	//
-	// The hostdb will naively assume the following for now:
+	// If the expected usage of the allowance is unknown, the hostdb will
+	// naively assume the following:
 	//    - each contract covers 6 weeks of storage (default is 12 weeks, but
 	//      renewals occur at midpoint) - 6048 blocks - and 25GB of storage.
 	//    - uploads happen once per 12 weeks (average lifetime of a file is 12 weeks)
 	//    - downloads happen once per 12 weeks (files are on average downloaded once throughout lifetime)
-	//
-	// In the future, the renter should be able to track average user behavior
-	// and adjust accordingly. This flexibility will be added later.
 	adjustedContractPrice := entry.ContractPrice.Div64(6048).Div64(25e9)        // Adjust contract price to match 25GB for 6 weeks.
 	adjustedUploadPrice := entry.UploadBandwidthPrice.Div64(24192)              // Adjust upload price to match a single upload over 24 weeks.
 	adjustedDownloadPrice := entry.DownloadBandwidthPrice.Div64(12096).Div64(3) // Adjust download price to match one download over 12 weeks, 1 redundancy.
+
+	// Otherwise the prices are adjusted to match the expected usage of a
+	// contract with the host, relative to the data stored by that contract.
+	hdb.allowanceMu.RLock()
+	allowance := hdb.allowance
+	hdb.allowanceMu.RUnlock()
+	storage, upload, download := allowance.ExpectedUsagePerHost()
+	if storage > 0 && allowance.Period > 0 {
+		storageTime := types.NewCurrency64(storage).Mul64(uint64(allowance.Period))
+		adjustedContractPrice = entry.ContractPrice.Div(storageTime)
+		adjustedUploadPrice = entry.UploadBandwidthPrice.Mul64(upload).Div(storageTime)
+		adjustedDownloadPrice = entry.DownloadBandwidthPrice.Mul64(download).Div(storageTime)
+	}
 	siafundFee := adjustedContractPrice.Add(adjustedUploadPrice).Add(adjustedDownloadPrice).Add(entry.Collateral).MulTax()
 	totalPrice := entry.StoragePrice.Add(adjustedContractPrice).Add(adjustedUploadPrice).Add(adjustedDownloadPrice).Add(siafundFee)
 
@@ -183,6 +213,20 @@ func (hdb *HostDB) priceAdjustments(entry modules.HostDBEntry) float64 {
 	return weight
 }
 
+// storageProofAdjustments penalizes hosts that miss the storage proofs of
+// their contracts. Like the interaction adjustments, every host starts with a
+// baseline of successful proofs, so that a single missed proof of a new host
+// doesn't outweigh everything else.
+func storageProofAdjustments(entry modules.HostDBEntry) float64 {
+	successful := float64(entry.SuccessfulStorageProofs) + 5
+	failed := float64(entry.FailedStorageProofs)
+	ratio := successful / (successful + failed)
+
+	// Missing a storage proof loses the data of the renter, so the ratio is
+	// raised to the 5th power.
+	return math.Pow(ratio, 5)
+}
+
 // storageRemainingAdjustments adjusts the weight of the entry according to how
 // much storage it has remaining.
 func storageRemainingAdjustments(entry modules.HostDBEntry) float64 {
@@ -274,6 +318,60 @@ func (hdb *HostDB) lifetimeAdjustments(entry modules.HostDBEntry) float64 {
 	return base
 }
 
+// measuredUptime returns the total uptime and the total downtime that have
+// been measured for a host.
+func (hdb *HostDB) measuredUptime(entry modules.HostDBEntry) (uptime, downtime time.Duration) {
+	downtime = entry.HistoricDowntime
+	uptime = entry.HistoricUptime
+	if len(entry.ScanHistory) == 0 {
+		return
+	}
+	recentTime := entry.ScanHistory[0].Timestamp
+	recentSuccess := entry.ScanHistory[0].Success
+	for _, scan := range entry.ScanHistory[1:] {
+		if recentTime.After(scan.Timestamp) {
+			if build.DEBUG {
+				hdb.log.Critical("Host entry scan history not sorted.")
+			} else {
+				hdb.log.Print("WARNING: Host entry scan history not sorted.")
+			}
+			// Ignore the unsorted scan entry.
+			continue
+		}
+		if recentSuccess {
+			uptime += scan.Timestamp.Sub(recentTime)
+		} else {
+			downtime += scan.Timestamp.Sub(recentTime)
+		}
+		recentTime = scan.Timestamp
+		recentSuccess = scan.Success
+	}
+	return
+}
+
+// scoringCutoff returns the reason why a host doesn't meet the cutoffs of the
+// scoring profile, or exceeds the maximum prices of the allowance. An empty
+// string is returned if the host meets all cutoffs. Hosts whose uptime hasn't
+// been measured yet meet the uptime cutoff.
+func (hdb *HostDB) scoringCutoff(entry modules.HostDBEntry, sp modules.HostScoringProfile) string {
+	hdb.allowanceMu.RLock()
+	allowance := hdb.allowance
+	hdb.allowanceMu.RUnlock()
+	if err := allowance.CheckPriceGouging(entry.HostExternalSettings); err != nil {
+		return err.Error()
+	}
+	if !sp.MaxStoragePrice.IsZero() && entry.StoragePrice.Cmp(sp.MaxStoragePrice) > 0 {
+		return "storage price is above the maximum storage price"
+	}
+	if sp.MinUptime > 0 {
+		uptime, downtime := hdb.measuredUptime(entry)
+		if uptime+downtime > 0 && float64(uptime)/float64(uptime+downtime) < sp.MinUptime {
+			return "uptime is below the minimum uptime"
+		}
+	}
+	return ""
+}
+
 // uptimeAdjustments penalizes the host for having poor uptime, and for being
 // offline.
 //
@@ -305,28 +403,8 @@ func (hdb *HostDB) uptimeAdjustments(entry modules.HostDBEntry) float64 {
 
 	// Compute the total measured uptime and total measured downtime for this
 	// host.
-	downtime := entry.HistoricDowntime
-	uptime := entry.HistoricUptime
-	recentTime := entry.ScanHistory[0].Timestamp
-	recentSuccess := entry.ScanHistory[0].Success
-	for _, scan := range entry.ScanHistory[1:] {
-		if recentTime.After(scan.Timestamp) {
-			if build.DEBUG {
-				hdb.log.Critical("Host entry scan history not sorted.")
-			} else {
-				hdb.log.Print("WARNING: Host entry scan history not sorted.")
-			}
-			// Ignore the unsorted scan entry.
-			continue
-		}
-		if recentSuccess {
-			uptime += scan.Timestamp.Sub(recentTime)
-		} else {
-			downtime += scan.Timestamp.Sub(recentTime)
-		}
-		recentTime = scan.Timestamp
-		recentSuccess = scan.Success
-	}
+	uptime, downtime := hdb.measuredUptime(entry)
+
 	// Sanity check against 0 total time.
 	if uptime == 0 && downtime == 0 {
 		return 0.001 // Shouldn't happen.
@@ -363,28 +441,42 @@ func (hdb *HostDB) uptimeAdjustments(entry modules.HostDBEntry) float64 {
 	return math.Pow(uptimeRatio, exp)
 }
 
-// calculateHostWeight returns the weight of a host according to the settings of
-// the host database entry.
-func (hdb *HostDB) calculateHostWeight(entry modules.HostDBEntry) types.Currency {
-	collateralReward := hdb.collateralAdjustments(entry)
-	interactionPenalty := hdb.interactionAdjustments(entry)
-	lifetimePenalty := hdb.lifetimeAdjustments(entry)
-	pricePenalty := hdb.priceAdjustments(entry)
-	storageRemainingPenalty := storageRemainingAdjustments(entry)
-	uptimePenalty := hdb.uptimeAdjustments(entry)
-	versionPenalty := versionAdjustments(entry)
+// scoreBreakdown returns the adjustments of the weight of a host, weighted by
+// the scoring profile of the hostdb, and the resulting score.
+func (hdb *HostDB) scoreBreakdown(entry modules.HostDBEntry) modules.HostScoreBreakdown {
+	sp := hdb.ScoringProfile()
+	sb := modules.HostScoreBreakdown{
+		AgeAdjustment:              math.Pow(hdb.lifetimeAdjustments(entry), sp.AgeWeight),
+		BurnAdjustment:             1,
+		CollateralAdjustment:       math.Pow(hdb.collateralAdjustments(entry), sp.CollateralWeight),
+		InteractionAdjustment:      math.Pow(hdb.interactionAdjustments(entry), sp.InteractionWeight),
+		PerformanceAdjustment:      math.Pow(performanceAdjustments(entry), sp.PerformanceWeight),
+		PriceAdjustment:            math.Pow(hdb.priceAdjustments(entry), sp.PriceWeight),
+		StorageProofAdjustment:     math.Pow(storageProofAdjustments(entry), sp.StorageProofWeight),
+		StorageRemainingAdjustment: math.Pow(storageRemainingAdjustments(entry), sp.StorageRemainingWeight),
+		UptimeAdjustment:           math.Pow(hdb.uptimeAdjustments(entry), sp.UptimeWeight),
+		VersionAdjustment:          math.Pow(versionAdjustments(entry), sp.VersionWeight),
+		CutoffReason:               hdb.scoringCutoff(entry, sp),
+	}
 
 	// Combine the adjustments.
-	fullPenalty := collateralReward * interactionPenalty * lifetimePenalty *
-		pricePenalty * storageRemainingPenalty * uptimePenalty * versionPenalty
+	fullPenalty := sb.AgeAdjustment * sb.CollateralAdjustment * sb.InteractionAdjustment * sb.PerformanceAdjustment *
+		sb.PriceAdjustment * sb.StorageProofAdjustment * sb.StorageRemainingAdjustment * sb.UptimeAdjustment * sb.VersionAdjustment
 
-	// Return a types.Currency.
-	weight := baseWeight.MulFloat(fullPenalty)
-	if weight.IsZero() {
+	// Return a types.Currency. Hosts that don't meet the cutoffs receive the
+	// lowest possible weight.
+	sb.Score = baseWeight.MulFloat(fullPenalty)
+	if sb.Score.IsZero() || sb.CutoffReason != "" {
 		// A weight of zero is problematic for for the host tree.
-		return types.NewCurrency64(1)
+		sb.Score = types.NewCurrency64(1)
 	}
-	return weight
+	return sb
+}
+
+// calculateHostWeight returns the weight of a host according to the settings of
+// the host database entry.
+func (hdb *HostDB) calculateHostWeight(entry modules.HostDBEntry) types.Currency {
+	return hdb.scoreBreakdown(entry).Score
 }
 
 // calculateConversionRate calculates the conversion rate of the provided
@@ -408,18 +500,20 @@ func (hdb *HostDB) calculateConversionRate(score types.Currency) float64 {
 // EstimateHostScore takes a HostExternalSettings and returns the estimated
 // score of that host in the hostdb, assuming no penalties for age or uptime.
 func (hdb *HostDB) EstimateHostScore(entry modules.HostDBEntry) modules.HostScoreBreakdown {
-	// Grab the adjustments. Age, and uptime penalties are set to '1', to
-	// assume best behavior from the host.
-	collateralReward := hdb.collateralAdjustments(entry)
-	pricePenalty := hdb.priceAdjustments(entry)
-	storageRemainingPenalty := storageRemainingAdjustments(entry)
-	versionPenalty := versionAdjustments(entry)
+	// Grab the adjustments. Age, performance, storage proof and uptime
+	// penalties are set to '1', to assume best behavior from the host.
+	sp := hdb.ScoringProfile()
+	collateralReward := math.Pow(hdb.collateralAdjustments(entry), sp.CollateralWeight)
+	pricePenalty := math.Pow(hdb.priceAdjustments(entry), sp.PriceWeight)
+	storageRemainingPenalty := math.Pow(storageRemainingAdjustments(entry), sp.StorageRemainingWeight)
+	versionPenalty := math.Pow(versionAdjustments(entry), sp.VersionWeight)
+	cutoffReason := hdb.scoringCutoff(entry, sp)
 
 	// Combine into a full penalty, then determine the resulting estimated
 	// score.
 	fullPenalty := collateralReward * pricePenalty * storageRemainingPenalty * versionPenalty
 	estimatedScore := baseWeight.MulFloat(fullPenalty)
-	if estimatedScore.IsZero() {
+	if estimatedScore.IsZero() || cutoffReason != "" {
 		estimatedScore = types.NewCurrency64(1)
 	}
 
@@ -431,10 +525,13 @@ func (hdb *HostDB) EstimateHostScore(entry modules.HostDBEntry) modules.HostScor
 		AgeAdjustment:              1,
 		BurnAdjustment:             1,
 		CollateralAdjustment:       collateralReward,
+		PerformanceAdjustment:      1,
 		PriceAdjustment:            pricePenalty,
+		StorageProofAdjustment:     1,
 		StorageRemainingAdjustment: storageRemainingPenalty,
 		UptimeAdjustment:           1,
 		VersionAdjustment:          versionPenalty,
+		CutoffReason:               cutoffReason,
 	}
 }
 
@@ -444,18 +541,7 @@ func (hdb *HostDB) ScoreBreakdown(entry modules.HostDBEntry) modules.HostScoreBr
 	hdb.mu.Lock()
 	defer hdb.mu.Unlock()
 
-	score := hdb.calculateHostWeight(entry)
-	return modules.HostScoreBreakdown{
-		Score:          score,
-		ConversionRate: hdb.calculateConversionRate(score),
-
-		AgeAdjustment:              hdb.lifetimeAdjustments(entry),
-		BurnAdjustment:             1,
-		CollateralAdjustment:       hdb.collateralAdjustments(entry),
-		InteractionAdjustment:      hdb.interactionAdjustments(entry),
-		PriceAdjustment:            hdb.priceAdjustments(entry),
-		StorageRemainingAdjustment: storageRemainingAdjustments(entry),
-		UptimeAdjustment:           hdb.uptimeAdjustments(entry),
-		VersionAdjustment:          versionAdjustments(entry),
-	}
+	sb := hdb.scoreBreakdown(entry)
+	sb.ConversionRate = hdb.calculateConversionRate(sb.Score)
+	return sb
 }
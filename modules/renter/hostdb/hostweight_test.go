@@ -286,3 +286,163 @@ func TestHostWeightUptimeDifferences4(t *testing.T) {
 		t.Error("Been around longer should have more weight")
 	}
 }
+
+// TestHostWeightScoringProfile checks that the weights and cutoffs of the
+// scoring profile are applied to the score of a host.
+func TestHostWeightScoringProfile(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.blockHeight = 10000
+	var entry modules.HostDBEntry
+	entry.Version = build.Version
+	entry.RemainingStorage = 250e3
+	entry.StoragePrice = types.SiacoinPrecision.Div64(4032).Div64(1e9)
+	entry.ScanHistory = modules.HostDBScans{
+		{Timestamp: time.Now().Add(time.Hour * -100), Success: true},
+		{Timestamp: time.Now().Add(time.Hour * -80), Success: false},
+		{Timestamp: time.Now().Add(time.Hour * -60), Success: true},
+		{Timestamp: time.Now().Add(time.Hour * -40), Success: true},
+		{Timestamp: time.Now().Add(time.Hour * -20), Success: true},
+	}
+	sb := hdb.scoreBreakdown(entry)
+	if sb.CutoffReason != "" {
+		t.Fatal("default profile shouldn't have cutoffs:", sb.CutoffReason)
+	}
+	if sb.UptimeAdjustment >= 1 || sb.PriceAdjustment == 1 {
+		t.Fatal("test entry should be penalized for uptime and price")
+	}
+
+	// Doubling the uptime weight squares the uptime adjustment, ignoring the
+	// price removes the price adjustment.
+	sp := modules.DefaultHostScoringProfile
+	sp.UptimeWeight = 2
+	sp.PriceWeight = 0
+	hdb.scoringProfile = sp
+	weighted := hdb.scoreBreakdown(entry)
+	if weighted.UptimeAdjustment != sb.UptimeAdjustment*sb.UptimeAdjustment {
+		t.Fatal("uptime adjustment wasn't squared:", weighted.UptimeAdjustment, sb.UptimeAdjustment)
+	}
+	if weighted.PriceAdjustment != 1 {
+		t.Fatal("price adjustment should be ignored:", weighted.PriceAdjustment)
+	}
+	if weighted.Score.Equals(sb.Score) {
+		t.Fatal("score should have changed with the profile")
+	}
+
+	// Hosts above the maximum storage price receive the lowest score.
+	sp = modules.DefaultHostScoringProfile
+	sp.MaxStoragePrice = entry.StoragePrice.Sub(types.NewCurrency64(1))
+	hdb.scoringProfile = sp
+	if sb := hdb.scoreBreakdown(entry); sb.CutoffReason == "" || !sb.Score.Equals64(1) {
+		t.Fatal("host above the max storage price should be cut off:", sb.CutoffReason, sb.Score)
+	}
+	if sb := hdb.EstimateHostScore(entry); sb.CutoffReason == "" {
+		t.Fatal("estimated score should apply the price cutoff")
+	}
+
+	// The host was offline for 20 of 80 hours, so it has 75% uptime.
+	sp = modules.DefaultHostScoringProfile
+	sp.MinUptime = 0.7
+	hdb.scoringProfile = sp
+	if sb := hdb.scoreBreakdown(entry); sb.CutoffReason != "" {
+		t.Fatal("host above the minimum uptime shouldn't be cut off:", sb.CutoffReason)
+	}
+	sp.MinUptime = 0.8
+	hdb.scoringProfile = sp
+	if sb := hdb.scoreBreakdown(entry); sb.CutoffReason == "" || !sb.Score.Equals64(1) {
+		t.Fatal("host below the minimum uptime should be cut off:", sb.CutoffReason, sb.Score)
+	}
+}
+
+// TestHostWeightExpectedUsage checks that the prices of hosts are weighted
+// according to the expected usage of the allowance.
+func TestHostWeightExpectedUsage(t *testing.T) {
+	hdb := bareHostDB()
+	var storageHost modules.HostDBEntry
+	storageHost.Version = build.Version
+	storageHost.RemainingStorage = 250e3
+	storageHost.StoragePrice = minTotalPrice.Mul64(10)
+	storageHost.DownloadBandwidthPrice = minTotalPrice.Mul64(1e5)
+	downloadHost := storageHost
+	downloadHost.StoragePrice = minTotalPrice.Mul64(20)
+	downloadHost.DownloadBandwidthPrice = minTotalPrice.Mul64(1e3)
+
+	// Without an expected usage, the price of storage matters most.
+	if hdb.calculateHostWeight(storageHost).Cmp(hdb.calculateHostWeight(downloadHost)) <= 0 {
+		t.Fatal("host with cheaper storage should have more weight")
+	}
+
+	// If the renter expects to download a lot, the price of downloads
+	// matters more.
+	err := hdb.SetAllowance(modules.Allowance{
+		Hosts:            10,
+		Period:           4032,
+		ExpectedStorage:  1e12,
+		ExpectedDownload: 10e12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdb.calculateHostWeight(downloadHost).Cmp(hdb.calculateHostWeight(storageHost)) <= 0 {
+		t.Fatal("host with cheaper downloads should have more weight")
+	}
+}
+
+// TestHostWeightPerformance checks that slow hosts have less weight than fast
+// hosts, and that the recorded throughput of a host affects its weight.
+func TestHostWeightPerformance(t *testing.T) {
+	hdb := bareHostDB()
+	entry := makeHostDBEntry()
+	entry.Version = build.Version
+	entry.RemainingStorage = 250e3
+	entry.StoragePrice = types.NewCurrency64(1000).Mul(types.SiacoinPrecision)
+	entry.Collateral = types.NewCurrency64(1000).Mul(types.SiacoinPrecision)
+
+	// Unmeasured hosts and hosts that are faster than the reference values
+	// don't receive a penalty.
+	fast := entry
+	fast.Latency = referenceLatency / 2
+	fast.UploadThroughput = referenceThroughput * 2
+	fast.DownloadThroughput = referenceThroughput * 2
+	if performanceAdjustments(entry) != 1 || performanceAdjustments(fast) != 1 {
+		t.Fatal("fast or unmeasured hosts should not receive a penalty")
+	}
+
+	// Hosts with a high latency or a low throughput have less weight.
+	slowLatency := entry
+	slowLatency.Latency = referenceLatency * 4
+	slowUpload := entry
+	slowUpload.UploadThroughput = referenceThroughput / 4
+	w := hdb.calculateHostWeight(entry)
+	for _, slow := range []modules.HostDBEntry{slowLatency, slowUpload} {
+		if hdb.calculateHostWeight(slow).Cmp(w) >= 0 {
+			t.Error("slow host should have less weight")
+		}
+		if adjustment := performanceAdjustments(slow); adjustment != 0.5 {
+			t.Error("expected an adjustment of 0.5, got", adjustment)
+		}
+	}
+
+	// Recording a slow download reduces the weight of the host.
+	if err := hdb.hostTree.Insert(entry); err != nil {
+		t.Fatal(err)
+	}
+	hdb.RecordDownloadThroughput(entry.PublicKey, 1<<10, time.Second*4/time.Duration(referenceThroughput/(1<<10)))
+	host, ok := hdb.Host(entry.PublicKey)
+	if !ok {
+		t.Fatal("host not found")
+	}
+	if host.DownloadThroughput == 0 || host.DownloadThroughput >= referenceThroughput {
+		t.Fatal("download throughput wasn't recorded correctly", host.DownloadThroughput)
+	}
+	if hdb.calculateHostWeight(host).Cmp(w) >= 0 {
+		t.Error("host with a slow download should have less weight")
+	}
+
+	// The rolling average moves towards new measurements.
+	throughput := host.DownloadThroughput
+	hdb.RecordDownloadThroughput(entry.PublicKey, 1<<30, time.Second)
+	host, _ = hdb.Host(entry.PublicKey)
+	if host.DownloadThroughput <= throughput || host.DownloadThroughput >= 1<<30 {
+		t.Fatal("rolling average wasn't updated correctly", host.DownloadThroughput)
+	}
+}
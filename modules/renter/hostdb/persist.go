@@ -1,6 +1,7 @@
 package hostdb
 
 import (
+	"os"
 	"path/filepath"
 	"time"
 
@@ -24,28 +25,42 @@ var (
 
 // hdbPersist defines what HostDB data persists across sessions.
 type hdbPersist struct {
-	AllHosts    []modules.HostDBEntry
-	BlockHeight types.BlockHeight
-	LastChange  modules.ConsensusChangeID
+	AllHosts       []modules.HostDBEntry
+	BlockHeight    types.BlockHeight
+	FilterMode     modules.FilterMode
+	FilteredHosts  []types.SiaPublicKey
+	LastChange     modules.ConsensusChangeID
+	ScoringProfile modules.HostScoringProfile
 }
 
 // persistData returns the data in the hostdb that will be saved to disk.
 func (hdb *HostDB) persistData() (data hdbPersist) {
 	data.AllHosts = hdb.hostTree.All()
 	data.BlockHeight = hdb.blockHeight
+	data.FilterMode = hdb.filterMode
+	data.FilteredHosts = hdb.filteredHosts
 	data.LastChange = hdb.lastChange
+	data.ScoringProfile = hdb.ScoringProfile()
 	return data
 }
 
-// saveSync saves the hostdb persistence data to disk and then syncs to disk.
+// saveSync saves the hostdb persistence data and the tracked contracts to disk
+// and then syncs to disk.
 func (hdb *HostDB) saveSync() error {
-	return hdb.deps.SaveFileSync(persistMetadata, hdb.persistData(), filepath.Join(hdb.persistDir, persistFilename))
+	err := hdb.deps.SaveFileSync(persistMetadata, hdb.persistData(), filepath.Join(hdb.persistDir, persistFilename))
+	if err != nil {
+		return err
+	}
+	return hdb.saveStorageProofs()
 }
 
 // load loads the hostdb persistence data from disk.
 func (hdb *HostDB) load() error {
-	// Fetch the data from the file.
-	var data hdbPersist
+	// Fetch the data from the file. Older persist files don't contain a
+	// scoring profile, so the default profile is used for them.
+	data := hdbPersist{
+		ScoringProfile: modules.DefaultHostScoringProfile,
+	}
 	err := hdb.deps.LoadFile(persistMetadata, &data, filepath.Join(hdb.persistDir, persistFilename))
 	if err != nil {
 		return err
@@ -54,6 +69,12 @@ func (hdb *HostDB) load() error {
 	// Set the hostdb internal values.
 	hdb.blockHeight = data.BlockHeight
 	hdb.lastChange = data.LastChange
+	hdb.filterMode = data.FilterMode
+	hdb.filteredHosts = data.FilteredHosts
+	hdb.hostTree.SetFilterMode(data.FilterMode, data.FilteredHosts)
+	hdb.scoringProfileMu.Lock()
+	hdb.scoringProfile = data.ScoringProfile
+	hdb.scoringProfileMu.Unlock()
 
 	// Load each of the hosts into the host tree.
 	for _, host := range data.AllHosts {
@@ -76,6 +97,12 @@ func (hdb *HostDB) load() error {
 			hdb.queueScan(host)
 		}
 	}
+
+	// Load the tracked contracts. Older hostdbs don't have a file for them.
+	err = hdb.loadStorageProofs()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
 
@@ -2,9 +2,11 @@ package hostdb
 
 import (
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
 )
 
 // quitAfterLoadDeps will quit startup in newHostDB
@@ -102,6 +104,60 @@ func TestSaveLoad(t *testing.T) {
 	}
 }
 
+// TestSaveLoadFilterMode tests that the filter mode of the hostdb is persisted.
+func TestSaveLoadFilterMode(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	hdbt, err := newHDBTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host1, host2 := makeHostDBEntry(), makeHostDBEntry()
+	hdbt.hdb.hostTree.Insert(host1)
+	hdbt.hdb.hostTree.Insert(host2)
+
+	// Invalid filters should be rejected.
+	if err := hdbt.hdb.SetFilterMode(modules.HostDBFilterWhitelist, nil); err != errEmptyWhitelist {
+		t.Fatal("expected errEmptyWhitelist, got", err)
+	}
+	if err := hdbt.hdb.SetFilterMode(modules.FilterMode(42), nil); err != modules.ErrInvalidFilterMode {
+		t.Fatal("expected ErrInvalidFilterMode, got", err)
+	}
+
+	// Blacklist the first host, it should no longer be active.
+	if err := hdbt.hdb.SetFilterMode(modules.HostDBFilterBlacklist, []types.SiaPublicKey{host1.PublicKey}); err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range hdbt.hdb.ActiveHosts() {
+		if host.PublicKey.String() == host1.PublicKey.String() {
+			t.Fatal("blacklisted host should not be active")
+		}
+	}
+
+	// Close and reload, the filter should be restored.
+	err = hdbt.hdb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdbt.hdb, err = NewCustomHostDB(hdbt.gateway, hdbt.cs, filepath.Join(hdbt.persistDir, modules.RenterDir), &quitAfterLoadDeps{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm, hosts := hdbt.hdb.Filter()
+	if fm != modules.HostDBFilterBlacklist || len(hosts) != 1 || hosts[0].String() != host1.PublicKey.String() {
+		t.Fatal("filter wasn't restored properly:", fm, hosts)
+	}
+	if h1, ok := hdbt.hdb.hostTree.Select(host1.PublicKey); !ok || !h1.Filtered {
+		t.Fatal("filter wasn't applied to the host tree after loading")
+	}
+	if h2, ok := hdbt.hdb.hostTree.Select(host2.PublicKey); !ok || h2.Filtered {
+		t.Fatal("host that isn't blacklisted should not be filtered")
+	}
+}
+
 // TestRescan tests that the hostdb will rescan the blockchain properly, picking
 // up new hosts which appear in an alternate past.
 func TestRescan(t *testing.T) {
@@ -115,3 +171,48 @@ func TestRescan(t *testing.T) {
 
 	t.Skip("create two consensus sets with blocks + announcements")
 }
+
+// TestSaveLoadScoringProfile checks that the scoring profile of the hostdb is
+// validated and persisted.
+func TestSaveLoadScoringProfile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	hdbt, err := newHDBTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid profiles should be rejected.
+	sp := modules.DefaultHostScoringProfile
+	sp.PriceWeight = -1
+	if err := hdbt.hdb.SetScoringProfile(sp); err != errInvalidScoringWeight {
+		t.Fatal("expected errInvalidScoringWeight, got", err)
+	}
+	sp = modules.DefaultHostScoringProfile
+	sp.MinUptime = 1.5
+	if err := hdbt.hdb.SetScoringProfile(sp); err != errInvalidMinUptime {
+		t.Fatal("expected errInvalidMinUptime, got", err)
+	}
+
+	sp = modules.DefaultHostScoringProfile
+	sp.UptimeWeight = 3
+	sp.MaxStoragePrice = types.SiacoinPrecision
+	if err := hdbt.hdb.SetScoringProfile(sp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close and reload, the profile should be restored.
+	err = hdbt.hdb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdbt.hdb, err = NewCustomHostDB(hdbt.gateway, hdbt.cs, filepath.Join(hdbt.persistDir, modules.RenterDir), &quitAfterLoadDeps{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded := hdbt.hdb.ScoringProfile(); !reflect.DeepEqual(loaded, sp) {
+		t.Fatal("scoring profile wasn't restored properly:", loaded)
+	}
+}
@@ -5,6 +5,7 @@ package hostdb
 // settings of the hosts.
 
 import (
+	"fmt"
 	"net"
 	"sort"
 	"time"
@@ -152,6 +153,8 @@ func (hdb *HostDB) updateEntry(entry modules.HostDBEntry, netErr error) {
 	newEntry, exists := hdb.hostTree.Select(entry.PublicKey)
 	if exists {
 		newEntry.HostExternalSettings = entry.HostExternalSettings
+		newEntry.IPNets = entry.IPNets
+		newEntry.LastIPNetChange = entry.LastIPNetChange
 	} else {
 		newEntry = entry
 	}
@@ -250,6 +253,42 @@ func (hdb *HostDB) updateEntry(entry modules.HostDBEntry, netErr error) {
 	}
 }
 
+// managedLookupIPNets resolves the address of a host and returns the sorted
+// subnets of the resulting IP addresses.
+func (hdb *HostDB) managedLookupIPNets(address modules.NetAddress) ([]string, error) {
+	addresses, err := hdb.deps.LookupIP(address.Host())
+	if err != nil {
+		return nil, err
+	}
+	var ipNets []string
+	for _, ip := range addresses {
+		filterRange := ipv6FilterRange
+		if ip.To4() != nil {
+			filterRange = ipv4FilterRange
+		}
+		_, ipNet, err := net.ParseCIDR(fmt.Sprintf("%s/%d", ip.String(), filterRange))
+		if err != nil {
+			return nil, err
+		}
+		ipNets = append(ipNets, ipNet.String())
+	}
+	sort.Strings(ipNets)
+	return ipNets, nil
+}
+
+// equalIPNets returns true if both sorted slices contain the same subnets.
+func equalIPNets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // managedScanHost will connect to a host and grab the settings, verifying
 // uptime and updating to the host's preferences.
 func (hdb *HostDB) managedScanHost(entry modules.HostDBEntry) {
@@ -264,7 +303,7 @@ func (hdb *HostDB) managedScanHost(entry modules.HostDBEntry) {
 	hdb.mu.RUnlock()
 
 	var settings modules.HostExternalSettings
-	var latency time.Duration
+	var latency, settingsLatency time.Duration
 	err := func() error {
 		timeout := hostRequestTimeout
 		hdb.mu.RLock()
@@ -305,13 +344,17 @@ func (hdb *HostDB) managedScanHost(entry modules.HostDBEntry) {
 		defer close(connCloseChan)
 		conn.SetDeadline(time.Now().Add(hostScanDeadline))
 
+		// Measure the round trip time of the settings request, which
+		// includes the time it took to establish the connection.
 		err = encoding.WriteObject(conn, modules.RPCSettings)
 		if err != nil {
 			return err
 		}
 		var pubkey crypto.PublicKey
 		copy(pubkey[:], pubKey.Key)
-		return crypto.ReadSignedObject(conn, &settings, maxSettingsLen, pubkey)
+		err = crypto.ReadSignedObject(conn, &settings, maxSettingsLen, pubkey)
+		settingsLatency = time.Since(start)
+		return err
 	}()
 	if err != nil {
 		hdb.log.Debugf("Scan of host at %v failed: %v", netAddr, err)
@@ -322,11 +365,24 @@ func (hdb *HostDB) managedScanHost(entry modules.HostDBEntry) {
 	}
 	success := err == nil
 
+	// Update the subnets of the host. If the address of the host can't be
+	// resolved, the subnets of the previous scan are kept.
+	ipNets, lookupErr := hdb.managedLookupIPNets(netAddr)
+	if lookupErr != nil {
+		hdb.log.Debugf("Unable to resolve address %v of host: %v", netAddr, lookupErr)
+	} else if !equalIPNets(entry.IPNets, ipNets) {
+		entry.IPNets = ipNets
+		entry.LastIPNetChange = time.Now()
+	}
+
 	hdb.mu.Lock()
 	defer hdb.mu.Unlock()
 	// Update the host tree to have a new entry, including the new error. Then
 	// delete the entry from the scan map as the scan has been successful.
 	hdb.updateEntry(entry, err)
+	if success {
+		hdb.updateLatency(pubKey, settingsLatency)
+	}
 
 	// Add the scan to the initialScanLatencies if it was successful.
 	if success && len(hdb.initialScanLatencies) < minScansForSpeedup {
@@ -2,6 +2,7 @@ package hostdb
 
 import (
 	"errors"
+	"net"
 	"testing"
 	"time"
 
@@ -182,3 +183,41 @@ func TestUpdateEntry(t *testing.T) {
 		t.Error("host not reporting historic uptime?")
 	}
 }
+
+// resolverDeps is a dependency that resolves hostnames using a static map.
+type resolverDeps struct {
+	modules.ProductionDependencies
+	addresses map[string][]net.IP
+}
+
+// LookupIP returns the addresses of the host from the static map.
+func (d *resolverDeps) LookupIP(host string) ([]net.IP, error) {
+	addresses, exists := d.addresses[host]
+	if !exists {
+		return nil, errors.New("no such host")
+	}
+	return addresses, nil
+}
+
+// TestLookupIPNets checks that managedLookupIPNets returns the correct subnets
+// for IPv4 and IPv6 addresses.
+func TestLookupIPNets(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.deps = &resolverDeps{
+		addresses: map[string][]net.IP{
+			"host.com": {net.ParseIP("2001:db8::1234"), net.ParseIP("192.168.10.20")},
+		},
+	}
+
+	ipNets, err := hdb.managedLookupIPNets("host.com:9982")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"192.168.10.0/24", "2001:db8::/54"}
+	if !equalIPNets(ipNets, expected) {
+		t.Fatalf("expected subnets %v, got %v", expected, ipNets)
+	}
+	if _, err := hdb.managedLookupIPNets("unknown.com:9982"); err == nil {
+		t.Fatal("expected an error when resolving an unknown host")
+	}
+}
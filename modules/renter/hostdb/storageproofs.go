@@ -0,0 +1,213 @@
+package hostdb
+
+// storageproofs.go keeps track of whether hosts submit the storage proofs of
+// their contracts. The consensus set doesn't know which host a file contract
+// belongs to, so the hostdb remembers the contracts of the hosts in the hostdb
+// that require a storage proof, together with the public key of the host. The
+// public key is part of the unlock conditions of every revision, and contracts
+// that haven't been revised yet are matched to hosts by the payout address of
+// their settings. Once a contract leaves the consensus set, the delayed
+// outputs that were created for it show whether the host submitted a valid
+// proof or missed it.
+//
+// The tracked contracts are kept in their own persist file, separate from the
+// hostdb persistence.
+
+import (
+	"path/filepath"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// storageProofsFilename is the name of the file that holds the tracked
+	// contracts of the hostdb.
+	storageProofsFilename = "storageproofs.json"
+
+	// storageProofsMetadata is the metadata of the file that holds the
+	// tracked contracts of the hostdb.
+	storageProofsMetadata = persist.Metadata{
+		Header:  "HostDB Storage Proofs",
+		Version: "1.3.4",
+	}
+)
+
+// A trackedContract is a file contract on the blockchain that requires a
+// storage proof from a host in the hostdb.
+type trackedContract struct {
+	ID            types.FileContractID `json:"id"`
+	HostPublicKey types.SiaPublicKey   `json:"hostpublickey"`
+	WindowEnd     types.BlockHeight    `json:"windowend"`
+}
+
+// requiresStorageProof returns true if the payout of the host depends on
+// whether it submits a storage proof. Hosts don't submit proofs for contracts
+// that don't contain any data, which is why those contracts are ignored.
+func requiresStorageProof(fc types.FileContract) bool {
+	if len(fc.ValidProofOutputs) < 2 || len(fc.MissedProofOutputs) < 2 {
+		return false
+	}
+	return !fc.ValidProofOutputs[1].Value.Equals(fc.MissedProofOutputs[1].Value)
+}
+
+// hostKeysFromRevisions returns the public keys of the hosts of all contracts
+// that were revised in the applied blocks of a consensus change. The host is
+// the second signer of a contract.
+func hostKeysFromRevisions(cc modules.ConsensusChange) map[types.FileContractID]types.SiaPublicKey {
+	keys := make(map[types.FileContractID]types.SiaPublicKey)
+	for _, block := range cc.AppliedBlocks {
+		for _, txn := range block.Transactions {
+			for _, fcr := range txn.FileContractRevisions {
+				if len(fcr.UnlockConditions.PublicKeys) == 2 {
+					keys[fcr.ParentID] = fcr.UnlockConditions.PublicKeys[1]
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// updateStorageProofs updates the tracked contracts and the storage proof
+// track records of the hosts according to a consensus change.
+func (hdb *HostDB) updateStorageProofs(cc modules.ConsensusChange) {
+	// Collect the delayed outputs that were created or removed. The outputs of
+	// an expired contract are removed again once they mature, but the
+	// contract isn't added back at that point.
+	createdOutputs := make(map[types.SiacoinOutputID]struct{})
+	removedOutputs := make(map[types.SiacoinOutputID]struct{})
+	for _, dscod := range cc.DelayedSiacoinOutputDiffs {
+		if dscod.Direction == modules.DiffApply {
+			createdOutputs[dscod.ID] = struct{}{}
+		} else {
+			removedOutputs[dscod.ID] = struct{}{}
+		}
+	}
+
+	// hostKey returns the public key of the host of a contract, if the host
+	// is in the hostdb. If the contract wasn't revised in this change, and
+	// isn't tracked yet, the host is found through its payout address.
+	hostKeys := hostKeysFromRevisions(cc)
+	var hostsByUnlockHash map[types.UnlockHash]types.SiaPublicKey
+	hostKey := func(id types.FileContractID, fc types.FileContract, old trackedContract, tracked bool) (types.SiaPublicKey, bool) {
+		if key, exists := hostKeys[id]; exists {
+			_, exists = hdb.hostTree.Select(key)
+			return key, exists
+		}
+		if tracked {
+			return old.HostPublicKey, true
+		}
+		if hostsByUnlockHash == nil {
+			hostsByUnlockHash = make(map[types.UnlockHash]types.SiaPublicKey)
+			for _, host := range hdb.hostTree.All() {
+				if host.UnlockHash != (types.UnlockHash{}) {
+					hostsByUnlockHash[host.UnlockHash] = host.PublicKey
+				}
+			}
+		}
+		key, exists := hostsByUnlockHash[fc.ValidProofOutputs[1].UnlockHash]
+		return key, exists
+	}
+
+	// A revision removes the contract and adds the revised contract. The
+	// removed contracts are remembered to keep the public key of the host.
+	removed := make(map[types.FileContractID]trackedContract)
+	for _, fcd := range cc.FileContractDiffs {
+		validID := fcd.ID.StorageProofOutputID(types.ProofValid, 1)
+		missedID := fcd.ID.StorageProofOutputID(types.ProofMissed, 1)
+		if fcd.Direction == modules.DiffRevert {
+			tc, exists := hdb.trackedContracts[fcd.ID]
+			if !exists {
+				continue
+			}
+			delete(hdb.trackedContracts, fcd.ID)
+			removed[fcd.ID] = tc
+			if _, ok := createdOutputs[validID]; ok {
+				hdb.recordStorageProof(tc.HostPublicKey, true, false)
+			} else if _, ok := createdOutputs[missedID]; ok {
+				hdb.recordStorageProof(tc.HostPublicKey, false, false)
+			}
+			continue
+		}
+
+		if !requiresStorageProof(fcd.FileContract) {
+			continue
+		}
+		old, tracked := removed[fcd.ID]
+		key, exists := hostKey(fcd.ID, fcd.FileContract, old, tracked)
+		if !exists {
+			continue
+		}
+		tc := trackedContract{
+			ID:            fcd.ID,
+			HostPublicKey: key,
+			WindowEnd:     fcd.FileContract.WindowEnd,
+		}
+		hdb.trackedContracts[fcd.ID] = tc
+
+		// A contract that is added back because a block was reverted undoes
+		// the outcome of its storage proof.
+		if _, ok := removedOutputs[validID]; ok {
+			hdb.recordStorageProof(tc.HostPublicKey, true, true)
+		} else if _, ok := removedOutputs[missedID]; ok {
+			hdb.recordStorageProof(tc.HostPublicKey, false, true)
+		}
+	}
+
+	// Prune the contracts whose proof window has ended, and the contracts of
+	// hosts that were removed from the hostdb. The consensus set removes
+	// every contract at the end of its window, so this only drops contracts
+	// whose removal was missed.
+	if len(cc.AppliedBlocks) == 0 {
+		return
+	}
+	for id, tc := range hdb.trackedContracts {
+		if _, exists := hdb.hostTree.Select(tc.HostPublicKey); tc.WindowEnd < hdb.blockHeight || !exists {
+			delete(hdb.trackedContracts, id)
+		}
+	}
+}
+
+// recordStorageProof counts a successful or failed storage proof of a host.
+// If undo is true, the storage proof is removed from the count instead.
+func (hdb *HostDB) recordStorageProof(key types.SiaPublicKey, success, undo bool) {
+	host, exists := hdb.hostTree.Select(key)
+	if !exists {
+		return
+	}
+	counter := &host.FailedStorageProofs
+	if success {
+		counter = &host.SuccessfulStorageProofs
+	}
+	if !undo {
+		*counter++
+	} else if *counter > 0 {
+		*counter--
+	}
+	if err := hdb.hostTree.Modify(host); err != nil {
+		hdb.log.Println("ERROR: unable to update the storage proofs of a host:", err)
+	}
+}
+
+// saveStorageProofs saves the tracked contracts to disk.
+func (hdb *HostDB) saveStorageProofs() error {
+	contracts := make([]trackedContract, 0, len(hdb.trackedContracts))
+	for _, tc := range hdb.trackedContracts {
+		contracts = append(contracts, tc)
+	}
+	return hdb.deps.SaveFileSync(storageProofsMetadata, contracts, filepath.Join(hdb.persistDir, storageProofsFilename))
+}
+
+// loadStorageProofs loads the tracked contracts from disk.
+func (hdb *HostDB) loadStorageProofs() error {
+	var contracts []trackedContract
+	err := hdb.deps.LoadFile(storageProofsMetadata, &contracts, filepath.Join(hdb.persistDir, storageProofsFilename))
+	if err != nil {
+		return err
+	}
+	for _, tc := range contracts {
+		hdb.trackedContracts[tc.ID] = tc
+	}
+	return nil
+}
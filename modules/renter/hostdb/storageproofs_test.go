@@ -0,0 +1,121 @@
+package hostdb
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestUpdateStorageProofs checks that the outcomes of expired contracts are
+// attributed to their hosts, both through the public keys of revisions and
+// through the payout addresses of hosts.
+func TestUpdateStorageProofs(t *testing.T) {
+	hdb := bareHostDB()
+	host := makeHostDBEntry()
+	host.UnlockHash = types.UnlockHash{1}
+	host.Version = build.Version
+	host.RemainingStorage = 250e3
+	host.StoragePrice = types.NewCurrency64(1000).Mul(types.SiacoinPrecision)
+	host.Collateral = types.NewCurrency64(1000).Mul(types.SiacoinPrecision)
+	if err := hdb.hostTree.Insert(host); err != nil {
+		t.Fatal(err)
+	}
+
+	// contract returns a contract that pays the host. The payout of the host
+	// differs between the valid and missed proof outputs if data is true.
+	contract := func(data bool) types.FileContract {
+		missed := types.NewCurrency64(100)
+		if data {
+			missed = types.NewCurrency64(50)
+		}
+		return types.FileContract{
+			ValidProofOutputs:  []types.SiacoinOutput{{}, {Value: types.NewCurrency64(100), UnlockHash: host.UnlockHash}},
+			MissedProofOutputs: []types.SiacoinOutput{{}, {Value: missed, UnlockHash: host.UnlockHash}, {}},
+		}
+	}
+	proofRecord := func() (uint64, uint64) {
+		entry, ok := hdb.hostTree.Select(host.PublicKey)
+		if !ok {
+			t.Fatal("host not found")
+		}
+		return entry.SuccessfulStorageProofs, entry.FailedStorageProofs
+	}
+
+	// Revise contract a, which reveals the public key of the host. Contract b
+	// is a renewed contract without revisions, contract c doesn't contain any
+	// data and contract d belongs to a host that isn't in the hostdb.
+	a, b, c, d := types.FileContractID{1}, types.FileContractID{2}, types.FileContractID{3}, types.FileContractID{4}
+	unknown := contract(true)
+	unknown.ValidProofOutputs[1].UnlockHash = types.UnlockHash{2}
+	revision := types.FileContractRevision{
+		ParentID: a,
+		UnlockConditions: types.UnlockConditions{
+			PublicKeys: []types.SiaPublicKey{{}, host.PublicKey},
+		},
+	}
+	hdb.updateStorageProofs(modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{{FileContractRevisions: []types.FileContractRevision{revision}}}}},
+		FileContractDiffs: []modules.FileContractDiff{
+			{Direction: modules.DiffRevert, ID: a, FileContract: contract(false)},
+			{Direction: modules.DiffApply, ID: a, FileContract: contract(true)},
+			{Direction: modules.DiffApply, ID: b, FileContract: contract(true)},
+			{Direction: modules.DiffApply, ID: c, FileContract: contract(false)},
+			{Direction: modules.DiffApply, ID: d, FileContract: unknown},
+		},
+	})
+	if len(hdb.trackedContracts) != 2 {
+		t.Fatal("expected 2 tracked contracts, got", len(hdb.trackedContracts))
+	}
+	if tc := hdb.trackedContracts[a]; tc.HostPublicKey.String() != host.PublicKey.String() {
+		t.Fatal("public key of the host wasn't taken from the revision")
+	}
+
+	// The host submits the proof of contract a and misses the proof of
+	// contract b.
+	hdb.updateStorageProofs(modules.ConsensusChange{
+		FileContractDiffs: []modules.FileContractDiff{
+			{Direction: modules.DiffRevert, ID: a, FileContract: contract(true)},
+			{Direction: modules.DiffRevert, ID: b, FileContract: contract(true)},
+		},
+		DelayedSiacoinOutputDiffs: []modules.DelayedSiacoinOutputDiff{
+			{Direction: modules.DiffApply, ID: a.StorageProofOutputID(types.ProofValid, 1)},
+			{Direction: modules.DiffApply, ID: b.StorageProofOutputID(types.ProofMissed, 1)},
+		},
+	})
+	if successful, failed := proofRecord(); successful != 1 || failed != 1 {
+		t.Fatalf("expected 1 successful and 1 failed proof, got %v and %v", successful, failed)
+	}
+	if len(hdb.trackedContracts) != 0 {
+		t.Fatal("expired contracts are still tracked")
+	}
+
+	// Reverting the block that expired contract b undoes the missed proof.
+	hdb.updateStorageProofs(modules.ConsensusChange{
+		FileContractDiffs: []modules.FileContractDiff{
+			{Direction: modules.DiffApply, ID: b, FileContract: contract(true)},
+		},
+		DelayedSiacoinOutputDiffs: []modules.DelayedSiacoinOutputDiff{
+			{Direction: modules.DiffRevert, ID: b.StorageProofOutputID(types.ProofMissed, 1)},
+		},
+	})
+	if successful, failed := proofRecord(); successful != 1 || failed != 0 {
+		t.Fatalf("expected 1 successful and 0 failed proofs, got %v and %v", successful, failed)
+	}
+
+	// Contracts are pruned once their proof window has ended.
+	hdb.blockHeight = 1
+	hdb.updateStorageProofs(modules.ConsensusChange{AppliedBlocks: []types.Block{{}}})
+	if len(hdb.trackedContracts) != 0 {
+		t.Fatal("contracts are still tracked after the end of their proof window")
+	}
+
+	// Missed storage proofs reduce the weight of the host.
+	entry, _ := hdb.hostTree.Select(host.PublicKey)
+	bad := entry
+	bad.FailedStorageProofs = 3
+	if hdb.calculateHostWeight(bad).Cmp(hdb.calculateHostWeight(entry)) >= 0 {
+		t.Fatal("host with missed storage proofs should have less weight")
+	}
+}
@@ -112,5 +112,8 @@ func (hdb *HostDB) ProcessConsensusChange(cc modules.ConsensusChange) {
 		}
 	}
 
+	// Update the storage proof track records of the hosts.
+	hdb.updateStorageProofs(cc)
+
 	hdb.lastChange = cc.ID
 }
@@ -0,0 +1,353 @@
+package renter
+
+// packs.go implements packing several small files into a shared chunk. A pack
+// is an internal file that consists of a single chunk. Small files that are
+// uploaded in packing mode are appended to the buffered data of an open pack
+// with the same erasure code and cipher, and record the name of the pack and
+// the offset of their data within it. Once a pack is full, or once it has
+// been open for packFlushInterval, it is sealed and uploaded by the repair
+// loop like any other file. Downloads of a packed file read the corresponding
+// range of its pack, which is served from the buffered data of the pack until
+// the pack is fully uploaded.
+//
+// The buffered data of a pack is stored on disk next to the pack's .sia file,
+// so that the pack can be uploaded after a restart. All packs are sealed when
+// the renter is loaded. The buffered data is removed once the pack is fully
+// uploaded. A pack is removed from the renter and the hosts once the last of
+// its files has been deleted.
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/persist"
+)
+
+var (
+	// errSharePackedFile is returned if the user tries to share a file that
+	// is stored in a pack.
+	errSharePackedFile = errors.New("packed files can't be shared")
+
+	// errUnknownPack is returned if a file references a pack that doesn't
+	// exist.
+	errUnknownPack = errors.New("file is stored in an unknown pack")
+)
+
+// packDataPath returns the path of the buffered data of a pack.
+func (r *Renter) packDataPath(pack *file) string {
+	return filepath.Join(r.persistDir, packsDir, pack.name+packDataExtension)
+}
+
+// readPackData reads length bytes at offset from the buffered data of a pack.
+// An error that satisfies os.IsNotExist is returned once the pack is fully
+// uploaded and its buffered data was removed.
+func (r *Renter) readPackData(pack *file, offset, length uint64) ([]byte, error) {
+	f, err := os.Open(r.packDataPath(pack))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := make([]byte, length)
+	if _, err := f.ReadAt(data, int64(offset)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// packIsOpen returns true if the pack still accepts new files. The renter
+// should be locked by the caller.
+func (r *Renter) packIsOpen(pack *file) bool {
+	for _, op := range r.openPacks {
+		if op == pack {
+			return true
+		}
+	}
+	return false
+}
+
+// dataFile returns the file that stores the data of f, which is the pack of
+// f if f is a packed file. The renter should be locked by the caller.
+func (r *Renter) dataFile(f *file) *file {
+	if f.packName == "" {
+		return f
+	}
+	if pack, exists := r.packs[f.packName]; exists {
+		return pack
+	}
+	return f
+}
+
+// managedDataFile returns the file that stores the data of f, which is the
+// pack of f if f is a packed file.
+func (r *Renter) managedDataFile(f *file) *file {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	return r.dataFile(f)
+}
+
+// openPack returns an open pack with the given erasure code and cipher that
+// has enough space left for size bytes. If the open pack of the erasure code
+// and cipher is too full, it is sealed and a new pack is opened. The renter
+// should be locked by the caller.
+func (r *Renter) openPack(ec modules.ErasureCoder, cipherType crypto.CipherType, size uint64) (*file, error) {
+	for _, pack := range r.openPacks {
+		if !sameErasureCode(pack.erasureCode, ec) || pack.masterKey.Type() != cipherType {
+			continue
+		}
+		if pack.packReserved+size <= pack.staticChunkSize() {
+			return pack, nil
+		}
+		r.sealPack(pack)
+		break
+	}
+
+	masterKey, err := crypto.GenerateCipherKey(cipherType)
+	if err != nil {
+		return nil, err
+	}
+	pack := newFile(persist.RandomSuffix(), ec, masterKey, 0)
+	pack.isPack = true
+	r.packs[pack.name] = pack
+	r.openPacks = append(r.openPacks, pack)
+	go r.threadedSealPack(pack)
+	return pack, nil
+}
+
+// sealPack prevents further files from being added to the pack and hands the
+// pack to the repair loop once the data of its files has been written. Packs
+// without files are removed instead. The renter should be locked by the
+// caller.
+func (r *Renter) sealPack(pack *file) {
+	for i, op := range r.openPacks {
+		if op == pack {
+			r.openPacks = append(r.openPacks[:i], r.openPacks[i+1:]...)
+			break
+		}
+	}
+	if pack.numMembers == 0 {
+		r.removePack(pack)
+		return
+	}
+
+	// Wake up the repair loop.
+	select {
+	case r.uploadHeap.newUploads <- struct{}{}:
+	default:
+	}
+}
+
+// threadedSealPack seals the pack once it has been open for
+// packFlushInterval, so that the files in it don't wait for other files to
+// fill the pack indefinitely.
+func (r *Renter) threadedSealPack(pack *file) {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	select {
+	case <-r.tg.StopChan():
+		return
+	case <-time.After(packFlushInterval):
+	}
+	id := r.mu.Lock()
+	if r.packIsOpen(pack) {
+		r.sealPack(pack)
+	}
+	r.mu.Unlock(id)
+}
+
+// removePack removes the pack from the renter and its pieces from the hosts.
+// The renter should be locked by the caller.
+func (r *Renter) removePack(pack *file) {
+	delete(r.packs, pack.name)
+
+	pack.mu.Lock()
+	pack.deleted = true
+	sectors := pack.sectors()
+	pack.mu.Unlock()
+
+	if err := persist.RemoveFile(r.filePath(pack)); err != nil && !os.IsNotExist(err) {
+		r.log.Println("WARN: couldn't remove pack:", err)
+	}
+	if err := os.Remove(r.packDataPath(pack)); err != nil && !os.IsNotExist(err) {
+		r.log.Println("WARN: couldn't remove buffered data of pack:", err)
+	}
+	go r.threadedDeleteSectors(sectors)
+}
+
+// releasePackMember is called when the packed file f is removed from the
+// renter. The pack of f is removed once it no longer stores any files, unless
+// it is still open. The renter should be locked by the caller.
+func (r *Renter) releasePackMember(f *file) {
+	pack, exists := r.packs[f.packName]
+	if f.packName == "" || !exists {
+		return
+	}
+	pack.numMembers--
+	if pack.numMembers == 0 && !r.packIsOpen(pack) {
+		r.removePack(pack)
+	}
+}
+
+// managedUploadPacked adds a small file to an open pack. The file is read
+// into the buffered data of the pack right away, and is uploaded together
+// with the other files of the pack once the pack is sealed.
+func (r *Renter) managedUploadPacked(up modules.FileUploadParams, fileInfo os.FileInfo) error {
+	// Read the file before acquiring the lock. Packed files are smaller than
+	// a chunk.
+	data, err := ioutil.ReadFile(up.Source)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != fileInfo.Size() {
+		return errors.New("file was modified during the upload")
+	}
+
+	// Reserve space for the data in an open pack. The pack is neither
+	// uploaded nor removed while the data is being written to it.
+	lockID := r.mu.Lock()
+	if _, exists := r.files[up.SiaPath]; exists {
+		r.mu.Unlock(lockID)
+		return ErrPathOverload
+	}
+	pack, err := r.openPack(up.ErasureCode, up.CipherType, uint64(len(data)))
+	if err != nil {
+		r.mu.Unlock(lockID)
+		return err
+	}
+	offset := pack.packReserved
+	pack.packReserved += uint64(len(data))
+	pack.pendingWrites++
+	pack.numMembers++
+	// Upload the pack as soon as it is full.
+	if pack.packReserved == pack.staticChunkSize() {
+		r.sealPack(pack)
+	}
+	r.mu.Unlock(lockID)
+
+	// Append the data to the pack. The data is written before the pack's
+	// metadata, so that the metadata never references missing data.
+	pack.mu.Lock()
+	err = writePackData(r.packDataPath(pack), data, int64(offset))
+	if err == nil {
+		if end := offset + uint64(len(data)); end > pack.size {
+			pack.size = end
+		}
+		err = r.saveFile(pack)
+	}
+	pack.mu.Unlock()
+
+	// Create the file.
+	lockID = r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	r.finishPackWrite(pack)
+	if _, exists := r.files[up.SiaPath]; exists && err == nil {
+		err = ErrPathOverload
+	}
+	if err != nil {
+		pack.numMembers--
+		if pack.numMembers == 0 && !r.packIsOpen(pack) {
+			r.removePack(pack)
+		}
+		return err
+	}
+	f := newFile(up.SiaPath, pack.erasureCode, pack.masterKey, uint64(len(data)))
+	f.mode = uint32(fileInfo.Mode())
+	f.packName = pack.name
+	f.packOffset = offset
+	r.files[up.SiaPath] = f
+	r.persist.Tracking[up.SiaPath] = trackedFile{
+		RepairPath: up.Source,
+		Size:       fileInfo.Size(),
+		ModTime:    fileInfo.ModTime(),
+	}
+	if err := r.saveSync(); err != nil {
+		return err
+	}
+	if err := r.saveFile(f); err != nil {
+		return err
+	}
+	go r.threadedBubbleMetadata(dirParent(up.SiaPath))
+	return nil
+}
+
+// finishPackWrite is called once the data of a file has been written to its
+// pack. A sealed pack is handed to the repair loop once all of its data has
+// been written. The renter should be locked by the caller.
+func (r *Renter) finishPackWrite(pack *file) {
+	pack.pendingWrites--
+	if pack.pendingWrites > 0 || r.packIsOpen(pack) {
+		return
+	}
+	select {
+	case r.uploadHeap.newUploads <- struct{}{}:
+	default:
+	}
+}
+
+// writePackData writes data to the buffered data of a pack at offset, and
+// syncs it to disk.
+func writePackData(path string, data []byte, offset int64) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(data, offset); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadPacks loads the packs of the renter from disk. All packs are sealed,
+// since their files are only known once the renter's files are loaded.
+func (r *Renter) loadPacks() error {
+	dir := filepath.Join(r.persistDir, packsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != ShareExtension {
+			continue
+		}
+		handle, err := os.Open(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			r.log.Println("ERROR: could not open pack:", err)
+			continue
+		}
+		files, err := readSharedFiles(handle)
+		handle.Close()
+		if err != nil || len(files) != 1 {
+			r.log.Println("ERROR: could not load pack:", fi.Name(), err)
+			continue
+		}
+		pack := files[0]
+		pack.isPack = true
+		r.packs[pack.name] = pack
+	}
+	return nil
+}
+
+// removeUnusedPacks removes the packs that don't store any files anymore. It
+// is called after the renter's files have been loaded.
+func (r *Renter) removeUnusedPacks() {
+	for _, pack := range r.packs {
+		if pack.numMembers == 0 {
+			r.removePack(pack)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package renter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestUploadPacked checks that small files are packed into shared packs, that
+// the packs are persisted, and that a pack is removed once all of its files
+// have been deleted.
+func TestUploadPacked(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	dir := build.TempDir(modules.RenterDir, t.Name(), "files")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	ec, err := NewRSCode(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := func(name string, data []byte) {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := r.Upload(modules.FileUploadParams{
+			Source:      path,
+			SiaPath:     name,
+			ErasureCode: ec,
+			Pack:        true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Upload two files that fit into the same pack.
+	data1, data2 := fastrand.Bytes(3000), fastrand.Bytes(3000)
+	upload("foo", data1)
+	upload("bar", data2)
+	foo, bar := r.files["foo"], r.files["bar"]
+	if foo.packName == "" || foo.packName != bar.packName {
+		t.Fatal("files weren't packed into the same pack")
+	}
+	if foo.packOffset != 0 || bar.packOffset != uint64(len(data1)) {
+		t.Fatal("files have wrong offsets within the pack:", foo.packOffset, bar.packOffset)
+	}
+	pack := r.packs[foo.packName]
+	if pack == nil || !r.packIsOpen(pack) || pack.numMembers != 2 || pack.size != uint64(len(data1)+len(data2)) {
+		t.Fatal("pack wasn't created correctly")
+	}
+	buffered, err := ioutil.ReadFile(r.packDataPath(pack))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buffered, append(data1, data2...)) {
+		t.Fatal("pack contains the wrong data")
+	}
+
+	// A file that doesn't fit into the pack should seal it and open a new
+	// pack.
+	upload("baz", fastrand.Bytes(3000))
+	if r.packIsOpen(pack) {
+		t.Fatal("full pack wasn't sealed")
+	}
+	if r.files["baz"].packName == pack.name || len(r.packs) != 2 {
+		t.Fatal("new pack wasn't opened")
+	}
+
+	// Files that are larger than a chunk aren't packed.
+	upload("qux", fastrand.Bytes(int(pack.staticChunkSize())+1))
+	if r.files["qux"].packName != "" {
+		t.Fatal("large file was packed")
+	}
+
+	// Reload the packs and files from disk.
+	r.files = make(map[string]*file)
+	r.packs = make(map[string]*file)
+	r.openPacks = nil
+	if err := r.loadPacks(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.loadSiaFiles(); err != nil {
+		t.Fatal(err)
+	}
+	pack = r.packs[foo.packName]
+	if len(r.packs) != 2 || pack == nil || pack.numMembers != 2 || pack.size != uint64(len(data1)+len(data2)) {
+		t.Fatal("packs weren't loaded correctly")
+	}
+	if r.files["bar"].packName != pack.name || r.files["bar"].packOffset != uint64(len(data1)) {
+		t.Fatal("packed file wasn't loaded correctly")
+	}
+
+	// Packed files can't be shared.
+	if err := r.ShareFiles([]string{"foo"}, filepath.Join(dir, "foo.sia")); err != errSharePackedFile {
+		t.Fatal("expected errSharePackedFile, got", err)
+	}
+
+	// The pack should be removed once both of its files are deleted.
+	if err := r.DeleteFile("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := r.packs[pack.name]; !exists {
+		t.Fatal("pack was removed while it still contains a file")
+	}
+	if err := r.DeleteFile("bar"); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := r.packs[pack.name]; exists {
+		t.Fatal("unused pack wasn't removed")
+	}
+	if _, err := os.Stat(r.filePath(pack)); !os.IsNotExist(err) {
+		t.Fatal("unused pack wasn't removed from disk:", err)
+	}
+}
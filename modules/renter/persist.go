@@ -11,6 +11,7 @@ import (
 	"strconv"
 
 	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/encoding"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/persist"
@@ -23,6 +24,16 @@ const (
 	PersistFilename = "renter.json"
 	// ShareExtension is the extension to be used
 	ShareExtension = ".sia"
+
+	// migrationExtension is appended to the path of a .sia file to store the
+	// pending layout of the file while its redundancy is being changed.
+	migrationExtension = ".migration"
+
+	// packsDir is the folder within the renter's persist directory that
+	// contains the packs of small files, and packDataExtension is the
+	// extension of the files that store the buffered data of the packs.
+	packsDir          = "packs"
+	packDataExtension = ".dat"
 )
 
 var (
@@ -41,7 +52,12 @@ var (
 	}
 
 	shareHeader  = [15]byte{'S', 'i', 'a', ' ', 'S', 'h', 'a', 'r', 'e', 'd', ' ', 'F', 'i', 'l', 'e'}
-	shareVersion = "0.4"
+	shareVersion = "1.3.4"
+
+	// shareVersion040 is the version of .sia files that don't contain the
+	// cipher type, the pack and the content hashes of the files. Their pieces
+	// are encrypted with Twofish.
+	shareVersion040 = "0.4"
 
 	// Persist Version Numbers
 	persistVersion040 = "0.4"
@@ -67,7 +83,8 @@ func (f *file) MarshalSia(w io.Writer) error {
 	err := enc.EncodeAll(
 		f.name,
 		f.size,
-		f.masterKey,
+		f.masterKey.Type(),
+		f.masterKey.Key(),
 		f.pieceSize,
 		f.mode,
 	)
@@ -82,22 +99,28 @@ func (f *file) MarshalSia(w io.Writer) error {
 	}
 
 	// encode erasureCode
-	switch code := f.erasureCode.(type) {
+	var codeType string
+	switch f.erasureCode.(type) {
 	case *rsCode:
-		err = enc.EncodeAll(
-			"Reed-Solomon",
-			uint64(code.dataPieces),
-			uint64(code.numPieces-code.dataPieces),
-		)
-		if err != nil {
-			return err
-		}
+		codeType = CodeTypeReedSolomon
+	case *rsSystematicCode:
+		codeType = CodeTypeReedSolomonSystematic
+	case *replicationCode:
+		codeType = CodeTypeReplication
 	default:
 		if build.DEBUG {
 			panic("unknown erasure code")
 		}
 		return errors.New("unknown erasure code")
 	}
+	err = enc.EncodeAll(
+		codeType,
+		uint64(f.erasureCode.MinPieces()),
+		uint64(f.erasureCode.NumPieces()-f.erasureCode.MinPieces()),
+	)
+	if err != nil {
+		return err
+	}
 	// encode contracts
 	if err := enc.Encode(uint64(len(f.contracts))); err != nil {
 		return err
@@ -107,12 +130,19 @@ func (f *file) MarshalSia(w io.Writer) error {
 			return err
 		}
 	}
-	return nil
+	// encode pack and content hashes
+	return enc.EncodeAll(f.packName, f.packOffset, f.dedup, f.chunkHashes)
 }
 
 // UnmarshalSia implements the encoding.SiaUnmarshaller interface,
 // reconstructing a file from the encoded bytes read from r.
 func (f *file) UnmarshalSia(r io.Reader) error {
+	return f.unmarshalSia(r, shareVersion)
+}
+
+// unmarshalSia reconstructs a file from the encoded bytes read from r, which
+// were encoded using the given version of the .sia format.
+func (f *file) unmarshalSia(r io.Reader, version string) error {
 	dec := encoding.NewDecoder(r)
 
 	// COMPATv0.4.3 - decode bytesUploaded and chunksUploaded into dummy vars.
@@ -122,7 +152,27 @@ func (f *file) UnmarshalSia(r io.Reader) error {
 	err := dec.DecodeAll(
 		&f.name,
 		&f.size,
-		&f.masterKey,
+	)
+	if err != nil {
+		return err
+	}
+	if version == shareVersion040 {
+		// COMPATv1.3.4 - files without a cipher type use Twofish.
+		var key crypto.TwofishKey
+		err = dec.Decode(&key)
+		f.masterKey = key
+	} else {
+		var cipherType crypto.CipherType
+		var key []byte
+		err = dec.DecodeAll(&cipherType, &key)
+		if err == nil {
+			f.masterKey, err = crypto.NewCipherKey(cipherType, key)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	err = dec.DecodeAll(
 		&f.pieceSize,
 		&f.mode,
 		&bytesUploaded,
@@ -138,23 +188,17 @@ func (f *file) UnmarshalSia(r io.Reader) error {
 	if err := dec.Decode(&codeType); err != nil {
 		return err
 	}
-	switch codeType {
-	case "Reed-Solomon":
-		var nData, nParity uint64
-		err = dec.DecodeAll(
-			&nData,
-			&nParity,
-		)
-		if err != nil {
-			return err
-		}
-		rsc, err := NewRSCode(int(nData), int(nParity))
-		if err != nil {
-			return err
-		}
-		f.erasureCode = rsc
-	default:
-		return errors.New("unrecognized erasure code type: " + codeType)
+	var nData, nParity uint64
+	err = dec.DecodeAll(
+		&nData,
+		&nParity,
+	)
+	if err != nil {
+		return err
+	}
+	f.erasureCode, err = NewErasureCoder(codeType, int(nData), int(nParity))
+	if err != nil {
+		return err
 	}
 
 	// Decode contracts.
@@ -170,7 +214,12 @@ func (f *file) UnmarshalSia(r io.Reader) error {
 		}
 		f.contracts[contract.ID] = contract
 	}
-	return nil
+
+	// COMPATv1.3.4 - older files are never packed or deduplicated.
+	if version == shareVersion040 {
+		return nil
+	}
+	return dec.DecodeAll(&f.packName, &f.packOffset, &f.dedup, &f.chunkHashes)
 }
 
 // saveFile saves a file to the renter directory.
@@ -179,14 +228,13 @@ func (r *Renter) saveFile(f *file) error {
 		return errors.New("can't save deleted file")
 	}
 	// Create directory structure specified in nickname.
-	fullPath := filepath.Join(r.persistDir, f.name+ShareExtension)
-	err := os.MkdirAll(filepath.Dir(fullPath), 0700)
+	err := r.createDirAll(dirParent(f.name))
 	if err != nil {
 		return err
 	}
 
 	// Open SafeFile handle.
-	handle, err := persist.NewSafeFile(filepath.Join(r.persistDir, f.name+ShareExtension))
+	handle, err := persist.NewSafeFile(r.filePath(f))
 	if err != nil {
 		return err
 	}
@@ -202,6 +250,19 @@ func (r *Renter) saveFile(f *file) error {
 	return handle.CommitSync()
 }
 
+// filePath returns the path of the .sia file of f. The pending layout of a file
+// is stored next to the file's .sia file. Packs are stored in the packs folder.
+func (r *Renter) filePath(f *file) string {
+	if f.isPack {
+		return filepath.Join(r.persistDir, packsDir, f.name+ShareExtension)
+	}
+	path := filepath.Join(r.persistDir, f.name+ShareExtension)
+	if f.original != nil {
+		path += migrationExtension
+	}
+	return path
+}
+
 // saveSync stores the current renter data to disk and then syncs to disk.
 func (r *Renter) saveSync() error {
 	return persist.SaveJSON(settingsMetadata, r.persist, filepath.Join(r.persistDir, PersistFilename))
@@ -212,7 +273,7 @@ func (r *Renter) saveSync() error {
 func (r *Renter) loadSiaFiles() error {
 	// Recursively load all files found in renter directory. Errors
 	// encountered during loading are logged, but are not considered fatal.
-	return filepath.Walk(r.persistDir, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(r.persistDir, func(path string, info os.FileInfo, err error) error {
 		// This error is non-nil if filepath.Walk couldn't stat a file or
 		// folder.
 		if err != nil {
@@ -220,6 +281,11 @@ func (r *Renter) loadSiaFiles() error {
 			return nil
 		}
 
+		// Skip the packs, they are loaded separately.
+		if info.IsDir() && path == filepath.Join(r.persistDir, packsDir) {
+			return filepath.SkipDir
+		}
+
 		// Skip folders and non-sia files.
 		if info.IsDir() || filepath.Ext(path) != ShareExtension {
 			return nil
@@ -241,6 +307,12 @@ func (r *Renter) loadSiaFiles() error {
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	r.loadMigrations()
+	r.removeUnusedPacks()
+	return nil
 }
 
 // load fetches the saved renter data from disk.
@@ -326,6 +398,8 @@ func (r *Renter) ShareFiles(nicknames []string, shareDest string) error {
 		f, exists := r.files[name]
 		if !exists {
 			return ErrUnknownPath
+		} else if f.packName != "" {
+			return errSharePackedFile
 		}
 		files[i] = f
 	}
@@ -350,6 +424,8 @@ func (r *Renter) ShareFilesASCII(nicknames []string) (string, error) {
 		f, exists := r.files[name]
 		if !exists {
 			return "", ErrUnknownPath
+		} else if f.packName != "" {
+			return "", errSharePackedFile
 		}
 		files[i] = f
 	}
@@ -363,9 +439,8 @@ func (r *Renter) ShareFilesASCII(nicknames []string) (string, error) {
 	return buf.String(), nil
 }
 
-// loadSharedFiles reads .sia data from reader and registers the contained
-// files in the renter. It returns the nicknames of the loaded files.
-func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
+// readSharedFiles reads the files contained in the .sia data of reader.
+func readSharedFiles(reader io.Reader) ([]*file, error) {
 	// read header
 	var header [15]byte
 	var version string
@@ -379,7 +454,7 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 		return nil, err
 	} else if header != shareHeader {
 		return nil, ErrBadFile
-	} else if version != shareVersion {
+	} else if version != shareVersion && version != shareVersion040 {
 		return nil, ErrIncompatible
 	}
 
@@ -394,10 +469,28 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 	files := make([]*file, numFiles)
 	for i := range files {
 		files[i] = new(file)
-		err := dec.Decode(files[i])
+		err := files[i].unmarshalSia(dec, version)
 		if err != nil {
 			return nil, err
 		}
+	}
+	return files, nil
+}
+
+// loadSharedFiles reads .sia data from reader and registers the contained
+// files in the renter. It returns the nicknames of the loaded files.
+func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
+	files, err := readSharedFiles(reader)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		// Make sure that the pack of a packed file exists.
+		if files[i].packName != "" {
+			if _, exists := r.packs[files[i].packName]; !exists {
+				return nil, errUnknownPack
+			}
+		}
 
 		// Make sure the file's name does not conflict with existing files.
 		dupCount := 0
@@ -413,10 +506,14 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 	}
 
 	// Add files to renter.
-	names := make([]string, numFiles)
+	names := make([]string, len(files))
 	for i, f := range files {
 		r.files[f.name] = f
 		names[i] = f.name
+		if f.packName != "" {
+			r.packs[f.packName].numMembers++
+		}
+		r.addDedupRefs(f)
 	}
 	// Save the files.
 	for _, f := range files {
@@ -447,7 +544,17 @@ func (r *Renter) initPersist() error {
 		return err
 	}
 
-	// Load the siafiles into memory.
+	// Create the root directory of the renter's directory hierarchy.
+	err = r.createDirAll("")
+	if err != nil {
+		return err
+	}
+
+	// Load the packs and the siafiles into memory. The packs need to be
+	// loaded first, since the packed files reference them.
+	if err := r.loadPacks(); err != nil {
+		return err
+	}
 	return r.loadSiaFiles()
 }
 
@@ -462,7 +569,12 @@ func (r *Renter) LoadSharedFiles(filename string) ([]string, error) {
 		return nil, err
 	}
 	defer file.Close()
-	return r.loadSharedFiles(file)
+	names, err := r.loadSharedFiles(file)
+	if err != nil {
+		return nil, err
+	}
+	r.bubbleParentDirs(names)
+	return names, nil
 }
 
 // LoadSharedFilesASCII loads an ASCII-encoded .sia file into the renter. It
@@ -472,7 +584,12 @@ func (r *Renter) LoadSharedFilesASCII(asciiSia string) ([]string, error) {
 	defer r.mu.Unlock(lockID)
 
 	dec := base64.NewDecoder(base64.URLEncoding, bytes.NewBufferString(asciiSia))
-	return r.loadSharedFiles(dec)
+	names, err := r.loadSharedFiles(dec)
+	if err != nil {
+		return nil, err
+	}
+	r.bubbleParentDirs(names)
+	return names, nil
 }
 
 // convertPersistVersionFrom040to133 upgrades a legacy persist file to the next
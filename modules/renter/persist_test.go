@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"testing"
 
@@ -22,12 +23,21 @@ func newTestingFile() *file {
 	data := fastrand.Bytes(8)
 	nData := fastrand.Intn(10)
 	nParity := fastrand.Intn(10)
-	rsc, _ := NewRSCode(nData+1, nParity+1)
+	codeType := []string{CodeTypeReedSolomon, CodeTypeReedSolomonSystematic, CodeTypeReplication}[fastrand.Intn(3)]
+	if codeType == CodeTypeReplication {
+		nData = 0
+	}
+	rsc, _ := NewErasureCoder(codeType, nData+1, nParity+1)
+	cipherType := crypto.TypeTwofish
+	if fastrand.Intn(2) == 0 {
+		cipherType = crypto.TypeXChaCha20
+	}
+	masterKey, _ := crypto.GenerateCipherKey(cipherType)
 
 	return &file{
 		name:        "testfile-" + strconv.Itoa(int(data[0])),
 		size:        encoding.DecUint64(data[1:5]),
-		masterKey:   crypto.GenerateTwofishKey(),
+		masterKey:   masterKey,
 		erasureCode: rsc,
 		pieceSize:   encoding.DecUint64(data[6:8]),
 		staticUID:   persist.RandomSuffix(),
@@ -48,9 +58,26 @@ func equalFiles(f1, f2 *file) error {
 	if f1.masterKey != f2.masterKey {
 		return fmt.Errorf("keys do not match: %v %v", f1.masterKey, f2.masterKey)
 	}
+	if reflect.TypeOf(f1.erasureCode) != reflect.TypeOf(f2.erasureCode) {
+		return fmt.Errorf("erasure code types do not match: %T %T", f1.erasureCode, f2.erasureCode)
+	}
+	if f1.erasureCode.MinPieces() != f2.erasureCode.MinPieces() || f1.erasureCode.NumPieces() != f2.erasureCode.NumPieces() {
+		return fmt.Errorf("erasure code parameters do not match")
+	}
 	if f1.pieceSize != f2.pieceSize {
 		return fmt.Errorf("pieceSizes do not match: %v %v", f1.pieceSize, f2.pieceSize)
 	}
+	if f1.packName != f2.packName || f1.packOffset != f2.packOffset {
+		return fmt.Errorf("packs do not match: %v/%v %v/%v", f1.packName, f1.packOffset, f2.packName, f2.packOffset)
+	}
+	if f1.dedup != f2.dedup || len(f1.chunkHashes) != len(f2.chunkHashes) {
+		return fmt.Errorf("dedup fields do not match: %v/%v %v/%v", f1.dedup, len(f1.chunkHashes), f2.dedup, len(f2.chunkHashes))
+	}
+	for i := range f1.chunkHashes {
+		if f1.chunkHashes[i] != f2.chunkHashes[i] {
+			return fmt.Errorf("content hashes of chunk %v do not match", i)
+		}
+	}
 	return nil
 }
 
@@ -58,6 +85,11 @@ func equalFiles(f1, f2 *file) error {
 // file type.
 func TestFileMarshalling(t *testing.T) {
 	savedFile := newTestingFile()
+	savedFile.packName = persist.RandomSuffix()
+	savedFile.packOffset = uint64(fastrand.Intn(1000))
+	savedFile.dedup = true
+	savedFile.chunkHashes = make([]crypto.Hash, 3)
+	fastrand.Read(savedFile.chunkHashes[1][:])
 	buf := new(bytes.Buffer)
 	savedFile.MarshalSia(buf)
 
@@ -356,4 +388,11 @@ func TestSiafileCompatibility(t *testing.T) {
 	if len(names) != 1 || names[0] != "testfile-183" {
 		t.Fatal("nickname not loaded properly:", names)
 	}
+	// The pieces of old files are encrypted with Twofish.
+	id := rt.renter.mu.RLock()
+	f := rt.renter.files[names[0]]
+	rt.renter.mu.RUnlock(id)
+	if f.masterKey.Type() != crypto.TypeTwofish {
+		t.Fatal("expected cipher type of old file to be Twofish, got", f.masterKey.Type())
+	}
 }
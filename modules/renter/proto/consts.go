@@ -19,6 +19,14 @@ const (
 	// remainingFile is a constant used to indicate that a fileSection can access
 	// the whole remaining file instead of being bound to a certain end offset.
 	remainingFile = -1
+
+	// sessionMaxIdleTime and sessionMaxTime are the amounts of time after which
+	// a Session expires. They are kept below the limits of the host, which
+	// ends a session after 10 minutes without a request, or after 20 minutes
+	// in total, so that the renter replaces a session before the host closes
+	// it.
+	sessionMaxIdleTime = 5 * time.Minute
+	sessionMaxTime     = 15 * time.Minute
 )
 
 var (
@@ -19,8 +19,9 @@ const (
 	// portion of a contract can consume.
 	contractHeaderSize = writeaheadlog.MaxPayloadSize // TODO: test this
 
-	updateNameSetHeader = "setHeader"
-	updateNameSetRoot   = "setRoot"
+	updateNameSetHeader     = "setHeader"
+	updateNameSetRoot       = "setRoot"
+	updateNameTruncateRoots = "truncateRoots"
 )
 
 type updateSetHeader struct {
@@ -42,6 +43,11 @@ type updateSetRoot struct {
 	Index int
 }
 
+type updateTruncateRoots struct {
+	ID       types.FileContractID
+	NumRoots int
+}
+
 type contractHeader struct {
 	// transaction is the signed transaction containing the most recent
 	// revision of the file contract.
@@ -231,6 +237,19 @@ func (c *SafeContract) makeUpdateSetRoot(root crypto.Hash, index int) writeahead
 	}
 }
 
+func (c *SafeContract) makeUpdateTruncateRoots(numRoots int) writeaheadlog.Update {
+	c.headerMu.Lock()
+	id := c.header.ID()
+	c.headerMu.Unlock()
+	return writeaheadlog.Update{
+		Name: updateNameTruncateRoots,
+		Instructions: encoding.Marshal(updateTruncateRoots{
+			ID:       id,
+			NumRoots: numRoots,
+		}),
+	}
+}
+
 func (c *SafeContract) applySetHeader(h contractHeader) error {
 	headerBytes := make([]byte, contractHeaderSize)
 	copy(headerBytes, encoding.Marshal(h))
@@ -247,7 +266,9 @@ func (c *SafeContract) applySetRoot(root crypto.Hash, index int) error {
 	return c.merkleRoots.insert(index, root)
 }
 
-func (c *SafeContract) recordUploadIntent(rev types.FileContractRevision, root crypto.Hash, storageCost, bandwidthCost types.Currency) (*writeaheadlog.Transaction, error) {
+// recordUploadIntent records a revision that appends roots to the contract in
+// a single WAL transaction.
+func (c *SafeContract) recordUploadIntent(rev types.FileContractRevision, roots []crypto.Hash, storageCost, bandwidthCost types.Currency) (*writeaheadlog.Transaction, error) {
 	// construct new header
 	// NOTE: this header will not include the host signature
 	c.headerMu.Lock()
@@ -257,10 +278,11 @@ func (c *SafeContract) recordUploadIntent(rev types.FileContractRevision, root c
 	newHeader.StorageSpending = newHeader.StorageSpending.Add(storageCost)
 	newHeader.UploadSpending = newHeader.UploadSpending.Add(bandwidthCost)
 
-	t, err := c.wal.NewTransaction([]writeaheadlog.Update{
-		c.makeUpdateSetHeader(newHeader),
-		c.makeUpdateSetRoot(root, c.merkleRoots.len()),
-	})
+	updates := []writeaheadlog.Update{c.makeUpdateSetHeader(newHeader)}
+	for i, root := range roots {
+		updates = append(updates, c.makeUpdateSetRoot(root, c.merkleRoots.len()+i))
+	}
+	t, err := c.wal.NewTransaction(updates)
 	if err != nil {
 		return nil, err
 	}
@@ -271,7 +293,9 @@ func (c *SafeContract) recordUploadIntent(rev types.FileContractRevision, root c
 	return t, nil
 }
 
-func (c *SafeContract) commitUpload(t *writeaheadlog.Transaction, signedTxn types.Transaction, root crypto.Hash, storageCost, bandwidthCost types.Currency) error {
+// commitUpload applies a revision that appends roots to the contract, and
+// marks the corresponding WAL transaction as applied.
+func (c *SafeContract) commitUpload(t *writeaheadlog.Transaction, signedTxn types.Transaction, roots []crypto.Hash, storageCost, bandwidthCost types.Currency) error {
 	// construct new header
 	c.headerMu.Lock()
 	newHeader := c.header
@@ -283,7 +307,67 @@ func (c *SafeContract) commitUpload(t *writeaheadlog.Transaction, signedTxn type
 	if err := c.applySetHeader(newHeader); err != nil {
 		return err
 	}
-	if err := c.applySetRoot(root, c.merkleRoots.len()); err != nil {
+	for _, root := range roots {
+		if err := c.applySetRoot(root, c.merkleRoots.len()); err != nil {
+			return err
+		}
+	}
+	if err := c.headerFile.Sync(); err != nil {
+		return err
+	}
+	if err := t.SignalUpdatesApplied(); err != nil {
+		return err
+	}
+	c.unappliedTxns = nil
+	return nil
+}
+
+// recordDeleteIntent records a revision that removes sectors from the
+// contract in a single WAL transaction. The roots at the given indices are
+// replaced with the new roots, after which the contract is truncated to
+// numRoots roots.
+func (c *SafeContract) recordDeleteIntent(rev types.FileContractRevision, indices []int, roots []crypto.Hash, numRoots int) (*writeaheadlog.Transaction, error) {
+	// construct new header
+	// NOTE: this header will not include the host signature
+	c.headerMu.Lock()
+	newHeader := c.header
+	c.headerMu.Unlock()
+	newHeader.Transaction.FileContractRevisions = []types.FileContractRevision{rev}
+
+	updates := []writeaheadlog.Update{c.makeUpdateSetHeader(newHeader)}
+	for i := range indices {
+		updates = append(updates, c.makeUpdateSetRoot(roots[i], indices[i]))
+	}
+	updates = append(updates, c.makeUpdateTruncateRoots(numRoots))
+	t, err := c.wal.NewTransaction(updates)
+	if err != nil {
+		return nil, err
+	}
+	if err := <-t.SignalSetupComplete(); err != nil {
+		return nil, err
+	}
+	c.unappliedTxns = append(c.unappliedTxns, t)
+	return t, nil
+}
+
+// commitDelete applies a revision that removes sectors from the contract, and
+// marks the corresponding WAL transaction as applied.
+func (c *SafeContract) commitDelete(t *writeaheadlog.Transaction, signedTxn types.Transaction, indices []int, roots []crypto.Hash, numRoots int) error {
+	// construct new header
+	c.headerMu.Lock()
+	newHeader := c.header
+	c.headerMu.Unlock()
+	newHeader.Transaction = signedTxn
+
+	if err := c.applySetHeader(newHeader); err != nil {
+		return err
+	}
+	for i := range indices {
+		if err := c.applySetRoot(roots[i], indices[i]); err != nil {
+			return err
+		}
+	}
+	if err := c.merkleRoots.truncate(numRoots); err != nil {
 		return err
 	}
 	if err := c.headerFile.Sync(); err != nil {
@@ -361,6 +445,14 @@ func (c *SafeContract) commitTxns() error {
 				if err := c.applySetRoot(u.Root, u.Index); err != nil {
 					return err
 				}
+			case updateNameTruncateRoots:
+				var u updateTruncateRoots
+				if err := encoding.Unmarshal(update.Instructions, &u); err != nil {
+					return err
+				}
+				if err := c.merkleRoots.truncate(u.NumRoots); err != nil {
+					return err
+				}
 			}
 		}
 		if err := c.headerFile.Sync(); err != nil {
@@ -474,6 +566,12 @@ func (cs *ContractSet) loadSafeContract(filename string, walTxns []*writeaheadlo
 				return err
 			}
 			id = u.ID
+		case updateNameTruncateRoots:
+			var u updateTruncateRoots
+			if err := encoding.Unmarshal(update.Instructions, &u); err != nil {
+				return err
+			}
+			id = u.ID
 		}
 		if id == header.ID() {
 			unappliedTxns = append(unappliedTxns, t)
@@ -518,7 +616,7 @@ func (cs *ContractSet) ConvertV130Contract(c V130Contract, cr V130CachedRevision
 		defer cs.Return(sc)
 		if len(cr.MerkleRoots) == sc.merkleRoots.len()+1 {
 			root := cr.MerkleRoots[len(cr.MerkleRoots)-1]
-			_, err = sc.recordUploadIntent(cr.Revision, root, types.ZeroCurrency, types.ZeroCurrency)
+			_, err = sc.recordUploadIntent(cr.Revision, []crypto.Hash{root}, types.ZeroCurrency, types.ZeroCurrency)
 		} else {
 			_, err = sc.recordDownloadIntent(cr.Revision, types.ZeroCurrency)
 		}
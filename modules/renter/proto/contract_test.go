@@ -62,7 +62,7 @@ func TestContractUncommittedTxn(t *testing.T) {
 	newRoot := revisedRoots[1]
 	storageCost := revisedHeader.StorageSpending.Sub(initialHeader.StorageSpending)
 	bandwidthCost := revisedHeader.UploadSpending.Sub(initialHeader.UploadSpending)
-	walTxn, err := sc.recordUploadIntent(fcr, newRoot, storageCost, bandwidthCost)
+	walTxn, err := sc.recordUploadIntent(fcr, []crypto.Hash{newRoot}, storageCost, bandwidthCost)
 	if err != nil {
 		t.Fatal(err)
 	}
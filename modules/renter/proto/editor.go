@@ -2,6 +2,7 @@ package proto
 
 import (
 	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -24,6 +25,122 @@ func cachedMerkleRoot(roots []crypto.Hash) crypto.Hash {
 	return tree.Root()
 }
 
+// uploadPrices returns the storage and bandwidth price and the collateral of
+// uploading numSectors sectors to the host, and checks that the contract can
+// support the upload.
+func uploadPrices(host modules.HostDBEntry, contract contractHeader, height types.BlockHeight, numSectors uint64) (types.Currency, types.Currency, types.Currency, error) {
+	blockBytes := types.NewCurrency64(numSectors * modules.SectorSize * uint64(contract.LastRevision().NewWindowEnd-height))
+	sectorStoragePrice := host.StoragePrice.Mul(blockBytes)
+	sectorBandwidthPrice := host.UploadBandwidthPrice.Mul64(numSectors * modules.SectorSize)
+	sectorCollateral := host.Collateral.Mul(blockBytes)
+
+	// to mitigate small errors (e.g. differing block heights), fudge the
+	// price and collateral by 0.2%. This is only applied to hosts above
+	// v1.0.1; older hosts use stricter math.
+	if build.VersionCmp(host.Version, "1.0.1") > 0 {
+		sectorStoragePrice = sectorStoragePrice.MulFloat(1 + hostPriceLeeway)
+		sectorBandwidthPrice = sectorBandwidthPrice.MulFloat(1 + hostPriceLeeway)
+		sectorCollateral = sectorCollateral.MulFloat(1 - hostPriceLeeway)
+	}
+
+	sectorPrice := sectorStoragePrice.Add(sectorBandwidthPrice)
+	if contract.RenterFunds().Cmp(sectorPrice) < 0 {
+		return types.Currency{}, types.Currency{}, types.Currency{}, errors.New("contract has insufficient funds to support upload")
+	}
+	if contract.LastRevision().NewMissedProofOutputs[1].Value.Cmp(sectorCollateral) < 0 {
+		return types.Currency{}, types.Currency{}, types.Currency{}, errors.New("contract has insufficient collateral to support upload")
+	}
+	return sectorStoragePrice, sectorBandwidthPrice, sectorCollateral, nil
+}
+
+// uploadBatchLen returns the number of sectors at the start of data that fit
+// into a single revision, given the maximum size of the encoded revision
+// actions that the host accepts. At least one sector is always included.
+func uploadBatchLen(data [][]byte, maxBatchSize uint64) int {
+	// each action consists of its type, the sector index and the offset,
+	// and the length-prefixed data; the actions are prefixed by their count
+	const actionOverhead = types.SpecifierLen + 8 + 8 + 8
+	size := uint64(8)
+	for i := range data {
+		size += actionOverhead + uint64(len(data[i]))
+		if size > maxBatchSize && i > 0 {
+			return i
+		}
+	}
+	return len(data)
+}
+
+// A sectorDeletion describes the revision actions that remove sectors from a
+// contract, and the state of the contract's roots afterwards.
+type sectorDeletion struct {
+	actions        []modules.RevisionAction
+	numDeleted     int
+	remainingRoots []crypto.Hash
+	swapIndices    []int
+	swapRoots      []crypto.Hash
+}
+
+// newSectorDeletion returns the sectorDeletion that removes roots from a
+// contract with the specified roots. Each sector is swapped with the last
+// sector of the contract, and the contract is then trimmed, so that the
+// remaining sectors don't need to be shifted. Roots that are not part of the
+// contract are ignored; if a root appears multiple times, only one copy is
+// removed per occurrence in roots. contractRoots is modified.
+func newSectorDeletion(contractRoots, roots []crypto.Hash) sectorDeletion {
+	// find the indices of the sectors that are deleted
+	rootIndices := make(map[crypto.Hash][]int)
+	for i, root := range contractRoots {
+		rootIndices[root] = append(rootIndices[root], i)
+	}
+	var deleted []int
+	for _, root := range roots {
+		if indices := rootIndices[root]; len(indices) > 0 {
+			deleted = append(deleted, indices[len(indices)-1])
+			rootIndices[root] = indices[:len(indices)-1]
+		}
+	}
+	if len(deleted) == 0 {
+		return sectorDeletion{remainingRoots: contractRoots}
+	}
+
+	// Starting with the highest index, swap each deleted sector with the
+	// last sector that remains in the contract. Because the indices are
+	// processed in descending order, the last sector is never one of the
+	// deleted sectors, unless it is the sector being deleted. The deleted
+	// sectors end up at the end of the contract, where they are trimmed.
+	sort.Sort(sort.Reverse(sort.IntSlice(deleted)))
+	var d sectorDeletion
+	var swapped []int
+	for _, i := range deleted {
+		last := len(contractRoots) - 1
+		if i != last {
+			d.actions = append(d.actions, modules.RevisionAction{
+				Type:        modules.ActionSwap,
+				SectorIndex: uint64(i),
+				Offset:      uint64(last),
+			})
+			contractRoots[i] = contractRoots[last]
+			swapped = append(swapped, i)
+		}
+		contractRoots = contractRoots[:last]
+	}
+	d.actions = append(d.actions, modules.RevisionAction{
+		Type:        modules.ActionTrim,
+		SectorIndex: uint64(len(deleted)),
+	})
+	d.numDeleted = len(deleted)
+	d.remainingRoots = contractRoots
+	// Only the swapped indices that remain after the trim need to be
+	// recorded; the others are removed by the trim anyway.
+	for _, i := range swapped {
+		if i < len(contractRoots) {
+			d.swapIndices = append(d.swapIndices, i)
+			d.swapRoots = append(d.swapRoots, contractRoots[i])
+		}
+	}
+	return d
+}
+
 // A Editor modifies a Contract by calling the revise RPC on a host. It
 // Editors are NOT thread-safe; calls to Upload must happen in serial.
 type Editor struct {
@@ -58,50 +175,70 @@ func (he *Editor) Close() error {
 }
 
 // Upload negotiates a revision that adds a sector to a file contract.
-func (he *Editor) Upload(data []byte) (_ modules.RenterContract, _ crypto.Hash, err error) {
+func (he *Editor) Upload(data []byte) (modules.RenterContract, crypto.Hash, error) {
+	contract, roots, err := he.UploadBatch([][]byte{data})
+	if err != nil {
+		return modules.RenterContract{}, crypto.Hash{}, err
+	}
+	return contract, roots[0], nil
+}
+
+// UploadBatch negotiates revisions that add the sectors to a file contract.
+// Each revision appends as many sectors as the host's MaxReviseBatchSize
+// allows. If an error occurs, the roots of the sectors that were uploaded
+// before the error are returned along with the error.
+func (he *Editor) UploadBatch(sectors [][]byte) (modules.RenterContract, []crypto.Hash, error) {
+	var contract modules.RenterContract
+	var roots []crypto.Hash
+	for len(sectors) > 0 {
+		n := uploadBatchLen(sectors, he.host.MaxReviseBatchSize)
+		batchContract, batchRoots, err := he.uploadBatch(sectors[:n])
+		if err != nil {
+			return modules.RenterContract{}, roots, err
+		}
+		contract = batchContract
+		roots = append(roots, batchRoots...)
+		sectors = sectors[n:]
+	}
+	return contract, roots, nil
+}
+
+// uploadBatch negotiates a single revision that adds the sectors to a file
+// contract.
+func (he *Editor) uploadBatch(sectors [][]byte) (_ modules.RenterContract, _ []crypto.Hash, err error) {
 	// Acquire the contract.
 	sc, haveContract := he.contractSet.Acquire(he.contractID)
 	if !haveContract {
-		return modules.RenterContract{}, crypto.Hash{}, errors.New("contract not present in contract set")
+		return modules.RenterContract{}, nil, errors.New("contract not present in contract set")
 	}
 	defer he.contractSet.Return(sc)
 	contract := sc.header // for convenience
 
 	// calculate price
 	// TODO: height is never updated, so we'll wind up overpaying on long-running uploads
-	blockBytes := types.NewCurrency64(modules.SectorSize * uint64(contract.LastRevision().NewWindowEnd-he.height))
-	sectorStoragePrice := he.host.StoragePrice.Mul(blockBytes)
-	sectorBandwidthPrice := he.host.UploadBandwidthPrice.Mul64(modules.SectorSize)
-	sectorCollateral := he.host.Collateral.Mul(blockBytes)
-
-	// to mitigate small errors (e.g. differing block heights), fudge the
-	// price and collateral by 0.2%. This is only applied to hosts above
-	// v1.0.1; older hosts use stricter math.
-	if build.VersionCmp(he.host.Version, "1.0.1") > 0 {
-		sectorStoragePrice = sectorStoragePrice.MulFloat(1 + hostPriceLeeway)
-		sectorBandwidthPrice = sectorBandwidthPrice.MulFloat(1 + hostPriceLeeway)
-		sectorCollateral = sectorCollateral.MulFloat(1 - hostPriceLeeway)
+	sectorStoragePrice, sectorBandwidthPrice, sectorCollateral, err := uploadPrices(he.host, contract, he.height, uint64(len(sectors)))
+	if err != nil {
+		return modules.RenterContract{}, nil, err
 	}
-
 	sectorPrice := sectorStoragePrice.Add(sectorBandwidthPrice)
-	if contract.RenterFunds().Cmp(sectorPrice) < 0 {
-		return modules.RenterContract{}, crypto.Hash{}, errors.New("contract has insufficient funds to support upload")
-	}
-	if contract.LastRevision().NewMissedProofOutputs[1].Value.Cmp(sectorCollateral) < 0 {
-		return modules.RenterContract{}, crypto.Hash{}, errors.New("contract has insufficient collateral to support upload")
-	}
 
 	// calculate the new Merkle root
-	sectorRoot := crypto.MerkleRoot(data)
-	merkleRoot := sc.merkleRoots.checkNewRoot(sectorRoot)
+	sectorRoots := make([]crypto.Hash, len(sectors))
+	for i, data := range sectors {
+		sectorRoots[i] = crypto.MerkleRoot(data)
+	}
+	merkleRoot := sc.merkleRoots.checkNewRoots(sectorRoots)
 
-	// create the action and revision
-	actions := []modules.RevisionAction{{
-		Type:        modules.ActionInsert,
-		SectorIndex: uint64(sc.merkleRoots.len()),
-		Data:        data,
-	}}
-	rev := newUploadRevision(contract.LastRevision(), merkleRoot, sectorPrice, sectorCollateral)
+	// create the actions and revision
+	actions := make([]modules.RevisionAction, len(sectors))
+	for i, data := range sectors {
+		actions[i] = modules.RevisionAction{
+			Type:        modules.ActionInsert,
+			SectorIndex: uint64(sc.merkleRoots.len() + i),
+			Data:        data,
+		}
+	}
+	rev := newUploadRevision(contract.LastRevision(), merkleRoot, uint64(len(sectors)), sectorPrice, sectorCollateral)
 
 	// run the revision iteration
 	defer func() {
@@ -120,26 +257,26 @@ func (he *Editor) Upload(data []byte) (_ modules.RenterContract, _ crypto.Hash,
 	// initiate revision
 	extendDeadline(he.conn, modules.NegotiateSettingsTime)
 	if err := startRevision(he.conn, he.host); err != nil {
-		return modules.RenterContract{}, crypto.Hash{}, err
+		return modules.RenterContract{}, nil, err
 	}
 
 	// record the change we are about to make to the contract. If we lose power
 	// mid-revision, this allows us to restore either the pre-revision or
 	// post-revision contract.
-	walTxn, err := sc.recordUploadIntent(rev, sectorRoot, sectorStoragePrice, sectorBandwidthPrice)
+	walTxn, err := sc.recordUploadIntent(rev, sectorRoots, sectorStoragePrice, sectorBandwidthPrice)
 	if err != nil {
-		return modules.RenterContract{}, crypto.Hash{}, err
+		return modules.RenterContract{}, nil, err
 	}
 
 	// send actions
-	extendDeadline(he.conn, modules.NegotiateFileContractRevisionTime)
+	extendDeadline(he.conn, time.Duration(len(sectors))*modules.NegotiateFileContractRevisionTime)
 	if err := encoding.WriteObject(he.conn, actions); err != nil {
-		return modules.RenterContract{}, crypto.Hash{}, err
+		return modules.RenterContract{}, nil, err
 	}
 
 	// Disrupt here before sending the signed revision to the host.
 	if he.deps.Disrupt("InterruptUploadBeforeSendingRevision") {
-		return modules.RenterContract{}, crypto.Hash{},
+		return modules.RenterContract{}, nil,
 			errors.New("InterruptUploadBeforeSendingRevision disrupt")
 	}
 
@@ -151,22 +288,96 @@ func (he *Editor) Upload(data []byte) (_ modules.RenterContract, _ crypto.Hash,
 		// cause the next operation to fail
 		he.conn.Close()
 	} else if err != nil {
-		return modules.RenterContract{}, crypto.Hash{}, err
+		return modules.RenterContract{}, nil, err
 	}
 
 	// Disrupt here before updating the contract.
 	if he.deps.Disrupt("InterruptUploadAfterSendingRevision") {
-		return modules.RenterContract{}, crypto.Hash{},
+		return modules.RenterContract{}, nil,
 			errors.New("InterruptUploadAfterSendingRevision disrupt")
 	}
 
 	// update contract
-	err = sc.commitUpload(walTxn, signedTxn, sectorRoot, sectorStoragePrice, sectorBandwidthPrice)
+	err = sc.commitUpload(walTxn, signedTxn, sectorRoots, sectorStoragePrice, sectorBandwidthPrice)
 	if err != nil {
-		return modules.RenterContract{}, crypto.Hash{}, err
+		return modules.RenterContract{}, nil, err
 	}
 
-	return sc.Metadata(), sectorRoot, nil
+	return sc.Metadata(), sectorRoots, nil
+}
+
+// DeleteSectors negotiates a revision that removes the sectors with the
+// specified Merkle roots from a file contract. The revision is described by
+// newSectorDeletion.
+func (he *Editor) DeleteSectors(roots []crypto.Hash) (_ modules.RenterContract, err error) {
+	// Acquire the contract.
+	sc, haveContract := he.contractSet.Acquire(he.contractID)
+	if !haveContract {
+		return modules.RenterContract{}, errors.New("contract not present in contract set")
+	}
+	defer he.contractSet.Return(sc)
+	contract := sc.header // for convenience
+
+	// create the actions and revision
+	contractRoots, err := sc.merkleRoots.merkleRoots()
+	if err != nil {
+		return modules.RenterContract{}, errors.AddContext(err, "couldn't read contract roots")
+	}
+	d := newSectorDeletion(contractRoots, roots)
+	if d.numDeleted == 0 {
+		return sc.Metadata(), nil
+	}
+	rev := newDeleteRevision(contract.LastRevision(), cachedMerkleRoot(d.remainingRoots), uint64(d.numDeleted))
+
+	// run the revision iteration
+	defer func() {
+		// Increase Successful/Failed interactions accordingly
+		if err != nil {
+			he.hdb.IncrementFailedInteractions(he.host.PublicKey)
+			err = errors.Extend(err, modules.ErrHostFault)
+		} else {
+			he.hdb.IncrementSuccessfulInteractions(he.host.PublicKey)
+		}
+
+		// reset deadline
+		extendDeadline(he.conn, time.Hour)
+	}()
+
+	// initiate revision
+	extendDeadline(he.conn, modules.NegotiateSettingsTime)
+	if err := startRevision(he.conn, he.host); err != nil {
+		return modules.RenterContract{}, err
+	}
+
+	// record the change we are about to make to the contract
+	walTxn, err := sc.recordDeleteIntent(rev, d.swapIndices, d.swapRoots, len(d.remainingRoots))
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+
+	// send actions
+	extendDeadline(he.conn, modules.NegotiateFileContractRevisionTime)
+	if err := encoding.WriteObject(he.conn, d.actions); err != nil {
+		return modules.RenterContract{}, err
+	}
+
+	// send revision to host and exchange signatures
+	extendDeadline(he.conn, connTimeout)
+	signedTxn, err := negotiateRevision(he.conn, rev, contract.SecretKey)
+	if err == modules.ErrStopResponse {
+		// if host gracefully closed, close our connection as well; this will
+		// cause the next operation to fail
+		he.conn.Close()
+	} else if err != nil {
+		return modules.RenterContract{}, err
+	}
+
+	// update contract
+	err = sc.commitDelete(walTxn, signedTxn, d.swapIndices, d.swapRoots, len(d.remainingRoots))
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+	return sc.Metadata(), nil
 }
 
 // NewEditor initiates the contract revision process with a host, and returns
@@ -248,15 +459,16 @@ func initiateRevisionLoop(host modules.HostDBEntry, contract contractHeader, rpc
 	// allot 2 minutes for RPC request + revision exchange
 	extendDeadline(conn, modules.NegotiateRecentRevisionTime)
 	defer extendDeadline(conn, time.Hour)
-	if err := encoding.WriteObject(conn, rpc); err != nil {
+	rpcConn, err := startRPC(conn, host, rpc)
+	if err != nil {
 		conn.Close()
 		close(closeChan)
-		return nil, closeChan, errors.New("couldn't initiate RPC: " + err.Error())
+		return nil, closeChan, err
 	}
-	if err := verifyRecentRevision(conn, contract, host.Version); err != nil {
+	if err := verifyRecentRevision(rpcConn, contract, host.Version); err != nil {
 		conn.Close() // TODO: close gracefully if host has entered revision loop
 		close(closeChan)
 		return nil, closeChan, err
 	}
-	return conn, closeChan, nil
+	return rpcConn, closeChan, nil
 }
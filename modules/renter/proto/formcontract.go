@@ -18,16 +18,11 @@ func (cs *ContractSet) FormContract(params ContractParams, txnBuilder transactio
 	// Extract vars from params, for convenience.
 	host, funding, startHeight, endHeight, refundAddress := params.Host, params.Funding, params.StartHeight, params.EndHeight, params.RefundAddress
 
-	// Create our key.
-	ourSK, ourPK := crypto.GenerateKeyPair()
+	// Derive our key from the renter seed, so that the contract can be
+	// recovered if the contract set is lost.
+	ourSK, _ := params.RenterSeed.contractKeys(host.PublicKey)
 	// Create unlock conditions.
-	uc := types.UnlockConditions{
-		PublicKeys: []types.SiaPublicKey{
-			types.Ed25519PublicKey(ourPK),
-			host.PublicKey,
-		},
-		SignaturesRequired: 2,
-	}
+	uc := params.RenterSeed.contractUnlockConditions(host.PublicKey)
 
 	// Calculate the anticipated transaction fee.
 	_, maxFee := tpool.FeeEstimation()
@@ -88,6 +83,14 @@ func (cs *ContractSet) FormContract(params ContractParams, txnBuilder transactio
 		return modules.RenterContract{}, err
 	}
 	txnBuilder.AddFileContract(fc)
+	// Add the identifier that allows the contract to be recovered from the
+	// renter seed.
+	fundedTxn, _ := txnBuilder.View()
+	identifier, err := params.RenterSeed.contractIdentifier(host.PublicKey, fundedTxn)
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+	txnBuilder.AddArbitraryData(identifier)
 	// Add miner fee.
 	txnBuilder.AddMinerFee(txnFee)
 
@@ -122,7 +125,7 @@ func (cs *ContractSet) FormContract(params ContractParams, txnBuilder transactio
 
 	// Allot time for sending RPC ID + verifySettings.
 	extendDeadline(conn, modules.NegotiateSettingsTime)
-	if err = encoding.WriteObject(conn, modules.RPCFormContract); err != nil {
+	if conn, err = startRPC(conn, host, modules.RPCFormContract); err != nil {
 		return modules.RenterContract{}, err
 	}
 
@@ -134,6 +137,11 @@ func (cs *ContractSet) FormContract(params ContractParams, txnBuilder transactio
 	if !host.AcceptingContracts {
 		return modules.RenterContract{}, errors.New("host is not accepting contracts")
 	}
+	// Refuse to form the contract if the host raised its prices above the
+	// maximum prices of the allowance.
+	if err = params.Allowance.CheckPriceGouging(host.HostExternalSettings); err != nil {
+		return modules.RenterContract{}, modules.WriteNegotiationRejection(conn, err)
+	}
 
 	// Allot time for negotiation.
 	extendDeadline(conn, modules.NegotiateFileContractTime)
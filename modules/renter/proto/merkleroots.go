@@ -187,6 +187,31 @@ func (mr *merkleRoots) delete(i int, lastRoot crypto.Hash, truncateSize int64) e
 	return nil
 }
 
+// truncate removes the roots at the end of the contract, so that only the
+// first n roots remain. Truncating to n or more roots is a no-op, which makes
+// the operation idempotent.
+func (mr *merkleRoots) truncate(n int) error {
+	if n >= mr.numMerkleRoots {
+		return nil
+	}
+	// Truncate the file.
+	if err := mr.rootsFile.Truncate(fileOffsetFromRootIndex(n)); err != nil {
+		return errors.AddContext(err, "failed to truncate file")
+	}
+	mr.numMerkleRoots = n
+	// Drop the cached subTrees that are no longer complete, and load the
+	// remaining roots after the last cached subTree into mr.uncachedRoots.
+	if numCached := n / merkleRootsPerCache; numCached < len(mr.cachedSubTrees) {
+		mr.cachedSubTrees = mr.cachedSubTrees[:numCached]
+	}
+	roots, err := mr.merkleRootsFromIndexFromDisk(len(mr.cachedSubTrees)*merkleRootsPerCache, n)
+	if err != nil {
+		return errors.AddContext(err, "failed to read uncached roots")
+	}
+	mr.uncachedRoots = roots
+	return nil
+}
+
 // insert inserts a root by replacing a root at an existing index.
 func (mr *merkleRoots) insert(index int, root crypto.Hash) error {
 	// If the index does point to an offset beyond the end of the file we fill
@@ -303,9 +328,9 @@ func (mr *merkleRoots) root() crypto.Hash {
 	return tree.Root()
 }
 
-// checkNewRoot returns the root of the merkleTree after appending the checkNewRoot
-// without actually appending it.
-func (mr *merkleRoots) checkNewRoot(newRoot crypto.Hash) crypto.Hash {
+// checkNewRoots returns the root of the merkleTree after appending the
+// newRoots without actually appending them.
+func (mr *merkleRoots) checkNewRoots(newRoots []crypto.Hash) crypto.Hash {
 	tree := crypto.NewCachedTree(sectorHeight)
 	for _, st := range mr.cachedSubTrees {
 		if err := tree.PushSubTree(st.height, st.sum); err != nil {
@@ -316,8 +341,10 @@ func (mr *merkleRoots) checkNewRoot(newRoot crypto.Hash) crypto.Hash {
 	for _, root := range mr.uncachedRoots {
 		tree.Push(root)
 	}
-	// Push the new root.
-	tree.Push(newRoot)
+	// Push the new roots.
+	for _, root := range newRoots {
+		tree.Push(root)
+	}
 	return tree.Root()
 }
 
@@ -287,6 +287,68 @@ func TestDeleteLastRoot(t *testing.T) {
 	}
 }
 
+// TestTruncate tests the truncate method by truncating the roots to sizes
+// that require dropping uncached roots and cached subTrees.
+func TestTruncate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	dir := build.TempDir(t.Name())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	filePath := path.Join(dir, "file.dat")
+	file, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create enough roots for multiple cached subTrees.
+	numMerkleRoots := 3*merkleRootsPerCache + 5
+	rootSection := newFileSection(file, 0, -1)
+	merkleRoots := newMerkleRoots(rootSection)
+	roots := make([]crypto.Hash, numMerkleRoots)
+	for i := range roots {
+		copy(roots[i][:], fastrand.Bytes(crypto.HashSize))
+		if err := merkleRoots.push(roots[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, n := range []int{numMerkleRoots + 1, numMerkleRoots - 2, 2*merkleRootsPerCache + 3, 2 * merkleRootsPerCache, merkleRootsPerCache - 1, 0} {
+		if err := merkleRoots.truncate(n); err != nil {
+			t.Fatal(err)
+		}
+		expected := roots
+		if n < len(expected) {
+			expected = roots[:n]
+		}
+		// The number of roots and the roots on disk should match.
+		if merkleRoots.len() != len(expected) {
+			t.Fatalf("expected %v roots but got %v", len(expected), merkleRoots.len())
+		}
+		diskRoots, err := merkleRoots.merkleRoots()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(diskRoots, expected) {
+			t.Fatal("roots on disk don't match the expected roots")
+		}
+		// The root of the tree should match the truncated roots.
+		if merkleRoots.checkNewRoots(nil) != cachedMerkleRoot(expected) {
+			t.Fatal("root doesn't match the truncated roots")
+		}
+		// The in-memory structure should match the one loaded from disk.
+		loadedRoots, err := loadExistingMerkleRoots(merkleRoots.rootsFile)
+		if err != nil {
+			t.Fatal("failed to load existing roots", err)
+		}
+		if err := cmpRoots(merkleRoots, loadedRoots); err != nil {
+			t.Fatal("loaded roots are inconsistent", err)
+		}
+	}
+}
+
 // TestDelete tests the deleteRoot method by creating many roots
 // and deleting random indices until there are no more roots left.
 func TestDelete(t *testing.T) {
@@ -15,6 +15,24 @@ import (
 // extendDeadline is a helper function for extending the connection timeout.
 func extendDeadline(conn net.Conn, d time.Duration) { _ = conn.SetDeadline(time.Now().Add(d)) }
 
+// startRPC calls rpc on the host. If the host supports the encrypted
+// transport, the connection is encrypted before rpc is sent, and the returned
+// connection must be used for the rest of the RPC. Older hosts are contacted
+// without encryption.
+func startRPC(conn net.Conn, host modules.HostDBEntry, rpc types.Specifier) (net.Conn, error) {
+	if build.VersionCmp(host.Version, modules.EncryptedTransportVersion) >= 0 {
+		sessionCipher, _, err := keyExchange(conn, host, modules.RPCEncrypt)
+		if err != nil {
+			return nil, err
+		}
+		conn = modules.NewEncryptedConn(conn, sessionCipher)
+	}
+	if err := encoding.WriteObject(conn, rpc); err != nil {
+		return nil, errors.New("couldn't initiate RPC: " + err.Error())
+	}
+	return conn, nil
+}
+
 // startRevision is run at the beginning of each revision iteration. It reads
 // the host's settings confirms that the values are acceptable, and writes an acceptance.
 func startRevision(conn net.Conn, host modules.HostDBEntry) error {
@@ -99,6 +117,12 @@ func verifyRecentRevision(conn net.Conn, contract contractHeader, hostVersion st
 	if err := encoding.ReadObject(conn, &hostSignatures, 2048); err != nil {
 		return errors.New("couldn't read host signatures: " + err.Error())
 	}
+	return checkRecentRevision(contract, lastRevision, hostSignatures)
+}
+
+// checkRecentRevision checks that the most recent revision sent by the host
+// matches the revision of the contract, and that it was signed correctly.
+func checkRecentRevision(contract contractHeader, lastRevision types.FileContractRevision, hostSignatures []types.TransactionSignature) error {
 	// Check that the unlock hashes match; if they do not, something is
 	// seriously wrong. Otherwise, check that the revision numbers match.
 	ourRev := contract.LastRevision()
@@ -116,18 +140,7 @@ func verifyRecentRevision(conn net.Conn, contract contractHeader, hostVersion st
 // negotiateRevision sends a revision and actions to the host for approval,
 // completing one iteration of the revision loop.
 func negotiateRevision(conn net.Conn, rev types.FileContractRevision, secretKey crypto.SecretKey) (types.Transaction, error) {
-	// create transaction containing the revision
-	signedTxn := types.Transaction{
-		FileContractRevisions: []types.FileContractRevision{rev},
-		TransactionSignatures: []types.TransactionSignature{{
-			ParentID:       crypto.Hash(rev.ParentID),
-			CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
-			PublicKeyIndex: 0, // renter key is always first -- see formContract
-		}},
-	}
-	// sign the transaction
-	encodedSig := crypto.SignHash(signedTxn.SigHash(0), secretKey)
-	signedTxn.TransactionSignatures[0].Signature = encodedSig[:]
+	signedTxn := signRevision(rev, secretKey)
 
 	// send the revision
 	if err := encoding.WriteObject(conn, rev); err != nil {
@@ -168,6 +181,24 @@ func negotiateRevision(conn net.Conn, rev types.FileContractRevision, secretKey
 	return signedTxn, responseErr
 }
 
+// signRevision creates a transaction containing the revision, signed by the
+// renter.
+func signRevision(rev types.FileContractRevision, secretKey crypto.SecretKey) types.Transaction {
+	// create transaction containing the revision
+	signedTxn := types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{rev},
+		TransactionSignatures: []types.TransactionSignature{{
+			ParentID:       crypto.Hash(rev.ParentID),
+			CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+			PublicKeyIndex: 0, // renter key is always first -- see formContract
+		}},
+	}
+	// sign the transaction
+	encodedSig := crypto.SignHash(signedTxn.SigHash(0), secretKey)
+	signedTxn.TransactionSignatures[0].Signature = encodedSig[:]
+	return signedTxn
+}
+
 // newRevision creates a copy of current with its revision number incremented,
 // and with cost transferred from the renter to the host.
 func newRevision(current types.FileContractRevision, cost types.Currency) types.FileContractRevision {
@@ -200,8 +231,8 @@ func newDownloadRevision(current types.FileContractRevision, downloadCost types.
 }
 
 // newUploadRevision revises the current revision to cover the cost of
-// uploading a sector.
-func newUploadRevision(current types.FileContractRevision, merkleRoot crypto.Hash, price, collateral types.Currency) types.FileContractRevision {
+// uploading numSectors sectors.
+func newUploadRevision(current types.FileContractRevision, merkleRoot crypto.Hash, numSectors uint64, price, collateral types.Currency) types.FileContractRevision {
 	rev := newRevision(current, price)
 
 	// move collateral from host to void
@@ -209,16 +240,16 @@ func newUploadRevision(current types.FileContractRevision, merkleRoot crypto.Has
 	rev.NewMissedProofOutputs[2].Value = rev.NewMissedProofOutputs[2].Value.Add(collateral)
 
 	// set new filesize and Merkle root
-	rev.NewFileSize += modules.SectorSize
+	rev.NewFileSize += numSectors * modules.SectorSize
 	rev.NewFileMerkleRoot = merkleRoot
 	return rev
 }
 
 // newDeleteRevision revises the current revision to cover the cost of
-// deleting a sector.
-func newDeleteRevision(current types.FileContractRevision, merkleRoot crypto.Hash) types.FileContractRevision {
+// deleting numSectors sectors.
+func newDeleteRevision(current types.FileContractRevision, merkleRoot crypto.Hash, numSectors uint64) types.FileContractRevision {
 	rev := newRevision(current, types.ZeroCurrency)
-	rev.NewFileSize -= modules.SectorSize
+	rev.NewFileSize -= numSectors * modules.SectorSize
 	rev.NewFileMerkleRoot = merkleRoot
 	return rev
 }
@@ -11,6 +11,7 @@ import (
 // Dependencies.
 type (
 	transactionBuilder interface {
+		AddArbitraryData(arb []byte) uint64
 		AddFileContract(types.FileContract) uint64
 		AddMinerFee(types.Currency) uint64
 		AddParents([]types.Transaction)
@@ -42,7 +43,8 @@ type ContractParams struct {
 	StartHeight   types.BlockHeight
 	EndHeight     types.BlockHeight
 	RefundAddress types.UnlockHash
-	// TODO: add optional keypair
+	RenterSeed    RenterSeed
+	Allowance     modules.Allowance
 }
 
 // A revisionSaver is called just before we send our revision signature to the host; this
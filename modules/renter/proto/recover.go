@@ -0,0 +1,267 @@
+package proto
+
+// recover.go allows a renter to recover its contracts using only the seed of
+// its wallet. The secret key of a contract is derived from the renter seed and
+// the public key of the host, and every contract transaction contains an
+// identifier which holds the encrypted public key of the host. This allows the
+// renter to find its contracts on the blockchain, and to ask the hosts for the
+// most recent revisions and the sector roots of the contracts.
+
+import (
+	"bytes"
+	"net"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+var (
+	// errNoContractIdentifier is returned if the identifier of a contract
+	// can't be added to its transaction because the transaction has no
+	// inputs.
+	errNoContractIdentifier = errors.New("can't add a contract identifier to a transaction without inputs")
+
+	// specifierRenterSeed is used to derive the renter seed from the wallet
+	// seed.
+	specifierRenterSeed = types.Specifier{'r', 'e', 'n', 't', 'e', 'r'}
+
+	// specifierContractKey, specifierIdentifierTag and specifierIdentifierKey
+	// are used to derive the keys and identifiers of contracts from the
+	// renter seed.
+	specifierContractKey   = types.Specifier{'c', 'o', 'n', 't', 'r', 'a', 'c', 't', 'k', 'e', 'y'}
+	specifierIdentifierKey = types.Specifier{'i', 'd', 'e', 'n', 't', 'i', 'f', 'i', 'e', 'r', 'k', 'e', 'y'}
+	specifierIdentifierTag = types.Specifier{'i', 'd', 'e', 'n', 't', 'i', 'f', 'i', 'e', 'r', 't', 'a', 'g'}
+)
+
+const (
+	// identifierTagSize is the size of the tag that allows the renter to
+	// recognize its own contract identifiers.
+	identifierTagSize = 16
+
+	// identifierSize is the size of a contract identifier, including the
+	// prefix, the tag, and the encrypted public key of the host.
+	identifierSize = types.SpecifierLen + identifierTagSize + crypto.PublicKeySize
+)
+
+type (
+	// A RenterSeed is derived from the primary seed of the wallet and is used
+	// to derive the secret keys and identifiers of the renter's contracts.
+	RenterSeed crypto.Hash
+
+	// A RecoverableContract is a contract that was found on the blockchain and
+	// that belongs to the renter seed. It contains everything that is
+	// necessary to request the contract from its host.
+	RecoverableContract struct {
+		types.FileContract
+		ID            types.FileContractID `json:"id"`
+		HostPublicKey types.SiaPublicKey   `json:"hostpublickey"`
+		StartHeight   types.BlockHeight    `json:"startheight"`
+		TxnFee        types.Currency       `json:"txnfee"`
+	}
+)
+
+// DeriveRenterSeed derives the renter seed from the primary seed of the
+// wallet.
+func DeriveRenterSeed(walletSeed modules.Seed) RenterSeed {
+	return RenterSeed(crypto.HashAll(walletSeed, specifierRenterSeed))
+}
+
+// contractKeys derives the key pair that the renter uses for contracts with
+// the specified host. Renewed contracts keep the key pair of the contract they
+// were renewed from.
+func (rs RenterSeed) contractKeys(hostKey types.SiaPublicKey) (crypto.SecretKey, crypto.PublicKey) {
+	return crypto.GenerateKeyPairDeterministic(crypto.HashAll(rs, specifierContractKey, hostKey))
+}
+
+// contractUnlockConditions returns the unlock conditions of the contracts with
+// the specified host.
+func (rs RenterSeed) contractUnlockConditions(hostKey types.SiaPublicKey) types.UnlockConditions {
+	_, pk := rs.contractKeys(hostKey)
+	return types.UnlockConditions{
+		PublicKeys: []types.SiaPublicKey{
+			types.Ed25519PublicKey(pk),
+			hostKey,
+		},
+		SignaturesRequired: 2,
+	}
+}
+
+// identifierKeys returns the tag and the key used to encrypt the public key of
+// the host for the identifier of a transaction that spends the specified
+// output. Using the first input of the transaction makes the identifiers of
+// different transactions unlinkable.
+func (rs RenterSeed) identifierKeys(parentID types.SiacoinOutputID) (tag []byte, key crypto.Hash) {
+	t := crypto.HashAll(rs, specifierIdentifierTag, parentID)
+	return t[:identifierTagSize], crypto.HashAll(rs, specifierIdentifierKey, parentID)
+}
+
+// contractIdentifier creates the identifier of a contract with the specified
+// host, which is added to the arbitrary data of the contract transaction.
+func (rs RenterSeed) contractIdentifier(hostKey types.SiaPublicKey, txn types.Transaction) ([]byte, error) {
+	if len(txn.SiacoinInputs) == 0 {
+		return nil, errNoContractIdentifier
+	}
+	tag, key := rs.identifierKeys(txn.SiacoinInputs[0].ParentID)
+	identifier := make([]byte, 0, identifierSize)
+	identifier = append(identifier, modules.PrefixFileContractIdentifier[:]...)
+	identifier = append(identifier, tag...)
+	for i := 0; i < crypto.PublicKeySize; i++ {
+		var b byte
+		if i < len(hostKey.Key) {
+			b = hostKey.Key[i]
+		}
+		identifier = append(identifier, b^key[i])
+	}
+	return identifier, nil
+}
+
+// FindRecoverableContracts returns the contracts of a transaction that belong
+// to the renter seed. Contracts that were formed before the renter seed was
+// used to derive contract keys can't be recovered.
+func FindRecoverableContracts(rs RenterSeed, txn types.Transaction, height types.BlockHeight) []RecoverableContract {
+	if len(txn.SiacoinInputs) == 0 || len(txn.FileContracts) == 0 {
+		return nil
+	}
+	tag, key := rs.identifierKeys(txn.SiacoinInputs[0].ParentID)
+	var rcs []RecoverableContract
+	for _, arb := range txn.ArbitraryData {
+		if len(arb) != identifierSize || !bytes.HasPrefix(arb, modules.PrefixFileContractIdentifier[:]) {
+			continue
+		}
+		encryptedKey := arb[types.SpecifierLen+identifierTagSize:]
+		if !bytes.Equal(arb[types.SpecifierLen:types.SpecifierLen+identifierTagSize], tag) {
+			continue
+		}
+		hostKey := types.SiaPublicKey{
+			Algorithm: types.SignatureEd25519,
+			Key:       make([]byte, crypto.PublicKeySize),
+		}
+		for i := range hostKey.Key {
+			hostKey.Key[i] = encryptedKey[i] ^ key[i]
+		}
+
+		// Only return contracts whose unlock hash matches the derived keys.
+		unlockHash := rs.contractUnlockConditions(hostKey).UnlockHash()
+		var txnFee types.Currency
+		for _, fee := range txn.MinerFees {
+			txnFee = txnFee.Add(fee)
+		}
+		for i, fc := range txn.FileContracts {
+			if fc.UnlockHash != unlockHash {
+				continue
+			}
+			rcs = append(rcs, RecoverableContract{
+				FileContract:  fc,
+				ID:            txn.FileContractID(uint64(i)),
+				HostPublicKey: hostKey,
+				StartHeight:   height,
+				TxnFee:        txnFee,
+			})
+		}
+	}
+	return rcs
+}
+
+// RecoverContract requests the most recent revision and the sector roots of a
+// recoverable contract from its host and adds the contract to the set. The
+// contract fee paid to the host can't be recovered and is therefore not
+// included in the total cost of the contract.
+func (cs *ContractSet) RecoverContract(rc RecoverableContract, rs RenterSeed, host modules.HostDBEntry, cancel <-chan struct{}) (_ modules.RenterContract, err error) {
+	if _, exists := cs.View(rc.ID); exists {
+		return modules.RenterContract{}, errors.New("contract already exists")
+	}
+	sk, _ := rs.contractKeys(rc.HostPublicKey)
+	uc := rs.contractUnlockConditions(rc.HostPublicKey)
+	if uc.UnlockHash() != rc.UnlockHash {
+		return modules.RenterContract{}, errors.New("contract doesn't belong to the renter seed")
+	}
+
+	// Initiate connection.
+	dialer := &net.Dialer{
+		Cancel:  cancel,
+		Timeout: connTimeout,
+	}
+	conn, err := dialer.Dial("tcp", string(host.NetAddress))
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Allot time for sending the RPC ID and the recent revision exchange.
+	extendDeadline(conn, modules.NegotiateRecentRevisionTime)
+	if conn, err = startRPC(conn, host, modules.RPCRecoverContract); err != nil {
+		return modules.RenterContract{}, err
+	}
+	if err = encoding.WriteObject(conn, rc.ID); err != nil {
+		return modules.RenterContract{}, errors.New("couldn't send contract ID: " + err.Error())
+	}
+	var challenge crypto.Hash
+	if err = encoding.ReadObject(conn, &challenge, 32); err != nil {
+		return modules.RenterContract{}, errors.New("couldn't read challenge: " + err.Error())
+	}
+	crypto.SecureWipe(challenge[:16])
+	if err = encoding.WriteObject(conn, crypto.SignHash(challenge, sk)); err != nil {
+		return modules.RenterContract{}, errors.New("couldn't send challenge response: " + err.Error())
+	}
+	if err = modules.ReadNegotiationAcceptance(conn); err != nil {
+		return modules.RenterContract{}, errors.New("host did not accept recover request: " + err.Error())
+	}
+	var lastRevision types.FileContractRevision
+	var signatures []types.TransactionSignature
+	if err = encoding.ReadObject(conn, &lastRevision, 2048); err != nil {
+		return modules.RenterContract{}, errors.New("couldn't read last revision: " + err.Error())
+	}
+	if err = encoding.ReadObject(conn, &signatures, 2048); err != nil {
+		return modules.RenterContract{}, errors.New("couldn't read revision signatures: " + err.Error())
+	}
+	if lastRevision.ParentID != rc.ID || lastRevision.UnlockConditions.UnlockHash() != rc.UnlockHash {
+		return modules.RenterContract{}, errors.New("host sent a revision of the wrong contract")
+	}
+	// NOTE: we can fake the blockheight here because it doesn't affect
+	// verification; it just needs to be above the fork height and below the
+	// contract expiration.
+	if err = modules.VerifyFileContractRevisionTransactionSignatures(lastRevision, signatures, lastRevision.NewWindowStart-1); err != nil {
+		return modules.RenterContract{}, err
+	}
+
+	// Read the sector roots and check that they match the revision.
+	extendDeadline(conn, modules.NegotiateRecoverContractTime)
+	var roots []crypto.Hash
+	numSectors := lastRevision.NewFileSize/modules.SectorSize + 1
+	if err = encoding.ReadObject(conn, &roots, numSectors*crypto.HashSize+8); err != nil {
+		return modules.RenterContract{}, errors.New("couldn't read sector roots: " + err.Error())
+	}
+	if len(roots) != 0 && cachedMerkleRoot(roots) != lastRevision.NewFileMerkleRoot {
+		return modules.RenterContract{}, errors.New("sector roots don't match the revision")
+	} else if len(roots) == 0 && lastRevision.NewFileMerkleRoot != (crypto.Hash{}) {
+		return modules.RenterContract{}, errors.New("host didn't send the sector roots")
+	}
+
+	// Construct the contract header. Spending can't be recovered, so all the
+	// money that was moved to the host is attributed to storage.
+	siafundFee := types.Tax(rc.StartHeight, rc.Payout)
+	initialFunds := rc.ValidProofOutputs[0].Value
+	header := contractHeader{
+		Transaction: types.Transaction{
+			FileContractRevisions: []types.FileContractRevision{lastRevision},
+			TransactionSignatures: signatures,
+		},
+		SecretKey:   sk,
+		StartHeight: rc.StartHeight,
+		TotalCost:   initialFunds.Add(rc.TxnFee).Add(siafundFee),
+		TxnFee:      rc.TxnFee,
+		SiafundFee:  siafundFee,
+		Utility: modules.ContractUtility{
+			GoodForUpload: true,
+			GoodForRenew:  true,
+		},
+	}
+	if remaining := lastRevision.NewValidProofOutputs[0].Value; initialFunds.Cmp(remaining) > 0 {
+		header.StorageSpending = initialFunds.Sub(remaining)
+	}
+	return cs.managedInsertContract(header, roots)
+}
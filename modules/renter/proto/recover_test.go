@@ -0,0 +1,73 @@
+package proto
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestFindRecoverableContracts tests that contracts formed with keys derived
+// from a renter seed can be found again using the same seed, and only using
+// that seed.
+func TestFindRecoverableContracts(t *testing.T) {
+	var walletSeed modules.Seed
+	fastrand.Read(walletSeed[:])
+	rs := DeriveRenterSeed(walletSeed)
+	_, hpk := crypto.GenerateKeyPair()
+	hostKey := types.Ed25519PublicKey(hpk)
+
+	// Create a contract transaction the same way FormContract does.
+	var parentID types.SiacoinOutputID
+	fastrand.Read(parentID[:])
+	txn := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{ParentID: parentID}},
+		FileContracts: []types.FileContract{{
+			WindowStart: 100,
+			UnlockHash:  rs.contractUnlockConditions(hostKey).UnlockHash(),
+		}},
+		MinerFees: []types.Currency{types.NewCurrency64(10)},
+	}
+	identifier, err := rs.contractIdentifier(hostKey, txn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.ArbitraryData = append(txn.ArbitraryData, identifier)
+
+	// The contract should be found with the correct host key.
+	rcs := FindRecoverableContracts(rs, txn, 5)
+	if len(rcs) != 1 {
+		t.Fatalf("expected 1 recoverable contract, got %v", len(rcs))
+	}
+	rc := rcs[0]
+	if rc.ID != txn.FileContractID(0) {
+		t.Error("wrong contract id")
+	}
+	if rc.HostPublicKey.String() != hostKey.String() {
+		t.Error("wrong host key", rc.HostPublicKey, hostKey)
+	}
+	if rc.StartHeight != 5 || !rc.TxnFee.Equals64(10) || rc.WindowStart != 100 {
+		t.Error("wrong contract metadata", rc)
+	}
+
+	// A different seed shouldn't find the contract.
+	var otherSeed modules.Seed
+	fastrand.Read(otherSeed[:])
+	if rcs := FindRecoverableContracts(DeriveRenterSeed(otherSeed), txn, 5); len(rcs) != 0 {
+		t.Fatal("contract was found using a different seed")
+	}
+
+	// A contract that wasn't formed with the derived keys shouldn't be found.
+	txn.FileContracts[0].UnlockHash = types.UnlockHash{}
+	if rcs := FindRecoverableContracts(rs, txn, 5); len(rcs) != 0 {
+		t.Fatal("contract with a different unlock hash was found")
+	}
+
+	// A transaction without inputs can't have an identifier.
+	if _, err := rs.contractIdentifier(hostKey, types.Transaction{}); err != errNoContractIdentifier {
+		t.Fatal("expected errNoContractIdentifier, got", err)
+	}
+}
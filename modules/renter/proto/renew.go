@@ -95,6 +95,14 @@ func (cs *ContractSet) Renew(oldContract *SafeContract, params ContractParams, t
 		return modules.RenterContract{}, err
 	}
 	txnBuilder.AddFileContract(fc)
+	// add the identifier that allows the contract to be recovered from the
+	// renter seed
+	fundedTxn, _ := txnBuilder.View()
+	identifier, err := params.RenterSeed.contractIdentifier(host.PublicKey, fundedTxn)
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+	txnBuilder.AddArbitraryData(identifier)
 	// add miner fee
 	txnBuilder.AddMinerFee(txnFee)
 
@@ -130,8 +138,8 @@ func (cs *ContractSet) Renew(oldContract *SafeContract, params ContractParams, t
 
 	// allot time for sending RPC ID, verifyRecentRevision, and verifySettings
 	extendDeadline(conn, modules.NegotiateRecentRevisionTime+modules.NegotiateSettingsTime)
-	if err = encoding.WriteObject(conn, modules.RPCRenewContract); err != nil {
-		return modules.RenterContract{}, errors.New("couldn't initiate RPC: " + err.Error())
+	if conn, err = startRPC(conn, host, modules.RPCRenewContract); err != nil {
+		return modules.RenterContract{}, err
 	}
 	// verify that both parties are renewing the same contract
 	if err = verifyRecentRevision(conn, contract, host.Version); err != nil {
@@ -147,6 +155,11 @@ func (cs *ContractSet) Renew(oldContract *SafeContract, params ContractParams, t
 	if !host.AcceptingContracts {
 		return modules.RenterContract{}, errors.New("host is not accepting contracts")
 	}
+	// refuse to renew the contract if the host raised its prices above the
+	// maximum prices of the allowance
+	if err = params.Allowance.CheckPriceGouging(host.HostExternalSettings); err != nil {
+		return modules.RenterContract{}, modules.WriteNegotiationRejection(conn, err)
+	}
 
 	// allot time for negotiation
 	extendDeadline(conn, modules.NegotiateRenewContractTime)
@@ -0,0 +1,509 @@
+package proto
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/ratelimit"
+)
+
+// A Session is an authenticated and encrypted connection with a host, which
+// can be used for any number of uploads and downloads using the same
+// contract. Unlike an Editor and a Downloader, a single Session can be used to
+// both upload and download data. Sessions are NOT thread-safe; calls to its
+// methods must be serialized.
+type Session struct {
+	cipher      *modules.SessionCipher
+	closeChan   chan struct{}
+	conn        net.Conn
+	contractID  types.FileContractID
+	contractSet *ContractSet
+	hdb         hostDB
+	host        modules.HostDBEntry
+	once        sync.Once
+
+	height      types.BlockHeight
+	lastRequest time.Time
+	started     time.Time
+}
+
+// request sends a request to the host and reads the response into resp.
+func (s *Session) request(id types.Specifier, req interface{}, resp interface{}, maxLen uint64) error {
+	s.lastRequest = time.Now()
+	if err := modules.WriteSessionRequest(s.conn, s.cipher, id, req); err != nil {
+		return errors.AddContext(err, "couldn't send request")
+	}
+	return modules.ReadSessionResponse(s.conn, s.cipher, resp, maxLen)
+}
+
+// Settings requests the settings of the host. The settings are used to price
+// the following uploads and downloads of the session.
+func (s *Session) Settings() (modules.HostExternalSettings, error) {
+	extendDeadline(s.conn, modules.NegotiateSettingsTime)
+	defer extendDeadline(s.conn, time.Hour) // TODO: Constant.
+
+	var settings modules.HostExternalSettings
+	if err := s.request(modules.RPCSessionSettings, nil, &settings, modules.NegotiateMaxHostExternalSettingsLen); err != nil {
+		return modules.HostExternalSettings{}, errors.AddContext(err, "couldn't read host's settings")
+	}
+	// the NetAddress is known to work, because it was used to dial the host
+	settings.NetAddress = s.host.NetAddress
+	s.host.HostExternalSettings = settings
+	return settings, nil
+}
+
+// Upload negotiates a revision that adds a sector to the contract of the
+// session.
+func (s *Session) Upload(data []byte) (modules.RenterContract, crypto.Hash, error) {
+	contract, roots, err := s.UploadBatch([][]byte{data})
+	if err != nil {
+		return modules.RenterContract{}, crypto.Hash{}, err
+	}
+	return contract, roots[0], nil
+}
+
+// UploadBatch negotiates revisions that add the sectors to the contract of the
+// session. Each revision appends as many sectors as the host's
+// MaxReviseBatchSize allows. If an error occurs, the roots of the sectors that
+// were uploaded before the error are returned along with the error.
+func (s *Session) UploadBatch(sectors [][]byte) (modules.RenterContract, []crypto.Hash, error) {
+	var contract modules.RenterContract
+	var roots []crypto.Hash
+	for len(sectors) > 0 {
+		n := uploadBatchLen(sectors, s.host.MaxReviseBatchSize)
+		batchContract, batchRoots, err := s.uploadBatch(sectors[:n])
+		if err != nil {
+			return modules.RenterContract{}, roots, err
+		}
+		contract = batchContract
+		roots = append(roots, batchRoots...)
+		sectors = sectors[n:]
+	}
+	return contract, roots, nil
+}
+
+// uploadBatch negotiates a single revision that adds the sectors to the
+// contract of the session.
+func (s *Session) uploadBatch(sectors [][]byte) (_ modules.RenterContract, _ []crypto.Hash, err error) {
+	// Acquire the contract.
+	sc, haveContract := s.contractSet.Acquire(s.contractID)
+	if !haveContract {
+		return modules.RenterContract{}, nil, errors.New("contract not present in contract set")
+	}
+	defer s.contractSet.Return(sc)
+	contract := sc.header // for convenience
+
+	// calculate price
+	sectorStoragePrice, sectorBandwidthPrice, sectorCollateral, err := uploadPrices(s.host, contract, s.height, uint64(len(sectors)))
+	if err != nil {
+		return modules.RenterContract{}, nil, err
+	}
+	sectorPrice := sectorStoragePrice.Add(sectorBandwidthPrice)
+
+	// calculate the new Merkle root
+	sectorRoots := make([]crypto.Hash, len(sectors))
+	for i, data := range sectors {
+		sectorRoots[i] = crypto.MerkleRoot(data)
+	}
+	merkleRoot := sc.merkleRoots.checkNewRoots(sectorRoots)
+
+	// create the actions and revision
+	actions := make([]modules.RevisionAction, len(sectors))
+	for i, data := range sectors {
+		actions[i] = modules.RevisionAction{
+			Type:        modules.ActionInsert,
+			SectorIndex: uint64(sc.merkleRoots.len() + i),
+			Data:        data,
+		}
+	}
+	rev := newUploadRevision(contract.LastRevision(), merkleRoot, uint64(len(sectors)), sectorPrice, sectorCollateral)
+
+	// Increase Successful/Failed interactions accordingly
+	defer s.recordInteraction(&err)
+
+	// record the change we are about to make to the contract. If we lose power
+	// mid-revision, this allows us to restore either the pre-revision or
+	// post-revision contract.
+	walTxn, err := sc.recordUploadIntent(rev, sectorRoots, sectorStoragePrice, sectorBandwidthPrice)
+	if err != nil {
+		return modules.RenterContract{}, nil, err
+	}
+
+	// send the actions and the signed revision, and read the host's signature
+	extendDeadline(s.conn, time.Duration(len(sectors))*modules.NegotiateFileContractRevisionTime)
+	signedTxn, err := s.write(actions, rev, contract.SecretKey)
+	if err != nil {
+		return modules.RenterContract{}, nil, err
+	}
+
+	// update contract
+	err = sc.commitUpload(walTxn, signedTxn, sectorRoots, sectorStoragePrice, sectorBandwidthPrice)
+	if err != nil {
+		return modules.RenterContract{}, nil, err
+	}
+	return sc.Metadata(), sectorRoots, nil
+}
+
+// DeleteSectors negotiates a revision that removes the sectors with the
+// specified Merkle roots from the contract of the session. The revision is
+// described by newSectorDeletion.
+func (s *Session) DeleteSectors(roots []crypto.Hash) (_ modules.RenterContract, err error) {
+	// Acquire the contract.
+	sc, haveContract := s.contractSet.Acquire(s.contractID)
+	if !haveContract {
+		return modules.RenterContract{}, errors.New("contract not present in contract set")
+	}
+	defer s.contractSet.Return(sc)
+	contract := sc.header // for convenience
+
+	// create the actions and revision
+	contractRoots, err := sc.merkleRoots.merkleRoots()
+	if err != nil {
+		return modules.RenterContract{}, errors.AddContext(err, "couldn't read contract roots")
+	}
+	d := newSectorDeletion(contractRoots, roots)
+	if d.numDeleted == 0 {
+		return sc.Metadata(), nil
+	}
+	rev := newDeleteRevision(contract.LastRevision(), cachedMerkleRoot(d.remainingRoots), uint64(d.numDeleted))
+
+	// Increase Successful/Failed interactions accordingly
+	defer s.recordInteraction(&err)
+
+	// record the change we are about to make to the contract
+	walTxn, err := sc.recordDeleteIntent(rev, d.swapIndices, d.swapRoots, len(d.remainingRoots))
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+
+	// send the actions and the signed revision, and read the host's signature
+	extendDeadline(s.conn, modules.NegotiateFileContractRevisionTime)
+	signedTxn, err := s.write(d.actions, rev, contract.SecretKey)
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+
+	// update contract
+	err = sc.commitDelete(walTxn, signedTxn, d.swapIndices, d.swapRoots, len(d.remainingRoots))
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+	return sc.Metadata(), nil
+}
+
+// write sends revision actions to the host, along with the revision that pays
+// for them, and returns the revision transaction signed by both parties.
+func (s *Session) write(actions []modules.RevisionAction, rev types.FileContractRevision, sk crypto.SecretKey) (types.Transaction, error) {
+	signedTxn := signRevision(rev, sk)
+	req := modules.SessionWriteRequest{
+		Actions:   actions,
+		Revision:  rev,
+		Signature: signedTxn.TransactionSignatures[0],
+	}
+	var resp modules.SessionWriteResponse
+	if err := s.request(modules.RPCSessionWrite, req, &resp, modules.NegotiateMaxTransactionSignatureSize); err != nil {
+		return types.Transaction{}, errors.AddContext(err, "host did not accept revision")
+	}
+	if err := addHostSignature(&signedTxn, resp.Signature); err != nil {
+		return types.Transaction{}, err
+	}
+	return signedTxn, nil
+}
+
+// recordInteraction records the outcome of a request in the hostdb, and
+// resets the deadline of the connection for the next request. It is called
+// with a pointer to the named error of the request.
+func (s *Session) recordInteraction(err *error) {
+	if *err != nil {
+		s.hdb.IncrementFailedInteractions(s.host.PublicKey)
+		*err = errors.Extend(*err, modules.ErrHostFault)
+	} else {
+		s.hdb.IncrementSuccessfulInteractions(s.host.PublicKey)
+	}
+	extendDeadline(s.conn, time.Hour) // TODO: Constant.
+}
+
+// Sector retrieves the sector with the specified Merkle root, and revises the
+// contract of the session to pay the host proportionally to the data
+// retrieved.
+func (s *Session) Sector(root crypto.Hash) (modules.RenterContract, []byte, error) {
+	return s.PartialSector(root, 0, modules.SectorSize)
+}
+
+// PartialSector retrieves length bytes of the sector with the specified Merkle
+// root, starting at offset. The data is verified using a Merkle range proof
+// sent by the host. Range proofs can only cover whole segments, so the
+// requested range is extended to the surrounding segments, and the renter
+// pays only for the bytes of those segments.
+func (s *Session) PartialSector(root crypto.Hash, offset, length uint64) (_ modules.RenterContract, _ []byte, err error) {
+	if length == 0 || offset+length > modules.SectorSize || offset+length < offset {
+		return modules.RenterContract{}, nil, errors.New("requested range is out of sector bounds")
+	}
+	fetchOffset := offset - offset%crypto.SegmentSize
+	fetchLength := (offset + length) - fetchOffset
+	if r := fetchLength % crypto.SegmentSize; r != 0 {
+		fetchLength += crypto.SegmentSize - r
+	}
+
+	// Acquire the contract.
+	sc, haveContract := s.contractSet.Acquire(s.contractID)
+	if !haveContract {
+		return modules.RenterContract{}, nil, errors.New("contract not present in contract set")
+	}
+	defer s.contractSet.Return(sc)
+	contract := sc.header // for convenience
+
+	// calculate price
+	price := s.host.DownloadBandwidthPrice.Mul64(fetchLength)
+	if contract.RenterFunds().Cmp(price) < 0 {
+		return modules.RenterContract{}, nil, errors.New("contract has insufficient funds to support download")
+	}
+	// To mitigate small errors (e.g. differing block heights), fudge the
+	// price and collateral by 0.2%.
+	price = price.MulFloat(1 + hostPriceLeeway)
+
+	// create the download revision
+	rev := newDownloadRevision(contract.LastRevision(), price)
+
+	// Increase Successful/Failed interactions accordingly
+	defer s.recordInteraction(&err)
+
+	// record the change we are about to make to the contract. If we lose power
+	// mid-revision, this allows us to restore either the pre-revision or
+	// post-revision contract.
+	walTxn, err := sc.recordDownloadIntent(rev, price)
+	if err != nil {
+		return modules.RenterContract{}, nil, err
+	}
+
+	// send the download action and the signed revision, and read the host's
+	// signature and the sector data
+	signedTxn := signRevision(rev, contract.SecretKey)
+	req := modules.SessionReadRequest{
+		Sections: []modules.DownloadAction{{
+			MerkleRoot: root,
+			Offset:     fetchOffset,
+			Length:     fetchLength,
+		}},
+		Revision:  rev,
+		Signature: signedTxn.TransactionSignatures[0],
+	}
+	var resp modules.SessionReadResponse
+	proofSize := uint64(sectorHeight+1) * crypto.HashSize
+	extendDeadline(s.conn, modules.NegotiateDownloadTime)
+	if err := s.request(modules.RPCSessionRead, req, &resp, fetchLength+proofSize+modules.NegotiateMaxTransactionSignatureSize); err != nil {
+		return modules.RenterContract{}, nil, errors.AddContext(err, "host did not accept download request")
+	}
+	if err := addHostSignature(&signedTxn, resp.Signature); err != nil {
+		return modules.RenterContract{}, nil, err
+	}
+	if len(resp.Data) != 1 || len(resp.MerkleProofs) != 1 {
+		return modules.RenterContract{}, nil, errors.New("host did not send enough sectors")
+	}
+	data := resp.Data[0]
+	proofStart := int(fetchOffset / crypto.SegmentSize)
+	proofEnd := int((fetchOffset + fetchLength) / crypto.SegmentSize)
+	if uint64(len(data)) != fetchLength {
+		return modules.RenterContract{}, nil, errors.New("host did not send enough sector data")
+	} else if !crypto.VerifyRangeProof(data, resp.MerkleProofs[0], proofStart, proofEnd, int(modules.SectorSize/crypto.SegmentSize), root) {
+		return modules.RenterContract{}, nil, errors.New("host sent bad sector data")
+	}
+
+	// update contract and metrics
+	if err := sc.commitDownload(walTxn, signedTxn, price); err != nil {
+		return modules.RenterContract{}, nil, err
+	}
+	return sc.Metadata(), data[offset-fetchOffset : offset-fetchOffset+length], nil
+}
+
+// Expired returns true if the host may already have ended the session because
+// it was idle or open for too long. An expired Session should be closed and
+// replaced by a new one instead of being used for further requests.
+func (s *Session) Expired() bool {
+	return time.Since(s.lastRequest) > sessionMaxIdleTime || time.Since(s.started) > sessionMaxTime
+}
+
+// SetHeight sets the block height that is used to price the uploads of the
+// session.
+func (s *Session) SetHeight(height types.BlockHeight) {
+	s.height = height
+}
+
+// shutdown ends the session and signals the goroutine spawned in NewSession
+// to return.
+func (s *Session) shutdown() {
+	extendDeadline(s.conn, modules.NegotiateSettingsTime)
+	// don't care about this error
+	_ = modules.WriteSessionRequest(s.conn, s.cipher, modules.RPCSessionStop, nil)
+	close(s.closeChan)
+}
+
+// Close cleanly ends the session with the host and closes the connection.
+func (s *Session) Close() error {
+	// using once ensures that Close is idempotent
+	s.once.Do(s.shutdown)
+	return s.conn.Close()
+}
+
+// addHostSignature adds the host's signature to a signed revision transaction
+// and verifies it.
+func addHostSignature(signedTxn *types.Transaction, hostSig types.TransactionSignature) error {
+	// NOTE: we can fake the blockheight here because it doesn't affect
+	// verification; it just needs to be above the fork height and below the
+	// contract expiration (which was checked earlier).
+	verificationHeight := signedTxn.FileContractRevisions[0].NewWindowStart - 1
+	signedTxn.TransactionSignatures = append(signedTxn.TransactionSignatures, hostSig)
+	return signedTxn.StandaloneValid(verificationHeight)
+}
+
+// keyExchange calls rpc on the host, which is either RPCSession or
+// RPCEncrypt, and performs the key exchange. The host's signature of the
+// exchange is verified using the public key of the host, which guarantees that
+// the connection can't be taken over by anyone else. The cipher and the
+// challenge of the session are returned.
+func keyExchange(conn net.Conn, host modules.HostDBEntry, rpc types.Specifier) (*modules.SessionCipher, [modules.SessionChallengeSize]byte, error) {
+	var challenge [modules.SessionChallengeSize]byte
+	if host.PublicKey.Algorithm != types.SignatureEd25519 || len(host.PublicKey.Key) != crypto.PublicKeySize {
+		return nil, challenge, errors.New("host used unsupported signature algorithm")
+	}
+	var pk crypto.PublicKey
+	copy(pk[:], host.PublicKey.Key)
+
+	xsk, xpk := crypto.GenerateX25519KeyPair()
+	req := modules.SessionKeyExchangeRequest{
+		PublicKey: xpk,
+		Ciphers:   []types.Specifier{modules.SessionCipherChaCha20Poly1305},
+	}
+	if err := encoding.WriteObject(conn, rpc); err != nil {
+		return nil, challenge, errors.New("couldn't initiate RPC: " + err.Error())
+	}
+	if err := encoding.WriteObject(conn, req); err != nil {
+		return nil, challenge, errors.New("couldn't send key exchange request: " + err.Error())
+	}
+	var resp modules.SessionKeyExchangeResponse
+	if err := encoding.ReadObject(conn, &resp, modules.NegotiateMaxSessionKeyExchangeSize); err != nil {
+		return nil, challenge, errors.New("couldn't read key exchange response: " + err.Error())
+	}
+	if err := crypto.VerifyHash(resp.SigHash(req), pk, resp.Signature); err != nil {
+		return nil, challenge, errors.New("host's key exchange signature is invalid: " + err.Error())
+	}
+	if resp.Cipher != modules.SessionCipherChaCha20Poly1305 {
+		return nil, challenge, modules.ErrSessionNoCipher
+	}
+	aead := crypto.NewChaCha20Poly1305(crypto.DeriveSharedSecret(xsk, resp.PublicKey))
+	return modules.NewSessionCipher(aead, false), resp.Challenge, nil
+}
+
+// sessionLock locks a contract within a session and checks that the host
+// and the renter agree upon the current state of the contract.
+func sessionLock(conn net.Conn, sessionCipher *modules.SessionCipher, challenge [modules.SessionChallengeSize]byte, contract contractHeader) (modules.SessionLockResponse, error) {
+	req := modules.SessionLockRequest{
+		ContractID: contract.ID(),
+		Signature:  crypto.SignHash(modules.SessionChallengeHash(challenge), contract.SecretKey),
+	}
+	if err := modules.WriteSessionRequest(conn, sessionCipher, modules.RPCSessionLock, req); err != nil {
+		return modules.SessionLockResponse{}, errors.New("couldn't send lock request: " + err.Error())
+	}
+	var resp modules.SessionLockResponse
+	if err := modules.ReadSessionResponse(conn, sessionCipher, &resp, modules.NegotiateMaxFileContractRevisionSize+modules.NegotiateMaxTransactionSignaturesSize); err != nil {
+		return modules.SessionLockResponse{}, errors.New("host did not accept lock request: " + err.Error())
+	}
+	return resp, nil
+}
+
+// NewSession starts a session with a host and locks the specified contract,
+// and returns a Session.
+func (cs *ContractSet) NewSession(host modules.HostDBEntry, id types.FileContractID, currentHeight types.BlockHeight, hdb hostDB, cancel <-chan struct{}) (_ *Session, err error) {
+	sc, ok := cs.Acquire(id)
+	if !ok {
+		return nil, errors.New("invalid contract")
+	}
+	defer cs.Return(sc)
+	contract := sc.header
+
+	// Increase Successful/Failed interactions accordingly
+	defer func() {
+		// a revision mismatch is not necessarily the host's fault
+		if err != nil && !IsRevisionMismatch(err) {
+			hdb.IncrementFailedInteractions(contract.HostPublicKey())
+			err = errors.Extend(err, modules.ErrHostFault)
+		} else if err == nil {
+			hdb.IncrementSuccessfulInteractions(contract.HostPublicKey())
+		}
+	}()
+
+	c, err := (&net.Dialer{
+		Cancel:  cancel,
+		Timeout: connTimeout,
+	}).Dial("tcp", string(host.NetAddress))
+	if err != nil {
+		return nil, err
+	}
+	conn := ratelimit.NewRLConn(c, cs.rl, cancel)
+	closeChan := make(chan struct{})
+	go func() {
+		select {
+		case <-cancel:
+			conn.Close()
+		case <-closeChan:
+		}
+	}()
+	defer func() {
+		if err != nil {
+			conn.Close()
+			close(closeChan)
+		}
+	}()
+
+	// allot 2 minutes for the key exchange and the lock request
+	extendDeadline(conn, modules.NegotiateRecentRevisionTime)
+	defer extendDeadline(conn, time.Hour)
+	sessionCipher, challenge, err := keyExchange(conn, host, modules.RPCSession)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sessionLock(conn, sessionCipher, challenge, contract)
+	if err != nil {
+		return nil, err
+	}
+	err = checkRecentRevision(contract, resp.Revision, resp.Signatures)
+	if IsRevisionMismatch(err) && len(sc.unappliedTxns) > 0 {
+		// we have desynced from the host. If we have unapplied updates from the
+		// WAL, try applying them.
+		if err = checkRecentRevision(sc.unappliedHeader(), resp.Revision, resp.Signatures); err != nil {
+			return nil, err
+		}
+		// applying the updates was successful; commit them to disk
+		if err = sc.commitTxns(); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	// if we succeeded, we can safely discard the unappliedTxns
+	for _, txn := range sc.unappliedTxns {
+		txn.SignalUpdatesApplied()
+	}
+	sc.unappliedTxns = nil
+
+	// the host is now ready to accept requests
+	return &Session{
+		cipher:      sessionCipher,
+		closeChan:   closeChan,
+		conn:        conn,
+		contractID:  id,
+		contractSet: cs,
+		hdb:         hdb,
+		height:      currentHeight,
+		host:        host,
+		lastRequest: time.Now(),
+		started:     time.Now(),
+	}, nil
+}
@@ -0,0 +1,182 @@
+package renter
+
+// redundancy.go implements changing the erasure code of a file that has
+// already been uploaded. The new layout of the file is created as a separate
+// file with the same name, size and master key, which is stored next to the
+// file's .sia file. The repair loop uploads the chunks of the new layout like
+// the chunks of any other file, fetching their data either from disk or from
+// the current layout of the file. Once every chunk of the new layout is fully
+// uploaded, the new layout replaces the file and the pieces of the old layout
+// are removed from the hosts. Until then, the file is downloaded using its old
+// layout.
+
+import (
+	"os"
+	"reflect"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// sameErasureCode returns true if both erasure codes are of the same type and
+// use the same number of pieces.
+func sameErasureCode(a, b modules.ErasureCoder) bool {
+	return reflect.TypeOf(a) == reflect.TypeOf(b) && a.MinPieces() == b.MinPieces() && a.NumPieces() == b.NumPieces()
+}
+
+// sectors returns the Merkle roots of the pieces of the file, grouped by the
+// contracts that store them.
+func (f *file) sectors() map[types.FileContractID][]crypto.Hash {
+	sectors := make(map[types.FileContractID][]crypto.Hash)
+	for id, fc := range f.contracts {
+		for _, p := range fc.Pieces {
+			sectors[id] = append(sectors[id], p.MerkleRoot)
+		}
+	}
+	return sectors
+}
+
+// cancelMigration discards the pending layout of f and removes its pieces from
+// the hosts. The file should be locked by the caller.
+func (r *Renter) cancelMigration(f *file) {
+	m := f.migration
+	if m == nil {
+		return
+	}
+	f.migration = nil
+
+	m.mu.Lock()
+	path := r.filePath(m)
+	m.deleted = true
+	sectors := m.sectors()
+	m.mu.Unlock()
+
+	if err := persist.RemoveFile(path); err != nil {
+		r.log.Println("WARN: couldn't remove pending layout of file:", err)
+	}
+	go r.threadedDeleteSectors(sectors)
+}
+
+// renameMigration updates the name of the pending layout of f after f has been
+// renamed. The file should be locked by the caller.
+func (r *Renter) renameMigration(f *file) error {
+	m := f.migration
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldPath := r.filePath(m)
+	m.name = f.name
+	if err := r.saveFile(m); err != nil {
+		return err
+	}
+	if oldPath == r.filePath(m) {
+		return nil
+	}
+	return persist.RemoveFile(oldPath)
+}
+
+// loadMigrations loads the pending layouts of the renter's files from disk.
+func (r *Renter) loadMigrations() {
+	for _, f := range r.files {
+		path := r.filePath(f) + migrationExtension
+		handle, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			r.log.Println("ERROR: could not open pending layout of file:", err)
+			continue
+		}
+		files, err := readSharedFiles(handle)
+		handle.Close()
+		if err != nil || len(files) != 1 {
+			r.log.Println("ERROR: could not load pending layout of file:", f.name, err)
+			continue
+		}
+		m := files[0]
+		m.name = f.name
+		m.original = f
+		f.migration = m
+		r.addDedupRefs(m)
+	}
+}
+
+// SetFileRedundancy changes the erasure code of the file at siaPath. The
+// chunks of the file are re-encoded in the background, and the file keeps its
+// current layout until all chunks have been uploaded using the new erasure
+// code. A pending change of the file's redundancy is discarded.
+func (r *Renter) SetFileRedundancy(siaPath string, ec modules.ErasureCoder) error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	f, exists := r.files[siaPath]
+	if !exists {
+		return ErrUnknownPath
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.cancelMigration(f)
+	if sameErasureCode(f.erasureCode, ec) {
+		return nil
+	}
+
+	// Create the new layout of the file. It uses the same piece size as the
+	// file, so that the chunks of the new layout can be downloaded from the
+	// current layout.
+	m := newFile(f.name, ec, f.masterKey, f.size)
+	m.pieceSize = f.pieceSize
+	m.mode = f.mode
+	m.dedup = f.dedup
+	m.original = f
+	if err := r.saveFile(m); err != nil {
+		return err
+	}
+	f.migration = m
+
+	// Wake up the repair loop.
+	select {
+	case r.uploadHeap.newUploads <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// managedFinishMigration replaces f with its pending layout m once all chunks
+// of m have been uploaded, and removes the pieces of the old layout from the
+// hosts.
+func (r *Renter) managedFinishMigration(f, m *file) {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// The file might have been deleted, or its redundancy changed again,
+	// since the migration was found to be complete.
+	if r.files[f.name] != f || f.migration != m {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	migrationPath := r.filePath(m)
+	m.original = nil
+	if err := r.saveFile(m); err != nil {
+		r.log.Println("WARN: unable to save file with new redundancy:", err)
+		m.original = f
+		return
+	}
+	if err := persist.RemoveFile(migrationPath); err != nil {
+		r.log.Println("WARN: couldn't remove pending layout of file:", err)
+	}
+
+	// Replace the file. Marking the old file as deleted prevents chunks of
+	// the old layout that are still being repaired from saving it again, and
+	// drops its chunks from the dedup index.
+	f.migration = nil
+	f.deleted = true
+	r.files[f.name] = m
+	r.releasePackMember(f)
+	go r.threadedDeleteSectors(f.sectors())
+}
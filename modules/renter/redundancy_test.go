@@ -0,0 +1,99 @@
+package renter
+
+import (
+	"os"
+	"testing"
+)
+
+// TestSetFileRedundancy checks that changing the redundancy of a file creates
+// a persisted pending layout, which replaces the file once the migration is
+// finished.
+func TestSetFileRedundancy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	ec, err := NewRSCode(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetFileRedundancy("foo", ec); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// Change the redundancy of a file.
+	f := newTestingFile()
+	f.name = "foo"
+	r.files["foo"] = f
+	if err := r.saveFile(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetFileRedundancy("foo", ec); err != nil {
+		t.Fatal(err)
+	}
+	m := f.migration
+	if m == nil || m.original != f || !sameErasureCode(m.erasureCode, ec) {
+		t.Fatal("pending layout wasn't created correctly")
+	}
+	if _, err := os.Stat(r.filePath(m)); err != nil {
+		t.Fatal("pending layout wasn't saved:", err)
+	}
+
+	// Changing the redundancy back to the current erasure code should
+	// discard the pending layout.
+	if err := r.SetFileRedundancy("foo", f.erasureCode); err != nil {
+		t.Fatal(err)
+	}
+	if f.migration != nil {
+		t.Fatal("pending layout wasn't discarded")
+	}
+	if _, err := os.Stat(r.filePath(m)); !os.IsNotExist(err) {
+		t.Fatal("pending layout wasn't removed from disk:", err)
+	}
+
+	// Renaming the file should rename the pending layout as well.
+	if err := r.SetFileRedundancy("foo", ec); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := r.filePath(f.migration)
+	if err := r.RenameFile("foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if f.migration.name != "bar" {
+		t.Fatal("pending layout wasn't renamed")
+	}
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Fatal("old pending layout wasn't removed from disk:", err)
+	}
+
+	// The pending layout should be loaded together with the file.
+	r.files = make(map[string]*file)
+	if err := r.loadSiaFiles(); err != nil {
+		t.Fatal(err)
+	}
+	f = r.files["bar"]
+	if f == nil || f.migration == nil || f.migration.original != f || !sameErasureCode(f.migration.erasureCode, ec) {
+		t.Fatal("pending layout wasn't loaded")
+	}
+
+	// Finishing the migration should replace the file.
+	m = f.migration
+	r.managedFinishMigration(f, m)
+	if r.files["bar"] != m || m.original != nil || !f.deleted {
+		t.Fatal("file wasn't replaced by its pending layout")
+	}
+	r.files = make(map[string]*file)
+	if err := r.loadSiaFiles(); err != nil {
+		t.Fatal(err)
+	}
+	f = r.files["bar"]
+	if f == nil || f.migration != nil || !sameErasureCode(f.erasureCode, ec) {
+		t.Fatal("migrated file wasn't persisted correctly")
+	}
+}
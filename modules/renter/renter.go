@@ -25,8 +25,10 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/contractor"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/hostdb"
@@ -74,6 +76,13 @@ type hostDB interface {
 	// Close closes the hostdb.
 	Close() error
 
+	// Filter returns the filter mode of the hostdb and the hosts of the
+	// filter.
+	Filter() (modules.FilterMode, []types.SiaPublicKey)
+
+	// SetFilterMode sets the filter mode of the hostdb.
+	SetFilterMode(modules.FilterMode, []types.SiaPublicKey) error
+
 	// Host returns the HostDBEntry for a given host.
 	Host(types.SiaPublicKey) (modules.HostDBEntry, bool)
 
@@ -81,15 +90,31 @@ type hostDB interface {
 	// hostdb is completed.
 	InitialScanComplete() (bool, error)
 
+	// RecordUploadThroughput and RecordDownloadThroughput record the
+	// throughput of a transfer of the given number of bytes with a host.
+	RecordUploadThroughput(types.SiaPublicKey, uint64, time.Duration)
+	RecordDownloadThroughput(types.SiaPublicKey, uint64, time.Duration)
+
 	// RandomHosts returns a set of random hosts, weighted by their estimated
 	// usefulness / attractiveness to the renter. RandomHosts will not return
-	// any offline or inactive hosts.
-	RandomHosts(int, []types.SiaPublicKey) ([]modules.HostDBEntry, error)
+	// any offline or inactive hosts, or hosts that share a subnet with a host
+	// of the address blacklist.
+	RandomHosts(int, []types.SiaPublicKey, []types.SiaPublicKey) ([]modules.HostDBEntry, error)
 
 	// ScoreBreakdown returns a detailed explanation of the various properties
 	// of the host.
 	ScoreBreakdown(modules.HostDBEntry) modules.HostScoreBreakdown
 
+	// ScoringProfile returns the scoring profile of the hostdb.
+	ScoringProfile() modules.HostScoringProfile
+
+	// SetScoringProfile sets the scoring profile of the hostdb.
+	SetScoringProfile(modules.HostScoringProfile) error
+
+	// SetAllowance sets the allowance that is used to score the prices of
+	// hosts.
+	SetAllowance(modules.Allowance) error
+
 	// EstimateHostScore returns the estimated score breakdown of a host with the
 	// provided settings.
 	EstimateHostScore(modules.HostDBEntry) modules.HostScoreBreakdown
@@ -123,6 +148,10 @@ type hostContractor interface {
 	// with a bool indicating if it exists.
 	ContractUtility(types.SiaPublicKey) (modules.ContractUtility, bool)
 
+	// ContractUtilityReason returns the reason why a contract is not good
+	// for upload or renew.
+	ContractUtilityReason(types.FileContractID) string
+
 	// CurrentPeriod returns the height at which the current allowance period
 	// began.
 	CurrentPeriod() types.BlockHeight
@@ -131,16 +160,12 @@ type hostContractor interface {
 	// billing period.
 	PeriodSpending() modules.ContractorSpending
 
-	// Editor creates an Editor from the specified contract ID, allowing the
-	// insertion, deletion, and modification of sectors.
-	Editor(types.SiaPublicKey, <-chan struct{}) (contractor.Editor, error)
-
 	// IsOffline reports whether the specified host is considered offline.
 	IsOffline(types.SiaPublicKey) bool
 
-	// Downloader creates a Downloader from the specified contract ID,
-	// allowing the retrieval of sectors.
-	Downloader(types.SiaPublicKey, <-chan struct{}) (contractor.Downloader, error)
+	// Session returns a Session with the specified host, allowing the
+	// upload, download and deletion of sectors over a single connection.
+	Session(types.SiaPublicKey, <-chan struct{}) (contractor.Session, error)
 
 	// ResolveIDToPubKey returns the public key of a host given a contract id.
 	ResolveIDToPubKey(types.FileContractID) types.SiaPublicKey
@@ -152,6 +177,27 @@ type hostContractor interface {
 	// SetRateLimits sets the bandwidth limits for connections created by the
 	// contractor and its submodules.
 	SetRateLimits(int64, int64, uint64)
+
+	// TriggerContractMaintenance starts a round of contract maintenance
+	// without waiting for the next block.
+	TriggerContractMaintenance()
+
+	// FormContract forms a contract with the specified host.
+	FormContract(hostKey types.SiaPublicKey, funds types.Currency, endHeight types.BlockHeight) (modules.RenterContract, error)
+
+	// RenewContract renews the specified contract right away.
+	RenewContract(id types.FileContractID, funds types.Currency) (modules.RenterContract, error)
+
+	// CancelContract cancels the specified contract and moves it to the old
+	// contracts.
+	CancelContract(id types.FileContractID) error
+
+	// InitRecoveryScan starts a scan for contracts that can be recovered
+	// using the wallet seed.
+	InitRecoveryScan() error
+
+	// RecoveryScanStatus returns the status of the recovery scan.
+	RecoveryScanStatus() (bool, types.BlockHeight)
 }
 
 // A trackedFile contains metadata about files being tracked by the Renter.
@@ -161,6 +207,13 @@ type hostContractor interface {
 type trackedFile struct {
 	// location of original file on disk
 	RepairPath string
+
+	// size and modification time of the original file at the time of the
+	// upload. They are used to detect whether the file has been changed since,
+	// in which case it can't be used for repairs anymore. A zero ModTime
+	// indicates that the values are unknown.
+	Size    int64
+	ModTime time.Time
 }
 
 // A Renter is responsible for tracking all of the files that a user has
@@ -179,6 +232,18 @@ type Renter struct {
 	// default, files loaded through sharing are not maintained by the user.
 	files map[string]*file
 
+	// Small file packing. packs contains the shared chunks that store the
+	// data of packed files, indexed by their names. openPacks are the packs
+	// that still accept new files. They are only uploaded once they are
+	// sealed.
+	packs     map[string]*file
+	openPacks []*file
+
+	// dedupIndex maps the content hashes of the chunks of deduplicated files
+	// to the chunks with that content. The number of references of an entry
+	// is the number of files that share the pieces of the chunk.
+	dedupIndex map[crypto.Hash][]dedupRef
+
 	// Download management. The heap has a separate mutex because it is always
 	// accessed in isolation.
 	downloadHeapMu sync.Mutex         // Used to protect the downloadHeap.
@@ -213,6 +278,8 @@ type Renter struct {
 	log               *persist.Logger
 	persist           persistence
 	persistDir        string
+	bubbleMu          sync.Mutex // Serializes bubbles, which read the metadata of subdirectories.
+	dirMetadataMu     sync.Mutex // Serializes writes to the directory metadata files.
 	mu                *siasync.RWMutex
 	tg                threadgroup.ThreadGroup
 	tpool             modules.TransactionPool
@@ -239,7 +306,7 @@ func (r *Renter) PriceEstimation() modules.RenterPriceEstimation {
 	}
 
 	// Grab hosts to perform the estimation.
-	hosts, err := r.hostDB.RandomHosts(priceEstimationScope, nil)
+	hosts, err := r.hostDB.RandomHosts(priceEstimationScope, nil, nil)
 	if err != nil {
 		return modules.RenterPriceEstimation{}
 	}
@@ -337,6 +404,10 @@ func (r *Renter) SetSettings(s modules.RenterSettings) error {
 	if err != nil {
 		return err
 	}
+	err = r.hostDB.SetAllowance(r.hostContractor.Allowance())
+	if err != nil {
+		return err
+	}
 
 	// Set the bandwidth limits.
 	err = r.setBandwidthLimits(s.MaxDownloadSpeed, s.MaxUploadSpeed)
@@ -374,6 +445,28 @@ func (r *Renter) AllHosts() []modules.HostDBEntry { return r.hostDB.AllHosts() }
 // Host returns the host associated with the given public key
 func (r *Renter) Host(spk types.SiaPublicKey) (modules.HostDBEntry, bool) { return r.hostDB.Host(spk) }
 
+// Filter returns the filter mode of the hostdb and the hosts of the filter.
+func (r *Renter) Filter() (modules.FilterMode, []types.SiaPublicKey) { return r.hostDB.Filter() }
+
+// SetFilterMode sets the filter mode of the hostdb. The utility of the
+// contracts is updated right away, so contracts with hosts that are excluded
+// by the filter are no longer used for uploads and will not be renewed.
+func (r *Renter) SetFilterMode(fm modules.FilterMode, hosts []types.SiaPublicKey) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := r.hostDB.SetFilterMode(fm, hosts); err != nil {
+		return err
+	}
+	allowance := r.hostContractor.Allowance()
+	if fm == modules.HostDBFilterWhitelist && uint64(len(hosts)) < allowance.Hosts {
+		r.log.Printf("WARN: the whitelist contains %v hosts, but the allowance requires %v hosts", len(hosts), allowance.Hosts)
+	}
+	r.hostContractor.TriggerContractMaintenance()
+	return nil
+}
+
 // InitialScanComplete returns a boolean indicating if the initial scan of the
 // hostdb is completed.
 func (r *Renter) InitialScanComplete() (bool, error) { return r.hostDB.InitialScanComplete() }
@@ -383,6 +476,24 @@ func (r *Renter) ScoreBreakdown(e modules.HostDBEntry) modules.HostScoreBreakdow
 	return r.hostDB.ScoreBreakdown(e)
 }
 
+// ScoringProfile returns the scoring profile of the hostdb.
+func (r *Renter) ScoringProfile() modules.HostScoringProfile { return r.hostDB.ScoringProfile() }
+
+// SetScoringProfile sets the scoring profile of the hostdb. The utility of the
+// contracts is updated right away, so contracts with hosts whose score dropped
+// too far are no longer used for uploads and will not be renewed.
+func (r *Renter) SetScoringProfile(sp modules.HostScoringProfile) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := r.hostDB.SetScoringProfile(sp); err != nil {
+		return err
+	}
+	r.hostContractor.TriggerContractMaintenance()
+	return nil
+}
+
 // EstimateHostScore returns the estimated host score
 func (r *Renter) EstimateHostScore(e modules.HostDBEntry) modules.HostScoreBreakdown {
 	return r.hostDB.EstimateHostScore(e)
@@ -396,6 +507,52 @@ func (r *Renter) OldContracts() []modules.RenterContract {
 	return r.hostContractor.OldContracts()
 }
 
+// FormContract forms a contract with the specified host. The contract is not
+// dropped by the contract maintenance because of the score of the host.
+func (r *Renter) FormContract(hostKey types.SiaPublicKey, funds types.Currency, endHeight types.BlockHeight) (modules.RenterContract, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.RenterContract{}, err
+	}
+	defer r.tg.Done()
+	return r.hostContractor.FormContract(hostKey, funds, endHeight)
+}
+
+// RenewContract renews the specified contract without waiting for the renew
+// window.
+func (r *Renter) RenewContract(id types.FileContractID, funds types.Currency) (modules.RenterContract, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.RenterContract{}, err
+	}
+	defer r.tg.Done()
+	return r.hostContractor.RenewContract(id, funds)
+}
+
+// CancelContract cancels the specified contract. The host of the contract is
+// not used for new contracts by the contract maintenance.
+func (r *Renter) CancelContract(id types.FileContractID) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	return r.hostContractor.CancelContract(id)
+}
+
+// InitRecoveryScan starts scanning the blockchain for contracts that can be
+// recovered using the wallet seed.
+func (r *Renter) InitRecoveryScan() error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	return r.hostContractor.InitRecoveryScan()
+}
+
+// RecoveryScanStatus returns whether a recovery scan is in progress and the
+// height of the blockchain it has reached.
+func (r *Renter) RecoveryScanStatus() (bool, types.BlockHeight) {
+	return r.hostContractor.RecoveryScanStatus()
+}
+
 // CurrentPeriod returns the host contractor's current period
 func (r *Renter) CurrentPeriod() types.BlockHeight { return r.hostContractor.CurrentPeriod() }
 
@@ -405,6 +562,12 @@ func (r *Renter) ContractUtility(pk types.SiaPublicKey) (modules.ContractUtility
 	return r.hostContractor.ContractUtility(pk)
 }
 
+// ContractUtilityReason returns the reason why a contract is not good for
+// upload or renew.
+func (r *Renter) ContractUtilityReason(id types.FileContractID) string {
+	return r.hostContractor.ContractUtilityReason(id)
+}
+
 // PeriodSpending returns the host contractor's period spending
 func (r *Renter) PeriodSpending() modules.ContractorSpending { return r.hostContractor.PeriodSpending() }
 
@@ -479,7 +642,9 @@ func NewCustomRenter(g modules.Gateway, cs modules.ConsensusSet, tpool modules.T
 	}
 
 	r := &Renter{
-		files: make(map[string]*file),
+		files:      make(map[string]*file),
+		packs:      make(map[string]*file),
+		dedupIndex: make(map[crypto.Hash][]dedupRef),
 
 		// Making newDownloads a buffered channel means that most of the time, a
 		// new download will trigger an unnecessary extra iteration of the
@@ -525,6 +690,14 @@ func NewCustomRenter(g modules.Gateway, cs modules.ConsensusSet, tpool modules.T
 	// Initialize the streaming cache.
 	r.staticStreamCache = newStreamCache(r.persist.StreamCacheSize)
 
+	// Score the hosts according to the expected usage of the allowance, since
+	// the hostdb doesn't persist the allowance.
+	if hdb != nil {
+		if err := hdb.SetAllowance(hc.Allowance()); err != nil {
+			return nil, err
+		}
+	}
+
 	// Subscribe to the consensus set.
 	err = cs.ConsensusSetSubscribe(r, modules.ConsensusChangeRecent, r.tg.StopChan())
 	if err != nil {
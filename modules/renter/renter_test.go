@@ -4,6 +4,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/crypto"
@@ -109,7 +110,7 @@ func (stubHostDB) AllHosts() []modules.HostDBEntry      { return nil }
 func (stubHostDB) AverageContractPrice() types.Currency { return types.Currency{} }
 func (stubHostDB) Close() error                         { return nil }
 func (stubHostDB) IsOffline(modules.NetAddress) bool    { return true }
-func (stubHostDB) RandomHosts(int, []types.SiaPublicKey) ([]modules.HostDBEntry, error) {
+func (stubHostDB) RandomHosts(int, []types.SiaPublicKey, []types.SiaPublicKey) ([]modules.HostDBEntry, error) {
 	return []modules.HostDBEntry{}, nil
 }
 func (stubHostDB) EstimateHostScore(modules.HostDBEntry) modules.HostScoreBreakdown {
@@ -121,6 +122,23 @@ func (stubHostDB) Host(types.SiaPublicKey) (modules.HostDBEntry, bool) {
 func (stubHostDB) ScoreBreakdown(modules.HostDBEntry) modules.HostScoreBreakdown {
 	return modules.HostScoreBreakdown{}
 }
+func (stubHostDB) Filter() (modules.FilterMode, []types.SiaPublicKey) {
+	return modules.HostDBFilterNone, nil
+}
+func (stubHostDB) SetFilterMode(modules.FilterMode, []types.SiaPublicKey) error {
+	return nil
+}
+func (stubHostDB) ScoringProfile() modules.HostScoringProfile {
+	return modules.DefaultHostScoringProfile
+}
+func (stubHostDB) SetScoringProfile(modules.HostScoringProfile) error {
+	return nil
+}
+func (stubHostDB) SetAllowance(modules.Allowance) error {
+	return nil
+}
+func (stubHostDB) RecordUploadThroughput(types.SiaPublicKey, uint64, time.Duration)   {}
+func (stubHostDB) RecordDownloadThroughput(types.SiaPublicKey, uint64, time.Duration) {}
 
 // stubContractor is the minimal implementation of the hostContractor
 // interface.
@@ -147,7 +165,7 @@ type pricesStub struct {
 
 func (pricesStub) InitialScanComplete() (bool, error) { return true, nil }
 
-func (ps pricesStub) RandomHosts(n int, exclude []types.SiaPublicKey) ([]modules.HostDBEntry, error) {
+func (ps pricesStub) RandomHosts(n int, exclude, addressBlacklist []types.SiaPublicKey) ([]modules.HostDBEntry, error) {
 	return ps.dbEntries, nil
 }
 
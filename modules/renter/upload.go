@@ -19,6 +19,7 @@ import (
 	"os"
 
 	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 )
 
@@ -41,6 +42,23 @@ func validateSource(sourcePath string) error {
 	return nil
 }
 
+// onDisk returns true if the original file of a tracked file is available on
+// disk and hasn't been modified since it was uploaded.
+func (tf trackedFile) onDisk() bool {
+	if tf.RepairPath == "" {
+		return false
+	}
+	fi, err := os.Stat(tf.RepairPath)
+	if err != nil || fi.IsDir() {
+		return false
+	}
+	if tf.ModTime.IsZero() {
+		// The file was uploaded before the metadata was tracked.
+		return true
+	}
+	return fi.Size() == tf.Size && fi.ModTime().Equal(tf.ModTime)
+}
+
 // Upload instructs the renter to start tracking a file. The renter will
 // automatically upload and repair tracked files using a background loop.
 func (r *Renter) Upload(up modules.FileUploadParams) error {
@@ -60,6 +78,12 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	if exists {
 		return ErrPathOverload
 	}
+	if r.dirExists(up.SiaPath) {
+		return ErrDirExists
+	}
+	if up.Pack && up.Dedup {
+		return errDedupPacked
+	}
 
 	// Fill in any missing upload params with sensible defaults.
 	fileInfo, err := os.Stat(up.Source)
@@ -69,6 +93,13 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	if up.ErasureCode == nil {
 		up.ErasureCode, _ = NewRSCode(defaultDataPieces, defaultParityPieces)
 	}
+	if up.CipherType == "" {
+		up.CipherType = defaultCipherType
+	}
+	masterKey, err := crypto.GenerateCipherKey(up.CipherType)
+	if err != nil {
+		return err
+	}
 
 	// Check that we have contracts to upload to. We need at least data +
 	// parity/2 contracts. NumPieces is equal to data+parity, and min pieces is
@@ -80,15 +111,24 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 		return fmt.Errorf("not enough contracts to upload file: got %v, needed %v", numContracts, (up.ErasureCode.NumPieces()+up.ErasureCode.MinPieces())/2)
 	}
 
+	// Small files are packed together with other small files if requested.
+	chunkSize := (modules.SectorSize - masterKey.Overhead()) * uint64(up.ErasureCode.MinPieces())
+	if up.Pack && fileInfo.Size() > 0 && uint64(fileInfo.Size()) <= chunkSize {
+		return r.managedUploadPacked(up, fileInfo)
+	}
+
 	// Create file object.
-	f := newFile(up.SiaPath, up.ErasureCode, pieceSize, uint64(fileInfo.Size()))
+	f := newFile(up.SiaPath, up.ErasureCode, masterKey, uint64(fileInfo.Size()))
 	f.mode = uint32(fileInfo.Mode())
+	f.dedup = up.Dedup
 
 	// Add file to renter.
 	lockID = r.mu.Lock()
 	r.files[up.SiaPath] = f
 	r.persist.Tracking[up.SiaPath] = trackedFile{
 		RepairPath: up.Source,
+		Size:       fileInfo.Size(),
+		ModTime:    fileInfo.ModTime(),
 	}
 	r.saveSync()
 	err = r.saveFile(f)
@@ -96,6 +136,7 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	if err != nil {
 		return err
 	}
+	go r.threadedBubbleMetadata(dirParent(up.SiaPath))
 
 	// Send the upload to the repair loop.
 	hosts := r.managedRefreshHostsAndWorkers()
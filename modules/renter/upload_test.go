@@ -2,10 +2,14 @@ package renter
 
 import (
 	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/fastrand"
 )
 
 // TestRenterUploadDirectory verifies that the renter returns an error if a
@@ -43,3 +47,85 @@ func TestRenterUploadInode(t *testing.T) {
 		t.Fatal("expected errUploadDirectory, got", err)
 	}
 }
+
+// TestTrackedFileOnDisk probes the onDisk method of trackedFile.
+func TestTrackedFileOnDisk(t *testing.T) {
+	dir := build.TempDir(modules.RenterDir, t.Name())
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, fastrand.Bytes(100), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf := trackedFile{
+		RepairPath: path,
+		Size:       fi.Size(),
+		ModTime:    fi.ModTime(),
+	}
+	if !tf.onDisk() {
+		t.Fatal("unchanged file should be on disk")
+	}
+	// Files without a repair path or metadata.
+	if (trackedFile{}).onDisk() {
+		t.Fatal("file without repair path shouldn't be on disk")
+	}
+	if !(trackedFile{RepairPath: path}).onDisk() {
+		t.Fatal("file without metadata should be on disk")
+	}
+
+	// Modify the file.
+	if err := ioutil.WriteFile(path, fastrand.Bytes(200), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if tf.onDisk() {
+		t.Fatal("modified file shouldn't be on disk")
+	}
+	// Delete the file.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if tf.onDisk() {
+		t.Fatal("deleted file shouldn't be on disk")
+	}
+}
+
+// TestUploadHeapHealthOrder checks that the upload heap returns the least
+// healthy chunks first.
+func TestUploadHeapHealthOrder(t *testing.T) {
+	uh := uploadHeap{
+		activeChunks: make(map[uploadChunkID]struct{}),
+	}
+	f := &file{staticUID: "foo"}
+	healths := []float64{0.5, 1.5, 0, 1, 0.25}
+	for i, health := range healths {
+		uh.managedPush(&unfinishedUploadChunk{
+			renterFile: f,
+			index:      uint64(i),
+			health:     health,
+		})
+	}
+	// Pushing the same chunk again should fail.
+	if uh.managedPush(&unfinishedUploadChunk{renterFile: f, index: 0}) {
+		t.Fatal("chunk shouldn't be added twice")
+	}
+
+	prev := math.Inf(1)
+	for i := 0; i < len(healths); i++ {
+		uuc := uh.managedPop()
+		if uuc == nil {
+			t.Fatal("heap is empty")
+		}
+		if uuc.health > prev {
+			t.Fatalf("chunk with health %v was popped after chunk with health %v", uuc.health, prev)
+		}
+		prev = uuc.health
+	}
+	if uh.managedPop() != nil {
+		t.Fatal("heap should be empty")
+	}
+}
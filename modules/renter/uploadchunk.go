@@ -5,11 +5,19 @@ import (
 	"os"
 	"sync"
 
-	"gitlab.com/NebulousLabs/Sia/crypto"
-
 	"gitlab.com/NebulousLabs/errors"
 )
 
+var (
+	// errLocalFileUnavailable is returned if a chunk can't be read from disk
+	// and not enough of its pieces are missing to justify downloading it.
+	errLocalFileUnavailable = errors.New("file not available locally")
+
+	// errNoRepairProgress is recorded if a repair finished without uploading
+	// any pieces.
+	errNoRepairProgress = errors.New("no pieces could be uploaded")
+)
+
 // uploadChunkID is a unique identifier for each chunk in the renter.
 type uploadChunkID struct {
 	fileUID string // Unique to each file.
@@ -20,10 +28,13 @@ type uploadChunkID struct {
 // finished uploading, including knowledge of the progress.
 type unfinishedUploadChunk struct {
 	// Information about the file. localPath may be the empty string if the file
-	// is known not to exist locally.
-	id         uploadChunkID
-	localPath  string
-	renterFile *file
+	// is known not to exist locally. sourceReader is only set for chunks of a
+	// streamed upload, in which case the logical data is read from it instead
+	// of the disk or the network.
+	id           uploadChunkID
+	localPath    string
+	renterFile   *file
+	sourceReader io.ReadCloser
 
 	// Information about the chunk, namely where it exists within the file.
 	//
@@ -38,6 +49,17 @@ type unfinishedUploadChunk struct {
 	minimumPieces  int    // number of pieces required to recover the file.
 	offset         int64  // Offset of the chunk within the file.
 	piecesNeeded   int    // number of pieces to achieve a 100% complete upload
+	remoteRepair   bool   // whether the logical data was downloaded from the network.
+
+	// health is the health of the chunk at the time it was added to the
+	// upload heap. The heap repairs the least healthy chunks first.
+	health float64
+
+	// err is the error that caused the repair of the chunk to fail before the
+	// chunk was distributed to the workers. initialPiecesCompleted is used to
+	// determine whether the repair made any progress.
+	err                    error
+	initialPiecesCompleted int
 
 	// The logical data is the data that is presented to the user when the user
 	// requests the chunk. The physical data is all of the pieces that get
@@ -122,6 +144,13 @@ func (r *Renter) managedDistributeChunkToWorkers(uc *unfinishedUploadChunk) {
 // download to the renter's downloader, and then using the data that gets
 // returned.
 func (r *Renter) managedDownloadLogicalChunkData(chunk *unfinishedUploadChunk) error {
+	// Mark the chunk as being repaired from the network. The mark is removed
+	// once the chunk is released from the set of active chunks.
+	chunk.remoteRepair = true
+	chunk.renterFile.mu.Lock()
+	chunk.renterFile.remoteRepairs++
+	chunk.renterFile.mu.Unlock()
+
 	//  Determine what the download length should be. Normally it is just the
 	//  chunk size, but if this is the last chunk we need to download less
 	//  because the file is not that large.
@@ -133,12 +162,21 @@ func (r *Renter) managedDownloadLogicalChunkData(chunk *unfinishedUploadChunk) e
 		downloadLength = chunk.renterFile.size % chunk.length
 	}
 
+	// The chunks of the pending layout of a file are downloaded from the
+	// current layout of the file.
+	source := chunk.renterFile
+	chunk.renterFile.mu.RLock()
+	if chunk.renterFile.original != nil {
+		source = chunk.renterFile.original
+	}
+	chunk.renterFile.mu.RUnlock()
+
 	// Create the download.
-	buf := NewDownloadDestinationBuffer(chunk.length)
+	buf := NewDownloadDestinationBuffer(chunk.length, chunk.renterFile.pieceSize)
 	d, err := r.managedNewDownload(downloadParams{
 		destination:     buf,
 		destinationType: "buffer",
-		file:            chunk.renterFile,
+		file:            source,
 
 		latencyTarget: 200e3, // No need to rush latency on repair downloads.
 		length:        downloadLength,
@@ -184,7 +222,7 @@ func (r *Renter) managedFetchAndRepairChunk(chunk *unfinishedUploadChunk) {
 	var pieceCompletedMemory uint64
 	for i := 0; i < len(chunk.pieceUsage); i++ {
 		if chunk.pieceUsage[i] {
-			pieceCompletedMemory += chunk.renterFile.pieceSize + crypto.TwofishOverhead
+			pieceCompletedMemory += chunk.renterFile.pieceSize + chunk.renterFile.masterKey.Overhead()
 		}
 	}
 
@@ -207,12 +245,38 @@ func (r *Renter) managedFetchAndRepairChunk(chunk *unfinishedUploadChunk) {
 		// release that as well.
 		chunk.logicalChunkData = nil
 		chunk.workersRemaining = 0
+		chunk.err = err
 		r.memoryManager.Return(erasureCodingMemory + pieceCompletedMemory)
 		chunk.memoryReleased += erasureCodingMemory + pieceCompletedMemory
 		r.log.Debugln("Fetching logical data of a chunk failed:", err)
 		return
 	}
 
+	// Reuse the pieces of identical chunks for deduplicated files. The memory
+	// of the reused pieces is released together with the memory of the
+	// completed pieces.
+	if chunk.renterFile.dedup {
+		reused, err := r.managedDeduplicateChunk(chunk)
+		if err != nil {
+			chunk.logicalChunkData = nil
+			chunk.workersRemaining = 0
+			chunk.err = err
+			r.memoryManager.Return(erasureCodingMemory + pieceCompletedMemory)
+			chunk.memoryReleased += erasureCodingMemory + pieceCompletedMemory
+			r.log.Debugln("Deduplicating a chunk failed:", err)
+			return
+		}
+		pieceCompletedMemory += uint64(reused) * (chunk.renterFile.pieceSize + chunk.renterFile.masterKey.Overhead())
+	}
+	if chunk.piecesCompleted >= chunk.piecesNeeded {
+		// All pieces are stored already, there is nothing left to upload.
+		chunk.logicalChunkData = nil
+		chunk.workersRemaining = 0
+		r.memoryManager.Return(erasureCodingMemory + pieceCompletedMemory)
+		chunk.memoryReleased += erasureCodingMemory + pieceCompletedMemory
+		return
+	}
+
 	// Create the physical pieces for the data. Immediately release the logical
 	// data.
 	//
@@ -229,6 +293,7 @@ func (r *Renter) managedFetchAndRepairChunk(chunk *unfinishedUploadChunk) {
 		// Physical data is not available, cannot upload. Chunk will not be
 		// distributed to workers, therefore set workersRemaining equal to zero.
 		chunk.workersRemaining = 0
+		chunk.err = err
 		r.memoryManager.Return(pieceCompletedMemory)
 		chunk.memoryReleased += pieceCompletedMemory
 		for i := 0; i < len(chunk.physicalChunkData); i++ {
@@ -246,12 +311,15 @@ func (r *Renter) managedFetchAndRepairChunk(chunk *unfinishedUploadChunk) {
 	}
 	// Loop through the pieces and encrypt any that are needed, while dropping
 	// any pieces that are not needed.
+	chunk.renterFile.mu.RLock()
+	chunkKey, keyIndex := chunk.renterFile.chunkKey(chunk.index)
+	chunk.renterFile.mu.RUnlock()
 	for i := 0; i < len(chunk.pieceUsage); i++ {
 		if chunk.pieceUsage[i] {
 			chunk.physicalChunkData[i] = nil
 		} else {
 			// Encrypt the piece.
-			key := deriveKey(chunk.renterFile.masterKey, chunk.index, uint64(i))
+			key := deriveKey(chunkKey, keyIndex, uint64(i))
 			chunk.physicalChunkData[i] = key.EncryptBytes(chunk.physicalChunkData[i])
 		}
 	}
@@ -271,6 +339,19 @@ func (r *Renter) managedFetchAndRepairChunk(chunk *unfinishedUploadChunk) {
 // chunk.data should be passed as 'nil' to the download, to keep memory usage as
 // light as possible.
 func (r *Renter) managedFetchLogicalChunkData(chunk *unfinishedUploadChunk) error {
+	// Streamed chunks are read from their source. The reader needs to be
+	// closed to signal the uploader that it can continue with the next chunk.
+	if chunk.sourceReader != nil {
+		defer chunk.sourceReader.Close()
+		buf := NewDownloadDestinationBuffer(chunk.length, chunk.renterFile.pieceSize)
+		_, err := buf.ReadFrom(io.LimitReader(chunk.sourceReader, int64(chunk.length)))
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return errors.Extend(err, errors.New("failed to read chunk from stream"))
+		}
+		chunk.logicalChunkData = buf
+		return nil
+	}
+
 	// Only download this file if more than 25% of the redundancy is missing.
 	numParityPieces := float64(chunk.piecesNeeded - chunk.minimumPieces)
 	minMissingPiecesToDownload := int(numParityPieces * RemoteRepairDownloadThreshold)
@@ -280,7 +361,7 @@ func (r *Renter) managedFetchLogicalChunkData(chunk *unfinishedUploadChunk) erro
 	if chunk.localPath == "" && download {
 		return r.managedDownloadLogicalChunkData(chunk)
 	} else if chunk.localPath == "" {
-		return errors.New("file not available locally")
+		return errLocalFileUnavailable
 	}
 
 	// Try to read the data from disk. If that fails at any point, prefer to
@@ -300,7 +381,7 @@ func (r *Renter) managedFetchLogicalChunkData(chunk *unfinishedUploadChunk) erro
 	// TODO: Once we have enabled support for small chunks, we should stop
 	// needing to ignore the EOF errors, because the chunk size should always
 	// match the tail end of the file. Until then, we ignore io.EOF.
-	buf := NewDownloadDestinationBuffer(chunk.length)
+	buf := NewDownloadDestinationBuffer(chunk.length, chunk.renterFile.pieceSize)
 	sr := io.NewSectionReader(osFile, chunk.offset, int64(chunk.length))
 	_, err = buf.ReadFrom(sr)
 	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF && download {
@@ -316,6 +397,39 @@ func (r *Renter) managedFetchLogicalChunkData(chunk *unfinishedUploadChunk) erro
 	return nil
 }
 
+// managedUpdateRepairFailures updates the repair failures of the chunk's file
+// after the chunk has been released. A repair attempt is considered a failure
+// if it returned an error or if not a single piece could be uploaded.
+func (uc *unfinishedUploadChunk) managedUpdateRepairFailures() {
+	uc.mu.Lock()
+	err := uc.err
+	progress := uc.piecesCompleted > uc.initialPiecesCompleted
+	uc.mu.Unlock()
+	if err == errLocalFileUnavailable {
+		// The chunk wasn't repaired on purpose, this doesn't count as an
+		// attempt.
+		return
+	}
+	if err == nil && !progress {
+		err = errNoRepairProgress
+	}
+
+	f := uc.renterFile
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.repairFailures, uc.index)
+		return
+	}
+	if f.repairFailures == nil {
+		f.repairFailures = make(map[uint64]chunkRepairFailure)
+	}
+	crf := f.repairFailures[uc.index]
+	crf.consecutive++
+	crf.lastErr = err.Error()
+	f.repairFailures[uc.index] = crf
+}
+
 // managedCleanUpUploadChunk will check the state of the chunk and perform any
 // cleanup required. This can include returning rememory and releasing the chunk
 // from the map of active chunks in the chunk heap.
@@ -336,7 +450,7 @@ func (r *Renter) managedCleanUpUploadChunk(uc *unfinishedUploadChunk) {
 		// will prefer releasing later pieces, which improves computational
 		// complexity for erasure coding.
 		if piecesAvailable >= uc.workersRemaining {
-			memoryReleased += uc.renterFile.pieceSize + crypto.TwofishOverhead
+			memoryReleased += uc.renterFile.pieceSize + uc.renterFile.masterKey.Overhead()
 			uc.physicalChunkData[i] = nil
 			// Mark this piece as taken so that we don't double release memory.
 			uc.pieceUsage[i] = true
@@ -374,6 +488,22 @@ func (r *Renter) managedCleanUpUploadChunk(uc *unfinishedUploadChunk) {
 		r.uploadHeap.mu.Lock()
 		delete(r.uploadHeap.activeChunks, uc.id)
 		r.uploadHeap.mu.Unlock()
+		if uc.remoteRepair {
+			uc.renterFile.mu.Lock()
+			uc.renterFile.remoteRepairs--
+			uc.renterFile.mu.Unlock()
+		}
+		uc.managedUpdateRepairFailures()
+
+		// The health of the file has changed. Packs don't record their
+		// members, so the directories of packed files are only bubbled
+		// when the files are added to a pack.
+		uc.renterFile.mu.RLock()
+		name, isPack := uc.renterFile.name, uc.renterFile.isPack
+		uc.renterFile.mu.RUnlock()
+		if !isPack {
+			go r.threadedBubbleMetadata(dirParent(name))
+		}
 	}
 	// Sanity check - all memory should be released if the chunk is complete.
 	if chunkComplete && totalMemoryReleased != uc.memoryNeeded {
@@ -23,7 +23,6 @@ import (
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
-	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/types"
 )
 
@@ -52,7 +51,7 @@ type uploadChunkHeap []*unfinishedUploadChunk
 // Implementation of heap.Interface for uploadChunkHeap.
 func (uch uploadChunkHeap) Len() int { return len(uch) }
 func (uch uploadChunkHeap) Less(i, j int) bool {
-	return float64(uch[i].piecesCompleted)/float64(uch[i].piecesNeeded) < float64(uch[j].piecesCompleted)/float64(uch[j].piecesNeeded)
+	return uch[i].health > uch[j].health
 }
 func (uch uploadChunkHeap) Swap(i, j int)       { uch[i], uch[j] = uch[j], uch[i] }
 func (uch *uploadChunkHeap) Push(x interface{}) { *uch = append(*uch, x.(*unfinishedUploadChunk)) }
@@ -64,8 +63,9 @@ func (uch *uploadChunkHeap) Pop() interface{} {
 	return x
 }
 
-// managedPush will add a chunk to the upload heap.
-func (uh *uploadHeap) managedPush(uuc *unfinishedUploadChunk) {
+// managedPush will add a chunk to the upload heap. It returns false if the
+// chunk is already being worked on.
+func (uh *uploadHeap) managedPush(uuc *unfinishedUploadChunk) bool {
 	// Create the unique chunk id.
 	ucid := uploadChunkID{
 		fileUID: uuc.renterFile.staticUID,
@@ -82,9 +82,10 @@ func (uh *uploadHeap) managedPush(uuc *unfinishedUploadChunk) {
 	_, exists := uh.activeChunks[ucid]
 	if !exists {
 		uh.activeChunks[ucid] = struct{}{}
-		uh.heap.Push(uuc)
+		heap.Push(&uh.heap, uuc)
 	}
 	uh.mu.Unlock()
+	return !exists
 }
 
 // managedPop will pull a chunk off of the upload heap and return it.
@@ -97,6 +98,52 @@ func (uh *uploadHeap) managedPop() (uc *unfinishedUploadChunk) {
 	return uc
 }
 
+// newUnfinishedUploadChunk creates the unfinished chunk at the given index of
+// a file. None of the pieces of the chunk are marked as completed and all of
+// the provided hosts are considered unused. The file should be locked by the
+// caller.
+func newUnfinishedUploadChunk(f *file, index uint64, localPath string, hosts map[string]struct{}) *unfinishedUploadChunk {
+	uuc := &unfinishedUploadChunk{
+		renterFile: f,
+		localPath:  localPath,
+
+		id: uploadChunkID{
+			fileUID: f.staticUID,
+			index:   index,
+		},
+
+		index:  index,
+		length: f.staticChunkSize(),
+		offset: int64(index * f.staticChunkSize()),
+
+		// memoryNeeded has to also include the logical data, and also
+		// include the overhead for encryption.
+		//
+		// TODO / NOTE: If we adjust the file to have a flexible encryption
+		// scheme, we'll need to adjust the overhead stuff too.
+		//
+		// TODO: Currently we request memory for all of the pieces as well
+		// as the minimum pieces, but we perhaps don't need to request all
+		// of that.
+		memoryNeeded:  f.pieceSize*uint64(f.erasureCode.NumPieces()+f.erasureCode.MinPieces()) + uint64(f.erasureCode.NumPieces())*f.masterKey.Overhead(),
+		minimumPieces: f.erasureCode.MinPieces(),
+		piecesNeeded:  f.erasureCode.NumPieces(),
+
+		physicalChunkData: make([][]byte, f.erasureCode.NumPieces()),
+
+		pieceUsage:  make([]bool, f.erasureCode.NumPieces()),
+		unusedHosts: make(map[string]struct{}),
+
+		// None of the pieces are completed yet.
+		health: fileHealth(0, f.erasureCode.MinPieces(), f.erasureCode.NumPieces()),
+	}
+	// Every chunk can have a different set of unused hosts.
+	for host := range hosts {
+		uuc.unusedHosts[host] = struct{}{}
+	}
+	return uuc
+}
+
 // buildUnfinishedChunks will pull all of the unfinished chunks out of a file.
 //
 // TODO / NOTE: This code can be substantially simplified once the files store
@@ -107,9 +154,15 @@ func (r *Renter) buildUnfinishedChunks(f *file, hosts map[string]struct{}) []*un
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	// If the file is not being tracked, don't repair it.
+	// Packed files are repaired through their packs.
+	if f.packName != "" {
+		return nil
+	}
+
+	// If the file is not being tracked, don't repair it. Packs are always
+	// repaired.
 	trackedFile, exists := r.persist.Tracking[f.name]
-	if !exists {
+	if !exists && !f.isPack {
 		return nil
 	}
 
@@ -118,6 +171,19 @@ func (r *Renter) buildUnfinishedChunks(f *file, hosts map[string]struct{}) []*un
 		return nil
 	}
 
+	// Only use the local file for repairs if it still matches the uploaded
+	// file. Otherwise the chunks will be repaired from the network. Packs
+	// use their buffered data as long as it is on disk.
+	localPath := trackedFile.RepairPath
+	if f.isPack {
+		localPath = r.packDataPath(f)
+		if _, err := os.Stat(localPath); err != nil {
+			localPath = ""
+		}
+	} else if !trackedFile.onDisk() {
+		localPath = ""
+	}
+
 	// Assemble the set of chunks.
 	//
 	// TODO / NOTE: Future files may have a different method for determining the
@@ -126,41 +192,7 @@ func (r *Renter) buildUnfinishedChunks(f *file, hosts map[string]struct{}) []*un
 	chunkCount := f.numChunks()
 	newUnfinishedChunks := make([]*unfinishedUploadChunk, chunkCount)
 	for i := uint64(0); i < chunkCount; i++ {
-		newUnfinishedChunks[i] = &unfinishedUploadChunk{
-			renterFile: f,
-			localPath:  trackedFile.RepairPath,
-
-			id: uploadChunkID{
-				fileUID: f.staticUID,
-				index:   i,
-			},
-
-			index:  i,
-			length: f.staticChunkSize(),
-			offset: int64(i * f.staticChunkSize()),
-
-			// memoryNeeded has to also include the logical data, and also
-			// include the overhead for encryption.
-			//
-			// TODO / NOTE: If we adjust the file to have a flexible encryption
-			// scheme, we'll need to adjust the overhead stuff too.
-			//
-			// TODO: Currently we request memory for all of the pieces as well
-			// as the minimum pieces, but we perhaps don't need to request all
-			// of that.
-			memoryNeeded:  f.pieceSize*uint64(f.erasureCode.NumPieces()+f.erasureCode.MinPieces()) + uint64(f.erasureCode.NumPieces()*crypto.TwofishOverhead),
-			minimumPieces: f.erasureCode.MinPieces(),
-			piecesNeeded:  f.erasureCode.NumPieces(),
-
-			physicalChunkData: make([][]byte, f.erasureCode.NumPieces()),
-
-			pieceUsage:  make([]bool, f.erasureCode.NumPieces()),
-			unusedHosts: make(map[string]struct{}),
-		}
-		// Every chunk can have a different set of unused hosts.
-		for host := range hosts {
-			newUnfinishedChunks[i].unusedHosts[host] = struct{}{}
-		}
+		newUnfinishedChunks[i] = newUnfinishedUploadChunk(f, i, localPath, hosts)
 	}
 
 	// Iterate through the contracts of the file and mark which hosts are
@@ -223,8 +255,11 @@ func (r *Renter) buildUnfinishedChunks(f *file, hosts map[string]struct{}) []*un
 	// completed.
 	incompleteChunks := newUnfinishedChunks[:0]
 	for i := 0; i < len(newUnfinishedChunks); i++ {
-		if newUnfinishedChunks[i].piecesCompleted < newUnfinishedChunks[i].piecesNeeded {
-			incompleteChunks = append(incompleteChunks, newUnfinishedChunks[i])
+		uuc := newUnfinishedChunks[i]
+		if uuc.piecesCompleted < uuc.piecesNeeded {
+			uuc.initialPiecesCompleted = uuc.piecesCompleted
+			uuc.health = fileHealth(float64(uuc.piecesCompleted)/float64(uuc.minimumPieces), uuc.minimumPieces, uuc.piecesNeeded)
+			incompleteChunks = append(incompleteChunks, uuc)
 		}
 	}
 	// TODO: Don't return chunks that can't be downloaded, uploaded or otherwise
@@ -240,35 +275,102 @@ func (r *Renter) managedBuildChunkHeap(hosts map[string]struct{}) {
 	id := r.mu.RLock()
 	goodForRenew := make(map[types.FileContractID]bool)
 	offline := make(map[types.FileContractID]bool)
-	for _, file := range r.files {
-		file.mu.RLock()
-		for cid := range file.contracts {
+	addContracts := func(f *file) {
+		f.mu.RLock()
+		for cid := range f.contracts {
 			resolvedID := r.hostContractor.ResolveIDToPubKey(cid)
 			cu, ok := r.hostContractor.ContractUtility(resolvedID)
 			goodForRenew[cid] = ok && cu.GoodForRenew
 			offline[cid] = r.hostContractor.IsOffline(resolvedID)
 		}
-		file.mu.RUnlock()
-
+		f.mu.RUnlock()
+	}
+	for _, file := range r.files {
+		addContracts(file)
 		unfinishedUploadChunks := r.buildUnfinishedChunks(file, hosts)
 		for i := 0; i < len(unfinishedUploadChunks); i++ {
 			r.uploadHeap.managedPush(unfinishedUploadChunks[i])
 		}
+
+		// The pending layout of a file with changed redundancy is repaired
+		// like any other file.
+		file.mu.RLock()
+		migration := file.migration
+		file.mu.RUnlock()
+		if migration == nil {
+			continue
+		}
+		addContracts(migration)
+		unfinishedUploadChunks = r.buildUnfinishedChunks(migration, hosts)
+		for i := 0; i < len(unfinishedUploadChunks); i++ {
+			r.uploadHeap.managedPush(unfinishedUploadChunks[i])
+		}
+	}
+	// Packs are repaired like any other file once they are sealed and the
+	// data of all of their files has been written.
+	var uploadedPacks []*file
+	for _, pack := range r.packs {
+		if r.packIsOpen(pack) || pack.pendingWrites > 0 {
+			continue
+		}
+		addContracts(pack)
+		unfinishedUploadChunks := r.buildUnfinishedChunks(pack, hosts)
+		for i := 0; i < len(unfinishedUploadChunks); i++ {
+			r.uploadHeap.managedPush(unfinishedUploadChunks[i])
+		}
+		pack.mu.RLock()
+		health := pack.health(offline, goodForRenew)
+		if health == 0 {
+			uploadedPacks = append(uploadedPacks, pack)
+		} else if health > unhealthyFileThreshold {
+			r.log.Printf("Pack %v is unhealthy: health %.2f, %v stuck chunks\n", pack.name, health, pack.numStuckChunks())
+		}
+		pack.mu.RUnlock()
 	}
+	migrated := make(map[*file]*file)
 	for _, file := range r.files {
 		file.mu.RLock()
+		// Check whether the pending layout of the file has been fully
+		// uploaded.
+		if m := file.migration; m != nil {
+			m.mu.RLock()
+			if m.health(offline, goodForRenew) == 0 {
+				migrated[file] = m
+			}
+			m.mu.RUnlock()
+		}
+		// The health of packed files is checked through their packs.
+		if file.packName != "" {
+			file.mu.RUnlock()
+			continue
+		}
 		// check for local file
 		tf, exists := r.persist.Tracking[file.name]
-		if exists {
-			// Check if local file is missing and redundancy is less than 1
-			// log warning to renter log
-			if _, err := os.Stat(tf.RepairPath); os.IsNotExist(err) && file.redundancy(offline, goodForRenew) < 1 {
+		if exists && tf.RepairPath != "" {
+			// Check if local file is missing or modified and redundancy is
+			// less than 1 log warning to renter log
+			if !tf.onDisk() && file.redundancy(offline, goodForRenew) < 1 {
 				r.log.Println("File not found on disk and possibly unrecoverable:", tf.RepairPath)
 			}
 		}
+		// Warn about files that are about to drop below the minimum number
+		// of pieces.
+		if health := file.health(offline, goodForRenew); health > unhealthyFileThreshold {
+			r.log.Printf("File %v is unhealthy: health %.2f, %v stuck chunks\n", file.name, health, file.numStuckChunks())
+		}
 		file.mu.RUnlock()
 	}
 	r.mu.RUnlock(id)
+
+	for f, m := range migrated {
+		r.managedFinishMigration(f, m)
+	}
+	// The buffered data of fully uploaded packs isn't needed anymore.
+	for _, pack := range uploadedPacks {
+		if err := os.Remove(r.packDataPath(pack)); err != nil && !os.IsNotExist(err) {
+			r.log.Println("WARN: couldn't remove buffered data of pack:", err)
+		}
+	}
 }
 
 // managedPrepareNextChunk takes the next chunk from the chunk heap and prepares
@@ -371,6 +473,15 @@ func (r *Renter) threadedUploadLoop() {
 			availableWorkers := len(r.workerPool)
 			r.mu.RUnlock(id)
 			if availableWorkers < nextChunk.minimumPieces {
+				// Streamed chunks can't be retried later since their data is
+				// only available once. Release the chunk and let the uploader
+				// know that it wasn't processed.
+				if nextChunk.sourceReader != nil {
+					nextChunk.sourceReader.Close()
+					r.uploadHeap.mu.Lock()
+					delete(r.uploadHeap.activeChunks, nextChunk.id)
+					r.uploadHeap.mu.Unlock()
+				}
 				continue
 			}
 
@@ -0,0 +1,199 @@
+package renter
+
+// uploadstreamer.go implements uploads from an io.Reader. The data is split
+// into chunks which are pushed one at a time onto the upload heap. A chunk is
+// only read from the stream once the repair loop fetches its logical data,
+// which means that the amount of data held in memory is bounded by the memory
+// manager, the same way as for regular uploads.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// errStreamChunkNotQueued is returned if a chunk of a streamed upload
+	// couldn't be processed by the repair loop.
+	errStreamChunkNotQueued = errors.New("unable to queue chunk of streamed upload")
+)
+
+// streamShard is a reader that wraps the stream of an upload and reads a
+// single chunk from it. Closing the shard signals the uploader that the chunk
+// has been read and that the next chunk can be queued.
+type streamShard struct {
+	n   int
+	err error
+
+	r        io.Reader
+	signal   chan struct{}
+	stopOnce sync.Once
+}
+
+// newStreamShard creates a shard that reads from r.
+func newStreamShard(r io.Reader) *streamShard {
+	return &streamShard{
+		r:      r,
+		signal: make(chan struct{}),
+	}
+}
+
+// Close implements io.Closer. It is safe to call Close multiple times.
+func (ss *streamShard) Close() error {
+	ss.stopOnce.Do(func() {
+		close(ss.signal)
+	})
+	return nil
+}
+
+// Read implements io.Reader. It keeps track of the number of bytes read and
+// the last error that occurred.
+func (ss *streamShard) Read(b []byte) (int, error) {
+	n, err := ss.r.Read(b)
+	ss.n += n
+	if err != nil && err != io.EOF {
+		ss.err = err
+	}
+	return n, err
+}
+
+// UploadStreamFromReader reads from the provided reader until io.EOF is reached
+// and uploads the data to the Sia network. The file is not tracked with a
+// local path, so any repairs will be performed by downloading the file from
+// the network.
+func (r *Renter) UploadStreamFromReader(up modules.FileUploadParams, reader io.Reader) error {
+	// Enforce nickname rules.
+	if err := validateSiapath(up.SiaPath); err != nil {
+		return err
+	}
+
+	// Check for a nickname conflict.
+	lockID := r.mu.RLock()
+	_, exists := r.files[up.SiaPath]
+	r.mu.RUnlock(lockID)
+	if exists {
+		return ErrPathOverload
+	}
+	if r.dirExists(up.SiaPath) {
+		return ErrDirExists
+	}
+
+	// Fill in any missing upload params with sensible defaults.
+	if up.ErasureCode == nil {
+		up.ErasureCode, _ = NewRSCode(defaultDataPieces, defaultParityPieces)
+	}
+	if up.CipherType == "" {
+		up.CipherType = defaultCipherType
+	}
+	masterKey, err := crypto.GenerateCipherKey(up.CipherType)
+	if err != nil {
+		return err
+	}
+
+	// Check that we have contracts to upload to. See Upload for details.
+	numContracts := len(r.hostContractor.Contracts())
+	requiredContracts := (up.ErasureCode.NumPieces() + up.ErasureCode.MinPieces()) / 2
+	if numContracts < requiredContracts && build.Release != "testing" {
+		return fmt.Errorf("not enough contracts to upload file: got %v, needed %v", numContracts, requiredContracts)
+	}
+
+	// Create an empty file object. The size of the file grows as the stream is
+	// read. The file is tracked without a repair path, so the repair loop will
+	// download it from the network if necessary.
+	f := newFile(up.SiaPath, up.ErasureCode, masterKey, 0)
+	f.mode = defaultFilePerm
+	f.dedup = up.Dedup
+
+	// Add file to renter.
+	lockID = r.mu.Lock()
+	r.files[up.SiaPath] = f
+	r.persist.Tracking[up.SiaPath] = trackedFile{
+		RepairPath: "",
+	}
+	r.saveSync()
+	err = r.saveFile(f)
+	r.mu.Unlock(lockID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		go r.threadedBubbleMetadata(dirParent(up.SiaPath))
+	}()
+
+	// Queue the chunks one at a time. A chunk is only created if there is
+	// more data left in the stream, to avoid uploading an empty chunk at the
+	// end of the file.
+	br := bufio.NewReader(reader)
+	chunkSize := f.staticChunkSize()
+	for index := uint64(0); ; index++ {
+		if _, err := br.Peek(1); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		// Queue the chunk before growing the file to include it. Otherwise
+		// the repair loop might pick up the chunk without its source.
+		hosts := r.managedRefreshHostsAndWorkers()
+		f.mu.RLock()
+		chunk := newUnfinishedUploadChunk(f, index, "", hosts)
+		f.mu.RUnlock()
+		ss := newStreamShard(br)
+		chunk.sourceReader = ss
+		if !r.uploadHeap.managedPush(chunk) {
+			return r.managedSetStreamSize(f, index*chunkSize, errStreamChunkNotQueued)
+		}
+		f.mu.Lock()
+		f.size = (index + 1) * chunkSize
+		f.mu.Unlock()
+		select {
+		case r.uploadHeap.newUploads <- struct{}{}:
+		default:
+		}
+
+		// Wait for the chunk to be read from the stream.
+		select {
+		case <-ss.signal:
+		case <-r.tg.StopChan():
+			return r.managedSetStreamSize(f, index*chunkSize, errors.New("upload interrupted by shutdown"))
+		}
+		if ss.err != nil {
+			// The data that was read before the error is still uploaded.
+			return r.managedSetStreamSize(f, index*chunkSize+uint64(ss.n), ss.err)
+		}
+		if ss.n == 0 {
+			// The chunk was released without being read.
+			return r.managedSetStreamSize(f, index*chunkSize, errStreamChunkNotQueued)
+		}
+		if err := r.managedSetStreamSize(f, index*chunkSize+uint64(ss.n), nil); err != nil {
+			return err
+		}
+		if uint64(ss.n) < chunkSize {
+			break
+		}
+	}
+	return nil
+}
+
+// managedSetStreamSize updates the size of a file that is being uploaded from
+// a stream and saves it. The provided error is returned, extended by any error
+// that occurred while saving the file.
+func (r *Renter) managedSetStreamSize(f *file, size uint64, err error) error {
+	f.mu.Lock()
+	f.size = size
+	f.mu.Unlock()
+
+	id := r.mu.Lock()
+	saveErr := r.saveFile(f)
+	r.mu.Unlock(id)
+	if saveErr != nil {
+		return build.ComposeErrors(err, saveErr)
+	}
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/contractor"
 	"gitlab.com/NebulousLabs/Sia/types"
 )
 
@@ -27,6 +28,12 @@ type worker struct {
 	hostPubKey types.SiaPublicKey
 	renter     *Renter
 
+	// The session with the host, which is used for both uploads and
+	// downloads. It is only accessed by the master thread for the worker. The
+	// session is opened when it is first needed, and closed when the worker
+	// is killed or an operation fails.
+	ownedSession contractor.Session
+
 	// Download variables that are not protected by a mutex, but also do not
 	// need to be protected by a mutex, as they are only accessed by the master
 	// thread for the worker.
@@ -98,6 +105,28 @@ func (r *Renter) managedUpdateWorkerPool() {
 	r.mu.Unlock(lockID)
 }
 
+// ownedOpenSession returns the worker's session with its host, opening a new
+// session if the worker doesn't have one.
+func (w *worker) ownedOpenSession() (contractor.Session, error) {
+	if w.ownedSession == nil {
+		s, err := w.renter.hostContractor.Session(w.hostPubKey, w.renter.tg.StopChan())
+		if err != nil {
+			return nil, err
+		}
+		w.ownedSession = s
+	}
+	return w.ownedSession, nil
+}
+
+// ownedCloseSession closes the worker's session with its host. The next
+// operation of the worker opens a new session.
+func (w *worker) ownedCloseSession() {
+	if w.ownedSession != nil {
+		w.ownedSession.Close()
+		w.ownedSession = nil
+	}
+}
+
 // threadedWorkLoop repeatedly issues work to a worker, stopping when the worker
 // is killed or when the thread group is closed.
 func (w *worker) threadedWorkLoop() {
@@ -108,6 +137,7 @@ func (w *worker) threadedWorkLoop() {
 	defer w.renter.tg.Done()
 	defer w.managedKillUploading()
 	defer w.managedKillDownloading()
+	defer w.ownedCloseSession()
 
 	for {
 		// Perform one stpe of processing download work.
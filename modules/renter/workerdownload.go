@@ -7,6 +7,9 @@ package renter
 import (
 	"sync/atomic"
 	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/contractor"
 )
 
 // managedDownload will perform some download work.
@@ -25,56 +28,143 @@ func (w *worker) managedDownload(udc *unfinishedDownloadChunk) {
 	// whether successful or failed, the worker needs to be removed.
 	defer udc.managedRemoveWorker()
 
-	// Fetch the sector. If fetching the sector fails, the worker needs to be
-	// unregistered with the chunk.
-	d, err := w.renter.hostContractor.Downloader(w.contract.HostPublicKey, w.renter.tg.StopChan())
+	// Fetch the piece. If the chunk only needs the part of the piece that
+	// contains the fetched range, and the piece can be decrypted in parts,
+	// only that part is fetched. If fetching the piece fails, the worker needs
+	// to be unregistered with the chunk.
+	s, err := w.ownedOpenSession()
 	if err != nil {
-		w.renter.log.Debugln("worker failed to create downloader:", err)
+		w.renter.log.Debugln("worker failed to acquire a session:", err)
 		udc.managedUnregisterWorker(w)
 		return
 	}
-	defer d.Close()
-	pieceData, err := d.Sector(udc.staticChunkMap[string(w.contract.HostPublicKey.Key)].root)
+	pieceInfo := udc.staticChunkMap[string(w.contract.HostPublicKey.Key)]
+	pieceIndex := pieceInfo.index
+	key := deriveKey(udc.chunkKey, udc.keyIndex, pieceIndex)
+	rd, canDecryptRange := key.(crypto.RangeDecrypter)
+	udc.mu.Lock()
+	partial := canDecryptRange && udc.rangePieces != nil && udc.wantsPiece(pieceIndex)
+	udc.mu.Unlock()
+
+	start := time.Now()
+	var pieceData, decryptedPiece []byte
+	var fetched uint64
+	if partial {
+		decryptedPiece, fetched, err = udc.fetchPieceRange(s, pieceInfo, rd)
+	} else {
+		pieceData, err = s.Sector(pieceInfo.root)
+		fetched = uint64(len(pieceData))
+	}
 	if err != nil {
 		w.renter.log.Debugln("worker failed to download sector:", err)
+		w.ownedCloseSession()
 		udc.managedUnregisterWorker(w)
 		return
 	}
+	w.renter.hostDB.RecordDownloadThroughput(w.contract.HostPublicKey, fetched, time.Since(start))
 	// TODO: Instead of adding the whole sector after the download completes,
-	// have the 'd.Sector' call add to this value ongoing as the sector comes
+	// have the 's.Sector' call add to this value ongoing as the sector comes
 	// in. Perhaps even include the data from creating the downloader and other
 	// data sent to and received from the host (like signatures) that aren't
 	// actually payload data.
-	atomic.AddUint64(&udc.download.atomicTotalDataTransferred, udc.staticPieceSize)
+	atomic.AddUint64(&udc.download.atomicTotalDataTransferred, fetched)
 
 	// Decrypt the piece. This might introduce some overhead for downloads with
 	// a large overdrive. It shouldn't be a bottleneck though since bandwidth
 	// is usually a lot more scarce than CPU processing power.
-	pieceIndex := udc.staticChunkMap[string(w.contract.HostPublicKey.Key)].index
-	key := deriveKey(udc.masterKey, udc.staticChunkIndex, pieceIndex)
-	decryptedPiece, err := key.DecryptBytesInPlace(pieceData)
-	if err != nil {
-		w.renter.log.Debugln("worker failed to decrypt piece:", err)
-		udc.managedUnregisterWorker(w)
-		return
+	if !partial {
+		decryptedPiece, err = key.DecryptBytesInPlace(pieceData)
+		if err != nil {
+			w.renter.log.Debugln("worker failed to decrypt piece:", err)
+			udc.managedUnregisterWorker(w)
+			return
+		}
 	}
 
 	// Mark the piece as completed. Perform chunk recovery if we newly have
 	// enough pieces to do so. Chunk recovery is an expensive operation that
 	// should be performed in a separate thread as to not block the worker.
 	udc.mu.Lock()
+	if udc.failed {
+		// The chunk failed or the download was cancelled while the piece was
+		// being fetched, the piece is no longer needed.
+		udc.piecesRegistered--
+		udc.mu.Unlock()
+		return
+	}
+	if partial && udc.rangePieces == nil {
+		// The chunk fell back to recovering the chunk from any MinPieces
+		// pieces while the part of the piece was being fetched, so it can't
+		// be used.
+		udc.piecesRegistered--
+		udc.pieceUsage[pieceIndex] = false
+		udc.mu.Unlock()
+		return
+	}
+	wasComplete := udc.complete()
 	udc.piecesCompleted++
 	udc.piecesRegistered--
-	if udc.piecesCompleted <= udc.erasureCode.MinPieces() {
-		atomic.AddUint64(&udc.download.atomicDataReceived, udc.staticFetchLength/uint64(udc.erasureCode.MinPieces()))
+	if !wasComplete {
+		atomic.AddUint64(&udc.download.atomicDataReceived, udc.staticFetchLength/uint64(udc.piecesNeeded()))
 		udc.physicalChunkData[pieceIndex] = decryptedPiece
+		udc.partialPieces[pieceIndex] = partial
 	}
-	if udc.piecesCompleted == udc.erasureCode.MinPieces() {
+	if !wasComplete && udc.complete() {
 		go udc.threadedRecoverLogicalData()
 	}
 	udc.mu.Unlock()
 }
 
+// fetchPieceRange downloads and decrypts the part of a data piece that
+// contains the fetched range of the chunk. The decrypted piece has the full
+// piece size, but only the bytes of the fetched range are set. The number of
+// bytes that were downloaded from the host is returned as well.
+//
+// The authentication tag of the piece is not downloaded. The part of the
+// piece is authenticated by the Merkle range proof that PartialSector checks
+// against the root of the sector.
+func (udc *unfinishedDownloadChunk) fetchPieceRange(s contractor.Session, pd downloadPieceInfo, key crypto.RangeDecrypter) (piece []byte, fetched uint64, err error) {
+	// Determine the range within the piece.
+	pieceStart := pd.index * udc.staticPieceSize
+	start, end := udc.staticFetchOffset, udc.staticFetchOffset+udc.staticFetchLength
+	if start < pieceStart {
+		start = pieceStart
+	}
+	if pieceEnd := pieceStart + udc.staticPieceSize; end > pieceEnd {
+		end = pieceEnd
+	}
+	start, end = start-pieceStart, end-pieceStart
+
+	// The nonce precedes the ciphertext in the sector. If the range starts
+	// within the first segment of the piece, the nonce is downloaded along
+	// with it.
+	nonceSize := key.NonceSize()
+	var nonce, ct []byte
+	if start < crypto.SegmentSize {
+		data, err := s.PartialSector(pd.root, 0, nonceSize+end)
+		if err != nil {
+			return nil, 0, err
+		}
+		nonce, ct = data[:nonceSize], data[nonceSize+start:]
+	} else {
+		nonce, err = s.PartialSector(pd.root, 0, nonceSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		ct, err = s.PartialSector(pd.root, nonceSize+start, end-start)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	plaintext, err := key.DecryptRange(nonce, ct, start)
+	if err != nil {
+		return nil, 0, err
+	}
+	piece = make([]byte, udc.staticPieceSize)
+	copy(piece[start:], plaintext)
+	return piece, uint64(len(nonce) + len(ct)), nil
+}
+
 // managedKillDownloading will drop all of the download work given to the
 // worker, and set a signal to prevent the worker from accepting more download
 // work.
@@ -139,8 +229,14 @@ func (w *worker) managedQueueDownloadChunk(udc *unfinishedDownloadChunk) {
 // only be called when a worker download fails.
 func (udc *unfinishedDownloadChunk) managedUnregisterWorker(w *worker) {
 	udc.mu.Lock()
+	index := udc.staticChunkMap[string(w.contract.HostPublicKey.Key)].index
 	udc.piecesRegistered--
-	udc.pieceUsage[udc.staticChunkMap[string(w.contract.HostPublicKey.Key)].index] = false
+	udc.pieceUsage[index] = false
+	// If one of the data pieces of the fetched range can't be downloaded,
+	// fall back to recovering the chunk from any MinPieces pieces.
+	if udc.rangePieces != nil && udc.wantsPiece(index) {
+		udc.abandonRangePieces()
+	}
 	udc.mu.Unlock()
 }
 
@@ -165,11 +261,17 @@ func (w *worker) ownedProcessDownloadChunk(udc *unfinishedDownloadChunk) *unfini
 	// worker and return nil. Worker only needs to be removed if worker is being
 	// dropped.
 	udc.mu.Lock()
-	chunkComplete := udc.piecesCompleted >= udc.erasureCode.MinPieces()
-	chunkFailed := udc.piecesCompleted+udc.workersRemaining < udc.erasureCode.MinPieces()
+	chunkComplete := udc.complete()
+	chunkFailed := udc.failed || udc.piecesCompleted+udc.workersRemaining < udc.erasureCode.MinPieces()
 	pieceData, workerHasPiece := udc.staticChunkMap[string(w.contract.HostPublicKey.Key)]
 	pieceTaken := udc.pieceUsage[pieceData.index]
 	if chunkComplete || chunkFailed || w.ownedOnDownloadCooldown() || !workerHasPiece || pieceTaken {
+		// If the worker was supposed to fetch one of the data pieces of the
+		// fetched range, fall back to recovering the chunk from any
+		// MinPieces pieces.
+		if !chunkComplete && workerHasPiece && !pieceTaken && udc.rangePieces != nil && udc.wantsPiece(pieceData.index) {
+			udc.abandonRangePieces()
+		}
 		udc.mu.Unlock()
 		udc.managedRemoveWorker()
 		return nil
@@ -215,9 +317,12 @@ func (w *worker) ownedProcessDownloadChunk(udc *unfinishedDownloadChunk) *unfini
 	// number of overdrive workers (typically zero). For our purposes, completed
 	// pieces count as active workers, though the workers have actually
 	// finished.
+	//
+	// If only some data pieces are needed to recover the fetched range, workers
+	// with other pieces are put on standby.
 	piecesInProgress := udc.piecesRegistered + udc.piecesCompleted
-	desiredPiecesInProgress := udc.erasureCode.MinPieces() + udc.staticOverdrive
-	workersDesired := piecesInProgress < desiredPiecesInProgress
+	desiredPiecesInProgress := udc.piecesNeeded() + udc.staticOverdrive
+	workersDesired := piecesInProgress < desiredPiecesInProgress && udc.wantsPiece(pieceData.index)
 
 	if workersDesired && meetsExtraCriteria {
 		// Worker can be useful. Register the worker and return the chunk for
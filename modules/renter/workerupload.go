@@ -4,6 +4,9 @@ import (
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
 )
 
 // managedDropChunk will remove a worker from the responsibility of tracking a chunk.
@@ -95,32 +98,65 @@ func (w *worker) managedQueueUploadChunk(uc *unfinishedUploadChunk) {
 	}
 }
 
-// managedUpload will perform some upload work.
+// managedUpload will perform some upload work. Other pieces that are queued
+// for the worker are uploaded in the same batch, so that they share revisions
+// with the host.
 func (w *worker) managedUpload(uc *unfinishedUploadChunk, pieceIndex uint64) {
-	// Open an editing connection to the host.
-	e, err := w.renter.hostContractor.Editor(w.contract.HostPublicKey, w.renter.tg.StopChan())
+	// Get the session with the host.
+	s, err := w.ownedOpenSession()
 	if err != nil {
-		w.renter.log.Debugln("Worker failed to acquire an editor:", err)
-		w.managedUploadFailed(uc, pieceIndex)
+		w.renter.log.Debugln("Worker failed to acquire a session:", err)
+		w.managedUploadFailed([]*unfinishedUploadChunk{uc}, []uint64{pieceIndex})
 		return
 	}
-	defer e.Close()
+
+	// Fill the batch with the next chunks of the queue.
+	chunks := []*unfinishedUploadChunk{uc}
+	pieceIndices := []uint64{pieceIndex}
+	for len(chunks) < maxUploadBatchPieces {
+		nextChunk, nextPieceIndex := w.managedNextUploadChunk()
+		if nextChunk == nil {
+			break
+		}
+		chunks = append(chunks, nextChunk)
+		pieceIndices = append(pieceIndices, nextPieceIndex)
+	}
+	pieces := make([][]byte, len(chunks))
+	var batchSize uint64
+	for i := range chunks {
+		pieces[i] = chunks[i].physicalChunkData[pieceIndices[i]]
+		batchSize += uint64(len(pieces[i]))
+	}
 
 	// Perform the upload, and update the failure stats based on the success of
-	// the upload attempt.
-	root, err := e.Upload(uc.physicalChunkData[pieceIndex])
-	if err != nil {
-		w.renter.log.Debugln("Worker failed to upload via the editor:", err)
-		w.managedUploadFailed(uc, pieceIndex)
-		return
+	// the upload attempt. The duration of successful uploads is recorded in
+	// the hostdb. If the upload fails partway, the pieces that were uploaded
+	// are still registered.
+	start := time.Now()
+	roots, err := s.UploadBatch(pieces)
+	if err == nil {
+		w.renter.hostDB.RecordUploadThroughput(w.contract.HostPublicKey, batchSize, time.Since(start))
+		w.mu.Lock()
+		w.uploadConsecutiveFailures = 0
+		w.mu.Unlock()
 	}
-	w.mu.Lock()
-	w.uploadConsecutiveFailures = 0
-	w.mu.Unlock()
 
 	// Update the renter metadata.
-	addr := e.Address()
-	endHeight := e.EndHeight()
+	addr := s.Address()
+	endHeight := s.EndHeight()
+	for i, root := range roots {
+		w.managedUploadCompleted(chunks[i], pieceIndices[i], root, addr, endHeight)
+	}
+	if err != nil {
+		w.renter.log.Debugln("Worker failed to upload via the session:", err)
+		w.ownedCloseSession()
+		w.managedUploadFailed(chunks[len(roots):], pieceIndices[len(roots):])
+	}
+}
+
+// managedUploadCompleted registers a piece that was uploaded to the worker's
+// host in the file of the chunk, and updates the state of the chunk.
+func (w *worker) managedUploadCompleted(uc *unfinishedUploadChunk, pieceIndex uint64, root crypto.Hash, addr modules.NetAddress, endHeight types.BlockHeight) {
 	id := w.renter.mu.Lock()
 	uc.renterFile.mu.Lock()
 	contract, exists := uc.renterFile.contracts[w.contract.ID]
@@ -220,9 +256,9 @@ func (w *worker) managedProcessUploadChunk(uc *unfinishedUploadChunk) (nextChunk
 	return uc, uint64(index)
 }
 
-// managedUploadFailed is called if a worker failed to upload part of an unfinished
-// chunk.
-func (w *worker) managedUploadFailed(uc *unfinishedUploadChunk, pieceIndex uint64) {
+// managedUploadFailed is called if a worker failed to upload pieces of
+// unfinished chunks.
+func (w *worker) managedUploadFailed(chunks []*unfinishedUploadChunk, pieceIndices []uint64) {
 	// Mark the failure in the worker if the gateway says we are online. It's
 	// not the worker's fault if we are offline.
 	if w.renter.g.Online() {
@@ -232,15 +268,17 @@ func (w *worker) managedUploadFailed(uc *unfinishedUploadChunk, pieceIndex uint6
 		w.mu.Unlock()
 	}
 
-	// Unregister the piece from the chunk and hunt for a replacement.
-	uc.mu.Lock()
-	uc.piecesRegistered--
-	uc.pieceUsage[pieceIndex] = false
-	uc.mu.Unlock()
+	for i, uc := range chunks {
+		// Unregister the piece from the chunk and hunt for a replacement.
+		uc.mu.Lock()
+		uc.piecesRegistered--
+		uc.pieceUsage[pieceIndices[i]] = false
+		uc.mu.Unlock()
 
-	// Notify the standby workers of the chunk
-	uc.managedNotifyStandbyWorkers()
-	w.renter.managedCleanUpUploadChunk(uc)
+		// Notify the standby workers of the chunk
+		uc.managedNotifyStandbyWorkers()
+		w.renter.managedCleanUpUploadChunk(uc)
+	}
 
 	// Because the worker is now on cooldown, drop all remaining chunks.
 	w.managedDropUploadChunks()
@@ -9,6 +9,7 @@ import (
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/types"
 	"gitlab.com/NebulousLabs/fastrand"
 )
 
@@ -225,3 +226,49 @@ func BenchmarkSliceCryptoHashSave(b *testing.B) {
 		}
 	}
 }
+
+// TestAllowanceCheckPriceGouging checks that hosts whose prices exceed the
+// maximum prices of an allowance are detected.
+func TestAllowanceCheckPriceGouging(t *testing.T) {
+	hes := HostExternalSettings{
+		StoragePrice:           types.NewCurrency64(100),
+		UploadBandwidthPrice:   types.NewCurrency64(100),
+		DownloadBandwidthPrice: types.NewCurrency64(100),
+		ContractPrice:          types.NewCurrency64(100),
+		Collateral:             types.NewCurrency64(200),
+	}
+
+	// An allowance without maximum prices accepts any host.
+	var a Allowance
+	if err := a.CheckPriceGouging(hes); err != nil {
+		t.Fatal(err)
+	}
+
+	// Prices equal to the maximum prices are accepted.
+	a = Allowance{
+		MaxStoragePrice:           types.NewCurrency64(100),
+		MaxUploadBandwidthPrice:   types.NewCurrency64(100),
+		MaxDownloadBandwidthPrice: types.NewCurrency64(100),
+		MaxContractPrice:          types.NewCurrency64(100),
+		MinCollateralRatio:        2,
+	}
+	if err := a.CheckPriceGouging(hes); err != nil {
+		t.Fatal(err)
+	}
+
+	// Exceeding any of the limits is price gouging.
+	gouging := []func(*HostExternalSettings){
+		func(hes *HostExternalSettings) { hes.StoragePrice = types.NewCurrency64(101) },
+		func(hes *HostExternalSettings) { hes.UploadBandwidthPrice = types.NewCurrency64(101) },
+		func(hes *HostExternalSettings) { hes.DownloadBandwidthPrice = types.NewCurrency64(101) },
+		func(hes *HostExternalSettings) { hes.ContractPrice = types.NewCurrency64(101) },
+		func(hes *HostExternalSettings) { hes.Collateral = types.NewCurrency64(199) },
+	}
+	for i, f := range gouging {
+		h := hes
+		f(&h)
+		if err := a.CheckPriceGouging(h); err == nil {
+			t.Errorf("price gouging %v wasn't detected", i)
+		}
+	}
+}
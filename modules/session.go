@@ -0,0 +1,300 @@
+package modules
+
+// session.go defines the session RPC. A session allows the renter to send a
+// sequence of requests to the host over a single connection. The session
+// starts with a key exchange, which is authenticated by the host's signature,
+// and all following messages are encrypted with the shared secret of the key
+// exchange. The nonce of every message is a counter, and the first byte of the
+// nonce indicates the direction of the message, so messages that are
+// replayed, reordered or reflected back to their sender fail to decrypt.
+// Within a session, the renter first locks a contract and can then
+// download and upload data using that contract.
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// NegotiateMaxSessionKeyExchangeSize is the maximum size of an encoded
+	// SessionKeyExchangeRequest.
+	NegotiateMaxSessionKeyExchangeSize = 1e3
+
+	// NegotiateMaxSessionRequestSize is the maximum size of a session request,
+	// not including the data of revision actions.
+	NegotiateMaxSessionRequestSize = NegotiateMaxDownloadActionRequestSize + NegotiateMaxFileContractRevisionSize + NegotiateMaxTransactionSignatureSize
+
+	// SessionChallengeSize is the size of the challenge that the renter signs
+	// to prove that it owns the contract it wants to lock.
+	SessionChallengeSize = 16
+
+	// SessionVersion is the first host version that supports RPCSession.
+	// Older hosts are contacted using the RPCs of editors and downloaders.
+	SessionVersion = "1.3.4"
+)
+
+var (
+	// ErrSessionNoCipher is returned if the host and the renter don't support
+	// a common cipher for the session.
+	ErrSessionNoCipher = errors.New("no supported session cipher")
+
+	// RPCSession is the specifier for starting a session with a host.
+	RPCSession = types.Specifier{'S', 'e', 's', 's', 'i', 'o', 'n'}
+
+	// RPCSessionLock is the specifier for locking a contract within a
+	// session. The host sends the most recent revision of the contract.
+	RPCSessionLock = types.Specifier{'S', 'e', 's', 's', 'i', 'o', 'n', 'L', 'o', 'c', 'k'}
+
+	// RPCSessionRead is the specifier for downloading data within a session.
+	RPCSessionRead = types.Specifier{'S', 'e', 's', 's', 'i', 'o', 'n', 'R', 'e', 'a', 'd'}
+
+	// RPCSessionSettings is the specifier for requesting the settings of the
+	// host within a session.
+	RPCSessionSettings = types.Specifier{'S', 'e', 's', 's', 'i', 'o', 'n', 'S', 'e', 't', 't', 'i', 'n', 'g', 's'}
+
+	// RPCSessionStop is the specifier for ending a session.
+	RPCSessionStop = types.Specifier{'S', 'e', 's', 's', 'i', 'o', 'n', 'S', 't', 'o', 'p'}
+
+	// RPCSessionUnlock is the specifier for unlocking the contract that was
+	// locked within a session.
+	RPCSessionUnlock = types.Specifier{'S', 'e', 's', 's', 'i', 'o', 'n', 'U', 'n', 'l', 'o', 'c', 'k'}
+
+	// RPCSessionWrite is the specifier for revising the sectors of a contract
+	// within a session.
+	RPCSessionWrite = types.Specifier{'S', 'e', 's', 's', 'i', 'o', 'n', 'W', 'r', 'i', 't', 'e'}
+
+	// SessionCipherChaCha20Poly1305 is the specifier of the ChaCha20-Poly1305
+	// AEAD, which is used to encrypt the messages of a session.
+	SessionCipherChaCha20Poly1305 = types.Specifier{'C', 'h', 'a', 'C', 'h', 'a', '2', '0', 'P', 'o', 'l', 'y', '1', '3', '0', '5'}
+)
+
+type (
+	// SessionKeyExchangeRequest is sent by the renter to start a session. It
+	// contains the renter's ephemeral public key and the ciphers that the
+	// renter supports.
+	SessionKeyExchangeRequest struct {
+		PublicKey crypto.X25519PublicKey
+		Ciphers   []types.Specifier
+	}
+
+	// SessionKeyExchangeResponse is the host's response to a
+	// SessionKeyExchangeRequest. It contains the host's ephemeral public key,
+	// the chosen cipher, and the challenge for locking contracts. The
+	// signature of the host covers both public keys, the challenge and the
+	// cipher, which prevents a man in the middle from taking over the
+	// session.
+	SessionKeyExchangeResponse struct {
+		PublicKey crypto.X25519PublicKey
+		Challenge [SessionChallengeSize]byte
+		Cipher    types.Specifier
+		Signature crypto.Signature
+	}
+
+	// SessionLockRequest requests a lock on a contract. The signature proves
+	// that the renter owns the contract; it signs the challenge of the
+	// session using the renter's key of the contract.
+	SessionLockRequest struct {
+		ContractID types.FileContractID
+		Signature  crypto.Signature
+	}
+
+	// SessionLockResponse contains the most recent revision of the locked
+	// contract and its signatures.
+	SessionLockResponse struct {
+		Revision   types.FileContractRevision
+		Signatures []types.TransactionSignature
+	}
+
+	// SessionReadRequest requests data from the host. It contains the
+	// sections to download, and the revision that pays for them, signed by
+	// the renter. The offset and length of each section must be multiples of
+	// crypto.SegmentSize, so that the host can prove that the data is part of
+	// the sector.
+	SessionReadRequest struct {
+		Sections  []DownloadAction
+		Revision  types.FileContractRevision
+		Signature types.TransactionSignature
+	}
+
+	// SessionReadResponse contains the host's signature of the payment
+	// revision and the requested data. For every section, the response
+	// contains a Merkle range proof of the data, which can be verified using
+	// the Merkle root of the sector.
+	SessionReadResponse struct {
+		Signature    types.TransactionSignature
+		Data         [][]byte
+		MerkleProofs [][]crypto.Hash
+	}
+
+	// SessionWriteRequest requests modifications of the sectors of a
+	// contract. It contains the revision actions, and the revision that pays
+	// for them, signed by the renter.
+	SessionWriteRequest struct {
+		Actions   []RevisionAction
+		Revision  types.FileContractRevision
+		Signature types.TransactionSignature
+	}
+
+	// SessionWriteResponse contains the host's signature of the revision.
+	SessionWriteResponse struct {
+		Signature types.TransactionSignature
+	}
+)
+
+// A SessionCipher encrypts the messages that one party of a session sends and
+// decrypts the messages it receives. It keeps a separate nonce for each
+// direction, which is incremented after every message. A SessionCipher is not
+// safe for concurrent use.
+type SessionCipher struct {
+	aead       cipher.AEAD
+	readNonce  []byte
+	writeNonce []byte
+}
+
+// NewSessionCipher returns a SessionCipher that uses aead. The host flag must
+// be set on the host's side of the session and unset on the renter's side.
+func NewSessionCipher(aead cipher.AEAD, host bool) *SessionCipher {
+	renterNonce := make([]byte, aead.NonceSize())
+	hostNonce := make([]byte, aead.NonceSize())
+	hostNonce[0] = 1
+	if host {
+		return &SessionCipher{aead: aead, readNonce: renterNonce, writeNonce: hostNonce}
+	}
+	return &SessionCipher{aead: aead, readNonce: hostNonce, writeNonce: renterNonce}
+}
+
+// incrementNonce increments the counter of a nonce.
+func incrementNonce(nonce []byte) {
+	counter := nonce[len(nonce)-8:]
+	binary.LittleEndian.PutUint64(counter, binary.LittleEndian.Uint64(counter)+1)
+}
+
+// Overhead returns the difference between the length of a ciphertext and the
+// length of its plaintext.
+func (c *SessionCipher) Overhead() uint64 {
+	return uint64(c.aead.Overhead())
+}
+
+// Seal encrypts the next message that is sent to the other party.
+func (c *SessionCipher) Seal(plaintext []byte) []byte {
+	ct := c.aead.Seal(nil, c.writeNonce, plaintext, nil)
+	incrementNonce(c.writeNonce)
+	return ct
+}
+
+// Open decrypts the next message that was received from the other party. The
+// ciphertext is overwritten. Opening fails if the message was not the next
+// message sent by the other party.
+func (c *SessionCipher) Open(ct []byte) ([]byte, error) {
+	plaintext, err := c.aead.Open(ct[:0], c.readNonce, ct, nil)
+	if err != nil {
+		return nil, err
+	}
+	incrementNonce(c.readNonce)
+	return plaintext, nil
+}
+
+// SigHash returns the hash of the key exchange that is signed by the host.
+func (resp SessionKeyExchangeResponse) SigHash(req SessionKeyExchangeRequest) crypto.Hash {
+	return crypto.HashAll(req.PublicKey, resp.PublicKey, resp.Challenge, resp.Cipher)
+}
+
+// SessionChallengeHash returns the hash that the renter signs to lock a
+// contract within a session.
+func SessionChallengeHash(challenge [SessionChallengeSize]byte) crypto.Hash {
+	return crypto.HashAll(RPCSession, challenge)
+}
+
+// ReadSessionMessage reads an encrypted message from r (usually a net.Conn)
+// and decodes it into obj. maxLen is the maximum length of the decrypted
+// message.
+func ReadSessionMessage(r io.Reader, sc *SessionCipher, obj interface{}, maxLen uint64) error {
+	ct, err := encoding.ReadPrefixedBytes(r, maxLen+sc.Overhead())
+	if err != nil {
+		return err
+	}
+	plaintext, err := sc.Open(ct)
+	if err != nil {
+		return err
+	}
+	return encoding.Unmarshal(plaintext, obj)
+}
+
+// WriteSessionMessage encodes obj, encrypts it and writes it to w (usually a
+// net.Conn).
+func WriteSessionMessage(w io.Writer, sc *SessionCipher, obj interface{}) error {
+	return encoding.WritePrefixedBytes(w, sc.Seal(encoding.Marshal(obj)))
+}
+
+// WriteSessionRequest writes the specifier of a session request to w,
+// followed by the request itself. Requests without any arguments are sent
+// with a nil req.
+func WriteSessionRequest(w io.Writer, sc *SessionCipher, id types.Specifier, req interface{}) error {
+	if err := WriteSessionMessage(w, sc, id); err != nil {
+		return err
+	}
+	if req == nil {
+		return nil
+	}
+	return WriteSessionMessage(w, sc, req)
+}
+
+// ReadSessionResponse reads the response to a session request from r. If the
+// other party rejected the request, the rejection is returned as an error.
+func ReadSessionResponse(r io.Reader, sc *SessionCipher, resp interface{}, maxLen uint64) error {
+	ct, err := encoding.ReadPrefixedBytes(r, maxLen+NegotiateMaxErrorSize+sc.Overhead())
+	if err != nil {
+		return err
+	}
+	plaintext, err := sc.Open(ct)
+	if err != nil {
+		return err
+	}
+	var rejection string
+	dec := encoding.NewDecoder(bytes.NewReader(plaintext))
+	if err := dec.Decode(&rejection); err != nil {
+		return err
+	} else if rejection != "" {
+		return errors.New(rejection)
+	}
+	if resp == nil {
+		return nil
+	}
+	return dec.Decode(resp)
+}
+
+// WriteSessionResponse writes the response to a session request to w. If err
+// is not nil, the request is rejected and the error is sent instead of the
+// response. The input error is returned, joined with the write error if the
+// write fails.
+func WriteSessionResponse(w io.Writer, sc *SessionCipher, resp interface{}, err error) error {
+	var msg []byte
+	if err != nil {
+		rejection := err.Error()
+		if rejection == "" {
+			rejection = "request rejected"
+		} else if len(rejection) > NegotiateMaxErrorSize-8 {
+			rejection = rejection[:NegotiateMaxErrorSize-8]
+		}
+		msg = encoding.Marshal(rejection)
+	} else if resp != nil {
+		msg = encoding.MarshalAll("", resp)
+	} else {
+		msg = encoding.Marshal("")
+	}
+	writeErr := encoding.WritePrefixedBytes(w, sc.Seal(msg))
+	if err != nil && writeErr != nil {
+		return build.JoinErrors([]error{err, writeErr}, "; ")
+	} else if err != nil {
+		return err
+	}
+	return writeErr
+}
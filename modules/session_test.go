@@ -0,0 +1,77 @@
+package modules
+
+import (
+	"bytes"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestSessionMessages checks that session messages can only be read in the
+// order they were sent, and only by the party they were sent to.
+func TestSessionMessages(t *testing.T) {
+	t.Parallel()
+
+	var key [crypto.EntropySize]byte
+	copy(key[:], fastrand.Bytes(crypto.EntropySize))
+	aead := crypto.NewChaCha20Poly1305(key)
+	newCiphers := func() (renter, host *SessionCipher) {
+		return NewSessionCipher(aead, false), NewSessionCipher(aead, true)
+	}
+
+	// Messages are received in order.
+	renter, host := newCiphers()
+	var buf bytes.Buffer
+	for _, id := range []types.Specifier{RPCSessionSettings, RPCSessionStop} {
+		if err := WriteSessionMessage(&buf, renter, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, expected := range []types.Specifier{RPCSessionSettings, RPCSessionStop} {
+		var id types.Specifier
+		if err := ReadSessionMessage(&buf, host, &id, types.SpecifierLen); err != nil {
+			t.Fatal(err)
+		} else if id != expected {
+			t.Fatalf("expected %v, got %v", expected, id)
+		}
+	}
+
+	// A replayed message is rejected.
+	renter, host = newCiphers()
+	if err := WriteSessionMessage(&buf, renter, RPCSessionStop); err != nil {
+		t.Fatal(err)
+	}
+	replay := append([]byte(nil), buf.Bytes()...)
+	var id types.Specifier
+	if err := ReadSessionMessage(&buf, host, &id, types.SpecifierLen); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadSessionMessage(bytes.NewReader(replay), host, &id, types.SpecifierLen); err == nil {
+		t.Fatal("expected replayed message to be rejected")
+	}
+
+	// Messages that are reordered are rejected.
+	renter, host = newCiphers()
+	var first, second bytes.Buffer
+	if err := WriteSessionMessage(&first, renter, RPCSessionSettings); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSessionMessage(&second, renter, RPCSessionStop); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadSessionMessage(&second, host, &id, types.SpecifierLen); err == nil {
+		t.Fatal("expected reordered message to be rejected")
+	}
+
+	// A message that is reflected back to its sender is rejected.
+	renter, _ = newCiphers()
+	if err := WriteSessionMessage(&buf, renter, RPCSessionStop); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadSessionMessage(&buf, renter, &id, types.SpecifierLen); err == nil {
+		t.Fatal("expected reflected message to be rejected")
+	}
+}
@@ -105,6 +105,7 @@ func isStandardTransaction(t types.Transaction) (uint64, error) {
 		// Check for a whilelisted prefix.
 		copy(prefix[:], arb)
 		if prefix == modules.PrefixHostAnnouncement ||
+			prefix == modules.PrefixFileContractIdentifier ||
 			prefix == modules.PrefixNonSia {
 			continue
 		}
@@ -72,31 +72,39 @@ func readAPIError(r io.Reader) error {
 // getRawResponse requests the specified resource. The response, if provided,
 // will be returned in a byte slice
 func (c *Client) getRawResponse(resource string) ([]byte, error) {
+	_, data, err := c.getRawResponseWithHeader(resource)
+	return data, err
+}
+
+// getRawResponseWithHeader requests the specified resource. The header of the
+// response is returned along with the response, if provided, in a byte slice.
+func (c *Client) getRawResponseWithHeader(resource string) (http.Header, []byte, error) {
 	req, err := c.NewRequest("GET", resource, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, errors.AddContext(err, "request failed")
+		return nil, nil, errors.AddContext(err, "request failed")
 	}
 	defer drainAndClose(res.Body)
 
 	if res.StatusCode == http.StatusNotFound {
-		return nil, errors.New("API call not recognized: " + resource)
+		return nil, nil, errors.New("API call not recognized: " + resource)
 	}
 
 	// If the status code is not 2xx, decode and return the accompanying
 	// api.Error.
 	if res.StatusCode < 200 || res.StatusCode > 299 {
-		return nil, readAPIError(res.Body)
+		return nil, nil, readAPIError(res.Body)
 	}
 
 	if res.StatusCode == http.StatusNoContent {
 		// no reason to read the response
-		return []byte{}, nil
+		return res.Header, []byte{}, nil
 	}
-	return ioutil.ReadAll(res.Body)
+	data, err := ioutil.ReadAll(res.Body)
+	return res.Header, data, err
 }
 
 // getRawResponse requests part of the specified resource. The response, if
@@ -155,8 +163,8 @@ func (c *Client) get(resource string, obj interface{}) error {
 
 // postRawResponse requests the specified resource. The response, if provided,
 // will be returned in a byte slice
-func (c *Client) postRawResponse(resource string, data string) ([]byte, error) {
-	req, err := c.NewRequest("POST", resource, strings.NewReader(data))
+func (c *Client) postRawResponse(resource string, body io.Reader) ([]byte, error) {
+	req, err := c.NewRequest("POST", resource, body)
 	if err != nil {
 		return nil, err
 	}
@@ -189,7 +197,7 @@ func (c *Client) postRawResponse(resource string, data string) ([]byte, error) {
 // request body. The response, if provided, will be decoded into `obj`.
 func (c *Client) post(resource string, data string, obj interface{}) error {
 	// Request resource
-	body, err := c.postRawResponse(resource, data)
+	body, err := c.postRawResponse(resource, strings.NewReader(data))
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,11 @@
 package client
 
 import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/node/api"
 	"gitlab.com/NebulousLabs/Sia/types"
 )
@@ -28,3 +33,57 @@ func (c *Client) HostDbHostsGet(pk types.SiaPublicKey) (hhg api.HostdbHostsGET,
 	err = c.get("/hostdb/hosts/"+pk.String(), &hhg)
 	return
 }
+
+// HostDbFilterModeGet requests the /hostdb/filtermode endpoint's resources.
+func (c *Client) HostDbFilterModeGet() (hdfmg api.HostdbFilterModeGET, err error) {
+	err = c.get("/hostdb/filtermode", &hdfmg)
+	return
+}
+
+// HostDbFilterModePost requests the /hostdb/filtermode endpoint to set the
+// filter mode of the hostdb.
+func (c *Client) HostDbFilterModePost(fm modules.FilterMode, hosts []types.SiaPublicKey) (err error) {
+	pks := make([]string, 0, len(hosts))
+	for _, pk := range hosts {
+		pks = append(pks, pk.String())
+	}
+	values := url.Values{}
+	values.Set("filtermode", fm.String())
+	values.Set("hosts", strings.Join(pks, ","))
+	err = c.post("/hostdb/filtermode", values.Encode(), nil)
+	return
+}
+
+// HostDbScoringGet requests the /hostdb/scoring endpoint's resources.
+func (c *Client) HostDbScoringGet() (hdsg api.HostdbScoringGET, err error) {
+	err = c.get("/hostdb/scoring", &hdsg)
+	return
+}
+
+// HostDbScoringPost requests the /hostdb/scoring endpoint to set the scoring
+// profile of the hostdb.
+func (c *Client) HostDbScoringPost(sp modules.HostScoringProfile) (err error) {
+	values := url.Values{}
+	values.Set("ageweight", strconv.FormatFloat(sp.AgeWeight, 'g', -1, 64))
+	values.Set("collateralweight", strconv.FormatFloat(sp.CollateralWeight, 'g', -1, 64))
+	values.Set("interactionweight", strconv.FormatFloat(sp.InteractionWeight, 'g', -1, 64))
+	values.Set("performanceweight", strconv.FormatFloat(sp.PerformanceWeight, 'g', -1, 64))
+	values.Set("priceweight", strconv.FormatFloat(sp.PriceWeight, 'g', -1, 64))
+	values.Set("storageproofweight", strconv.FormatFloat(sp.StorageProofWeight, 'g', -1, 64))
+	values.Set("storageremainingweight", strconv.FormatFloat(sp.StorageRemainingWeight, 'g', -1, 64))
+	values.Set("uptimeweight", strconv.FormatFloat(sp.UptimeWeight, 'g', -1, 64))
+	values.Set("versionweight", strconv.FormatFloat(sp.VersionWeight, 'g', -1, 64))
+	values.Set("maxstorageprice", sp.MaxStoragePrice.String())
+	values.Set("minuptime", strconv.FormatFloat(sp.MinUptime, 'g', -1, 64))
+	err = c.post("/hostdb/scoring", values.Encode(), nil)
+	return
+}
+
+// HostDbScoringSettingPost requests the /hostdb/scoring endpoint to change a
+// single setting of the scoring profile of the hostdb.
+func (c *Client) HostDbScoringSettingPost(param, value string) (err error) {
+	values := url.Values{}
+	values.Set(param, value)
+	err = c.post("/hostdb/scoring", values.Encode(), nil)
+	return
+}
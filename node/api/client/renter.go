@@ -2,6 +2,7 @@ package client
 
 import (
 	"fmt"
+	"io"
 	"net/url"
 	"strconv"
 	"strings"
@@ -9,6 +10,7 @@ import (
 
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/node/api"
+	"gitlab.com/NebulousLabs/Sia/types"
 )
 
 // RenterContractsGet requests the /renter/contracts resource and returns
@@ -34,6 +36,55 @@ func (c *Client) RenterExpiredContractsGet() (rc api.RenterContracts, err error)
 	return
 }
 
+// RenterContractFormPost uses the /renter/contract/form endpoint to form a
+// contract with a specific host. A zero funds or endHeight uses the defaults of
+// the contractor.
+func (c *Client) RenterContractFormPost(hostKey types.SiaPublicKey, funds types.Currency, endHeight types.BlockHeight) (rcp api.RenterContractPOST, err error) {
+	values := url.Values{}
+	values.Set("host", hostKey.String())
+	if !funds.IsZero() {
+		values.Set("funds", funds.String())
+	}
+	if endHeight != 0 {
+		values.Set("endheight", fmt.Sprint(endHeight))
+	}
+	err = c.post("/renter/contract/form", values.Encode(), &rcp)
+	return
+}
+
+// RenterContractRenewPost uses the /renter/contract/renew/:id endpoint to
+// renew a contract right away. A zero funds estimates the funding from the
+// usage of the contract.
+func (c *Client) RenterContractRenewPost(id types.FileContractID, funds types.Currency) (rcp api.RenterContractPOST, err error) {
+	values := url.Values{}
+	if !funds.IsZero() {
+		values.Set("funds", funds.String())
+	}
+	err = c.post("/renter/contract/renew/"+id.String(), values.Encode(), &rcp)
+	return
+}
+
+// RenterContractCancelPost uses the /renter/contract/cancel/:id endpoint to
+// cancel a contract.
+func (c *Client) RenterContractCancelPost(id types.FileContractID) (err error) {
+	err = c.post("/renter/contract/cancel/"+id.String(), "", nil)
+	return
+}
+
+// RenterInitRecoveryScanPost uses the /renter/recoveryscan endpoint to start a
+// scan for contracts that can be recovered using the wallet seed.
+func (c *Client) RenterInitRecoveryScanPost() (err error) {
+	err = c.post("/renter/recoveryscan", "", nil)
+	return
+}
+
+// RenterRecoveryStatusGet uses the /renter/recoveryscan endpoint to get the
+// status of the recovery scan.
+func (c *Client) RenterRecoveryStatusGet() (rsg api.RenterRecoveryStatusGET, err error) {
+	err = c.get("/renter/recoveryscan", &rsg)
+	return
+}
+
 // RenterDeletePost uses the /renter/delete endpoint to delete a file.
 func (c *Client) RenterDeletePost(siaPath string) (err error) {
 	siaPath = strings.TrimPrefix(siaPath, "/")
@@ -41,6 +92,40 @@ func (c *Client) RenterDeletePost(siaPath string) (err error) {
 	return err
 }
 
+// RenterDirGet uses the /renter/dir/:siapath endpoint to query a directory.
+func (c *Client) RenterDirGet(siaPath string) (rd api.RenterDirectory, err error) {
+	siaPath = strings.TrimPrefix(siaPath, "/")
+	err = c.get("/renter/dir/"+siaPath, &rd)
+	return
+}
+
+// RenterDirCreatePost uses the /renter/dir/:siapath endpoint to create a
+// directory.
+func (c *Client) RenterDirCreatePost(siaPath string) (err error) {
+	siaPath = strings.TrimPrefix(siaPath, "/")
+	err = c.post("/renter/dir/"+siaPath, "action=create", nil)
+	return
+}
+
+// RenterDirDeletePost uses the /renter/dir/:siapath endpoint to delete a
+// directory.
+func (c *Client) RenterDirDeletePost(siaPath string) (err error) {
+	siaPath = strings.TrimPrefix(siaPath, "/")
+	err = c.post("/renter/dir/"+siaPath, "action=delete", nil)
+	return
+}
+
+// RenterDirRenamePost uses the /renter/dir/:siapath endpoint to rename a
+// directory.
+func (c *Client) RenterDirRenamePost(siaPath, newSiaPath string) (err error) {
+	siaPath = strings.TrimPrefix(siaPath, "/")
+	values := url.Values{}
+	values.Set("action", "rename")
+	values.Set("newsiapath", strings.TrimPrefix(newSiaPath, "/"))
+	err = c.post("/renter/dir/"+siaPath, values.Encode(), nil)
+	return
+}
+
 // RenterDownloadGet uses the /renter/download endpoint to download a file to a
 // destination on disk.
 func (c *Client) RenterDownloadGet(siaPath, destination string, offset, length uint64, async bool) (err error) {
@@ -61,6 +146,58 @@ func (c *Client) RenterDownloadFullGet(siaPath, destination string, async bool)
 	return
 }
 
+// RenterDownloadAsyncGet uses the /renter/downloadasync endpoint to start a
+// download and returns the ID of the download.
+func (c *Client) RenterDownloadAsyncGet(siaPath, destination string, offset, length uint64) (modules.DownloadID, error) {
+	siaPath = strings.TrimPrefix(siaPath, "/")
+	values := url.Values{}
+	values.Set("destination", destination)
+	values.Set("offset", strconv.FormatUint(offset, 10))
+	values.Set("length", strconv.FormatUint(length, 10))
+	header, _, err := c.getRawResponseWithHeader("/renter/downloadasync/" + siaPath + "?" + values.Encode())
+	if err != nil {
+		return "", err
+	}
+	return modules.DownloadID(header.Get("ID")), nil
+}
+
+// RenterDownloadCancelPost uses the /renter/download/cancel endpoint to
+// cancel a download.
+func (c *Client) RenterDownloadCancelPost(id modules.DownloadID) (err error) {
+	values := url.Values{}
+	values.Set("id", string(id))
+	err = c.post("/renter/download/cancel", values.Encode(), nil)
+	return
+}
+
+// RenterDownloadPausePost uses the /renter/download/pause endpoint to pause a
+// download.
+func (c *Client) RenterDownloadPausePost(id modules.DownloadID) (err error) {
+	values := url.Values{}
+	values.Set("id", string(id))
+	err = c.post("/renter/download/pause", values.Encode(), nil)
+	return
+}
+
+// RenterDownloadResumePost uses the /renter/download/resume endpoint to
+// resume a paused download.
+func (c *Client) RenterDownloadResumePost(id modules.DownloadID) (err error) {
+	values := url.Values{}
+	values.Set("id", string(id))
+	err = c.post("/renter/download/resume", values.Encode(), nil)
+	return
+}
+
+// RenterDownloadPriorityPost uses the /renter/download/priority endpoint to
+// change the priority of a download.
+func (c *Client) RenterDownloadPriorityPost(id modules.DownloadID, priority uint64) (err error) {
+	values := url.Values{}
+	values.Set("id", string(id))
+	values.Set("priority", strconv.FormatUint(priority, 10))
+	err = c.post("/renter/download/priority", values.Encode(), nil)
+	return
+}
+
 // RenterClearAllDownloadsPost requests the /renter/downloads/clear resource
 // with no parameters
 func (c *Client) RenterClearAllDownloadsPost() (err error) {
@@ -137,6 +274,15 @@ func (c *Client) RenterPostAllowance(allowance modules.Allowance) (err error) {
 	values.Set("hosts", strconv.FormatUint(allowance.Hosts, 10))
 	values.Set("period", strconv.FormatUint(uint64(allowance.Period), 10))
 	values.Set("renewwindow", strconv.FormatUint(uint64(allowance.RenewWindow), 10))
+	values.Set("expectedstorage", strconv.FormatUint(allowance.ExpectedStorage, 10))
+	values.Set("expectedupload", strconv.FormatUint(allowance.ExpectedUpload, 10))
+	values.Set("expecteddownload", strconv.FormatUint(allowance.ExpectedDownload, 10))
+	values.Set("expectedredundancy", strconv.FormatFloat(allowance.ExpectedRedundancy, 'f', -1, 64))
+	values.Set("maxstorageprice", allowance.MaxStoragePrice.String())
+	values.Set("maxuploadbandwidthprice", allowance.MaxUploadBandwidthPrice.String())
+	values.Set("maxdownloadbandwidthprice", allowance.MaxDownloadBandwidthPrice.String())
+	values.Set("maxcontractprice", allowance.MaxContractPrice.String())
+	values.Set("mincollateralratio", strconv.FormatFloat(allowance.MinCollateralRatio, 'f', -1, 64))
 	err = c.post("/renter", values.Encode(), nil)
 	return
 }
@@ -171,6 +317,18 @@ func (c *Client) RenterRenamePost(siaPathOld, siaPathNew string) (err error) {
 	return
 }
 
+// RenterFileRedundancyPost uses the /renter/file/redundancy endpoint to change
+// the erasure code of an uploaded file.
+func (c *Client) RenterFileRedundancyPost(siaPath, codeType string, dataPieces, parityPieces uint64) (err error) {
+	siaPath = strings.TrimPrefix(siaPath, "/")
+	values := url.Values{}
+	values.Set("erasurecode", codeType)
+	values.Set("datapieces", strconv.FormatUint(dataPieces, 10))
+	values.Set("paritypieces", strconv.FormatUint(parityPieces, 10))
+	err = c.post(fmt.Sprintf("/renter/file/redundancy/%v", siaPath), values.Encode(), nil)
+	return
+}
+
 // RenterSetStreamCacheSizePost uses the /renter endpoint to change the renter's
 // streamCacheSize for streaming
 func (c *Client) RenterSetStreamCacheSizePost(cacheSize uint64) (err error) {
@@ -207,6 +365,32 @@ func (c *Client) RenterUploadPost(path, siaPath string, dataPieces, parityPieces
 	return
 }
 
+// RenterUploadValuesPost uses the /renter/upload endpoint to upload a file
+// with the provided upload parameters, such as the erasure code, the cipher
+// or whether the file is packed or deduplicated. Parameters that aren't
+// provided use the defaults of the renter.
+func (c *Client) RenterUploadValuesPost(path, siaPath string, values url.Values) (err error) {
+	siaPath = strings.TrimPrefix(siaPath, "/")
+	query := url.Values{}
+	for key, value := range values {
+		query[key] = value
+	}
+	query.Set("source", path)
+	err = c.post(fmt.Sprintf("/renter/upload/%v", siaPath), query.Encode(), nil)
+	return
+}
+
+// RenterUploadStreamPost uses the /renter/uploadstream endpoint to upload a
+// file using a stream.
+func (c *Client) RenterUploadStreamPost(r io.Reader, siaPath string, dataPieces, parityPieces uint64) (err error) {
+	siaPath = strings.TrimPrefix(siaPath, "/")
+	values := url.Values{}
+	values.Set("datapieces", strconv.FormatUint(dataPieces, 10))
+	values.Set("paritypieces", strconv.FormatUint(parityPieces, 10))
+	_, err = c.postRawResponse(fmt.Sprintf("/renter/uploadstream/%v?%v", siaPath, values.Encode()), r)
+	return
+}
+
 // RenterUploadDefaultPost uses the /renter/upload endpoint with default
 // redundancy settings to upload a file.
 func (c *Client) RenterUploadDefaultPost(path, siaPath string) (err error) {
@@ -3,6 +3,8 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
@@ -36,6 +38,18 @@ type (
 		ScoreBreakdown modules.HostScoreBreakdown `json:"scorebreakdown"`
 	}
 
+	// HostdbFilterModeGET contains the filter mode of the hostdb and the
+	// hosts of the filter.
+	HostdbFilterModeGET struct {
+		FilterMode string   `json:"filtermode"`
+		Hosts      []string `json:"hosts"`
+	}
+
+	// HostdbScoringGET contains the scoring profile of the hostdb.
+	HostdbScoringGET struct {
+		ScoringProfile modules.HostScoringProfile `json:"scoringprofile"`
+	}
+
 	// HostdbGet holds information about the hostdb.
 	HostdbGet struct {
 		InitialScanComplete bool `json:"initialscancomplete"`
@@ -132,3 +146,94 @@ func (api *API) hostdbHostsHandler(w http.ResponseWriter, req *http.Request, ps
 		ScoreBreakdown: breakdown,
 	})
 }
+
+// hostdbFilterModeHandlerGET handles the API call to get the filter mode of
+// the hostdb.
+func (api *API) hostdbFilterModeHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	fm, hosts := api.renter.Filter()
+	pks := make([]string, 0, len(hosts))
+	for _, pk := range hosts {
+		pks = append(pks, pk.String())
+	}
+	WriteJSON(w, HostdbFilterModeGET{
+		FilterMode: fm.String(),
+		Hosts:      pks,
+	})
+}
+
+// hostdbFilterModeHandlerPOST handles the API call to set the filter mode of
+// the hostdb.
+func (api *API) hostdbFilterModeHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var fm modules.FilterMode
+	if err := fm.FromString(req.FormValue("filtermode")); err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	var hosts []types.SiaPublicKey
+	if req.FormValue("hosts") != "" {
+		for _, str := range strings.Split(req.FormValue("hosts"), ",") {
+			var pk types.SiaPublicKey
+			pk.LoadString(strings.TrimSpace(str))
+			if len(pk.Key) == 0 {
+				WriteError(w, Error{"unable to parse host public key: " + str}, http.StatusBadRequest)
+				return
+			}
+			hosts = append(hosts, pk)
+		}
+	}
+	if err := api.renter.SetFilterMode(fm, hosts); err != nil {
+		WriteError(w, Error{"failed to set the filter mode: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// hostdbScoringHandlerGET handles the API call to get the scoring profile of
+// the hostdb.
+func (api *API) hostdbScoringHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	WriteJSON(w, HostdbScoringGET{
+		ScoringProfile: api.renter.ScoringProfile(),
+	})
+}
+
+// hostdbScoringHandlerPOST handles the API call to set the scoring profile of
+// the hostdb. Settings that are not provided keep their current value.
+func (api *API) hostdbScoringHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sp := api.renter.ScoringProfile()
+	floats := map[string]*float64{
+		"ageweight":              &sp.AgeWeight,
+		"collateralweight":       &sp.CollateralWeight,
+		"interactionweight":      &sp.InteractionWeight,
+		"performanceweight":      &sp.PerformanceWeight,
+		"priceweight":            &sp.PriceWeight,
+		"storageproofweight":     &sp.StorageProofWeight,
+		"storageremainingweight": &sp.StorageRemainingWeight,
+		"uptimeweight":           &sp.UptimeWeight,
+		"versionweight":          &sp.VersionWeight,
+		"minuptime":              &sp.MinUptime,
+	}
+	for param, value := range floats {
+		if req.FormValue(param) == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(req.FormValue(param), 64)
+		if err != nil {
+			WriteError(w, Error{"unable to parse " + param + ": " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		*value = f
+	}
+	if req.FormValue("maxstorageprice") != "" {
+		price, ok := scanAmount(req.FormValue("maxstorageprice"))
+		if !ok {
+			WriteError(w, Error{"unable to parse maxstorageprice"}, http.StatusBadRequest)
+			return
+		}
+		sp.MaxStoragePrice = price
+	}
+	if err := api.renter.SetScoringProfile(sp); err != nil {
+		WriteError(w, Error{"failed to set the scoring profile: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/modules/renter"
 	"gitlab.com/NebulousLabs/Sia/types"
@@ -111,6 +113,20 @@ type (
 		GoodForUpload bool `json:"goodforupload"`
 		// Signals if contract is good for a renewal
 		GoodForRenew bool `json:"goodforrenew"`
+		// Reason why the contract is not good for uploading or renewal
+		UtilityReason string `json:"utilityreason"`
+	}
+
+	// RenterContractPOST contains the contract that was formed or renewed
+	// manually.
+	RenterContractPOST struct {
+		Contract RenterContract `json:"contract"`
+	}
+
+	// RenterRecoveryStatusGET contains the status of the recovery scan.
+	RenterRecoveryStatusGET struct {
+		ScanInProgress bool              `json:"scaninprogress"`
+		ScannedHeight  types.BlockHeight `json:"scannedheight"`
 	}
 
 	// RenterContracts contains the renter's contracts.
@@ -121,6 +137,14 @@ type (
 		ExpiredContracts  []RenterContract `json:"expiredcontracts"`
 	}
 
+	// RenterDirectory lists the files and directories contained in the queried
+	// directory. The first entry of Directories is the queried directory
+	// itself.
+	RenterDirectory struct {
+		Directories []modules.DirectoryInfo `json:"directories"`
+		Files       []modules.FileInfo      `json:"files"`
+	}
+
 	// RenterDownloadQueue contains the renter's download queue.
 	RenterDownloadQueue struct {
 		Downloads []DownloadInfo `json:"downloads"`
@@ -128,7 +152,8 @@ type (
 
 	// RenterFile lists the file queried.
 	RenterFile struct {
-		File modules.FileInfo `json:"file"`
+		File   modules.FileInfo    `json:"file"`
+		Chunks []modules.ChunkInfo `json:"chunks"`
 	}
 
 	// RenterFiles lists the files known to the renter.
@@ -154,12 +179,13 @@ type (
 
 	// DownloadInfo contains all client-facing information of a file.
 	DownloadInfo struct {
-		Destination     string `json:"destination"`     // The destination of the download.
-		DestinationType string `json:"destinationtype"` // Can be "file", "memory buffer", or "http stream".
-		Filesize        uint64 `json:"filesize"`        // DEPRECATED. Same as 'Length'.
-		Length          uint64 `json:"length"`          // The length requested for the download.
-		Offset          uint64 `json:"offset"`          // The offset within the siafile requested for the download.
-		SiaPath         string `json:"siapath"`         // The siapath of the file used for the download.
+		ID              modules.DownloadID `json:"id"`              // The ID of the download.
+		Destination     string             `json:"destination"`     // The destination of the download.
+		DestinationType string             `json:"destinationtype"` // Can be "file", "memory buffer", or "http stream".
+		Filesize        uint64             `json:"filesize"`        // DEPRECATED. Same as 'Length'.
+		Length          uint64             `json:"length"`          // The length requested for the download.
+		Offset          uint64             `json:"offset"`          // The offset within the siafile requested for the download.
+		SiaPath         string             `json:"siapath"`         // The siapath of the file used for the download.
 
 		Completed            bool      `json:"completed"`            // Whether or not the download has completed.
 		EndTime              time.Time `json:"endtime"`              // The time when the download fully completed.
@@ -168,6 +194,9 @@ type (
 		StartTime            time.Time `json:"starttime"`            // The time when the download was started.
 		StartTimeUnix        int64     `json:"starttimeunix"`        // The time when the download was started in unix format.
 		TotalDataTransferred uint64    `json:"totaldatatransferred"` // The total amount of data transferred, including negotiation, overdrive etc.
+
+		Paused   bool   `json:"paused"`   // Whether or not the download is paused.
+		Priority uint64 `json:"priority"` // Downloads with a higher priority are processed first.
 	}
 )
 
@@ -239,6 +268,76 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 		// Sane defaults if renew window hasn't been set before.
 		settings.Allowance.RenewWindow = settings.Allowance.Period / 2
 	}
+	// Scan the expected storage. (optional parameter)
+	if es := req.FormValue("expectedstorage"); es != "" {
+		var expectedStorage uint64
+		if _, err := fmt.Sscan(es, &expectedStorage); err != nil {
+			WriteError(w, Error{"unable to parse expectedstorage: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.Allowance.ExpectedStorage = expectedStorage
+	}
+	// Scan the expected upload. (optional parameter)
+	if eu := req.FormValue("expectedupload"); eu != "" {
+		var expectedUpload uint64
+		if _, err := fmt.Sscan(eu, &expectedUpload); err != nil {
+			WriteError(w, Error{"unable to parse expectedupload: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.Allowance.ExpectedUpload = expectedUpload
+	}
+	// Scan the expected download. (optional parameter)
+	if ed := req.FormValue("expecteddownload"); ed != "" {
+		var expectedDownload uint64
+		if _, err := fmt.Sscan(ed, &expectedDownload); err != nil {
+			WriteError(w, Error{"unable to parse expecteddownload: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.Allowance.ExpectedDownload = expectedDownload
+	}
+	// Scan the expected redundancy. (optional parameter)
+	if er := req.FormValue("expectedredundancy"); er != "" {
+		var expectedRedundancy float64
+		if _, err := fmt.Sscan(er, &expectedRedundancy); err != nil {
+			WriteError(w, Error{"unable to parse expectedredundancy: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.Allowance.ExpectedRedundancy = expectedRedundancy
+	}
+	// Scan the maximum prices. (optional parameters)
+	maxPrices := []struct {
+		name  string
+		price *types.Currency
+	}{
+		{"maxstorageprice", &settings.Allowance.MaxStoragePrice},
+		{"maxuploadbandwidthprice", &settings.Allowance.MaxUploadBandwidthPrice},
+		{"maxdownloadbandwidthprice", &settings.Allowance.MaxDownloadBandwidthPrice},
+		{"maxcontractprice", &settings.Allowance.MaxContractPrice},
+	}
+	for _, mp := range maxPrices {
+		if p := req.FormValue(mp.name); p != "" {
+			price, ok := scanAmount(p)
+			if !ok {
+				WriteError(w, Error{"unable to parse " + mp.name}, http.StatusBadRequest)
+				return
+			}
+			*mp.price = price
+		}
+	}
+	// Scan the minimum collateral ratio. (optional parameter)
+	if mcr := req.FormValue("mincollateralratio"); mcr != "" {
+		var minCollateralRatio float64
+		if _, err := fmt.Sscan(mcr, &minCollateralRatio); err != nil {
+			WriteError(w, Error{"unable to parse mincollateralratio: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.Allowance.MinCollateralRatio = minCollateralRatio
+	}
+	// An allowance without funds, hosts and period cancels the allowance,
+	// including its expected usage.
+	if a := settings.Allowance; a.Funds.IsZero() && a.Hosts == 0 && a.Period == 0 && a.RenewWindow == 0 {
+		settings.Allowance = modules.Allowance{}
+	}
 	// Scan the download speed limit. (optional parameter)
 	if d := req.FormValue("maxdownloadspeed"); d != "" {
 		var downloadSpeed int64
@@ -306,46 +405,10 @@ func (api *API) renterContractsHandler(w http.ResponseWriter, req *http.Request,
 	inactiveContracts := []RenterContract{}
 	expiredContracts := []RenterContract{}
 	for _, c := range api.renter.Contracts() {
-		var size uint64
-		if len(c.Transaction.FileContractRevisions) != 0 {
-			size = c.Transaction.FileContractRevisions[0].NewFileSize
-		}
-
-		// Fetch host address
-		var netAddress modules.NetAddress
-		hdbe, exists := api.renter.Host(c.HostPublicKey)
-		if exists {
-			netAddress = hdbe.NetAddress
-		}
-
-		// Fetch utilities for contract
-		var goodForUpload bool
-		var goodForRenew bool
-		if utility, ok := api.renter.ContractUtility(c.HostPublicKey); ok {
-			goodForUpload = utility.GoodForUpload
-			goodForRenew = utility.GoodForRenew
-		}
-		contract := RenterContract{
-			DownloadSpending:          c.DownloadSpending,
-			EndHeight:                 c.EndHeight,
-			Fees:                      c.TxnFee.Add(c.SiafundFee).Add(c.ContractFee),
-			GoodForUpload:             goodForUpload,
-			GoodForRenew:              goodForRenew,
-			HostPublicKey:             c.HostPublicKey,
-			ID:                        c.ID,
-			LastTransaction:           c.Transaction,
-			NetAddress:                netAddress,
-			RenterFunds:               c.RenterFunds,
-			Size:                      size,
-			StartHeight:               c.StartHeight,
-			StorageSpending:           c.StorageSpending,
-			StorageSpendingDeprecated: c.StorageSpending,
-			TotalCost:                 c.TotalCost,
-			UploadSpending:            c.UploadSpending,
-		}
-		if goodForRenew {
+		contract := api.renterContract(c)
+		if contract.GoodForRenew {
 			activeContracts = append(activeContracts, contract)
-		} else if inactive && !goodForRenew {
+		} else if inactive && !contract.GoodForRenew {
 			inactiveContracts = append(inactiveContracts, contract)
 		}
 		contracts = append(contracts, contract)
@@ -354,44 +417,7 @@ func (api *API) renterContractsHandler(w http.ResponseWriter, req *http.Request,
 	// Get expired contracts
 	if expired || inactive {
 		for _, c := range api.renter.OldContracts() {
-			var size uint64
-			if len(c.Transaction.FileContractRevisions) != 0 {
-				size = c.Transaction.FileContractRevisions[0].NewFileSize
-			}
-
-			// Fetch host address
-			var netAddress modules.NetAddress
-			hdbe, exists := api.renter.Host(c.HostPublicKey)
-			if exists {
-				netAddress = hdbe.NetAddress
-			}
-
-			// Fetch utilities for contract
-			var goodForUpload bool
-			var goodForRenew bool
-			if utility, ok := api.renter.ContractUtility(c.HostPublicKey); ok {
-				goodForUpload = utility.GoodForUpload
-				goodForRenew = utility.GoodForRenew
-			}
-
-			contract := RenterContract{
-				DownloadSpending:          c.DownloadSpending,
-				EndHeight:                 c.EndHeight,
-				Fees:                      c.TxnFee.Add(c.SiafundFee).Add(c.ContractFee),
-				GoodForUpload:             goodForUpload,
-				GoodForRenew:              goodForRenew,
-				HostPublicKey:             c.HostPublicKey,
-				ID:                        c.ID,
-				LastTransaction:           c.Transaction,
-				NetAddress:                netAddress,
-				RenterFunds:               c.RenterFunds,
-				Size:                      size,
-				StartHeight:               c.StartHeight,
-				StorageSpending:           c.StorageSpending,
-				StorageSpendingDeprecated: c.StorageSpending,
-				TotalCost:                 c.TotalCost,
-				UploadSpending:            c.UploadSpending,
-			}
+			contract := api.renterContract(c)
 			if expired && c.EndHeight < blockHeight {
 				expiredContracts = append(expiredContracts, contract)
 			} else if inactive && c.EndHeight >= blockHeight {
@@ -408,6 +434,149 @@ func (api *API) renterContractsHandler(w http.ResponseWriter, req *http.Request,
 	})
 }
 
+// renterContract converts a contract of the renter to the type used by the
+// API.
+func (api *API) renterContract(c modules.RenterContract) RenterContract {
+	var size uint64
+	if len(c.Transaction.FileContractRevisions) != 0 {
+		size = c.Transaction.FileContractRevisions[0].NewFileSize
+	}
+
+	// Fetch host address
+	var netAddress modules.NetAddress
+	hdbe, exists := api.renter.Host(c.HostPublicKey)
+	if exists {
+		netAddress = hdbe.NetAddress
+	}
+
+	// Fetch utilities for contract
+	var goodForUpload bool
+	var goodForRenew bool
+	if utility, ok := api.renter.ContractUtility(c.HostPublicKey); ok {
+		goodForUpload = utility.GoodForUpload
+		goodForRenew = utility.GoodForRenew
+	}
+
+	return RenterContract{
+		DownloadSpending:          c.DownloadSpending,
+		EndHeight:                 c.EndHeight,
+		Fees:                      c.TxnFee.Add(c.SiafundFee).Add(c.ContractFee),
+		GoodForUpload:             goodForUpload,
+		GoodForRenew:              goodForRenew,
+		HostPublicKey:             c.HostPublicKey,
+		ID:                        c.ID,
+		LastTransaction:           c.Transaction,
+		NetAddress:                netAddress,
+		RenterFunds:               c.RenterFunds,
+		Size:                      size,
+		StartHeight:               c.StartHeight,
+		StorageSpending:           c.StorageSpending,
+		StorageSpendingDeprecated: c.StorageSpending,
+		TotalCost:                 c.TotalCost,
+		UploadSpending:            c.UploadSpending,
+		UtilityReason:             api.renter.ContractUtilityReason(c.ID),
+	}
+}
+
+// renterContractFormHandler handles the API call to form a contract with a
+// specific host.
+func (api *API) renterContractFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var hostKey types.SiaPublicKey
+	hostKey.LoadString(req.FormValue("host"))
+	if len(hostKey.Key) == 0 {
+		WriteError(w, Error{"unable to parse host public key"}, http.StatusBadRequest)
+		return
+	}
+	// Scan the funds. (optional parameter)
+	var funds types.Currency
+	if f := req.FormValue("funds"); f != "" {
+		var ok bool
+		funds, ok = scanAmount(f)
+		if !ok {
+			WriteError(w, Error{"unable to parse funds"}, http.StatusBadRequest)
+			return
+		}
+	}
+	// Scan the end height. (optional parameter)
+	var endHeight types.BlockHeight
+	if e := req.FormValue("endheight"); e != "" {
+		if _, err := fmt.Sscan(e, &endHeight); err != nil {
+			WriteError(w, Error{"unable to parse endheight: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	contract, err := api.renter.FormContract(hostKey, funds, endHeight)
+	if err != nil {
+		WriteError(w, Error{"unable to form contract: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterContractPOST{
+		Contract: api.renterContract(contract),
+	})
+}
+
+// renterContractRenewHandler handles the API call to renew a contract right
+// away.
+func (api *API) renterContractRenewHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var id types.FileContractID
+	if err := id.LoadString(ps.ByName("id")); err != nil {
+		WriteError(w, Error{"unable to parse contract id: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	// Scan the funds. (optional parameter)
+	var funds types.Currency
+	if f := req.FormValue("funds"); f != "" {
+		var ok bool
+		funds, ok = scanAmount(f)
+		if !ok {
+			WriteError(w, Error{"unable to parse funds"}, http.StatusBadRequest)
+			return
+		}
+	}
+	contract, err := api.renter.RenewContract(id, funds)
+	if err != nil {
+		WriteError(w, Error{"unable to renew contract: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterContractPOST{
+		Contract: api.renterContract(contract),
+	})
+}
+
+// renterContractCancelHandler handles the API call to cancel a contract.
+func (api *API) renterContractCancelHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var id types.FileContractID
+	if err := id.LoadString(ps.ByName("id")); err != nil {
+		WriteError(w, Error{"unable to parse contract id: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := api.renter.CancelContract(id); err != nil {
+		WriteError(w, Error{"unable to cancel contract: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterRecoveryScanHandlerGET handles the API call to get the status of the
+// recovery scan.
+func (api *API) renterRecoveryScanHandlerGET(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	scanInProgress, scannedHeight := api.renter.RecoveryScanStatus()
+	WriteJSON(w, RenterRecoveryStatusGET{
+		ScanInProgress: scanInProgress,
+		ScannedHeight:  scannedHeight,
+	})
+}
+
+// renterRecoveryScanHandlerPOST handles the API call to start a scan for
+// contracts that can be recovered using the wallet seed.
+func (api *API) renterRecoveryScanHandlerPOST(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	if err := api.renter.InitRecoveryScan(); err != nil {
+		WriteError(w, Error{"unable to start recovery scan: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
 // renterClearDownloadsHandler handles the API call to request to clear the download queue.
 func (api *API) renterClearDownloadsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	var afterTime time.Time
@@ -438,11 +607,99 @@ func (api *API) renterClearDownloadsHandler(w http.ResponseWriter, req *http.Req
 	WriteSuccess(w)
 }
 
+// renterDownloadCancelHandler handles the API call to cancel a download.
+func (api *API) renterDownloadCancelHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	err := api.renter.CancelDownload(modules.DownloadID(req.FormValue("id")))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterDownloadPauseHandler handles the API call to pause a download.
+func (api *API) renterDownloadPauseHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	err := api.renter.PauseDownload(modules.DownloadID(req.FormValue("id")))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterDownloadResumeHandler handles the API call to resume a paused
+// download.
+func (api *API) renterDownloadResumeHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	err := api.renter.ResumeDownload(modules.DownloadID(req.FormValue("id")))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterDownloadPriorityHandler handles the API call to change the priority
+// of a download.
+func (api *API) renterDownloadPriorityHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	priority, err := strconv.ParseUint(req.FormValue("priority"), 10, 64)
+	if err != nil {
+		WriteError(w, Error{"unable to parse priority: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	err = api.renter.SetDownloadPriority(modules.DownloadID(req.FormValue("id")), priority)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterDirHandlerGET handles the API call to list the contents of a
+// directory.
+func (api *API) renterDirHandlerGET(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	directories, files, err := api.renter.DirList(strings.TrimPrefix(ps.ByName("siapath"), "/"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterDirectory{
+		Directories: directories,
+		Files:       files,
+	})
+}
+
+// renterDirHandlerPOST handles the API call to create, delete or rename a
+// directory.
+func (api *API) renterDirHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	siaPath := strings.TrimPrefix(ps.ByName("siapath"), "/")
+	var err error
+	switch action := req.FormValue("action"); action {
+	case "create":
+		err = api.renter.CreateDir(siaPath)
+	case "delete":
+		err = api.renter.DeleteDir(siaPath)
+	case "rename":
+		err = api.renter.RenameDir(siaPath, strings.TrimPrefix(req.FormValue("newsiapath"), "/"))
+	case "":
+		WriteError(w, Error{"you must set the action you wish to execute"}, http.StatusBadRequest)
+		return
+	default:
+		WriteError(w, Error{"unknown action: " + action}, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
 // renterDownloadsHandler handles the API call to request the download queue.
 func (api *API) renterDownloadsHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
 	var downloads []DownloadInfo
 	for _, di := range api.renter.DownloadHistory() {
 		downloads = append(downloads, DownloadInfo{
+			ID:              di.ID,
 			Destination:     di.Destination,
 			DestinationType: di.DestinationType,
 			Filesize:        di.Length,
@@ -457,6 +714,9 @@ func (api *API) renterDownloadsHandler(w http.ResponseWriter, _ *http.Request, _
 			StartTime:            di.StartTime,
 			StartTimeUnix:        di.StartTimeUnix,
 			TotalDataTransferred: di.TotalDataTransferred,
+
+			Paused:   di.Paused,
+			Priority: di.Priority,
 		})
 	}
 	WriteJSON(w, RenterDownloadQueue{
@@ -505,15 +765,42 @@ func (api *API) renterRenameHandler(w http.ResponseWriter, req *http.Request, ps
 	WriteSuccess(w)
 }
 
+// renterFileRedundancyHandler handles the API call to change the erasure code
+// of an uploaded file.
+func (api *API) renterFileRedundancyHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	ec, err := parseErasureCodingParameters(req.FormValue("erasurecode"), req.FormValue("datapieces"), req.FormValue("paritypieces"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	} else if ec == nil {
+		WriteError(w, Error{"must provide the datapieces and paritypieces parameters"}, http.StatusBadRequest)
+		return
+	}
+	err = api.renter.SetFileRedundancy(strings.TrimPrefix(ps.ByName("siapath"), "/"), ec)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	WriteSuccess(w)
+}
+
 // renterFileHandler handles the API call to return specific file.
 func (api *API) renterFileHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-	file, err := api.renter.File(strings.TrimPrefix(ps.ByName("siapath"), "/"))
+	siaPath := strings.TrimPrefix(ps.ByName("siapath"), "/")
+	file, err := api.renter.File(siaPath)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	chunks, err := api.renter.FileChunks(siaPath)
 	if err != nil {
 		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteJSON(w, RenterFile{
-		File: file,
+		File:   file,
+		Chunks: chunks,
 	})
 }
 
@@ -552,10 +839,18 @@ func (api *API) renterDownloadHandler(w http.ResponseWriter, req *http.Request,
 		return
 	}
 	if params.Async {
-		err = api.renter.DownloadAsync(params)
-	} else {
-		err = api.renter.Download(params)
+		var id modules.DownloadID
+		id, err = api.renter.DownloadAsync(params)
+		if err != nil {
+			WriteError(w, Error{"download failed: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		// The ID is returned in a header to keep the response body empty.
+		w.Header().Set("ID", string(id))
+		WriteSuccess(w)
+		return
 	}
+	err = api.renter.Download(params)
 	if err != nil {
 		WriteError(w, Error{"download failed: " + err.Error()}, http.StatusInternalServerError)
 		return
@@ -680,6 +975,100 @@ func (api *API) renterStreamHandler(w http.ResponseWriter, req *http.Request, ps
 	http.ServeContent(w, req, fileName, time.Time{}, streamer)
 }
 
+// renterUploadStreamHandler handles the API call to upload a file from the
+// request body.
+func (api *API) renterUploadStreamHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	// The request body contains the file, so the parameters have to be read
+	// from the query string.
+	queryForm := req.URL.Query()
+	ec, err := parseErasureCodingParameters(queryForm.Get("erasurecode"), queryForm.Get("datapieces"), queryForm.Get("paritypieces"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	cipherType, err := parseCipherType(queryForm.Get("ciphertype"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	dedup, err := scanBool(queryForm.Get("dedup"))
+	if err != nil {
+		WriteError(w, Error{"unable to parse dedup: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	// Call the renter to upload the file.
+	err = api.renter.UploadStreamFromReader(modules.FileUploadParams{
+		SiaPath:     strings.TrimPrefix(ps.ByName("siapath"), "/"),
+		ErasureCode: ec,
+		CipherType:  cipherType,
+		Dedup:       dedup,
+	}, req.Body)
+	if err != nil {
+		WriteError(w, Error{"upload failed: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// parseErasureCodingParameters parses the supplied string values and creates
+// an erasure coder. If the values are empty, a nil erasure coder is returned
+// and the renter will use its default parameters. If no code type is
+// supplied, Reed-Solomon is used.
+func parseErasureCodingParameters(strCodeType, strDataPieces, strParityPieces string) (modules.ErasureCoder, error) {
+	// Check whether the erasure coding parameters have been supplied.
+	if strCodeType == "" && strDataPieces == "" && strParityPieces == "" {
+		return nil, nil
+	}
+	if strCodeType == "" {
+		strCodeType = renter.CodeTypeReedSolomon
+	}
+	// Check that both values have been supplied.
+	if strDataPieces == "" || strParityPieces == "" {
+		return nil, errors.New("must provide both the datapieces parameter and the paritypieces parameter if specifying erasure coding parameters")
+	}
+
+	// Parse the erasure coding parameters.
+	var dataPieces, parityPieces int
+	_, err := fmt.Sscan(strDataPieces, &dataPieces)
+	if err != nil {
+		return nil, errors.New("unable to read parameter 'datapieces': " + err.Error())
+	}
+	_, err = fmt.Sscan(strParityPieces, &parityPieces)
+	if err != nil {
+		return nil, errors.New("unable to read parameter 'paritypieces': " + err.Error())
+	}
+
+	// Verify that sane values for parityPieces and redundancy are being
+	// supplied.
+	if parityPieces < requiredParityPieces {
+		return nil, fmt.Errorf("a minimum of %v parity pieces is required, but %v parity pieces requested", parityPieces, requiredParityPieces)
+	}
+	redundancy := float64(dataPieces+parityPieces) / float64(dataPieces)
+	if float64(dataPieces+parityPieces)/float64(dataPieces) < requiredRedundancy {
+		return nil, fmt.Errorf("a redundancy of %.2f is required, but redundancy of %.2f supplied", redundancy, requiredRedundancy)
+	}
+
+	// Create the erasure coder.
+	ec, err := renter.NewErasureCoder(strCodeType, dataPieces, parityPieces)
+	if err != nil {
+		return nil, errors.New("unable to encode file using the provided parameters: " + err.Error())
+	}
+	return ec, nil
+}
+
+// parseCipherType parses the supplied cipher type. If the value is empty, an
+// empty cipher type is returned and the renter will use its default cipher.
+func parseCipherType(strCipherType string) (crypto.CipherType, error) {
+	cipherType := crypto.CipherType(strCipherType)
+	switch cipherType {
+	case "", crypto.TypeTwofish, crypto.TypeXChaCha20:
+		return cipherType, nil
+	default:
+		return "", fmt.Errorf("unknown cipher type %q, must be %q or %q", strCipherType, crypto.TypeTwofish, crypto.TypeXChaCha20)
+	}
+}
+
 // renterUploadHandler handles the API call to upload a file.
 func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	source := req.FormValue("source")
@@ -688,53 +1077,36 @@ func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps
 		return
 	}
 
-	// Check whether the erasure coding parameters have been supplied.
-	var ec modules.ErasureCoder
-	if req.FormValue("datapieces") != "" || req.FormValue("paritypieces") != "" {
-		// Check that both values have been supplied.
-		if req.FormValue("datapieces") == "" || req.FormValue("paritypieces") == "" {
-			WriteError(w, Error{"must provide both the datapieces parameter and the paritypieces parameter if specifying erasure coding parameters"}, http.StatusBadRequest)
-			return
-		}
-
-		// Parse the erasure coding parameters.
-		var dataPieces, parityPieces int
-		_, err := fmt.Sscan(req.FormValue("datapieces"), &dataPieces)
-		if err != nil {
-			WriteError(w, Error{"unable to read parameter 'datapieces': " + err.Error()}, http.StatusBadRequest)
-			return
-		}
-		_, err = fmt.Sscan(req.FormValue("paritypieces"), &parityPieces)
-		if err != nil {
-			WriteError(w, Error{"unable to read parameter 'paritypieces': " + err.Error()}, http.StatusBadRequest)
-			return
-		}
-
-		// Verify that sane values for parityPieces and redundancy are being
-		// supplied.
-		if parityPieces < requiredParityPieces {
-			WriteError(w, Error{fmt.Sprintf("a minimum of %v parity pieces is required, but %v parity pieces requested", parityPieces, requiredParityPieces)}, http.StatusBadRequest)
-			return
-		}
-		redundancy := float64(dataPieces+parityPieces) / float64(dataPieces)
-		if float64(dataPieces+parityPieces)/float64(dataPieces) < requiredRedundancy {
-			WriteError(w, Error{fmt.Sprintf("a redundancy of %.2f is required, but redundancy of %.2f supplied", redundancy, requiredRedundancy)}, http.StatusBadRequest)
-			return
-		}
-
-		// Create the erasure coder.
-		ec, err = renter.NewRSCode(dataPieces, parityPieces)
-		if err != nil {
-			WriteError(w, Error{"unable to encode file using the provided parameters: " + err.Error()}, http.StatusBadRequest)
-			return
-		}
+	// Parse the erasure coding parameters.
+	ec, err := parseErasureCodingParameters(req.FormValue("erasurecode"), req.FormValue("datapieces"), req.FormValue("paritypieces"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	cipherType, err := parseCipherType(req.FormValue("ciphertype"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	pack, err := scanBool(req.FormValue("pack"))
+	if err != nil {
+		WriteError(w, Error{"unable to parse pack: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	dedup, err := scanBool(req.FormValue("dedup"))
+	if err != nil {
+		WriteError(w, Error{"unable to parse dedup: " + err.Error()}, http.StatusBadRequest)
+		return
 	}
 
 	// Call the renter to upload the file.
-	err := api.renter.Upload(modules.FileUploadParams{
+	err = api.renter.Upload(modules.FileUploadParams{
 		Source:      source,
 		SiaPath:     strings.TrimPrefix(ps.ByName("siapath"), "/"),
 		ErasureCode: ec,
+		CipherType:  cipherType,
+		Pack:        pack,
+		Dedup:       dedup,
 	})
 	if err != nil {
 		WriteError(w, Error{"upload failed: " + err.Error()}, http.StatusInternalServerError)
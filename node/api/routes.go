@@ -70,10 +70,22 @@ func (api *API) buildHTTPRoutes(requiredUserAgent string, requiredPassword strin
 		router.GET("/renter", api.renterHandlerGET)
 		router.POST("/renter", RequirePassword(api.renterHandlerPOST, requiredPassword))
 		router.GET("/renter/contracts", api.renterContractsHandler)
+		router.POST("/renter/contract/form", RequirePassword(api.renterContractFormHandler, requiredPassword))
+		router.POST("/renter/contract/renew/:id", RequirePassword(api.renterContractRenewHandler, requiredPassword))
+		router.POST("/renter/contract/cancel/:id", RequirePassword(api.renterContractCancelHandler, requiredPassword))
+		router.GET("/renter/recoveryscan", api.renterRecoveryScanHandlerGET)
+		router.POST("/renter/recoveryscan", RequirePassword(api.renterRecoveryScanHandlerPOST, requiredPassword))
+		router.GET("/renter/dir/*siapath", api.renterDirHandlerGET)
+		router.POST("/renter/dir/*siapath", RequirePassword(api.renterDirHandlerPOST, requiredPassword))
 		router.GET("/renter/downloads", api.renterDownloadsHandler)
 		router.POST("/renter/downloads/clear", RequirePassword(api.renterClearDownloadsHandler, requiredPassword))
+		router.POST("/renter/download/cancel", RequirePassword(api.renterDownloadCancelHandler, requiredPassword))
+		router.POST("/renter/download/pause", RequirePassword(api.renterDownloadPauseHandler, requiredPassword))
+		router.POST("/renter/download/resume", RequirePassword(api.renterDownloadResumeHandler, requiredPassword))
+		router.POST("/renter/download/priority", RequirePassword(api.renterDownloadPriorityHandler, requiredPassword))
 		router.GET("/renter/files", api.renterFilesHandler)
 		router.GET("/renter/file/*siapath", api.renterFileHandler)
+		router.POST("/renter/file/redundancy/*siapath", RequirePassword(api.renterFileRedundancyHandler, requiredPassword))
 		router.GET("/renter/prices", api.renterPricesHandler)
 
 		// TODO: re-enable these routes once the new .sia format has been
@@ -89,11 +101,16 @@ func (api *API) buildHTTPRoutes(requiredUserAgent string, requiredPassword strin
 		router.POST("/renter/rename/*siapath", RequirePassword(api.renterRenameHandler, requiredPassword))
 		router.GET("/renter/stream/*siapath", api.renterStreamHandler)
 		router.POST("/renter/upload/*siapath", RequirePassword(api.renterUploadHandler, requiredPassword))
+		router.POST("/renter/uploadstream/*siapath", RequirePassword(api.renterUploadStreamHandler, requiredPassword))
 
 		// HostDB endpoints.
 		router.GET("/hostdb", api.hostdbHandler)
 		router.GET("/hostdb/active", api.hostdbActiveHandler)
 		router.GET("/hostdb/all", api.hostdbAllHandler)
+		router.GET("/hostdb/filtermode", api.hostdbFilterModeHandlerGET)
+		router.POST("/hostdb/filtermode", RequirePassword(api.hostdbFilterModeHandlerPOST, requiredPassword))
+		router.GET("/hostdb/scoring", api.hostdbScoringHandlerGET)
+		router.POST("/hostdb/scoring", RequirePassword(api.hostdbScoringHandlerPOST, requiredPassword))
 		router.GET("/hostdb/hosts/:pubkey", api.hostdbHostsHandler)
 	}
 
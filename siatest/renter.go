@@ -1,10 +1,13 @@
 package siatest
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"net/url"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
@@ -165,14 +168,28 @@ func (tn *TestNode) FileInfo(rf *RemoteFile) (modules.FileInfo, error) {
 
 // Upload uses the node to upload the file.
 func (tn *TestNode) Upload(lf *LocalFile, dataPieces, parityPieces uint64) (*RemoteFile, error) {
+	return tn.UploadToPath(lf, lf.fileName(), dataPieces, parityPieces)
+}
+
+// UploadToPath uses the node to upload the file to the specified siapath.
+func (tn *TestNode) UploadToPath(lf *LocalFile, siaPath string, dataPieces, parityPieces uint64) (*RemoteFile, error) {
+	values := url.Values{}
+	values.Set("datapieces", strconv.FormatUint(dataPieces, 10))
+	values.Set("paritypieces", strconv.FormatUint(parityPieces, 10))
+	return tn.UploadWithValues(lf, siaPath, values)
+}
+
+// UploadWithValues uses the node to upload the file to the specified siapath,
+// using the provided parameters of the /renter/upload endpoint.
+func (tn *TestNode) UploadWithValues(lf *LocalFile, siaPath string, values url.Values) (*RemoteFile, error) {
 	// Upload file
-	err := tn.RenterUploadPost(lf.path, "/"+lf.fileName(), dataPieces, parityPieces)
+	err := tn.RenterUploadValuesPost(lf.path, "/"+siaPath, values)
 	if err != nil {
 		return nil, err
 	}
 	// Create remote file object
 	rf := &RemoteFile{
-		siaPath:  lf.fileName(),
+		siaPath:  siaPath,
 		checksum: lf.checksum,
 	}
 	// Make sure renter tracks file
@@ -183,6 +200,29 @@ func (tn *TestNode) Upload(lf *LocalFile, dataPieces, parityPieces uint64) (*Rem
 	return rf, nil
 }
 
+// UploadStreamBlocking uploads data to the specified siapath using the
+// /renter/uploadstream endpoint and waits for the upload to reach 100%
+// progress and redundancy.
+func (tn *TestNode) UploadStreamBlocking(data []byte, siaPath string, dataPieces, parityPieces uint64) (*RemoteFile, error) {
+	// Upload file
+	err := tn.RenterUploadStreamPost(bytes.NewReader(data), siaPath, dataPieces, parityPieces)
+	if err != nil {
+		return nil, err
+	}
+	// Create remote file object
+	rf := &RemoteFile{
+		siaPath:  siaPath,
+		checksum: crypto.HashBytes(data),
+	}
+	// Wait until upload reached the specified progress
+	if err = tn.WaitForUploadProgress(rf, 1); err != nil {
+		return nil, err
+	}
+	// Wait until upload reaches a certain redundancy
+	err = tn.WaitForUploadRedundancy(rf, float64((dataPieces+parityPieces))/float64(dataPieces))
+	return rf, err
+}
+
 // UploadNewFile initiates the upload of a filesize bytes large file.
 func (tn *TestNode) UploadNewFile(filesize int, dataPieces uint64, parityPieces uint64) (*LocalFile, *RemoteFile, error) {
 	// Create file for upload
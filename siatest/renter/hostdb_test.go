@@ -3,12 +3,15 @@ package renter
 import (
 	"fmt"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/node"
 	"gitlab.com/NebulousLabs/Sia/siatest"
+	"gitlab.com/NebulousLabs/Sia/types"
 )
 
 // TestInitialScanComplete tests if the initialScanComplete field is set
@@ -87,3 +90,182 @@ func TestInitialScanComplete(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestFilterMode tests that hosts which are excluded by the filter of the
+// hostdb are no longer active and that their contracts aren't renewed.
+func TestFilterMode(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	// Create a group for the test.
+	groupParams := siatest.GroupParams{
+		Hosts:   3,
+		Renters: 1,
+		Miners:  1,
+	}
+	tg, err := siatest.NewGroupFromTemplate(renterTestDir(t.Name()), groupParams)
+	if err != nil {
+		t.Fatal("Failed to create group: ", err)
+	}
+	defer func() {
+		if err := tg.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	renter := tg.Renters()[0]
+
+	// Blacklist the host of the first contract.
+	rc, err := renter.RenterContractsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Contracts) == 0 {
+		t.Fatal("renter doesn't have any contracts")
+	}
+	blacklisted := rc.Contracts[0].HostPublicKey
+	if err := renter.HostDbFilterModePost(modules.HostDBFilterBlacklist, []types.SiaPublicKey{blacklisted}); err != nil {
+		t.Fatal(err)
+	}
+	hdfmg, err := renter.HostDbFilterModeGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdfmg.FilterMode != "blacklist" || len(hdfmg.Hosts) != 1 || hdfmg.Hosts[0] != blacklisted.String() {
+		t.Fatal("filter mode wasn't set correctly:", hdfmg)
+	}
+
+	// The blacklisted host shouldn't be active anymore and its contract
+	// shouldn't be renewed.
+	hdag, err := renter.HostDbActiveGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range hdag.Hosts {
+		if host.PublicKeyString == blacklisted.String() {
+			t.Fatal("blacklisted host is still active")
+		}
+	}
+	checkUtility := func(filtered bool) error {
+		rc, err := renter.RenterContractsGet()
+		if err != nil {
+			return err
+		}
+		if len(rc.Contracts) != len(tg.Hosts()) {
+			return fmt.Errorf("expected %v contracts but got %v", len(tg.Hosts()), len(rc.Contracts))
+		}
+		for _, c := range rc.Contracts {
+			excluded := filtered && c.HostPublicKey.String() == blacklisted.String()
+			if c.GoodForRenew == excluded || c.GoodForUpload == excluded {
+				return fmt.Errorf("contract with host %v has wrong utility", c.HostPublicKey)
+			}
+		}
+		return nil
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		return checkUtility(true)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid filters should be rejected.
+	if err := renter.HostDbFilterModePost(modules.HostDBFilterWhitelist, nil); err == nil {
+		t.Fatal("setting an empty whitelist should fail")
+	}
+
+	// Disable the filter again, the contract should become usable again.
+	if err := renter.HostDbFilterModePost(modules.HostDBFilterNone, nil); err != nil {
+		t.Fatal(err)
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		return checkUtility(false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestScoringProfile tests that the scoring profile of the hostdb can be set
+// and that contracts with hosts that don't meet its cutoffs lose their
+// utility.
+func TestScoringProfile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	// Create a group for the test.
+	groupParams := siatest.GroupParams{
+		Hosts:   2,
+		Renters: 1,
+		Miners:  1,
+	}
+	tg, err := siatest.NewGroupFromTemplate(renterTestDir(t.Name()), groupParams)
+	if err != nil {
+		t.Fatal("Failed to create group: ", err)
+	}
+	defer func() {
+		if err := tg.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	renter := tg.Renters()[0]
+
+	// The renter should start out with the default profile.
+	hdsg, err := renter.HostDbScoringGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hdsg.ScoringProfile, modules.DefaultHostScoringProfile) {
+		t.Fatal("renter doesn't use the default scoring profile:", hdsg.ScoringProfile)
+	}
+
+	// Invalid profiles should be rejected.
+	if err := renter.HostDbScoringSettingPost("uptimeweight", "-1"); err == nil {
+		t.Fatal("setting a negative weight should fail")
+	}
+
+	// Cut off all hosts by setting the max storage price below their prices.
+	sp := modules.DefaultHostScoringProfile
+	sp.UptimeWeight = 3
+	sp.MaxStoragePrice = types.NewCurrency64(1)
+	if err := renter.HostDbScoringPost(sp); err != nil {
+		t.Fatal(err)
+	}
+	hdsg, err = renter.HostDbScoringGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hdsg.ScoringProfile, sp) {
+		t.Fatal("scoring profile wasn't set:", hdsg.ScoringProfile)
+	}
+	rc, err := renter.RenterContractsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Contracts) == 0 {
+		t.Fatal("renter doesn't have any contracts")
+	}
+	hhg, err := renter.HostDbHostsGet(rc.Contracts[0].HostPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hhg.ScoreBreakdown.CutoffReason == "" {
+		t.Fatal("host should not meet the cutoffs of the profile")
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		rc, err := renter.RenterContractsGet()
+		if err != nil {
+			return err
+		}
+		for _, c := range rc.Contracts {
+			if c.GoodForUpload || c.GoodForRenew {
+				return fmt.Errorf("contract with host %v should have no utility", c.HostPublicKey)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
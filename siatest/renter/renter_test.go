@@ -1,10 +1,12 @@
 package renter
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"math"
 	"math/big"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -58,13 +60,21 @@ func TestRenter(t *testing.T) {
 		test func(*testing.T, *siatest.TestGroup)
 	}{
 		{"TestClearDownloadHistory", testClearDownloadHistory},
+		{"TestDedupUploads", testDedupUploads},
+		{"TestDirectories", testDirectories},
 		{"TestDownloadAfterRenew", testDownloadAfterRenew},
+		{"TestDownloadControl", testDownloadControl},
 		{"TestDownloadMultipleLargeSectors", testDownloadMultipleLargeSectors},
 		{"TestLocalRepair", testLocalRepair},
+		{"TestPackedUploads", testPackedUploads},
 		{"TestRemoteRepair", testRemoteRepair},
+		{"TestSetFileRedundancy", testSetFileRedundancy},
 		{"TestSingleFileGet", testSingleFileGet},
 		{"TestStreamingCache", testStreamingCache},
 		{"TestUploadDownload", testUploadDownload},
+		{"TestUploadDownloadCipher", testUploadDownloadCipher},
+		{"TestUploadDownloadErasureCodes", testUploadDownloadErasureCodes},
+		{"TestUploadStreaming", testUploadStreaming},
 	}
 	// Run subtests
 	for _, subtest := range subTests {
@@ -225,6 +235,78 @@ func testClearDownloadHistory(t *testing.T, tg *siatest.TestGroup) {
 	}
 }
 
+// testDirectories tests creating, listing, renaming and deleting directories
+// through the API.
+func testDirectories(t *testing.T, tg *siatest.TestGroup) {
+	// Grab the first of the group's renters
+	renter := tg.Renters()[0]
+
+	// Create a directory and upload a file into one of its subdirectories.
+	if err := renter.RenterDirCreatePost("dirtest"); err != nil {
+		t.Fatal(err)
+	}
+	lf, err := renter.NewFile(100 + siatest.Fuzz())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataPieces := uint64(1)
+	parityPieces := uint64(len(tg.Hosts())) - dataPieces
+	if _, err := renter.UploadToPath(lf, "dirtest/sub/file", dataPieces, parityPieces); err != nil {
+		t.Fatal(err)
+	}
+
+	// The root directory should contain the new directory.
+	rd, err := renter.RenterDirGet("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, dir := range rd.Directories[1:] {
+		found = found || dir.SiaPath == "dirtest"
+	}
+	if !found {
+		t.Fatal("root directory doesn't list the new directory:", rd.Directories)
+	}
+
+	// Check the contents of the new directory. The metadata of the
+	// subdirectory is updated in the background.
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		rd, err = renter.RenterDirGet("dirtest")
+		if err != nil {
+			return err
+		}
+		if len(rd.Directories) != 2 || rd.Directories[1].SiaPath != "dirtest/sub" || len(rd.Files) != 0 {
+			return fmt.Errorf("unexpected directory contents: %v", rd)
+		}
+		if rd.Directories[0].AggregateNumFiles != 1 || rd.Directories[1].NumFiles != 1 {
+			return fmt.Errorf("unexpected directory metadata: %v", rd.Directories)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rename the directory. The file should be renamed as well.
+	if err := renter.RenterDirRenamePost("dirtest", "dirtest2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := renter.File("dirtest2/sub/file"); err != nil {
+		t.Fatal("file wasn't renamed:", err)
+	}
+	if _, err := renter.RenterDirGet("dirtest"); err == nil {
+		t.Fatal("old directory should be gone")
+	}
+
+	// Delete the directory.
+	if err := renter.RenterDirDeletePost("dirtest2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := renter.File("dirtest2/sub/file"); err == nil {
+		t.Fatal("file should have been deleted together with the directory")
+	}
+}
+
 // testDownloadAfterRenew makes sure that we can still download a file
 // after the contract period has ended.
 func testDownloadAfterRenew(t *testing.T, tg *siatest.TestGroup) {
@@ -254,6 +336,71 @@ func testDownloadAfterRenew(t *testing.T, tg *siatest.TestGroup) {
 	}
 }
 
+// testDownloadControl tests that async downloads can be identified by their ID
+// and that downloads can only be controlled while they are in progress.
+func testDownloadControl(t *testing.T, tg *siatest.TestGroup) {
+	// Grab the first of the group's renters
+	r := tg.Renters()[0]
+	_, remoteFile, err := r.UploadNewFileBlocking(100+siatest.Fuzz(), 1, 1)
+	if err != nil {
+		t.Fatal("Failed to upload a file for testing: ", err)
+	}
+
+	// Start an async download and wait for it to complete. The destination
+	// contains characters that need to be escaped in the query.
+	dest := filepath.Join(siatest.SiaTestingDir, "download #1 & "+strconv.Itoa(fastrand.Intn(math.MaxInt32)))
+	id, err := r.RenterDownloadAsyncGet(remoteFile.SiaPath(), dest, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == "" {
+		t.Fatal("download ID should not be empty")
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		rdg, err := r.RenterDownloadsGet()
+		if err != nil {
+			return err
+		}
+		for _, d := range rdg.Downloads {
+			if d.ID != id {
+				continue
+			}
+			if !d.Completed {
+				return errors.New("download hasn't completed yet")
+			}
+			if d.Error != "" {
+				return errors.New(d.Error)
+			}
+			return nil
+		}
+		return errors.New("download not found in history")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dest); err != nil {
+		t.Fatal("download wasn't written to its destination:", err)
+	}
+
+	// A completed download can't be paused, resumed or cancelled.
+	if err := r.RenterDownloadPausePost(id); err == nil {
+		t.Fatal("pausing a completed download should fail")
+	}
+	if err := r.RenterDownloadResumePost(id); err == nil {
+		t.Fatal("resuming a completed download should fail")
+	}
+	if err := r.RenterDownloadCancelPost(id); err == nil {
+		t.Fatal("cancelling a completed download should fail")
+	}
+	if err := r.RenterDownloadPriorityPost(id, 10); err == nil {
+		t.Fatal("changing the priority of a completed download should fail")
+	}
+	// Unknown downloads can't be controlled either.
+	if err := r.RenterDownloadCancelPost(modules.DownloadID("foo")); err == nil {
+		t.Fatal("cancelling an unknown download should fail")
+	}
+}
+
 // testDownloadMultipleLargeSectors downloads multiple large files (>5 Sectors)
 // in parallel and makes sure that the downloads are blocking each other.
 func testDownloadMultipleLargeSectors(t *testing.T, tg *siatest.TestGroup) {
@@ -396,6 +543,13 @@ func testRemoteRepair(t *testing.T, tg *siatest.TestGroup) {
 	if err := localFile.Delete(); err != nil {
 		t.Fatal("failed to delete local file", err)
 	}
+	deletedInfo, err := r.FileInfo(remoteFile)
+	if err != nil {
+		t.Fatal("failed to get file info", err)
+	}
+	if deletedInfo.OnDisk || !deletedInfo.Recoverable {
+		t.Fatalf("file should be recoverable but not on disk: %v %v", deletedInfo.OnDisk, deletedInfo.Recoverable)
+	}
 
 	// Take down all of the parity hosts and check if redundancy decreases.
 	for i := uint64(0); i < parityPieces; i++ {
@@ -427,6 +581,45 @@ func testRemoteRepair(t *testing.T, tg *siatest.TestGroup) {
 	}
 }
 
+// testUploadStreaming uploads random data using the /renter/uploadstream
+// endpoint and downloads it again.
+func testUploadStreaming(t *testing.T, tg *siatest.TestGroup) {
+	// Grab the first of the group's renters
+	r := tg.Renters()[0]
+
+	// Upload some data that doesn't fill the last chunk and some data that
+	// fills exactly one chunk.
+	dataPieces := uint64(1)
+	parityPieces := uint64(len(tg.Hosts())) - dataPieces
+	chunkSize := int(siatest.ChunkSize(dataPieces))
+	for i, size := range []int{2*chunkSize + 100 + siatest.Fuzz(), chunkSize} {
+		data := fastrand.Bytes(size)
+		siaPath := fmt.Sprintf("stream%d", i)
+		rf, err := r.UploadStreamBlocking(data, siaPath, dataPieces, parityPieces)
+		if err != nil {
+			t.Fatal("failed to upload stream", err)
+		}
+		fi, err := r.FileInfo(rf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Filesize != uint64(size) {
+			t.Fatalf("expected filesize %v, got %v", size, fi.Filesize)
+		}
+		if fi.LocalPath != "" {
+			t.Fatal("streamed file shouldn't have a local path", fi.LocalPath)
+		}
+		if _, err := r.DownloadByStream(rf); err != nil {
+			t.Fatal("failed to download streamed file", err)
+		}
+	}
+
+	// Uploading to the same siapath again should fail.
+	if err := r.RenterUploadStreamPost(bytes.NewReader(fastrand.Bytes(10)), "stream0", dataPieces, parityPieces); err == nil {
+		t.Fatal("expected upload to existing siapath to fail")
+	}
+}
+
 // testSingleFileGet is a subtest that uses an existing TestGroup to test if
 // using the single file API endpoint works
 func testSingleFileGet(t *testing.T, tg *siatest.TestGroup) {
@@ -436,11 +629,23 @@ func testSingleFileGet(t *testing.T, tg *siatest.TestGroup) {
 	dataPieces := uint64(1)
 	parityPieces := uint64(len(tg.Hosts())) - dataPieces
 	fileSize := 100 + siatest.Fuzz()
-	_, _, err := renter.UploadNewFileBlocking(fileSize, dataPieces, parityPieces)
+	_, rf, err := renter.UploadNewFileBlocking(fileSize, dataPieces, parityPieces)
 	if err != nil {
 		t.Fatal("Failed to upload a file for testing: ", err)
 	}
 
+	// The fully uploaded file should be healthy.
+	rfg, err := renter.RenterFileGet(rf.SiaPath())
+	if err != nil {
+		t.Fatal("Failed to request single file", err)
+	}
+	if rfg.File.Health != 0 || rfg.File.NumStuckChunks != 0 {
+		t.Fatalf("expected healthy file, got health %v with %v stuck chunks", rfg.File.Health, rfg.File.NumStuckChunks)
+	}
+	if len(rfg.Chunks) != 1 || rfg.Chunks[0].Health != 0 || rfg.Chunks[0].Stuck {
+		t.Fatal("expected a single healthy chunk, got", rfg.Chunks)
+	}
+
 	files, err := renter.Files()
 	if err != nil {
 		t.Fatal("Failed to get renter files: ", err)
@@ -592,6 +797,273 @@ func testUploadDownload(t *testing.T, tg *siatest.TestGroup) {
 	}
 }
 
+// testUploadDownloadCipher tests that a file encrypted with XChaCha20 can be
+// uploaded and downloaded.
+func testUploadDownloadCipher(t *testing.T, tg *siatest.TestGroup) {
+	// Grab the first of the group's renters
+	renter := tg.Renters()[0]
+	// Upload a file that spans multiple chunks.
+	dataPieces := uint64(1)
+	parityPieces := uint64(len(tg.Hosts())) - dataPieces
+	localFile, err := renter.NewFile(int(2*(modules.SectorSize-crypto.XChaCha20Overhead)) + siatest.Fuzz())
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := url.Values{}
+	values.Set("datapieces", strconv.FormatUint(dataPieces, 10))
+	values.Set("paritypieces", strconv.FormatUint(parityPieces, 10))
+	values.Set("ciphertype", string(crypto.TypeXChaCha20))
+	remoteFile, err := renter.UploadWithValues(localFile, "cipher", values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := renter.WaitForUploadProgress(remoteFile, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := renter.WaitForUploadRedundancy(remoteFile, float64(dataPieces+parityPieces)/float64(dataPieces)); err != nil {
+		t.Fatal(err)
+	}
+	// Download the file and compare it to the original.
+	if _, err := renter.DownloadByStream(remoteFile); err != nil {
+		t.Fatal(err)
+	}
+	// Uploading with an unknown cipher should fail.
+	values.Set("ciphertype", "foo")
+	if _, err := renter.UploadWithValues(localFile, "unknowncipher", values); err == nil {
+		t.Fatal("expected upload with unknown cipher to fail")
+	}
+}
+
+// testUploadDownloadErasureCodes tests that files can be uploaded and
+// downloaded using the alternative erasure codes.
+func testUploadDownloadErasureCodes(t *testing.T, tg *siatest.TestGroup) {
+	numHosts := uint64(len(tg.Hosts()))
+	tests := []struct {
+		codeType     string
+		dataPieces   uint64
+		parityPieces uint64
+	}{
+		{renter.CodeTypeReplication, 1, numHosts - 1},
+		{renter.CodeTypeReedSolomonSystematic, 2, numHosts - 2},
+	}
+	// Grab the first of the group's renters
+	renter := tg.Renters()[0]
+	for i, test := range tests {
+		// Upload a file that spans multiple chunks.
+		fileSize := int(3*siatest.ChunkSize(test.dataPieces)/2) + siatest.Fuzz()
+		localFile, err := renter.NewFile(fileSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := url.Values{}
+		values.Set("erasurecode", test.codeType)
+		values.Set("datapieces", strconv.FormatUint(test.dataPieces, 10))
+		values.Set("paritypieces", strconv.FormatUint(test.parityPieces, 10))
+		remoteFile, err := renter.UploadWithValues(localFile, fmt.Sprintf("erasurecode%v", i), values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := renter.WaitForUploadProgress(remoteFile, 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := renter.WaitForUploadRedundancy(remoteFile, float64(test.dataPieces+test.parityPieces)/float64(test.dataPieces)); err != nil {
+			t.Fatal(err)
+		}
+		// Download the whole file, and stream parts of it.
+		if _, err := renter.DownloadByStream(remoteFile); err != nil {
+			t.Fatal(test.codeType, err)
+		}
+		if _, err := renter.Stream(remoteFile); err != nil {
+			t.Fatal(test.codeType, err)
+		}
+		for i := 0; i < 5; i++ {
+			from := fastrand.Intn(fileSize - 1)
+			to := from + 1 + fastrand.Intn(fileSize-from-1)
+			if _, err := renter.StreamPartial(remoteFile, localFile, uint64(from), uint64(to)); err != nil {
+				t.Fatal(test.codeType, err)
+			}
+		}
+	}
+}
+
+// testDedupUploads tests that identical files uploaded with deduplication
+// share their pieces, and that the pieces are kept as long as one of the
+// files still references them.
+func testDedupUploads(t *testing.T, tg *siatest.TestGroup) {
+	// Grab the first of the group's renters
+	r := tg.Renters()[0]
+
+	// contractSize returns the total size of the renter's active contracts.
+	contractSize := func() uint64 {
+		rc, err := r.RenterContractsGet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var size uint64
+		for _, c := range rc.ActiveContracts {
+			size += c.Size
+		}
+		return size
+	}
+
+	// Upload a file with deduplication.
+	numHosts := float64(len(tg.Hosts()))
+	localFile, err := r.NewFile(int(2*siatest.ChunkSize(1)) + siatest.Fuzz())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dedup := url.Values{"dedup": {"true"}}
+	remoteFile1, err := r.UploadWithValues(localFile, "dedup1", dedup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WaitForUploadRedundancy(remoteFile1, numHosts); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload the same data to another siapath. The pieces of the first file
+	// should be reused instead of being uploaded again.
+	size := contractSize()
+	remoteFile2, err := r.UploadWithValues(localFile, "dedup2", dedup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WaitForUploadRedundancy(remoteFile2, numHosts); err != nil {
+		t.Fatal(err)
+	}
+	if newSize := contractSize(); newSize > size {
+		t.Fatalf("deduplicated file was uploaded again: contracts grew from %v to %v bytes", size, newSize)
+	}
+
+	// Delete the local file and the first file. The second file should still
+	// be downloadable, since it references the shared pieces.
+	if err := localFile.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RenterDeletePost(remoteFile1.SiaPath()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.DownloadByStream(remoteFile2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testPackedUploads tests that small files can be packed into a shared chunk
+// and downloaded individually afterwards.
+func testPackedUploads(t *testing.T, tg *siatest.TestGroup) {
+	// Grab the first of the group's renters
+	r := tg.Renters()[0]
+
+	// Upload a few small files in packing mode.
+	var localFiles []*siatest.LocalFile
+	var remoteFiles []*siatest.RemoteFile
+	for i := 0; i < 3; i++ {
+		localFile, err := r.NewFile(100*(i+1) + siatest.Fuzz())
+		if err != nil {
+			t.Fatal(err)
+		}
+		remoteFile, err := r.UploadWithValues(localFile, fmt.Sprintf("packed%v", i), url.Values{"pack": {"true"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		localFiles = append(localFiles, localFile)
+		remoteFiles = append(remoteFiles, remoteFile)
+	}
+
+	// The files can be downloaded while the pack is still buffered.
+	if _, err := r.DownloadByStream(remoteFiles[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The files should be uploaded once the pack is sealed. Every host stores
+	// a single piece of the shared chunk.
+	numHosts := float64(len(tg.Hosts()))
+	for _, remoteFile := range remoteFiles {
+		if err := r.WaitForUploadRedundancy(remoteFile, numHosts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Delete the local files, so that the files have to be downloaded from
+	// the shared chunk.
+	for _, localFile := range localFiles {
+		if err := localFile.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, remoteFile := range remoteFiles {
+		if _, err := r.DownloadByStream(remoteFile); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Stream(remoteFile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Deleting one of the files shouldn't affect the others.
+	if err := r.RenterDeletePost(remoteFiles[0].SiaPath()); err != nil {
+		t.Fatal(err)
+	}
+	for _, remoteFile := range remoteFiles[1:] {
+		if _, err := r.DownloadByStream(remoteFile); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testSetFileRedundancy tests that the redundancy of an uploaded file can be
+// changed, and that the file can be downloaded afterwards.
+func testSetFileRedundancy(t *testing.T, tg *siatest.TestGroup) {
+	// Grab the first of the group's renters
+	r := tg.Renters()[0]
+
+	// Upload a file using replication.
+	numHosts := uint64(len(tg.Hosts()))
+	fileSize := int(3*siatest.ChunkSize(2)/2) + siatest.Fuzz()
+	localFile, err := r.NewFile(fileSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := url.Values{}
+	values.Set("erasurecode", renter.CodeTypeReplication)
+	values.Set("datapieces", "1")
+	values.Set("paritypieces", strconv.FormatUint(numHosts-1, 10))
+	remoteFile, err := r.UploadWithValues(localFile, "redundancy", values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WaitForUploadRedundancy(remoteFile, float64(numHosts)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete the local file, so that the file has to be re-encoded by
+	// downloading it.
+	if err := localFile.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Switch to Reed-Solomon with 2 data pieces. The redundancy of the file
+	// should drop once the file has been re-encoded.
+	err = r.RenterFileRedundancyPost(remoteFile.SiaPath(), renter.CodeTypeReedSolomon, 2, numHosts-2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WaitForDecreasingRedundancy(remoteFile, float64(numHosts)/2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.DownloadByStream(remoteFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Stream(remoteFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the redundancy of an unknown file should fail.
+	if err := r.RenterFileRedundancyPost("unknown", renter.CodeTypeReedSolomon, 2, 1); err == nil {
+		t.Fatal("expected changing the redundancy of an unknown file to fail")
+	}
+}
+
 // TestRenterInterrupt executes a number of subtests using the same TestGroup to
 // save time on initialization
 func TestRenterInterrupt(t *testing.T) {
@@ -1209,6 +1681,118 @@ func TestRenterCancelAllowance(t *testing.T) {
 	}
 }
 
+// TestRenterManualContracts tests forming, renewing and canceling contracts
+// through the API.
+func TestRenterManualContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a group for testing.
+	groupParams := siatest.GroupParams{
+		Hosts:   2,
+		Renters: 1,
+		Miners:  1,
+	}
+	tg, err := siatest.NewGroupFromTemplate(renterTestDir(t.Name()), groupParams)
+	if err != nil {
+		t.Fatal("Failed to create group: ", err)
+	}
+	defer func() {
+		if err := tg.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	renter := tg.Renters()[0]
+	rc, err := renter.RenterContractsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.ActiveContracts) != groupParams.Hosts {
+		t.Fatalf("expected %v active contracts, got %v", groupParams.Hosts, len(rc.ActiveContracts))
+	}
+
+	// Forming a second contract with a host should fail.
+	canceled := rc.ActiveContracts[0]
+	if _, err := renter.RenterContractFormPost(canceled.HostPublicKey, types.ZeroCurrency, 0); err == nil {
+		t.Fatal("expected an error when forming a second contract with a host")
+	}
+
+	// Cancel a contract. It should become inactive right away.
+	if err := renter.RenterContractCancelPost(canceled.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := renter.RenterContractCancelPost(canceled.ID); err == nil {
+		t.Fatal("expected an error when canceling a contract twice")
+	}
+	rc, err = renter.RenterInactiveContractsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.ActiveContracts) != groupParams.Hosts-1 {
+		t.Fatalf("expected %v active contracts, got %v", groupParams.Hosts-1, len(rc.ActiveContracts))
+	}
+	if len(rc.InactiveContracts) != 1 || rc.InactiveContracts[0].ID != canceled.ID {
+		t.Fatal("canceled contract should be inactive:", rc.InactiveContracts)
+	}
+	if rc.InactiveContracts[0].GoodForUpload || rc.InactiveContracts[0].GoodForRenew {
+		t.Fatal("canceled contract should be neither goodForUpload nor goodForRenew")
+	}
+
+	// Contract maintenance shouldn't form a new contract with the host.
+	for i := 0; i < 2; i++ {
+		if err := tg.Miners()[0].MineBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(time.Second)
+	rc, err = renter.RenterContractsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range rc.Contracts {
+		if reflect.DeepEqual(c.HostPublicKey, canceled.HostPublicKey) {
+			t.Fatal("maintenance formed a contract with the host of a canceled contract")
+		}
+	}
+
+	// Form a contract with the host manually.
+	formed, err := renter.RenterContractFormPost(canceled.HostPublicKey, types.ZeroCurrency, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(formed.Contract.HostPublicKey, canceled.HostPublicKey) {
+		t.Fatal("contract was formed with the wrong host")
+	}
+	if !formed.Contract.GoodForUpload || !formed.Contract.GoodForRenew {
+		t.Fatal("manually formed contract should be goodForUpload and goodForRenew")
+	}
+
+	// Renew the contract right away.
+	renewed, err := renter.RenterContractRenewPost(formed.Contract.ID, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed.Contract.ID == formed.Contract.ID {
+		t.Fatal("renewed contract should have a new id")
+	}
+	rc, err = renter.RenterInactiveContractsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.ActiveContracts) != groupParams.Hosts {
+		t.Fatalf("expected %v active contracts, got %v", groupParams.Hosts, len(rc.ActiveContracts))
+	}
+	var found bool
+	for _, c := range rc.InactiveContracts {
+		found = found || c.ID == formed.Contract.ID
+	}
+	if !found {
+		t.Fatal("renewed contract should be inactive")
+	}
+}
+
 // TestRenterContractEndHeight makes sure that the endheight of renewed
 // contracts is set properly
 func TestRenterContractEndHeight(t *testing.T) {
@@ -2663,3 +3247,106 @@ LOOP:
 	}
 	return startingUploadSpend, nil
 }
+
+// TestRenterRecoverContracts tests that a renter that lost its contracts can
+// recover them using the wallet seed.
+func TestRenterRecoverContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a group for testing.
+	groupParams := siatest.GroupParams{
+		Hosts:   2,
+		Renters: 1,
+		Miners:  1,
+	}
+	tg, err := siatest.NewGroupFromTemplate(renterTestDir(t.Name()), groupParams)
+	if err != nil {
+		t.Fatal("Failed to create group: ", err)
+	}
+	defer func() {
+		if err := tg.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Upload a file to store some data in the contracts.
+	renter := tg.Renters()[0]
+	if _, _, err := renter.UploadNewFileBlocking(int(modules.SectorSize), 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := renter.RenterContractsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contracts := make(map[types.FileContractID]api.RenterContract)
+	for _, c := range rc.ActiveContracts {
+		contracts[c.ID] = c
+	}
+	if len(contracts) != groupParams.Hosts {
+		t.Fatalf("expected %v active contracts, got %v", groupParams.Hosts, len(contracts))
+	}
+
+	// Mine a block to make sure that all contract transactions are confirmed.
+	if err := tg.Miners()[0].MineBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tg.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stop the renter and delete its renter directory, which contains the
+	// contracts and the allowance.
+	if err := tg.StopNode(renter); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(renter.Dir, modules.RenterDir)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tg.StartNode(renter); err != nil {
+		t.Fatal(err)
+	}
+	rc, err = renter.RenterContractsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.ActiveContracts) != 0 {
+		t.Fatal("renter shouldn't have any contracts after losing its directory")
+	}
+
+	// Recover the contracts.
+	if err := renter.RenterInitRecoveryScanPost(); err != nil {
+		t.Fatal(err)
+	}
+	err = build.Retry(60, time.Second, func() error {
+		rsg, err := renter.RenterRecoveryStatusGet()
+		if err != nil {
+			return err
+		}
+		if rsg.ScanInProgress {
+			return errors.New("recovery scan still in progress")
+		}
+		rc, err = renter.RenterContractsGet()
+		if err != nil {
+			return err
+		}
+		if len(rc.ActiveContracts) != len(contracts) {
+			return fmt.Errorf("expected %v active contracts, got %v", len(contracts), len(rc.ActiveContracts))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range rc.ActiveContracts {
+		old, exists := contracts[c.ID]
+		if !exists {
+			t.Fatal("unknown contract was recovered:", c.ID)
+		}
+		if c.Size != old.Size || c.HostPublicKey.String() != old.HostPublicKey.String() {
+			t.Fatalf("recovered contract doesn't match: %v %v", c.Size, old.Size)
+		}
+	}
+}